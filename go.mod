@@ -0,0 +1,5 @@
+module github.com/hyperbricks/plugins
+
+go 1.23.4
+
+require github.com/Masterminds/semver/v3 v3.3.0
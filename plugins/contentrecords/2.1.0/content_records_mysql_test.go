@@ -0,0 +1,46 @@
+//go:build mysql
+
+package main
+
+import (
+	"os"
+	"testing"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// TestMySQLStore runs against a real server, e.g. a test container:
+//
+//	docker run -d -p 3306:3306 -e MYSQL_ROOT_PASSWORD=test -e MYSQL_DATABASE=cr mysql:8
+//	CONTENT_RECORDS_MYSQL_DSN='root:test@tcp(127.0.0.1:3306)/cr' go test -tags mysql -run TestMySQLStore
+func TestMySQLStore(t *testing.T) {
+	dsn := os.Getenv("CONTENT_RECORDS_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("CONTENT_RECORDS_MYSQL_DSN not set")
+	}
+
+	db, err := openStore(Fields{Driver: "mysql", Store: dsn})
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	for _, table := range requiredTables {
+		var name string
+		if err := db.QueryRow(mysqlDialect.TableExists, table).Scan(&name); err != nil {
+			t.Fatalf("table %s: %v", table, err)
+		}
+	}
+
+	opts := writeOptions{Actor: "test", MergeUpdate: true}
+	id, err := createRecord(db, "mysql_test", map[string]string{"title": "a"}, opts)
+	if err != nil {
+		t.Fatalf("createRecord: %v", err)
+	}
+	defer func() { _ = deleteRecord(db, id, "mysql_test", opts) }()
+	if _, err := updateRecord(db, id, "mysql_test", map[string]string{"title": "b"}, opts); err != nil {
+		t.Fatalf("updateRecord: %v", err)
+	}
+	values, err := fetchRecordFields(db, id)
+	if err != nil || values["title"] != "b" {
+		t.Fatalf("fetchRecordFields = %v, %v", values, err)
+	}
+}
@@ -3,60 +3,192 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/subtle"
 	"database/sql"
+	"encoding/csv"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"expvar"
 	"fmt"
+	"hash/fnv"
 	"html"
 	"io"
+	"math"
+	"mime"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
+	"github.com/hyperbricks/hyperbricks/pkg/logging"
 	"github.com/hyperbricks/hyperbricks/pkg/shared"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
+	xhtml "golang.org/x/net/html"
+	"golang.org/x/text/encoding/htmlindex"
 )
 
 // FieldDef defines a single editable field mapping.
 type FieldDef struct {
-	Type  string `mapstructure:"type"`
-	Bind  string `mapstructure:"bind"`
-	Path  string `mapstructure:"path"`
-	Label string `mapstructure:"label"`
-	Order int    `mapstructure:"order"`
+	Type      string `mapstructure:"type"`
+	Bind      string `mapstructure:"bind"`
+	Path      string `mapstructure:"path"`
+	Attribute string `mapstructure:"attribute"` // key inside the attribute map at path
+	Label     string `mapstructure:"label"`
+	Order     int    `mapstructure:"order"`
+	Expr      string `mapstructure:"expr"` // type computed: "{{first}} {{last}}"
+	Raw       *bool  `mapstructure:"raw"`  // value is HTML; default true for markdown/richtext/html
+	// InlineEditable = false keeps inline mode from wrapping or updating the
+	// field; fields are inline-editable by default.
+	InlineEditable *bool `mapstructure:"inline_editable"`
+	// Default is bound and shown in the edit form for records that have no
+	// stored value for the field; a stored empty string is kept.
+	Default string `mapstructure:"default"`
+	// AltBind and CaptionBind (image fields) name the stored fields holding
+	// the image's alt text and caption; the edit form shows an input for each
+	// next to the file input.
+	AltBind     string `mapstructure:"alt_bind"`
+	CaptionBind string `mapstructure:"caption_bind"`
+	// Separator splits a list field's stored value into items (default ",");
+	// Join joins the items for a bind without a * segment (default ", ").
+	Separator string  `mapstructure:"separator"`
+	Join      *string `mapstructure:"join"`
 }
 
 // Fields defines the plugin field schema.
 type Fields struct {
-	Template    interface{}         `mapstructure:"template"`
-	Type        interface{}         `mapstructure:"type"`   // legacy alias
-	View        string              `mapstructure:"view"`   // list|single
-	Action      string              `mapstructure:"action"` // render|edit
-	Mode        string              `mapstructure:"mode"`   // legacy alias
-	Store       string              `mapstructure:"store"`
-	Schema      map[string]FieldDef `mapstructure:"schema"` // CMS form schema
-	Fields      map[string]FieldDef `mapstructure:"fields"` // legacy alias
-	Query       string              `mapstructure:"query"`  // SQL or query string
-	SQL         string              `mapstructure:"sql"`    // legacy alias
-	ID          interface{}         `mapstructure:"id"`
-	IDs         []interface{}       `mapstructure:"ids"`
-	Teaser      bool                `mapstructure:"teaser"`
-	Inline      bool                `mapstructure:"inline"`
-	InlineParam string              `mapstructure:"inline_param"`
-	Preview     *bool               `mapstructure:"preview"`
-	Seed        bool                `mapstructure:"seed"`
-	Editable    bool                `mapstructure:"editable"`
-	EditRoute   string              `mapstructure:"edit_route"`
-	ListRoute   string              `mapstructure:"list_route"`
-	Route       string              `mapstructure:"route"` // legacy alias
-	RecordParam string              `mapstructure:"record_param"`
-	UploadDir   string              `mapstructure:"upload_dir"`
-	Upload      string              `mapstructure:"upload"`
+	Template           interface{}         `mapstructure:"template"`
+	Type               interface{}         `mapstructure:"type"`   // legacy alias
+	View               string              `mapstructure:"view"`   // list|single|history|debug
+	Action             string              `mapstructure:"action"` // render|edit|new|preview|health|validate|restore_version|export|feed|maintenance|migrate_field
+	Mode               string              `mapstructure:"mode"`   // legacy alias
+	Store              string              `mapstructure:"store"`  // sqlite path or driver DSN
+	Driver             string              `mapstructure:"driver"` // sqlite3 (default) | mysql
+	Schema             map[string]FieldDef `mapstructure:"schema"` // CMS form schema
+	Fields             map[string]FieldDef `mapstructure:"fields"` // legacy alias
+	Query              string              `mapstructure:"query"`  // SQL or query string
+	SQL                string              `mapstructure:"sql"`    // legacy alias
+	ID                 interface{}         `mapstructure:"id"`
+	IDs                []interface{}       `mapstructure:"ids"`
+	Teaser             bool                `mapstructure:"teaser"`
+	Inline             bool                `mapstructure:"inline"`
+	InlineParam        string              `mapstructure:"inline_param"`
+	InlineWrapper      string              `mapstructure:"inline_wrapper"`       // markup for nodes with an enclose
+	InlineBlockWrapper string              `mapstructure:"inline_block_wrapper"` // markup for nodes without one
+	Preview            *bool               `mapstructure:"preview"`
+	Seed               bool                `mapstructure:"seed"`
+	SeedCount          int                 `mapstructure:"seed_count"` // records inserted by seed (default 1)
+	Editable           bool                `mapstructure:"editable"`
+	EditRoute          string              `mapstructure:"edit_route"`
+	ListRoute          string              `mapstructure:"list_route"`
+	Route              string              `mapstructure:"route"` // legacy alias
+	RecordParam        string              `mapstructure:"record_param"`
+	PathParamIndex     *int                `mapstructure:"path_param_index"` // URL path segment holding the record id; negative counts from the end
+	UploadDir          string              `mapstructure:"upload_dir"`
+	Upload             string              `mapstructure:"upload"`
+	ActorHeader        string              `mapstructure:"actor_header"`
+	MaxRetries         *int                `mapstructure:"max_retries"`
+	RetryDelay         string              `mapstructure:"retry_delay"`
+	Debug              bool                `mapstructure:"debug"`
+	LoadMore           bool                `mapstructure:"load_more"`
+	PageSize           int                 `mapstructure:"page_size"`
+	HTTPCaching        bool                `mapstructure:"http_caching"`
+	CleanupFiles       bool                `mapstructure:"cleanup_files"`
+	CreateMissingPaths bool                `mapstructure:"create_missing_paths"` // create missing maps on bind paths
+	Filterable         []string            `mapstructure:"filterable"`           // binds list views may filter on via request params
+	KeyStart           *int                `mapstructure:"key_start"`            // first generated <TREE> key (default 10)
+	ParentID           interface{}         `mapstructure:"parent_id"`            // set by an enclosing ContentRecords render
+	ParentType         string              `mapstructure:"parent_type"`          // set by an enclosing ContentRecords render
+	ParentBind         string              `mapstructure:"parent_bind"`          // bind holding the parent record id
+	KeyStep            int                 `mapstructure:"key_step"`             // step between generated keys (default 10)
+	MaxVersions        int                 `mapstructure:"max_versions"`         // field snapshots kept per record (0 = off)
+	CORSOrigins        interface{}         `mapstructure:"cors_origins"`         // "*", "https://a.example, https://b.example" or a list
+	MergeUpdate        bool                `mapstructure:"merge_update"`         // keep stored fields missing from the form
+	NaturalKey         string              `mapstructure:"natural_key"`          // bind that identifies a record on create
+	RateLimit          string              `mapstructure:"rate_limit"`           // inline writes per client, e.g. "30/1m"
+	EmptyHTML          string              `mapstructure:"empty_html"`           // render views: markup when nothing matches
+	ErrorHTML          string              `mapstructure:"error_html"`           // render views: markup when rendering fails
+	Pragmas            map[string]string   `mapstructure:"pragmas"`              // SQLite tuning, e.g. cache_size, synchronous
+	Storage            string              `mapstructure:"storage"`              // fields (default) | columns
+	ItemTemplates      interface{}         `mapstructure:"item_templates"`       // list render: template per item_template_bind value
+	ItemTemplateBind   string              `mapstructure:"item_template_bind"`   // bind selecting an item template (default layout)
+	NewParam           string              `mapstructure:"new_param"`            // request param asking the edit view for a create form (default new)
+	NewValue           string              `mapstructure:"new_value"`            // value the New button sends in new_param (default 1)
+	ActionParam        string              `mapstructure:"action_param"`         // form key of the CMS/edit action (default action)
+	RecordIDParam      string              `mapstructure:"record_id_param"`      // form key of the posted record id (default record_id)
+	IDStrategy         string              `mapstructure:"id_strategy"`          // autoincrement (default) | uuid | ulid
+	ExportFormat       string              `mapstructure:"export_format"`        // action export: json (default) | csv
+	Sanitize           bool                `mapstructure:"sanitize"`             // render views: filter raw HTML fields through the allowlist
+	AllowTags          []string            `mapstructure:"allow_tags"`           // sanitize allowlist; empty keeps the UGC default
+	AllowAttrs         []string            `mapstructure:"allow_attrs"`          // "attr" or "tag.attr"
+	AllowSchemes       []string            `mapstructure:"allow_schemes"`        // URL schemes kept in href/src
+	TableFormat        string              `mapstructure:"table_format"`         // view table: html (default) | json
+	TableClass         string              `mapstructure:"table_class"`          // view table: class of the <table>
+	MaxRecords         int                 `mapstructure:"max_records"`          // creates evict the oldest records beyond this count (0 = off)
+	Feed               FeedConfig          `mapstructure:"feed"`                 // action feed: channel metadata and item binds
+	TouchOnChangeOnly  bool                `mapstructure:"touch_on_change_only"` // saves without changed values skip the write and keep updated_at
+	MaintenanceToken   string              `mapstructure:"maintenance_token"`    // action maintenance: bearer token required to run it
+	CheckpointWAL      bool                `mapstructure:"checkpoint_wal"`       // action maintenance: checkpoint and truncate the WAL first
+	Metrics            bool                `mapstructure:"metrics"`              // count operations in the expvar map "contentrecords"
+	ReadOnly           bool                `mapstructure:"read_only"`            // reject every write; render/list/preview keep working
+	Where              WhereConditions     `mapstructure:"where"`                // structured filter compiled to a parameterized query (instead of query)
+	OrderBy            string              `mapstructure:"order_by"`             // "bind [asc|desc], ..."; also id, created_at, updated_at
+	Limit              int                 `mapstructure:"limit"`                // records selected by where/order_by (0 = all)
+	ListColumns        []string            `mapstructure:"list_columns"`         // CMS table columns in order: "bind" or "bind: Label"
+	Placeholder        bool                `mapstructure:"placeholder_template"` // list render: one card from template defaults while the type has no records
+	SerializeWrites    bool                `mapstructure:"serialize_writes"`     // one write at a time per store within this process
+	UploadCharset      string              `mapstructure:"upload_charset"`       // charset of text-field uploads that declare none; "auto" guesses
+	ValidateOnly       bool                `mapstructure:"validate_only"`        // check the config and report errors; no store access, no output
+	DirMode            string              `mapstructure:"dir_mode"`             // octal permissions for created store/upload directories (default 0755)
+	FileMode           string              `mapstructure:"file_mode"`            // octal permissions for uploaded files (default 0644)
+	NotFoundHTML       string              `mapstructure:"not_found_html"`       // single views: markup when the requested record does not exist
+	QueryTimeout       string              `mapstructure:"query_timeout"`        // time budget for data.query / where (e.g. 2s or ms); empty: no limit
+	UploadURLPrefix    string              `mapstructure:"upload_url_prefix"`    // web path of upload_dir (e.g. /static/uploads); stored instead of the disk path
+	TemplateName       string              `mapstructure:"template_name"`        // publish the inline template to the store under this name for data.template references
+	Output             string              `mapstructure:"output"`               // list renders: tree (default, <TREE> keyed 10, 20, ...) | array (ordered slice)
+	Redirect           *bool               `mapstructure:"redirect"`             // after a CMS save: true always redirects, false re-renders in place; unset skips it for AJAX
+	RedirectStatus     int                 `mapstructure:"redirect_status"`      // status of that redirect: 301, 302, 303 (default), 307 or 308
+	SoftDelete         bool                `mapstructure:"soft_delete"`          // delete moves records to the trash (records.deleted_at); the CMS list can show and restore them
+
+	// showDeleted is set per request by the CMS list's show_deleted=1 toggle.
+	showDeleted bool
+}
+
+// FeedConfig maps binds to feed elements for action = feed (data.feed).
+type FeedConfig struct {
+	Format          string `mapstructure:"format"`           // rss (default) | atom
+	Title           string `mapstructure:"title"`            // channel title (required)
+	Link            string `mapstructure:"link"`             // channel link and Atom id (required)
+	Description     string `mapstructure:"description"`      // channel description / Atom subtitle
+	Author          string `mapstructure:"author"`           // Atom author name (default title)
+	Limit           int    `mapstructure:"limit"`            // items in the feed (default 20)
+	ItemTitle       string `mapstructure:"item_title"`       // bind for the item title (default title)
+	ItemLink        string `mapstructure:"item_link"`        // bind for the item link, resolved against link
+	ItemDescription string `mapstructure:"item_description"` // bind for the item description / summary
+	ItemPubDate     string `mapstructure:"item_pubdate"`     // bind for the item date
+	DateFormat      string `mapstructure:"date_format"`      // Go layout of item_pubdate values (default typed date layouts)
+}
+
+// WhereConditions is data.where: conditions keyed like a Hyperbricks tree
+// (10, 20, ...). All of them must match.
+type WhereConditions map[string]WhereCondition
+
+// WhereCondition is one data.where entry.
+type WhereCondition struct {
+	Bind  string      `mapstructure:"bind"`
+	Op    string      `mapstructure:"op"`    // eq (default) | contains | gt | gte | lt | lte | in
+	Value interface{} `mapstructure:"value"` // in: a list or a comma-separated string
 }
 
 // ContentRecordsConfig is the component config for this plugin.
@@ -83,13 +215,63 @@ func (p *ContentRecordsPlugin) Render(instance interface{}, ctx context.Context)
 			Path:     config.HyperBricksPath,
 			Key:      config.HyperBricksKey,
 			Rejected: true,
-			Err:      fmt.Sprintf("Decode error: %v", err),
+			Err:      fmt.Sprintf("Decode error: %s", describeDecodeError(err)),
 		})
 		return "<!-- content_records_plugin decode failed -->", errors
 	}
 
+	if config.Fields.ValidateOnly {
+		return "", validateConfig(config.Fields)
+	}
+
+	if config.Fields.Metrics {
+		metrics.enable()
+	}
+	metrics.add("renders", 1)
+	defer func() {
+		metrics.add("errors", int64(len(errors)))
+		if config.Fields.Debug {
+			metrics.logSnapshot()
+		}
+	}()
+
+	if applyCORS(ctx, config.Fields) {
+		return "", errors
+	}
+
+	fields, err := bindNamedTemplate(config.Fields, ctx)
+	if err != nil {
+		errors = append(errors, err)
+	}
+	config.Fields = fields
+
 	view, action := resolveViewAction(config.Fields)
+	logDebug(config.Fields, "resolved view/action", "view", view, "action", action, "path", config.HyperBricksPath)
 	switch {
+	case view == "debug":
+		return renderBindDebug(config.Fields, ctx, &errors), errors
+	case view == "table":
+		return renderTable(config.Fields, ctx, &errors), errors
+	case action == "health":
+		return renderHealth(config.Fields, ctx, &errors), errors
+	case action == "maintenance":
+		return renderMaintenance(config.Fields, ctx, &errors), errors
+	case action == "migrate_field":
+		return renderMigrateField(config.Fields, ctx, &errors), errors
+	case action == "validate":
+		return renderValidate(config.Fields, ctx, &errors), errors
+	case action == "export":
+		return renderExport(config.Fields, ctx, &errors), errors
+	case action == "feed":
+		return renderFeed(config.Fields, ctx, &errors), errors
+	case action == "new":
+		return renderSingleNew(config.Fields, ctx, &errors), errors
+	case action == "preview":
+		return renderPreview(config.Fields, ctx, &errors), errors
+	case action == "restore_version":
+		return renderRestoreVersion(config.Fields, ctx, &errors), errors
+	case view == "history":
+		return renderHistory(config.Fields, ctx, &errors), errors
 	case view == "list" && action == "edit":
 		return renderListEdit(config.Fields, ctx, &errors), errors
 	case view == "single" && action == "edit":
@@ -110,11 +292,44 @@ func Plugin() (shared.PluginRenderer, error) {
 
 type bindTarget struct {
 	Path string
+	// Attribute, when set, makes Path point at an attribute map and the value
+	// is written to this key instead of replacing the node at Path.
+	Attribute string
+	// CreateMissing creates missing intermediate maps when the value is
+	// written (data.create_missing_paths).
+	CreateMissing bool
+	// Type is the schema type of the bound field; boolean and number values
+	// are written as Go bools and numbers instead of strings.
+	Type string
+	// Separator and Join split and rejoin list field values.
+	Separator string
+	Join      string
+	// Owner is the path of the boundary plugin node that declared the @bind;
+	// the bind may write into that node's own config.
+	Owner string
+	// Blocked marks a bind whose path enters another boundary plugin's
+	// subtree. It is not applied, so the nested config stays intact.
+	Blocked bool
+}
+
+// defaultAttributePath is used when an @bind sets attribute without a path.
+const defaultAttributePath = "attributes"
+
+// lookupPath identifies the bind target, e.g. "20.attributes.href".
+func (t bindTarget) lookupPath() string {
+	if t.Attribute == "" {
+		return t.Path
+	}
+	return t.Path + "." + t.Attribute
 }
 
 type record struct {
 	ID     int64
+	UID    string // set for records created with id_strategy uuid or ulid
 	Fields map[string]string
+	// Deleted marks a trashed record; only the CMS list with show_deleted=1
+	// fetches them.
+	Deleted bool
 }
 
 type cmsField struct {
@@ -124,13 +339,29 @@ type cmsField struct {
 	Bind  string
 	Path  string
 	Order int
+	// AltBind and CaptionBind are the image field's companion keys.
+	AltBind     string
+	CaptionBind string
+	// Separator and Join are set for list fields.
+	Separator string
+	Join      string
 }
 
 type inlineOptions struct {
-	Enabled   bool
-	BindTypes map[string]string
+	Enabled      bool
+	BindTypes    map[string]string
+	Locked       map[string]struct{} // binds with inline_editable = false
+	Wrapper      string
+	BlockWrapper string
 }
 
+// Default inline wrappers. Placeholders are replaced with HTML-escaped values;
+// | marks where the node's content goes.
+const (
+	defaultInlineWrapper      = `<span class="cr-inline" data-cr-bind="{{bind}}" data-cr-id="{{id}}" data-cr-type="{{type}}" data-cr-value="{{value}}">|</span>`
+	defaultInlineBlockWrapper = `<div class="cr-inline cr-inline--block" data-cr-bind="{{bind}}" data-cr-id="{{id}}" data-cr-type="{{type}}" data-cr-value="{{value}}">|</div>`
+)
+
 var (
 	dbMu     sync.Mutex
 	dbByPath = map[string]*dbEntry{}
@@ -138,8 +369,494 @@ var (
 
 type dbEntry struct {
 	db      *sql.DB
+	dialect *storeDialect
+	pragmas []string // data.pragmas the store was initialized with
 	once    sync.Once
 	initErr error
+
+	layoutMu sync.Mutex
+	layouts  map[string]*columnLayout // content type → table, for data.storage = columns
+}
+
+// storeDialect holds the SQL that differs between database backends. Both
+// backends use ? placeholders and support LastInsertId.
+type storeDialect struct {
+	Driver      string   // database/sql driver name
+	Schema      []string // CREATE statements run once per store
+	UpsertField string   // insert-or-update for one record_fields row
+	TableExists string   // returns a row when table ? exists
+	// ColumnExists returns a row when table ? has column ?.
+	ColumnExists string
+	// Columns are added with ALTER TABLE when an existing store lacks them.
+	Columns []columnMigration
+	// Indexes run after Columns, for indexes on migrated columns.
+	Indexes []string
+	// UpsertTemplate publishes a named_templates row (name, template JSON).
+	UpsertTemplate string
+
+	// IdentQuote wraps table and column names built from config.
+	IdentQuote string
+	// ColumnTable creates a data.storage = columns table (%s: quoted name);
+	// its field columns are added with ensureColumn.
+	ColumnTable  string
+	TextColumn   string // column type for text binds
+	NumberColumn string // column type for number binds
+	// UpsertColumns completes an INSERT into a columns table (%s: the
+	// ColumnAssign list) so an existing row is updated instead.
+	UpsertColumns string
+	ColumnAssign  string
+}
+
+// identPattern is what table and column names built from config may contain.
+var identPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// quoteIdent validates a table or column name and wraps it in the dialect's
+// quote character. Every identifier interpolated into SQL goes through it:
+// names come from bind keys and template names in config, so anything
+// outside letters, digits and _ is rejected rather than escaped.
+func (d *storeDialect) quoteIdent(name string) (string, error) {
+	if !identPattern.MatchString(name) {
+		return "", fmt.Errorf("invalid identifier %q: only letters, digits and _ are allowed", name)
+	}
+	return d.IdentQuote + name + d.IdentQuote, nil
+}
+
+// columnMigration is a column added after a table was first released.
+type columnMigration struct {
+	Table      string
+	Column     string
+	Definition string
+}
+
+var sqliteDialect = &storeDialect{
+	Driver: "sqlite3",
+	Schema: []string{
+		`CREATE TABLE IF NOT EXISTS records (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			type TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			created_by TEXT,
+			updated_by TEXT
+		)`,
+		`CREATE TABLE IF NOT EXISTS record_fields (
+			record_id INTEGER,
+			bind_key TEXT,
+			value TEXT,
+			num_value REAL,
+			date_value DATETIME,
+			PRIMARY KEY(record_id, bind_key)
+		)`,
+		`CREATE TABLE IF NOT EXISTS record_field_versions (
+			record_id INTEGER,
+			version INTEGER,
+			bind_key TEXT,
+			value TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			created_by TEXT,
+			PRIMARY KEY(record_id, version, bind_key)
+		)`,
+		`CREATE TABLE IF NOT EXISTS named_templates (
+			name TEXT PRIMARY KEY,
+			template TEXT,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_records_type ON records(type)`,
+		`CREATE INDEX IF NOT EXISTS idx_record_fields_record_id ON record_fields(record_id)`,
+	},
+	UpsertField: `INSERT INTO record_fields(record_id, bind_key, value, num_value, date_value) VALUES(?, ?, ?, ?, ?)
+			ON CONFLICT(record_id, bind_key) DO UPDATE SET
+			value = excluded.value, num_value = excluded.num_value, date_value = excluded.date_value`,
+	UpsertTemplate: `INSERT INTO named_templates(name, template) VALUES(?, ?)
+			ON CONFLICT(name) DO UPDATE SET template = excluded.template, updated_at = CURRENT_TIMESTAMP`,
+	TableExists:  `SELECT name FROM sqlite_master WHERE type = 'table' AND name = ?`,
+	ColumnExists: `SELECT name FROM pragma_table_info(?) WHERE name = ?`,
+	// Stores created before actor tracking and typed columns lack these.
+	Columns: []columnMigration{
+		{"records", "created_by", "TEXT"},
+		{"records", "updated_by", "TEXT"},
+		{"record_fields", "num_value", "REAL"},
+		{"record_fields", "date_value", "DATETIME"},
+		{"records", "uid", "TEXT"},
+		{"records", "deleted_at", "DATETIME"},
+	},
+	Indexes: []string{
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_records_uid ON records(uid)`,
+	},
+	IdentQuote:    `"`,
+	ColumnTable:   `CREATE TABLE IF NOT EXISTS %s (record_id INTEGER PRIMARY KEY)`,
+	TextColumn:    "TEXT",
+	NumberColumn:  "REAL",
+	UpsertColumns: ` ON CONFLICT(record_id) DO UPDATE SET %s`,
+	ColumnAssign:  `%[1]s = excluded.%[1]s`,
+}
+
+// mysqlDialect targets MySQL 5.7+ and MariaDB 10.2+. Indexed text columns
+// are VARCHAR(191) so keys fit utf8mb4 index limits; CREATE INDEX has no
+// IF NOT EXISTS in MySQL, so indexes are declared inline.
+var mysqlDialect = &storeDialect{
+	Driver: "mysql",
+	Schema: []string{
+		`CREATE TABLE IF NOT EXISTS records (
+			id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+			type VARCHAR(191),
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			created_by VARCHAR(191),
+			updated_by VARCHAR(191),
+			INDEX idx_records_type (type)
+		) DEFAULT CHARSET = utf8mb4`,
+		`CREATE TABLE IF NOT EXISTS record_fields (
+			record_id BIGINT NOT NULL,
+			bind_key VARCHAR(191) NOT NULL,
+			value LONGTEXT,
+			num_value DOUBLE,
+			date_value DATETIME,
+			PRIMARY KEY(record_id, bind_key)
+		) DEFAULT CHARSET = utf8mb4`,
+		`CREATE TABLE IF NOT EXISTS record_field_versions (
+			record_id BIGINT NOT NULL,
+			version INT NOT NULL,
+			bind_key VARCHAR(191) NOT NULL,
+			value LONGTEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			created_by VARCHAR(191),
+			PRIMARY KEY(record_id, version, bind_key)
+		) DEFAULT CHARSET = utf8mb4`,
+		`CREATE TABLE IF NOT EXISTS named_templates (
+			name VARCHAR(191) NOT NULL PRIMARY KEY,
+			template LONGTEXT,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		) DEFAULT CHARSET = utf8mb4`,
+	},
+	UpsertField: `INSERT INTO record_fields(record_id, bind_key, value, num_value, date_value) VALUES(?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE
+			value = VALUES(value), num_value = VALUES(num_value), date_value = VALUES(date_value)`,
+	UpsertTemplate: `INSERT INTO named_templates(name, template) VALUES(?, ?)
+			ON DUPLICATE KEY UPDATE template = VALUES(template), updated_at = CURRENT_TIMESTAMP`,
+	TableExists:  `SELECT table_name FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?`,
+	ColumnExists: `SELECT column_name FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?`,
+	// MySQL stores created before typed columns lack these.
+	Columns: []columnMigration{
+		{"record_fields", "num_value", "DOUBLE"},
+		{"record_fields", "date_value", "DATETIME"},
+		// No CREATE INDEX IF NOT EXISTS: the index is added with the column.
+		{"records", "uid", "VARCHAR(64), ADD UNIQUE INDEX idx_records_uid (uid)"},
+		{"records", "deleted_at", "DATETIME"},
+	},
+	IdentQuote:    "`",
+	ColumnTable:   `CREATE TABLE IF NOT EXISTS %s (record_id BIGINT NOT NULL PRIMARY KEY) DEFAULT CHARSET = utf8mb4`,
+	TextColumn:    "LONGTEXT",
+	NumberColumn:  "DOUBLE",
+	UpsertColumns: ` ON DUPLICATE KEY UPDATE %s`,
+	ColumnAssign:  `%[1]s = VALUES(%[1]s)`,
+}
+
+// resolveDialect maps data.driver to a dialect. SQLite is the default.
+func resolveDialect(driver string) (*storeDialect, error) {
+	switch strings.ToLower(strings.TrimSpace(driver)) {
+	case "", "sqlite", "sqlite3":
+		return sqliteDialect, nil
+	case "mysql", "mariadb":
+		return mysqlDialect, nil
+	default:
+		return nil, fmt.Errorf("content_records_plugin: unsupported driver %q", driver)
+	}
+}
+
+// dialectOf returns the dialect a store was opened with.
+func dialectOf(db *sql.DB) *storeDialect {
+	if entry := entryOf(db); entry != nil {
+		return entry.dialect
+	}
+	return sqliteDialect
+}
+
+// entryOf returns the shared entry for an open store handle.
+func entryOf(db *sql.DB) *dbEntry {
+	dbMu.Lock()
+	defer dbMu.Unlock()
+	for _, entry := range dbByPath {
+		if entry.db == db {
+			return entry
+		}
+	}
+	return nil
+}
+
+// storeLabel is data.store for logs and CMS output; DSN credentials are masked.
+func storeLabel(fields Fields) string {
+	store := strings.TrimSpace(fields.Store)
+	if i := strings.LastIndex(store, "@"); i >= 0 {
+		return "***" + store[i:]
+	}
+	return store
+}
+
+// logDebug writes a structured log line through the shared Hyperbricks logger
+// when data.debug is enabled.
+func logDebug(fields Fields, msg string, keysAndValues ...interface{}) {
+	if !fields.Debug {
+		return
+	}
+	logging.GetLogger().Infow("ContentRecords: "+msg, keysAndValues...)
+}
+
+// metrics counts renders, store reads and writes, HTTP cache hits/misses and
+// errors under the expvar name "contentrecords" (data.metrics).
+var metrics = newPluginMetrics("contentrecords")
+
+// metricsLogInterval is the minimum time between two counter snapshots in
+// the debug log.
+const metricsLogInterval = time.Minute
+
+// pluginMetrics counts plugin operations in an expvar map, served on
+// /debug/vars when the host mounts expvar's handler. Counting starts once a
+// config sets data.metrics; until then add returns after one atomic load.
+type pluginMetrics struct {
+	name    string
+	enabled atomic.Bool
+	once    sync.Once
+	vars    *expvar.Map
+	lastLog atomic.Int64 // unix nanoseconds of the last debug snapshot
+}
+
+func newPluginMetrics(name string) *pluginMetrics {
+	return &pluginMetrics{name: name}
+}
+
+// enable publishes the expvar map on first use. A map of the same name that
+// is already published, e.g. by another version of the plugin, is shared.
+func (m *pluginMetrics) enable() {
+	m.once.Do(func() {
+		m.vars = publishMap(m.name)
+		m.enabled.Store(true)
+	})
+}
+
+// publishMap returns the expvar map published as name, publishing one if
+// there is none. expvar.NewMap panics when name is taken: by another plugin
+// copy publishing between the Get and the NewMap, whose map is then shared,
+// or by a var that is not a map, in which case the counters stay unpublished.
+func publishMap(name string) (vars *expvar.Map) {
+	if existing, ok := expvar.Get(name).(*expvar.Map); ok {
+		return existing
+	}
+	defer func() {
+		if recover() == nil {
+			return
+		}
+		if existing, ok := expvar.Get(name).(*expvar.Map); ok {
+			vars = existing
+		} else {
+			vars = new(expvar.Map)
+		}
+	}()
+	return expvar.NewMap(name)
+}
+
+// add increments counter by delta while metrics are enabled.
+func (m *pluginMetrics) add(counter string, delta int64) {
+	if delta == 0 || !m.enabled.Load() {
+		return
+	}
+	m.vars.Add(counter, delta)
+}
+
+// value returns counter, or 0 while metrics are disabled.
+func (m *pluginMetrics) value(counter string) int64 {
+	if !m.enabled.Load() {
+		return 0
+	}
+	if v, ok := m.vars.Get(counter).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+// logSnapshot writes every counter to the shared logger, at most once per
+// metricsLogInterval.
+func (m *pluginMetrics) logSnapshot() {
+	if !m.enabled.Load() {
+		return
+	}
+	now := time.Now().UnixNano()
+	last := m.lastLog.Load()
+	if now-last < int64(metricsLogInterval) || !m.lastLog.CompareAndSwap(last, now) {
+		return
+	}
+	var keysAndValues []interface{}
+	m.vars.Do(func(kv expvar.KeyValue) {
+		keysAndValues = append(keysAndValues, kv.Key, kv.Value.String())
+	})
+	logging.GetLogger().Infow(m.name+" metrics", keysAndValues...)
+}
+
+// corsMethods are the methods the plugin's endpoints accept.
+const corsMethods = "GET, HEAD, POST, OPTIONS"
+
+// decodeErrorPatterns rewrite mapstructure's type mismatch messages into
+// "<field>: expected <type>, got <type>" so the offending data.* key is clear.
+var decodeErrorPatterns = []struct {
+	re     *regexp.Regexp
+	format func(m []string) string
+}{
+	{regexp.MustCompile(`^'([^']*)' expected type '([^']*)', got unconvertible type '([^']*)', value: '(.*)'$`), func(m []string) string {
+		return fmt.Sprintf("%s: expected %s, got %s %q", m[1], friendlyType(m[2]), friendlyType(m[3]), m[4])
+	}},
+	{regexp.MustCompile(`^'([^']*)' expected type '([^']*)', got '([^']*)'$`), func(m []string) string {
+		return fmt.Sprintf("%s: expected %s, got %s", m[1], friendlyType(m[2]), friendlyType(m[3]))
+	}},
+	{regexp.MustCompile(`^'([^']*)':? source data must be an array or slice, got (\S+)$`), func(m []string) string {
+		return fmt.Sprintf("%s: expected a list, got %s", m[1], friendlyType(m[2]))
+	}},
+	{regexp.MustCompile(`^'([^']*)' expected a map, got '([^']*)'$`), func(m []string) string {
+		return fmt.Sprintf("%s: expected a map, got %s", m[1], friendlyType(m[2]))
+	}},
+	{regexp.MustCompile(`^cannot parse '([^']*)' as (\w+): (.*)$`), func(m []string) string {
+		return fmt.Sprintf("%s: expected %s (%s)", m[1], friendlyType(m[2]), m[3])
+	}},
+}
+
+// describeDecodeError lists every field-level failure in the errors
+// shared.DecodeWithBasicHooks returned, rewritten by decodeErrorPatterns
+// where the message is recognised.
+func describeDecodeError(errs []error) string {
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, decodeMessages(err)...)
+	}
+	for i, msg := range messages {
+		for _, pattern := range decodeErrorPatterns {
+			if m := pattern.re.FindStringSubmatch(msg); m != nil {
+				messages[i] = pattern.format(m)
+				break
+			}
+		}
+	}
+	return strings.Join(messages, "; ")
+}
+
+// decodeMessages splits one decode error into its field-level messages. The
+// host keeps only the text of a *mapstructure.Error in its ComponentError
+// ("N error(s) decoding:\n\n* msg\n* msg"), so that form is split as well.
+func decodeMessages(err error) []string {
+	var messages []string
+	switch wrapped := err.(type) {
+	case interface{ WrappedErrors() []error }: // *mapstructure.Error
+		for _, e := range wrapped.WrappedErrors() {
+			messages = append(messages, decodeMessages(e)...)
+		}
+		return messages
+	case interface{ Unwrap() []error }:
+		for _, e := range wrapped.Unwrap() {
+			messages = append(messages, decodeMessages(e)...)
+		}
+		return messages
+	}
+	text := err.Error()
+	_, list, ok := strings.Cut(text, "decoding:\n\n")
+	if !ok {
+		return []string{text}
+	}
+	for _, line := range strings.Split(list, "\n") {
+		if line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "* ")); line != "" {
+			messages = append(messages, line)
+		}
+	}
+	return messages
+}
+
+// friendlyType names Go kinds the way config authors think of them.
+func friendlyType(goType string) string {
+	goType = strings.TrimPrefix(goType, "*")
+	switch {
+	case strings.HasPrefix(goType, "[]"), goType == "slice", goType == "array":
+		return "list"
+	case strings.HasPrefix(goType, "map"):
+		return "map"
+	case strings.HasPrefix(goType, "int"), strings.HasPrefix(goType, "uint"):
+		return "integer"
+	case strings.HasPrefix(goType, "float"):
+		return "number"
+	}
+	return goType
+}
+
+// resolveCORSOrigins accepts a comma separated string or a list.
+func resolveCORSOrigins(value interface{}) []string {
+	var raw []string
+	switch v := value.(type) {
+	case string:
+		raw = strings.Split(v, ",")
+	case []string:
+		raw = v
+	case []interface{}:
+		for _, item := range v {
+			raw = append(raw, fmt.Sprint(item))
+		}
+	}
+	origins := make([]string, 0, len(raw))
+	for _, origin := range raw {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// applyCORS sets CORS headers when data.cors_origins allows the request's
+// Origin and reports whether the request was an OPTIONS preflight, which is
+// answered with 204 and no body. Without cors_origins no headers are set.
+func applyCORS(ctx context.Context, fields Fields) bool {
+	origins := resolveCORSOrigins(fields.CORSOrigins)
+	if len(origins) == 0 || ctx == nil {
+		return false
+	}
+	req, _ := ctx.Value(shared.Request).(*http.Request)
+	writer, _ := ctx.Value(shared.ResponseWriter).(http.ResponseWriter)
+	if req == nil || writer == nil {
+		return false
+	}
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+
+	allowed := ""
+	for _, candidate := range origins {
+		if candidate == "*" {
+			allowed = "*"
+			break
+		}
+		if strings.EqualFold(candidate, origin) {
+			allowed = origin
+			break
+		}
+	}
+	if allowed == "" {
+		return false
+	}
+
+	header := writer.Header()
+	header.Set("Access-Control-Allow-Origin", allowed)
+	if allowed != "*" {
+		header.Add("Vary", "Origin")
+	}
+	header.Set("Access-Control-Allow-Methods", corsMethods)
+	allowHeaders := "Content-Type, If-None-Match, If-Modified-Since"
+	if actorHeader := strings.TrimSpace(fields.ActorHeader); actorHeader != "" {
+		allowHeaders += ", " + actorHeader
+	}
+	header.Set("Access-Control-Allow-Headers", allowHeaders)
+	header.Set("Access-Control-Expose-Headers", "ETag, Last-Modified, Retry-After, X-CR-Total, X-CR-Next-Offset, X-CR-Has-More")
+
+	if req.Method != http.MethodOptions {
+		return false
+	}
+	header.Set("Access-Control-Max-Age", "600")
+	writer.WriteHeader(http.StatusNoContent)
+	return true
 }
 
 func resolveViewAction(fields Fields) (string, string) {
@@ -161,8 +878,14 @@ func resolveViewAction(fields Fields) (string, string) {
 		}
 	}
 
+	if action == "create" {
+		action = "new"
+	}
 	if view == "" {
 		view = "list"
+		if action == "new" {
+			view = "single"
+		}
 	}
 	if action == "" {
 		action = "render"
@@ -171,7 +894,17 @@ func resolveViewAction(fields Fields) (string, string) {
 	return view, action
 }
 
+// resolveTemplateValue returns the template: data.template as an inline map,
+// or, when data.template is a name bindNamedTemplate found no template for,
+// the inline data.type map.
 func resolveTemplateValue(fields Fields) interface{} {
+	if _, ok := fields.Template.(string); ok {
+		return fields.Type
+	}
+	return inlineTemplateValue(fields)
+}
+
+func inlineTemplateValue(fields Fields) interface{} {
 	if fields.Template != nil {
 		return fields.Template
 	}
@@ -181,6 +914,122 @@ func resolveTemplateValue(fields Fields) interface{} {
 	return nil
 }
 
+// Named templates live in the named_templates table of the store that
+// publishes them, so a reference resolves against the store it renders
+// from: it survives restarts, and sites with separate stores never see each
+// other's names.
+
+// publishedTemplates is the JSON last written per store handle and name, so
+// an unchanged template is not rewritten on every render.
+var publishedTemplates = struct {
+	sync.Mutex
+	byStore map[*sql.DB]map[string]string
+}{byStore: map[*sql.DB]map[string]string{}}
+
+// bindNamedTemplate publishes the inline template under data.template_name
+// and replaces a data.template name with the template stored under it. When
+// the store cannot be opened the fields are returned unchanged; the render
+// reports the store error itself.
+func bindNamedTemplate(fields Fields, ctx context.Context) (Fields, error) {
+	ref, isRef := fields.Template.(string)
+	publish := !isRef && strings.TrimSpace(fields.TemplateName) != ""
+	if !isRef && !publish {
+		return fields, nil
+	}
+	db, err := openStoreWith(fields, memoFor(ctx))
+	if err != nil {
+		return fields, nil
+	}
+	dialect, err := resolveDialect(fields.Driver)
+	if err != nil {
+		return fields, nil
+	}
+	if publish {
+		if err := publishNamedTemplate(db, dialect, fields); err != nil {
+			return fields, fmt.Errorf("content_records_plugin: data.template_name: %w", err)
+		}
+	}
+	if isRef {
+		template, found, err := lookupNamedTemplate(db, ref)
+		if err != nil {
+			return fields, fmt.Errorf("content_records_plugin: data.template %q: %w", strings.TrimSpace(ref), err)
+		}
+		if found {
+			fields.Template = template
+		}
+	}
+	return fields, nil
+}
+
+// publishNamedTemplate stores the instance's inline template under
+// data.template_name, replacing the one stored before.
+func publishNamedTemplate(db *sql.DB, dialect *storeDialect, fields Fields) error {
+	name := strings.TrimSpace(fields.TemplateName)
+	template, ok := normalizeToStringMap(inlineTemplateValue(fields))
+	if !ok {
+		return nil
+	}
+	encoded, err := json.Marshal(jsonValue(template))
+	if err != nil {
+		return err
+	}
+
+	publishedTemplates.Lock()
+	defer publishedTemplates.Unlock()
+	published := publishedTemplates.byStore[db]
+	if published[name] == string(encoded) {
+		return nil
+	}
+	if _, err := db.Exec(dialect.UpsertTemplate, name, string(encoded)); err != nil {
+		return err
+	}
+	if published == nil {
+		published = map[string]string{}
+		publishedTemplates.byStore[db] = published
+	}
+	published[name] = string(encoded)
+	return nil
+}
+
+func lookupNamedTemplate(db *sql.DB, name string) (map[string]interface{}, bool, error) {
+	var encoded string
+	err := db.QueryRow(`SELECT template FROM named_templates WHERE name = ?`, strings.TrimSpace(name)).Scan(&encoded)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var template map[string]interface{}
+	if err := json.Unmarshal([]byte(encoded), &template); err != nil {
+		return nil, false, err
+	}
+	return template, true, nil
+}
+
+// jsonValue converts the map[interface{}]interface{} levels of a config
+// value so encoding/json accepts it.
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			out[key] = jsonValue(child)
+		}
+		return out
+	case map[interface{}]interface{}:
+		return jsonValue(normalizeInterfaceMap(v))
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, child := range v {
+			out[i] = jsonValue(child)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
 func applyTeaserFilter(template map[string]interface{}, fields Fields) map[string]interface{} {
 	if !fields.Teaser {
 		return template
@@ -249,7 +1098,10 @@ func resolveShowPreview(fields Fields) bool {
 	return *fields.Preview
 }
 
-func redirectIfPossible(ctx context.Context, target string) bool {
+// redirectIfPossible answers a successful CMS action with a redirect to
+// target. data.redirect = false re-renders in place instead, and so do AJAX
+// requests unless data.redirect = true.
+func redirectIfPossible(ctx context.Context, fields Fields, target string) bool {
 	if ctx == nil || strings.TrimSpace(target) == "" {
 		return false
 	}
@@ -258,47 +1110,247 @@ func redirectIfPossible(ctx context.Context, target string) bool {
 	if writer == nil || req == nil {
 		return false
 	}
-	http.Redirect(writer, req, target, http.StatusSeeOther)
+	if fields.Redirect != nil && !*fields.Redirect {
+		return false
+	}
+	if fields.Redirect == nil && isAJAXRequest(req) {
+		return false
+	}
+	http.Redirect(writer, req, target, resolveRedirectStatus(fields))
 	return true
 }
 
-func inlineMode(fields Fields, ctx context.Context) bool {
-	if !fields.Inline || ctx == nil {
-		return false
+// resolveRedirectStatus returns data.redirect_status, or 303 See Other when
+// it is unset or not a redirect status.
+func resolveRedirectStatus(fields Fields) int {
+	switch fields.RedirectStatus {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return fields.RedirectStatus
 	}
-	val := GetInputFromContext(ctx, resolveInlineParam(fields))
-	return parseBoolFlag(val)
+	return http.StatusSeeOther
 }
 
-func parseBoolFlag(value string) bool {
-	switch strings.ToLower(strings.TrimSpace(value)) {
-	case "1", "true", "yes", "on", "y":
+// isAJAXRequest reports requests sent from script (htmx, fetch, XHR) rather
+// than by a plain form post: they set X-Requested-With or HX-Request, or
+// accept JSON but not HTML.
+func isAJAXRequest(req *http.Request) bool {
+	if strings.EqualFold(req.Header.Get("X-Requested-With"), "XMLHttpRequest") || strings.EqualFold(req.Header.Get("HX-Request"), "true") {
 		return true
-	default:
-		return false
 	}
+	accept := strings.ToLower(req.Header.Get("Accept"))
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/html")
 }
 
-func parseBoolish(value interface{}) bool {
-	switch v := value.(type) {
-	case bool:
-		return v
-	case string:
-		return parseBoolFlag(v)
-	case int:
-		return v != 0
-	case int64:
-		return v != 0
-	case float64:
-		return v != 0
-	default:
-		return false
-	}
+// actorKey is unexported so no other package can collide with the key.
+type actorKey struct{}
+
+// ActorContextKey is the context key the host application sets to identify the
+// current user. Hosts that load the plugin resolve it, or WithActor, through
+// plugin.Lookup.
+var ActorContextKey = actorKey{}
+
+// WithActor returns ctx carrying actor under ActorContextKey.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, ActorContextKey, actor)
 }
 
-func isBoundaryPlugin(node map[string]interface{}) bool {
-	nodeType, _ := node["@type"].(string)
-	if !strings.EqualFold(strings.TrimSpace(nodeType), "<PLUGIN>") {
+const anonymousActor = "anonymous"
+
+// actorFromContext returns the user performing a mutation. The context key
+// wins over the optional data.actor_header request header.
+func actorFromContext(ctx context.Context, header string) string {
+	if ctx == nil {
+		return anonymousActor
+	}
+	if actor := hostActor(ctx); actor != "" {
+		return actor
+	}
+	header = strings.TrimSpace(header)
+	if header != "" {
+		if req, _ := ctx.Value(shared.Request).(*http.Request); req != nil {
+			if actor := strings.TrimSpace(req.Header.Get(header)); actor != "" {
+				return actor
+			}
+		}
+	}
+	return anonymousActor
+}
+
+// hostActor returns the actor the host set under ActorContextKey, or "".
+func hostActor(ctx context.Context) string {
+	switch v := ctx.Value(ActorContextKey).(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case fmt.Stringer:
+		return strings.TrimSpace(v.String())
+	}
+	return ""
+}
+
+const (
+	defaultMaxRetries = 3
+	defaultRetryDelay = 50 * time.Millisecond
+	// maxRetries and maxRetryDelay bound how long a locked write can stall
+	// the request, whatever data.max_retries and data.retry_delay say.
+	maxRetries    = 10
+	maxRetryDelay = 2 * time.Second
+)
+
+// writeOptions carries the per-request settings used by the mutation helpers.
+type writeOptions struct {
+	Actor      string
+	MaxRetries int
+	RetryDelay time.Duration
+	// MergeUpdate keeps stored fields that are not part of an update instead
+	// of replacing the record's whole field set.
+	MergeUpdate bool
+	// NaturalKey turns creates into upserts: a record of the same type with
+	// the same value for this bind is updated instead of duplicated.
+	NaturalKey string
+	// MaxVersions > 0 snapshots a record's fields before each update and
+	// keeps that many snapshots per record.
+	MaxVersions int
+	// FieldTypes maps binds to schema types; number and date binds also fill
+	// the typed num_value/date_value columns.
+	FieldTypes map[string]string
+	// Columns is set for data.storage = columns: field values are written to
+	// the type's table instead of record_fields.
+	Columns *columnLayout
+	// IDStrategy is uuid or ulid to give new records a records.uid; empty
+	// for plain autoincrement ids.
+	IDStrategy string
+	// MaxRecords > 0 caps the records of a type: creates evict the oldest
+	// records beyond it in the same transaction.
+	MaxRecords int
+	// TouchOnChangeOnly skips updates whose values match the stored fields,
+	// so updated_at only moves when something changed.
+	TouchOnChangeOnly bool
+	// ReadOnly (data.read_only) makes every write return errReadOnly before
+	// it opens a transaction.
+	ReadOnly bool
+	// WriteLock (data.serialize_writes) is held around every write attempt,
+	// so writes to one store never overlap within the process.
+	WriteLock *sync.Mutex
+	// SoftDelete (data.soft_delete) makes deletes set records.deleted_at and
+	// keep the record's fields, versions and files.
+	SoftDelete bool
+	// Changes is bumped after every successful write; see storeChangeCounter.
+	Changes *atomic.Int64
+}
+
+// writeLocks holds one mutex per store path for data.serialize_writes.
+var writeLocks sync.Map
+
+// storeWriteLock returns the process-wide write mutex for store.
+func storeWriteLock(store string) *sync.Mutex {
+	lock, _ := writeLocks.LoadOrStore(strings.TrimSpace(store), &sync.Mutex{})
+	return lock.(*sync.Mutex)
+}
+
+// storeChanges holds one write counter per store path. The data.http_caching
+// ETag includes it, so two writes within the same second of updated_at still
+// produce different ETags.
+var storeChanges sync.Map
+
+// storeChangeCounter returns the process-wide write counter for store.
+func storeChangeCounter(store string) *atomic.Int64 {
+	counter, _ := storeChanges.LoadOrStore(strings.TrimSpace(store), new(atomic.Int64))
+	return counter.(*atomic.Int64)
+}
+
+// processEpoch keeps ETags from one process apart from those of a restarted
+// one, whose change counters start at zero again.
+var processEpoch = time.Now().UnixNano()
+
+// errReadOnly is returned by writes to a store rendered with data.read_only.
+var errReadOnly = errors.New("store is read-only")
+
+// errRecordNotFound is returned when a record id does not exist (or has
+// another type), so callers can answer 404 instead of failing.
+var errRecordNotFound = errors.New("record not found")
+
+func resolveWriteOptions(fields Fields, binds map[string]bindTarget, ctx context.Context) writeOptions {
+	opts := writeOptions{
+		Actor:             actorFromContext(ctx, fields.ActorHeader),
+		MaxRetries:        defaultMaxRetries,
+		RetryDelay:        defaultRetryDelay,
+		MergeUpdate:       fields.MergeUpdate,
+		NaturalKey:        strings.TrimSpace(fields.NaturalKey),
+		MaxVersions:       fields.MaxVersions,
+		MaxRecords:        fields.MaxRecords,
+		FieldTypes:        buildBindTypeMap(fields, binds),
+		TouchOnChangeOnly: fields.TouchOnChangeOnly,
+		ReadOnly:          fields.ReadOnly,
+		SoftDelete:        fields.SoftDelete,
+		Changes:           storeChangeCounter(fields.Store),
+	}
+	// Invalid storage and id_strategy settings already failed openStore.
+	opts.Columns, _ = resolveColumnLayout(fields)
+	opts.IDStrategy, _ = resolveIDStrategy(fields.IDStrategy)
+	if fields.MaxRetries != nil && *fields.MaxRetries >= 0 {
+		opts.MaxRetries = min(*fields.MaxRetries, maxRetries)
+	}
+	if delay, ok := parseDelay(fields.RetryDelay); ok {
+		opts.RetryDelay = min(delay, maxRetryDelay)
+	}
+	if fields.SerializeWrites {
+		opts.WriteLock = storeWriteLock(fields.Store)
+	}
+	return opts
+}
+
+// parseDelay accepts Go durations ("100ms") or a bare number of milliseconds.
+func parseDelay(value string) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if ms, err := strconv.Atoi(value); err == nil && ms >= 0 {
+		return time.Duration(ms) * time.Millisecond, true
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return d, true
+	}
+	return 0, false
+}
+
+func inlineMode(fields Fields, ctx context.Context) bool {
+	if !fields.Inline || ctx == nil {
+		return false
+	}
+	val := GetInputFromContext(ctx, resolveInlineParam(fields))
+	return parseBoolFlag(val)
+}
+
+func parseBoolFlag(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "1", "true", "yes", "on", "y":
+		return true
+	default:
+		return false
+	}
+}
+
+func parseBoolish(value interface{}) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		return parseBoolFlag(v)
+	case int:
+		return v != 0
+	case int64:
+		return v != 0
+	case float64:
+		return v != 0
+	default:
+		return false
+	}
+}
+
+func isBoundaryPlugin(node map[string]interface{}) bool {
+	nodeType, _ := node["@type"].(string)
+	if !strings.EqualFold(strings.TrimSpace(nodeType), "<PLUGIN>") {
 		return false
 	}
 
@@ -322,6 +1374,76 @@ func isBoundaryPlugin(node map[string]interface{}) bool {
 	}
 }
 
+// injectParentContext passes the record being rendered to the boundary
+// plugins directly inside instance: their data gets parent_id and
+// parent_type, and {{parent_id}}/{{parent_type}} in their data strings are
+// replaced. Deeper plugins are left alone; each nested ContentRecords render
+// injects its own record into its own children, so any depth works with
+// every level seeing only its direct parent.
+func injectParentContext(node interface{}, parentID int64, parentType string) {
+	if parentID == 0 {
+		return
+	}
+	typed, ok := node.(map[string]interface{})
+	if !ok {
+		if list, ok := node.([]interface{}); ok {
+			for _, child := range list {
+				injectParentContext(child, parentID, parentType)
+			}
+		}
+		return
+	}
+	if isBoundaryPlugin(typed) {
+		var data map[string]interface{}
+		switch raw := typed["data"].(type) {
+		case map[string]interface{}:
+			data = raw
+		case map[interface{}]interface{}:
+			data = normalizeInterfaceMap(raw)
+		default:
+			data = map[string]interface{}{}
+		}
+		id := strconv.FormatInt(parentID, 10)
+		replacer := strings.NewReplacer("{{parent_id}}", id, "{{parent_type}}", parentType)
+		for key, value := range data {
+			data[key] = replaceParentPlaceholders(value, replacer)
+		}
+		data["parent_id"] = id
+		data["parent_type"] = parentType
+		typed["data"] = data
+		return
+	}
+	for key, child := range typed {
+		if strings.HasPrefix(key, "@") {
+			continue
+		}
+		if raw, ok := child.(map[interface{}]interface{}); ok {
+			if !hasBoundaryPlugin(raw) {
+				continue
+			}
+			child = normalizeInterfaceMap(raw)
+			typed[key] = child
+		}
+		injectParentContext(child, parentID, parentType)
+	}
+}
+
+func replaceParentPlaceholders(value interface{}, replacer *strings.Replacer) interface{} {
+	switch v := value.(type) {
+	case string:
+		return replacer.Replace(v)
+	case map[string]interface{}:
+		for key, child := range v {
+			v[key] = replaceParentPlaceholders(child, replacer)
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = replaceParentPlaceholders(child, replacer)
+		}
+	}
+	return value
+}
+
 func hasBoundaryPlugin(node interface{}) bool {
 	switch typed := node.(type) {
 	case map[string]interface{}:
@@ -349,6 +1471,73 @@ func hasBoundaryPlugin(node interface{}) bool {
 	return false
 }
 
+// resolveNewParam returns the param name and value the CMS "New" button sends
+// to edit_route so the edit view shows an empty create form.
+func resolveNewParam(fields Fields) (string, string) {
+	param := strings.TrimSpace(fields.NewParam)
+	if param == "" {
+		param = "new"
+	}
+	value := strings.TrimSpace(fields.NewValue)
+	if value == "" {
+		value = "1"
+	}
+	return param, value
+}
+
+// formParams are the request keys the CMS and edit forms post their action
+// and record id under. Namespaced names keep a host page's own action or
+// record_id field from driving the plugin.
+type formParams struct {
+	Action   string // data.action_param (default action)
+	RecordID string // data.record_id_param (default record_id)
+}
+
+func resolveFormParams(fields Fields) formParams {
+	params := formParams{
+		Action:   strings.TrimSpace(fields.ActionParam),
+		RecordID: strings.TrimSpace(fields.RecordIDParam),
+	}
+	if params.Action == "" {
+		params.Action = "action"
+	}
+	if params.RecordID == "" {
+		params.RecordID = "record_id"
+	}
+	return params
+}
+
+// requestsNewRecord reports whether the request carries new_param. The
+// configured new_value matches exactly; any truthy value is accepted too so
+// hand-written links like ?new=true keep working.
+func requestsNewRecord(fields Fields, ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	param, value := resolveNewParam(fields)
+	got := strings.TrimSpace(GetInputFromContext(ctx, param))
+	if got == "" {
+		return false
+	}
+	return got == value || parseBoolFlag(got)
+}
+
+// wantsCreateForm reports whether the edit view should hand over to the
+// create form: new_param is set and neither the route nor a posted form names
+// an existing record, so saving a record created from ?new=1 still updates it.
+func wantsCreateForm(fields Fields, ctx context.Context, errors *[]error) bool {
+	if !requestsNewRecord(fields, ctx) || resolveSingleRecordID(fields, ctx) != 0 || singleRecordUID(fields, ctx) != "" {
+		return false
+	}
+	if req, _ := ctx.Value(shared.Request).(*http.Request); req != nil && req.Method == http.MethodPost {
+		parseRequestForm(req, errors)
+		if ref := strings.TrimSpace(GetInputFromContext(ctx, resolveFormParams(fields).RecordID)); parseRecordID(ref) != 0 || isRecordUID(ref) {
+			return false
+		}
+	}
+	return true
+}
+
 func resolveSingleRecordID(fields Fields, ctx context.Context) int64 {
 	if id := parseIDValue(fields.ID); id != 0 {
 		return id
@@ -358,9 +1547,78 @@ func resolveSingleRecordID(fields Fields, ctx context.Context) int64 {
 			return id
 		}
 	}
+	if id := resolvePathRecordID(fields, ctx); id != 0 {
+		return id
+	}
 	return resolveRecordID(ctx, fields.RecordParam)
 }
 
+// resolvePathRecordID reads the record id from a segment of the request
+// path (data.path_param_index), e.g. index 1 or -1 for /articles/42. It
+// returns 0 when the option is unset, the segment is missing or it is not a
+// positive integer, so callers fall back to the query/form param.
+func resolvePathRecordID(fields Fields, ctx context.Context) int64 {
+	id := parseRecordID(pathRecordSegment(fields, ctx))
+	if id < 0 {
+		return 0
+	}
+	return id
+}
+
+// pathRecordSegment returns the raw data.path_param_index segment, or "".
+func pathRecordSegment(fields Fields, ctx context.Context) string {
+	if fields.PathParamIndex == nil || ctx == nil {
+		return ""
+	}
+	req, _ := ctx.Value(shared.Request).(*http.Request)
+	if req == nil || req.URL == nil {
+		return ""
+	}
+	var segments []string
+	for _, segment := range strings.Split(req.URL.Path, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	index := *fields.PathParamIndex
+	if index < 0 {
+		index += len(segments)
+	}
+	if index < 0 || index >= len(segments) {
+		return ""
+	}
+	return segments[index]
+}
+
+// singleRecordUID returns the first uid-shaped record reference, checked in
+// the same order as resolveSingleRecordID: data.id, data.ids, the path
+// segment and the record param.
+func singleRecordUID(fields Fields, ctx context.Context) string {
+	refs := []string{fmt.Sprint(fields.ID)}
+	if len(fields.IDs) > 0 {
+		refs = append(refs, fmt.Sprint(fields.IDs[0]))
+	}
+	refs = append(refs, pathRecordSegment(fields, ctx))
+	if ctx != nil {
+		refs = append(refs, GetInputFromContext(ctx, resolveRecordParam(fields)))
+	}
+	for _, ref := range refs {
+		if ref = strings.TrimSpace(ref); isRecordUID(ref) {
+			return ref
+		}
+	}
+	return ""
+}
+
+// resolveSingleRecord is resolveSingleRecordID for views with a store: a
+// uuid/ulid reference is looked up in records.uid.
+func resolveSingleRecord(db *sql.DB, fields Fields, ctx context.Context) int64 {
+	if id := resolveSingleRecordID(fields, ctx); id != 0 {
+		return id
+	}
+	return lookupRecordRef(db, singleRecordUID(fields, ctx))
+}
+
 func resolveIDs(fields Fields) []int64 {
 	ids := make([]int64, 0, len(fields.IDs)+1)
 	if id := parseIDValue(fields.ID); id != 0 {
@@ -392,15 +1650,26 @@ func parseIDValue(value interface{}) int64 {
 }
 
 func renderListEdit(fields Fields, ctx context.Context, errors *[]error) any {
-	template, binds, db, contentType, ok := loadTemplateAndDB(fields, errors)
+	template, binds, db, contentType, ok := loadTemplateAndDB(fields, ctx, errors)
 	if !ok {
 		return "<!-- content_records_plugin list edit failed -->"
 	}
 
 	fieldDefs := collectCMSFields(fields, binds)
-	applyCMSAction(ctx, db, contentType, fieldDefs, resolveUploadDir(fields), errors)
+	filters := resolveFilters(fields, binds, ctx)
+	opts := resolveWriteOptions(fields, binds, ctx)
+	fields.showDeleted = fields.SoftDelete && GetInputFromContext(ctx, showDeletedParam) == "1"
+	errCount := len(*errors)
+	cleanup := newFileCleanup(fields, fieldDefs, template, binds)
+	var bulk map[string]interface{}
+	if action := applyCMSAction(ctx, db, contentType, fieldDefs, resolveUploadOptions(fields), resolveFormParams(fields), opts, cleanup, errors); action != "" {
+		if action == bulkSetAction && !opts.ReadOnly {
+			bulk = applyBulkSet(ctx, db, fields, contentType, fieldDefs, filters, opts, errors)
+		}
+		logDebug(fields, "cms action applied", "action", action, "type", contentType, "failed", len(*errors) > errCount)
+	}
 
-	records, err := fetchRecordsForList(db, fields, contentType)
+	records, err := fetchRecordsForList(db, fields, contentType, filters)
 	if err != nil {
 		*errors = append(*errors, fmt.Errorf("content_records_plugin: fetch records failed: %w", err))
 		return "<!-- content_records_plugin fetch records failed -->"
@@ -409,6 +1678,8 @@ func renderListEdit(fields Fields, ctx context.Context, errors *[]error) any {
 	imageBinds := collectImageBinds(fields, binds)
 	listBinds := collectFlaggedBindKeys(template, "@list")
 	values := buildCMSValues(template, binds, records, fields, fieldDefs, imageBinds, listBinds)
+	values["filters"] = filterValues(filters)
+	values["bulk"] = bulk
 	cms := map[string]interface{}{
 		"@type":  "<TEMPLATE>",
 		"inline": cmsInlineTemplate(),
@@ -422,9 +1693,9 @@ func renderListEdit(fields Fields, ctx context.Context, errors *[]error) any {
 }
 
 func renderListRender(fields Fields, ctx context.Context, errors *[]error) any {
-	template, binds, db, contentType, ok := loadTemplateAndDB(fields, errors)
+	template, binds, db, contentType, ok := loadTemplateAndDB(fields, ctx, errors)
 	if !ok {
-		return "<!-- content_records_plugin list render failed -->"
+		return fallbackMarkup(fields.ErrorHTML, "<!-- content_records_plugin list render failed -->")
 	}
 
 	if inlineMode(fields, ctx) {
@@ -433,1680 +1704,6805 @@ func renderListRender(fields Fields, ctx context.Context, errors *[]error) any {
 		}
 	}
 
-	records, err := fetchRecordsForList(db, fields, contentType)
+	if fields.LoadMore {
+		if handled, response := handleLoadMore(ctx, db, contentType, binds, fields, template, errors); handled {
+			return response
+		}
+	}
+
+	var records []record
+	var total int
+	var err error
+	if fields.LoadMore {
+		// The first page is rendered inline; the rest is fetched via cr_more.
+		records, total, err = fetchRecordPage(db, fields, contentType, resolveFilters(fields, binds, ctx), 0, resolvePageSize(fields))
+	} else {
+		records, err = fetchRecordsForList(db, fields, contentType, resolveFilters(fields, binds, ctx))
+	}
 	if err != nil {
 		*errors = append(*errors, fmt.Errorf("content_records_plugin: fetch records failed: %w", err))
-		return "<!-- content_records_plugin fetch records failed -->"
+		return fallbackMarkup(fields.ErrorHTML, "<!-- content_records_plugin fetch records failed -->")
+	}
+	if len(records) == 0 && fields.Placeholder {
+		if placeholder, ok := placeholderList(db, fields, template, binds, contentType, errors); ok {
+			return placeholder
+		}
+	}
+	if len(records) == 0 && strings.TrimSpace(fields.EmptyHTML) != "" {
+		return fields.EmptyHTML
 	}
 
+	applyFieldDefaults(fields, binds, records)
+	applyComputedFields(fields, binds, records)
+	sanitizeRawFields(fields, binds, records)
 	imageBinds := collectImageBinds(fields, binds)
 	template = applyTeaserFilter(template, fields)
 	inlineOpts := buildInlineOptions(fields, binds, inlineMode(fields, ctx))
-	return buildList(template, binds, records, imageBinds, fields.Editable, resolveEditRoute(fields), resolveRecordParam(fields), inlineOpts)
+	list := buildList(template, binds, records, imageBinds, fields.Editable && !fields.ReadOnly, resolveEditRoute(fields), resolveRecordParam(fields), inlineOpts, resolveTreeKeys(fields), resolveItemTemplates(fields, errors))
+	if fields.LoadMore && total > len(records) {
+		// Non-numeric keys render after the records; array output drops it.
+		list["_more"] = loadMoreControl(len(records), resolvePageSize(fields))
+	}
+	return listOutput(fields, list)
 }
 
-func renderSingleEdit(fields Fields, ctx context.Context, errors *[]error) any {
-	template, binds, db, contentType, ok := loadTemplateAndDB(fields, errors)
-	if !ok {
-		return "<!-- content_records_plugin single edit failed -->"
+// loadMoreControl is the button a load_more list ends with. Its script asks
+// the current URL for the next page with cr_more=1, inserts the fragment
+// before the button and removes the button once X-CR-Has-More is false.
+func loadMoreControl(offset, limit int) map[string]interface{} {
+	return map[string]interface{}{
+		"@type": "<HTML>",
+		"value": fmt.Sprintf(`<div class="content-records-more" data-cr-more data-cr-offset="%d" data-cr-limit="%d"><button type="button">Load more</button></div>`, offset, limit) + loadMoreScript,
 	}
+}
 
-	fieldDefs := collectCMSFields(fields, binds)
-	recordID := resolveSingleRecordID(fields, ctx)
-	actionApplied := false
-	actionSuccess := false
+// loadMoreScript binds one document-wide click handler for every
+// .content-records-more control on the page.
+const loadMoreScript = `<script>
+(() => {
+  if (window.contentRecordsLoadMore) {
+    return;
+  }
+  window.contentRecordsLoadMore = true;
+  document.addEventListener("click", async (event) => {
+    const button = event.target.closest("[data-cr-more] button");
+    if (!button) {
+      return;
+    }
+    const control = button.closest("[data-cr-more]");
+    const url = new URL(window.location.href);
+    url.searchParams.set("cr_more", "1");
+    url.searchParams.set("offset", control.dataset.crOffset);
+    url.searchParams.set("limit", control.dataset.crLimit);
+    button.disabled = true;
+    try {
+      const res = await fetch(url, { headers: { "X-Requested-With": "XMLHttpRequest" } });
+      if (!res.ok) {
+        throw new Error("load more failed: " + res.status);
+      }
+      control.insertAdjacentHTML("beforebegin", await res.text());
+      control.dataset.crOffset = res.headers.get("X-CR-Next-Offset") || control.dataset.crOffset;
+      if (res.headers.get("X-CR-Has-More") !== "true") {
+        control.remove();
+        return;
+      }
+    } catch (err) {
+      console.error(err);
+    }
+    button.disabled = false;
+  });
+})();
+</script>`
+
+// placeholderList renders a single card from the template's default values
+// while contentType has no records at all (data.placeholder_template), so a
+// fresh page shows its layout. Lists that are only empty because of filters
+// or a query fall through to empty_html.
+func placeholderList(db *sql.DB, fields Fields, template map[string]interface{}, binds map[string]bindTarget, contentType string, errors *[]error) (any, bool) {
+	count, err := countRecords(db, contentType)
+	if err != nil || count > 0 {
+		return nil, false
+	}
+	rec := record{Fields: defaultValuesFromTemplate(template, binds)}
+	applyComputedFields(fields, binds, []record{rec})
+	logDebug(fields, "placeholder rendered", "type", contentType)
+	template = applyTeaserFilter(template, fields)
+	return listOutput(fields, buildList(template, binds, []record{rec}, collectImageBinds(fields, binds), false, "", "", nil, resolveTreeKeys(fields), resolveItemTemplates(fields, errors))), true
+}
 
-	if req, _ := ctx.Value(shared.Request).(*http.Request); req != nil && req.Method == http.MethodPost {
-		parseRequestForm(req, errors)
-		action := strings.ToLower(strings.TrimSpace(GetInputFromContext(ctx, "action")))
-		if action != "" {
-			actionApplied = true
-		}
-		values := readFieldValuesFromContext(ctx, fieldDefs)
-		mergeUploads(ctx, fieldDefs, resolveUploadDir(fields), values, errors)
-		formID := parseRecordID(GetInputFromContext(ctx, "record_id"))
-		if formID != 0 {
-			recordID = formID
-		}
+const sqliteTimeLayout = "2006-01-02 15:04:05"
 
-		switch action {
-		case "update":
-			if recordID == 0 {
-				if newID, err := createRecord(db, contentType, values); err == nil {
-					recordID = newID
-					actionSuccess = true
-				} else {
-					*errors = append(*errors, fmt.Errorf("content_records_plugin: create failed: %w", err))
-				}
-			} else {
-				if err := updateRecord(db, recordID, contentType, values); err != nil {
-					*errors = append(*errors, fmt.Errorf("content_records_plugin: update failed: %w", err))
-				} else {
-					actionSuccess = true
-				}
-			}
-		case "delete":
-			if recordID != 0 {
-				if err := deleteRecord(db, recordID, contentType); err != nil {
-					*errors = append(*errors, fmt.Errorf("content_records_plugin: delete failed: %w", err))
-				} else {
-					actionSuccess = true
-				}
-				recordID = 0
-			}
-		case "create":
-			if newID, err := createRecord(db, contentType, values); err == nil {
-				recordID = newID
-				actionSuccess = true
-			} else {
-				*errors = append(*errors, fmt.Errorf("content_records_plugin: create failed: %w", err))
-			}
-		}
+// notModified sets ETag/Last-Modified when data.http_caching is enabled and
+// writes 304 Not Modified when the client's validators still match. The weak
+// ETag covers the record count and latest updated_at for the content type,
+// the store's change counter, plus a hash of the render config so template
+// changes invalidate it. Only responses the plugin owns (load more, history)
+// call it; a component inside a page must not answer for the whole page.
+func notModified(ctx context.Context, db *sql.DB, fields Fields, contentType string) bool {
+	if !fields.HTTPCaching || ctx == nil {
+		return false
 	}
-
-	if actionApplied && actionSuccess {
-		if redirectIfPossible(ctx, resolveListRoute(fields)) {
-			return ""
-		}
+	req, _ := ctx.Value(shared.Request).(*http.Request)
+	writer, _ := ctx.Value(shared.ResponseWriter).(http.ResponseWriter)
+	if req == nil || writer == nil {
+		return false
 	}
-
-	if recordID == 0 {
-		if newID, err := createRecordFromTemplate(db, contentType, template, binds); err == nil {
-			recordID = newID
-		} else {
-			*errors = append(*errors, fmt.Errorf("content_records_plugin: create failed: %w", err))
-		}
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
 	}
 
-	rec, err := fetchRecordByID(db, recordID, contentType)
+	count, lastModified, err := fetchTypeStats(db, contentType)
 	if err != nil {
-		*errors = append(*errors, fmt.Errorf("content_records_plugin: fetch record failed: %w", err))
-		return "<!-- content_records_plugin fetch record failed -->"
+		logDebug(fields, "http caching skipped", "error", err)
+		return false
 	}
 
-	imageBinds := collectImageBinds(fields, binds)
-	showPreview := resolveShowPreview(fields)
-	var preview map[string]interface{}
-	if showPreview {
-		preview = buildList(template, binds, []record{rec}, imageBinds, false, "", "", nil)
-	}
-	values := buildEditValues(rec, fieldDefs, fields, preview)
-	edit := map[string]interface{}{
-		"@type":  "<TEMPLATE>",
-		"inline": editInlineTemplate(),
-		"values": values,
+	hasher := fnv.New64a()
+	view, action := resolveViewAction(fields)
+	fmt.Fprintf(hasher, "%s|%s|%s|%v|%v|%v|%v|%s|%d|%d", view, action, resolveQuery(fields), fields.Teaser, resolveIDs(fields), resolveTemplateValue(fields), fields.Where, fields.OrderBy, fields.Limit, processEpoch)
+	etag := fmt.Sprintf(`W/"%x-%d-%d-%d"`, hasher.Sum64(), count, lastModified.Unix(), storeChangeCounter(fields.Store).Load())
+
+	writer.Header().Set("ETag", etag)
+	// updated_at has one-second resolution: while its second is still running
+	// another write can land in it, so Last-Modified is withheld until then.
+	settled := !lastModified.IsZero() && lastModified.Before(time.Now().UTC().Truncate(time.Second))
+	if settled {
+		writer.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	fresh := false
+	if match := req.Header.Get("If-None-Match"); match != "" {
+		fresh = etagMatches(match, etag)
+	} else if since := req.Header.Get("If-Modified-Since"); since != "" && settled {
+		t, err := http.ParseTime(since)
+		fresh = err == nil && !lastModified.Truncate(time.Second).After(t)
+	}
+	if !fresh {
+		metrics.add("cache_misses", 1)
+		return false
 	}
 
-	return map[string]interface{}{
-		"@type": "<TREE>",
-		"10":    edit,
-	}
+	metrics.add("cache_hits", 1)
+	writer.WriteHeader(http.StatusNotModified)
+	return true
 }
 
-func renderSingleRender(fields Fields, ctx context.Context, errors *[]error) any {
-	template, binds, db, contentType, ok := loadTemplateAndDB(fields, errors)
-	if !ok {
-		return "<!-- content_records_plugin single render failed -->"
-	}
-
-	if inlineMode(fields, ctx) {
-		if handled, response := handleInlineUpdate(ctx, db, contentType, binds, fields, template, errors); handled {
-			return response
+// etagMatches applies the weak comparison used for If-None-Match.
+func etagMatches(header, etag string) bool {
+	want := strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == want {
+			return true
 		}
 	}
+	return false
+}
 
-	recordID := resolveSingleRecordID(fields, ctx)
-	if recordID == 0 {
-		query := resolveQuery(fields)
-		if query != "" {
-			if ids, err := fetchRecordIDs(db, query, contentType); err == nil && len(ids) > 0 {
-				recordID = ids[0]
-			}
-		}
-	}
-	if recordID == 0 {
-		return "<!-- content_records_plugin no record id -->"
+// fetchTypeStats returns the record count and the newest updated_at for a type.
+func fetchTypeStats(db *sql.DB, contentType string) (int, time.Time, error) {
+	var count int
+	var latest sql.NullString
+	var err error
+	if strings.TrimSpace(contentType) == "" {
+		err = db.QueryRow(`SELECT COUNT(*), MAX(updated_at) FROM records`).Scan(&count, &latest)
+	} else {
+		err = db.QueryRow(`SELECT COUNT(*), MAX(updated_at) FROM records WHERE type = ?`, contentType).Scan(&count, &latest)
 	}
-
-	rec, err := fetchRecordByID(db, recordID, contentType)
 	if err != nil {
-		*errors = append(*errors, fmt.Errorf("content_records_plugin: fetch record failed: %w", err))
-		return "<!-- content_records_plugin fetch record failed -->"
+		return 0, time.Time{}, err
 	}
-
-	template = applyTeaserFilter(template, fields)
-	instance, ok := deepCopy(template).(map[string]interface{})
-	if !ok {
-		return "<!-- content_records_plugin render failed -->"
+	if !latest.Valid {
+		return count, time.Time{}, nil
 	}
-	stripPluginMetaKeys(instance)
-	imageBinds := collectImageBinds(fields, binds)
-	for bindKey, value := range rec.Fields {
-		target, ok := binds[bindKey]
-		if !ok {
-			continue
-		}
-		if value == "" {
-			if _, isImage := imageBinds[bindKey]; isImage {
-				continue
-			}
+	lastModified, err := time.Parse(sqliteTimeLayout, latest.String)
+	if err != nil {
+		// MySQL DSNs with parseTime=true scan DATETIME as RFC 3339.
+		if lastModified, err = time.Parse(time.RFC3339Nano, latest.String); err != nil {
+			return count, time.Time{}, nil
 		}
-		_ = setAtPath(instance, target.Path, value)
 	}
-	inlineOpts := buildInlineOptions(fields, binds, inlineMode(fields, ctx))
-	applyInlineAttributes(instance, binds, rec, inlineOpts)
-	if fields.Editable && strings.TrimSpace(resolveEditRoute(fields)) != "" {
-		addEditLink(instance, resolveEditRoute(fields), resolveRecordParam(fields), rec.ID)
+	return count, lastModified, nil
+}
+
+const (
+	defaultPageSize = 10
+	maxPageSize     = 100
+)
+
+func resolvePageSize(fields Fields) int {
+	if fields.PageSize <= 0 {
+		return defaultPageSize
 	}
-	return instance
+	if fields.PageSize > maxPageSize {
+		return maxPageSize
+	}
+	return fields.PageSize
 }
 
-func loadTemplateAndDB(fields Fields, errors *[]error) (map[string]interface{}, map[string]bindTarget, *sql.DB, string, bool) {
-	templateValue := resolveTemplateValue(fields)
-	template, ok := normalizeToStringMap(templateValue)
-	if !ok {
-		*errors = append(*errors, fmt.Errorf("content_records_plugin: data.template must be a map"))
-		return nil, nil, nil, "", false
+// handleLoadMore serves GET ?cr_more=1&offset=N&limit=M for infinite-scroll
+// lists. format=json returns record fields; otherwise the page is returned as
+// a rendered <TREE> fragment with paging info in X-CR-* headers.
+func handleLoadMore(ctx context.Context, db *sql.DB, contentType string, binds map[string]bindTarget, fields Fields, template map[string]interface{}, errors *[]error) (bool, any) {
+	req, _ := ctx.Value(shared.Request).(*http.Request)
+	if req == nil || req.Method != http.MethodGet {
+		return false, nil
+	}
+	if !parseBoolFlag(GetInputFromContext(ctx, "cr_more")) {
+		return false, nil
+	}
+	if notModified(ctx, db, fields, contentType) {
+		return true, ""
 	}
 
-	binds := map[string]bindTarget{}
-	collectBinds(template, "", binds)
+	offset, _ := strconv.Atoi(strings.TrimSpace(GetInputFromContext(ctx, "offset")))
+	if offset < 0 {
+		offset = 0
+	}
+	limit, _ := strconv.Atoi(strings.TrimSpace(GetInputFromContext(ctx, "limit")))
+	if limit <= 0 {
+		limit = resolvePageSize(fields)
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
 
-	db, err := getDB(fields.Store)
+	records, total, err := fetchRecordPage(db, fields, contentType, resolveFilters(fields, binds, ctx), offset, limit)
 	if err != nil {
-		*errors = append(*errors, fmt.Errorf("content_records_plugin: db open failed: %w", err))
-		return nil, nil, nil, "", false
+		if errors != nil {
+			*errors = append(*errors, fmt.Errorf("content_records_plugin: load more failed: %w", err))
+		}
+		return true, writeInlineJSON(ctx, http.StatusInternalServerError, map[string]interface{}{
+			"error": "load failed",
+		})
 	}
-
-	contentType := resolveTypeName(templateValue)
-	if fields.Seed {
-		if err := ensureSeed(db, template, binds, contentType); err != nil {
-			*errors = append(*errors, fmt.Errorf("content_records_plugin: seed failed: %w", err))
+	applyFieldDefaults(fields, binds, records)
+	applyComputedFields(fields, binds, records)
+	sanitizeRawFields(fields, binds, records)
+	nextOffset := offset + len(records)
+	hasMore := nextOffset < total
+	logDebug(fields, "load more", "offset", offset, "limit", limit, "rows", len(records), "total", total)
+
+	if strings.EqualFold(strings.TrimSpace(GetInputFromContext(ctx, "format")), "json") {
+		items := make([]interface{}, 0, len(records))
+		for _, rec := range records {
+			items = append(items, map[string]interface{}{
+				"id":     strconv.FormatInt(rec.ID, 10),
+				"fields": mapStringToInterface(rec.Fields),
+			})
 		}
+		return true, writeInlineJSON(ctx, http.StatusOK, map[string]interface{}{
+			"records":     items,
+			"offset":      offset,
+			"limit":       limit,
+			"total":       total,
+			"next_offset": nextOffset,
+			"has_more":    hasMore,
+		})
 	}
 
-	return template, binds, db, contentType, true
+	if writer, _ := ctx.Value(shared.ResponseWriter).(http.ResponseWriter); writer != nil {
+		writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+		writer.Header().Set("X-CR-Total", strconv.Itoa(total))
+		writer.Header().Set("X-CR-Next-Offset", strconv.Itoa(nextOffset))
+		writer.Header().Set("X-CR-Has-More", strconv.FormatBool(hasMore))
+	}
+	imageBinds := collectImageBinds(fields, binds)
+	template = applyTeaserFilter(template, fields)
+	inlineOpts := buildInlineOptions(fields, binds, inlineMode(fields, ctx))
+	return true, listOutput(fields, buildList(template, binds, records, imageBinds, fields.Editable && !fields.ReadOnly, resolveEditRoute(fields), resolveRecordParam(fields), inlineOpts, resolveTreeKeys(fields), resolveItemTemplates(fields, errors)))
 }
 
-func buildList(template map[string]interface{}, binds map[string]bindTarget, records []record, imageBinds map[string]struct{}, editable bool, route string, recordParam string, inline *inlineOptions) map[string]interface{} {
-	list := map[string]interface{}{
-		"@type": "<TREE>",
+func renderSingleEdit(fields Fields, ctx context.Context, errors *[]error) any {
+	// The CMS "New" button links here with new_param; show the create form
+	// instead of inserting a placeholder row for a missing record id.
+	if wantsCreateForm(fields, ctx, errors) {
+		return renderSingleNew(fields, ctx, errors)
 	}
 
-	for i, rec := range records {
-		instance, ok := deepCopy(template).(map[string]interface{})
-		if !ok {
-			continue
+	template, binds, db, contentType, ok := loadTemplateAndDB(fields, ctx, errors)
+	if !ok {
+		return "<!-- content_records_plugin single edit failed -->"
+	}
+
+	fieldDefs := collectCMSFields(fields, binds)
+	recordID := resolveSingleRecord(db, fields, ctx)
+	opts := resolveWriteOptions(fields, binds, ctx)
+	cleanup := newFileCleanup(fields, fieldDefs, template, binds)
+	actionApplied := false
+	actionSuccess := false
+	// Posted values that were not saved (action=preview, no action or a
+	// failed write) are shown in the form and preview instead of the stored ones.
+	var pending map[string]string
+
+	params := resolveFormParams(fields)
+	if req, _ := ctx.Value(shared.Request).(*http.Request); req != nil && req.Method == http.MethodPost {
+		parseRequestForm(req, errors)
+		action := strings.ToLower(strings.TrimSpace(GetInputFromContext(ctx, params.Action)))
+		if action == "preview" {
+			action = ""
 		}
-		stripPluginMetaKeys(instance)
-		for bindKey, value := range rec.Fields {
-			target, ok := binds[bindKey]
-			if !ok {
-				continue
+		if action != "" {
+			actionApplied = true
+		}
+		if actionApplied && opts.ReadOnly {
+			*errors = append(*errors, fmt.Errorf("content_records_plugin: %s rejected: %w", action, errReadOnly))
+			action = ""
+		}
+		values := readFieldValuesFromContext(ctx, fieldDefs)
+		if !opts.ReadOnly {
+			mergeUploads(ctx, fieldDefs, resolveUploadOptions(fields), values, errors)
+		}
+		formID := lookupRecordRef(db, GetInputFromContext(ctx, params.RecordID))
+		if formID != 0 {
+			recordID = formID
+		}
+
+		switch action {
+		case "update":
+			if recordID == 0 {
+				if newID, err := createRecord(db, contentType, values, opts); err == nil {
+					recordID = newID
+					actionSuccess = true
+				} else {
+					*errors = append(*errors, fmt.Errorf("content_records_plugin: create failed: %w", err))
+				}
+			} else {
+				previous := cleanup.snapshot(db, recordID, contentType)
+				if changed, err := updateRecord(db, recordID, contentType, values, opts); err != nil {
+					*errors = append(*errors, fmt.Errorf("content_records_plugin: update failed: %w", err))
+				} else {
+					if changed {
+						cleanup.removeReplaced(db, previous, values, errors)
+					} else {
+						logDebug(fields, "update skipped, no changes", "record", recordID)
+					}
+					actionSuccess = true
+				}
 			}
-			if value == "" {
-				if _, isImage := imageBinds[bindKey]; isImage {
-					continue
+		case "delete":
+			if recordID != 0 {
+				previous := cleanup.snapshot(db, recordID, contentType)
+				if err := deleteRecord(db, recordID, contentType, opts); err != nil {
+					*errors = append(*errors, fmt.Errorf("content_records_plugin: delete failed: %w", err))
+				} else {
+					if !opts.SoftDelete {
+						cleanup.removeReplaced(db, previous, nil, errors)
+					}
+					actionSuccess = true
 				}
+				recordID = 0
+			}
+		case "create":
+			if newID, err := createRecord(db, contentType, values, opts); err == nil {
+				recordID = newID
+				actionSuccess = true
+			} else {
+				*errors = append(*errors, fmt.Errorf("content_records_plugin: create failed: %w", err))
 			}
-			_ = setAtPath(instance, target.Path, value)
 		}
-
-		if editable && strings.TrimSpace(route) != "" {
-			addEditLink(instance, route, recordParam, rec.ID)
+		if !actionSuccess && action != "delete" {
+			pending = values
 		}
-		applyInlineAttributes(instance, binds, rec, inline)
-
-		key := strconv.Itoa((i + 1) * 10)
-		list[key] = instance
 	}
 
-	return list
-}
+	if actionApplied {
+		logDebug(fields, "cms action applied", "action", GetInputFromContext(ctx, params.Action), "record_id", recordID, "success", actionSuccess)
+	}
 
-func stripPluginMetaKeys(node interface{}) {
-	switch typed := node.(type) {
-	case map[string]interface{}:
-		if isBoundaryPlugin(typed) {
-			return
-		}
-		for key, child := range typed {
-			if key == "@bind" || key == "@name" || key == "@list" || key == "@teaser" {
-				delete(typed, key)
-				continue
-			}
-			stripPluginMetaKeys(child)
+	if actionApplied && actionSuccess {
+		if redirectIfPossible(ctx, fields, resolveListRoute(fields)) {
+			return ""
 		}
-	case []interface{}:
-		for _, child := range typed {
-			stripPluginMetaKeys(child)
+	}
+
+	// A read-only store has no record to fall back on; the fetch below reports it.
+	if recordID == 0 && !opts.ReadOnly {
+		if newID, err := createRecordFromTemplate(db, contentType, template, binds, opts); err == nil {
+			recordID = newID
+		} else {
+			*errors = append(*errors, fmt.Errorf("content_records_plugin: create failed: %w", err))
 		}
 	}
-}
 
-func buildInlineOptions(fields Fields, binds map[string]bindTarget, active bool) *inlineOptions {
-	if !active {
-		return nil
+	rec, err := fetchRecordByID(db, recordID, contentType)
+	if err == errRecordNotFound {
+		logDebug(fields, "record not found", "record_id", recordID, "type", contentType)
+		return fallbackMarkup(fields.NotFoundHTML, "<!-- content_records_plugin record not found -->")
 	}
-	return &inlineOptions{
-		Enabled:   true,
-		BindTypes: buildBindTypeMap(fields, binds),
+	if err != nil {
+		*errors = append(*errors, fmt.Errorf("content_records_plugin: fetch record failed: %w", err))
+		return "<!-- content_records_plugin fetch record failed -->"
 	}
-}
+	overlayPostedValues(ctx, &rec, fieldDefs, pending)
+	applyFieldDefaults(fields, binds, []record{rec})
+	applyComputedFields(fields, binds, []record{rec})
 
-func buildBindTypeMap(fields Fields, binds map[string]bindTarget) map[string]string {
-	out := map[string]string{}
-	schema := resolveSchema(fields)
-	for name, def := range schema {
-		bind := strings.TrimSpace(def.Bind)
-		if bind == "" && strings.TrimSpace(def.Path) != "" {
-			if resolved, ok := findBindByPath(binds, strings.TrimSpace(def.Path)); ok {
-				bind = resolved
-			}
-		}
-		if bind == "" {
-			bind = name
-		}
-		if _, ok := binds[bind]; !ok {
-			continue
-		}
-		t := strings.ToLower(strings.TrimSpace(def.Type))
-		if t == "" {
-			t = "text"
-		}
-		out[bind] = t
+	imageBinds := collectImageBinds(fields, binds)
+	showPreview := resolveShowPreview(fields)
+	var preview map[string]interface{}
+	if showPreview {
+		preview = buildList(template, binds, []record{rec}, imageBinds, false, "", "", nil, resolveTreeKeys(fields), nil)
+	}
+	values := buildEditValues(rec, fieldDefs, fields, preview)
+	edit := map[string]interface{}{
+		"@type":  "<TEMPLATE>",
+		"inline": editInlineTemplate(),
+		"values": values,
+	}
+
+	return map[string]interface{}{
+		"@type": "<TREE>",
+		"10":    edit,
 	}
-	return out
 }
 
-func applyInlineAttributes(instance map[string]interface{}, binds map[string]bindTarget, rec record, inline *inlineOptions) {
-	if inline == nil || !inline.Enabled {
+// overlayPostedValues replaces the stored fields of rec with the values the
+// request posted, so an unsaved edit shows in the form and preview. Fields
+// the request did not post keep their stored value, and image/file fields
+// keep the stored path unless a new file was uploaded.
+func overlayPostedValues(ctx context.Context, rec *record, fieldDefs []cmsField, values map[string]string) {
+	if len(values) == 0 {
 		return
 	}
-	for bindKey, target := range binds {
-		nodePath, _ := splitPath(target.Path)
-		node := findInlineNode(instance, nodePath)
-		if node == nil {
-			continue
+	if rec.Fields == nil {
+		rec.Fields = map[string]string{}
+	}
+	uploads := map[string]bool{}
+	for _, def := range fieldDefs {
+		if isUploadFieldType(def.Type) {
+			uploads[def.Bind] = true
 		}
-		if nodeType, ok := node["@type"].(string); ok && nodeType == "<TREE>" {
+	}
+	for key, value := range values {
+		if uploads[key] && value == "" {
 			continue
 		}
-		value := rec.Fields[bindKey]
-		bindType := "text"
-		if inline.BindTypes != nil {
-			if t := strings.TrimSpace(inline.BindTypes[bindKey]); t != "" {
-				bindType = strings.ToLower(t)
-			}
+		if !formHasKey(ctx, key) && !uploads[key] {
+			continue
 		}
-		applyInlineWrapper(node, bindKey, rec.ID, bindType, value)
+		rec.Fields[key] = value
 	}
 }
 
-func applyInlineWrapper(node map[string]interface{}, bindKey string, recordID int64, bindType string, value string) {
-	inlineWrapper := fmt.Sprintf(
-		`<span class="cr-inline" data-cr-bind="%s" data-cr-id="%d" data-cr-type="%s" data-cr-value="%s">|</span>`,
-		html.EscapeString(bindKey),
-		recordID,
-		html.EscapeString(bindType),
-		html.EscapeString(value),
-	)
-	blockWrapper := fmt.Sprintf(
-		`<div class="cr-inline cr-inline--block" data-cr-bind="%s" data-cr-id="%d" data-cr-type="%s" data-cr-value="%s">|</div>`,
-		html.EscapeString(bindKey),
-		recordID,
-		html.EscapeString(bindType),
-		html.EscapeString(value),
-	)
-	if existing, ok := node["enclose"].(string); ok && strings.TrimSpace(existing) != "" {
-		if strings.Contains(existing, "data-cr-bind=") || strings.Contains(existing, "cr-inline") {
-			return
+// formHasKey reports whether the request posted key, even with an empty value.
+func formHasKey(ctx context.Context, key string) bool {
+	if form, ok := ctx.Value(shared.FormData).(url.Values); ok && form != nil {
+		if _, exists := form[key]; exists {
+			return true
 		}
-		node["enclose"] = strings.Replace(existing, "|", inlineWrapper, 1)
-		return
 	}
-	node["enclose"] = blockWrapper
-}
-
-func splitPath(path string) (string, string) {
-	parts := strings.Split(path, ".")
-	if len(parts) == 0 {
-		return "", ""
+	req, _ := ctx.Value(shared.Request).(*http.Request)
+	if req == nil {
+		return false
 	}
-	if len(parts) == 1 {
-		return "", parts[0]
+	if _, exists := req.Form[key]; exists {
+		return true
 	}
-	return strings.Join(parts[:len(parts)-1], "."), parts[len(parts)-1]
+	_, exists := req.PostForm[key]
+	return exists
 }
 
-func getNodeAtPath(root map[string]interface{}, path string) map[string]interface{} {
-	if path == "" {
-		return root
-	}
-	node, ok := getAtPath(root, path)
+// renderSingleNew renders an empty form prefilled with template defaults. No
+// row is inserted until the form is submitted with action=create.
+func renderSingleNew(fields Fields, ctx context.Context, errors *[]error) any {
+	template, binds, db, contentType, ok := loadTemplateAndDB(fields, ctx, errors)
 	if !ok {
-		return nil
-	}
-	typed, ok := node.(map[string]interface{})
-	if !ok {
-		return nil
-	}
-	return typed
-}
-
-func findInlineNode(root map[string]interface{}, path string) map[string]interface{} {
-	current := strings.TrimSpace(path)
-	for {
-		node := getNodeAtPath(root, current)
-		if node != nil {
-			if nodeType, ok := node["@type"].(string); ok && strings.TrimSpace(nodeType) != "" {
-				return node
-			}
-		}
-		if current == "" {
-			break
-		}
-		if idx := strings.LastIndex(current, "."); idx >= 0 {
-			current = current[:idx]
-		} else {
-			current = ""
-		}
+		return "<!-- content_records_plugin single new failed -->"
 	}
-	return getNodeAtPath(root, path)
-}
 
-func collectFlaggedBindKeys(template map[string]interface{}, flagKey string) map[string]struct{} {
-	out := map[string]struct{}{}
-	collectFlaggedBindKeysInto(template, flagKey, out)
-	return out
-}
+	fieldDefs := collectCMSFields(fields, binds)
+	rec := record{Fields: defaultValuesFromTemplate(template, binds)}
 
-func collectFlaggedBindKeysInto(node interface{}, flagKey string, out map[string]struct{}) {
-	switch typed := node.(type) {
-	case map[string]interface{}:
-		if isBoundaryPlugin(typed) {
-			return
-		}
-		if hasFlag(typed, flagKey) {
-			if bindValue, ok := typed["@bind"].(map[string]interface{}); ok {
-				if field, ok := bindValue["field"].(string); ok {
-					field = strings.TrimSpace(field)
-					if field != "" {
-						out[field] = struct{}{}
-					}
-				}
+	if req, _ := ctx.Value(shared.Request).(*http.Request); req != nil && req.Method == http.MethodPost {
+		parseRequestForm(req, errors)
+		action := strings.ToLower(strings.TrimSpace(GetInputFromContext(ctx, resolveFormParams(fields).Action)))
+		if action == "create" && fields.ReadOnly {
+			*errors = append(*errors, fmt.Errorf("content_records_plugin: %s rejected: %w", action, errReadOnly))
+		} else if action == "create" {
+			values := readFieldValuesFromContext(ctx, fieldDefs)
+			mergeUploads(ctx, fieldDefs, resolveUploadOptions(fields), values, errors)
+			if parent := resolveParentFilter(fields); parent != nil && values[parent.Bind] == "" {
+				values[parent.Bind] = parent.Value
 			}
-		}
-		for key, child := range typed {
-			if strings.HasPrefix(key, "@") {
-				continue
+			newID, err := createRecord(db, contentType, values, resolveWriteOptions(fields, binds, ctx))
+			logDebug(fields, "cms action applied", "action", action, "record_id", newID, "success", err == nil)
+			if err != nil {
+				*errors = append(*errors, fmt.Errorf("content_records_plugin: create failed: %w", err))
+				// Keep the submitted values so the form is not lost.
+				for key, value := range values {
+					rec.Fields[key] = value
+				}
+			} else {
+				if redirectIfPossible(ctx, fields, resolveListRoute(fields)) {
+					return ""
+				}
+				if created, err := fetchRecordByID(db, newID, contentType); err == nil {
+					rec = created
+				}
 			}
-			collectFlaggedBindKeysInto(child, flagKey, out)
-		}
-	case map[interface{}]interface{}:
-		normalized := normalizeInterfaceMap(typed)
-		collectFlaggedBindKeysInto(normalized, flagKey, out)
-	case []interface{}:
-		for _, child := range typed {
-			collectFlaggedBindKeysInto(child, flagKey, out)
 		}
 	}
-}
 
-func hasFlag(node map[string]interface{}, flagKey string) bool {
-	raw, ok := node[flagKey]
-	if !ok {
-		return false
+	applyComputedFields(fields, binds, []record{rec})
+	imageBinds := collectImageBinds(fields, binds)
+	var preview map[string]interface{}
+	if resolveShowPreview(fields) {
+		preview = buildList(template, binds, []record{rec}, imageBinds, false, "", "", nil, resolveTreeKeys(fields), nil)
 	}
-	switch v := raw.(type) {
-	case bool:
-		return v
-	case string:
-		val := strings.ToLower(strings.TrimSpace(v))
-		return val != "" && val != "false" && val != "0"
-	case int:
-		return v != 0
-	case int64:
-		return v != 0
-	case float64:
-		return v != 0
-	default:
-		return false
+	values := buildEditValues(rec, fieldDefs, fields, preview)
+	edit := map[string]interface{}{
+		"@type":  "<TEMPLATE>",
+		"inline": editInlineTemplate(),
+		"values": values,
+	}
+
+	return map[string]interface{}{
+		"@type": "<TREE>",
+		"10":    edit,
 	}
 }
 
-func filterTemplateByFlag(template map[string]interface{}, flagKey string) (map[string]interface{}, bool) {
-	filtered, ok := filterNodeByFlag(template, flagKey)
+// renderPreview renders the template from request values (falling back to
+// template defaults) without opening the store, so an editor can call it on
+// every keystroke.
+func renderPreview(fields Fields, ctx context.Context, errors *[]error) any {
+	template, binds, ok := loadTemplate(fields, errors)
 	if !ok {
-		return nil, false
+		return "<!-- content_records_plugin preview failed -->"
 	}
-	result, ok := filtered.(map[string]interface{})
-	if !ok {
-		return nil, false
+
+	if req, _ := ctx.Value(shared.Request).(*http.Request); req != nil && req.Method == http.MethodPost {
+		parseRequestForm(req, errors)
 	}
-	return result, true
-}
 
-func filterNodeByFlag(node interface{}, flagKey string) (interface{}, bool) {
-	switch typed := node.(type) {
-	case map[string]interface{}:
-		if hasFlag(typed, flagKey) {
-			return deepCopy(typed), true
-		}
-		if isBoundaryPlugin(typed) {
-			return nil, false
-		}
-		out := map[string]interface{}{}
-		kept := false
-		for key, child := range typed {
-			if strings.HasPrefix(key, "@") {
-				out[key] = child
-				continue
-			}
-			filtered, ok := filterNodeByFlag(child, flagKey)
-			if ok {
-				out[key] = filtered
-				kept = true
-			}
+	rec := record{Fields: defaultValuesFromTemplate(template, binds)}
+	for bindKey := range binds {
+		if value := GetInputFromContext(ctx, bindKey); value != "" {
+			rec.Fields[bindKey] = value
 		}
-		if kept {
-			for key, child := range typed {
-				if strings.HasPrefix(key, "@") {
-					continue
-				}
-				if _, exists := out[key]; exists {
-					continue
-				}
-				switch child.(type) {
-				case map[string]interface{}, map[interface{}]interface{}, []interface{}:
-					continue
-				default:
-					out[key] = child
+	}
+
+	applyComputedFields(fields, binds, []record{rec})
+	sanitizeRawFields(fields, binds, []record{rec})
+	template = applyTeaserFilter(template, fields)
+	return buildList(template, binds, []record{rec}, collectImageBinds(fields, binds), false, "", "", nil, resolveTreeKeys(fields), nil)
+}
+
+// renderTable runs data.query and renders its columns and rows as a plain
+// HTML table (or JSON with table_format = json), without templates or
+// record_fields. Cells are escaped; NULL renders as an empty cell.
+func renderTable(fields Fields, ctx context.Context, errors *[]error) any {
+	fail := func(err error) any {
+		*errors = append(*errors, fmt.Errorf("content_records_plugin: table failed: %w", err))
+		return fallbackMarkup(fields.ErrorHTML, "<!-- content_records_plugin table failed -->")
+	}
+	format := strings.ToLower(strings.TrimSpace(fields.TableFormat))
+	if format != "" && format != "html" && format != "json" {
+		return fail(fmt.Errorf("unsupported table_format %q (expected html or json)", fields.TableFormat))
+	}
+	query := resolveQuery(fields)
+	if query == "" {
+		return fail(fmt.Errorf("view table needs data.query"))
+	}
+	db, err := openStoreWith(fields, memoFor(ctx))
+	if err != nil {
+		return fail(err)
+	}
+	columns, rows, err := queryTable(db, query, resolveQueryTimeout(fields))
+	if err != nil {
+		logDebug(fields, "table query failed", "query", query, "error", err)
+		return fail(err)
+	}
+	logDebug(fields, "table query executed", "query", query, "columns", len(columns), "rows", len(rows))
+
+	if format == "json" {
+		jsonRows := make([]interface{}, len(rows))
+		for i, row := range rows {
+			cells := make([]interface{}, len(row))
+			for j, cell := range row {
+				if cell.Valid {
+					cells[j] = cell.String
 				}
 			}
-			return out, true
-		}
-		return nil, false
-	case map[interface{}]interface{}:
-		normalized := normalizeInterfaceMap(typed)
-		return filterNodeByFlag(normalized, flagKey)
-	case []interface{}:
-		out := make([]interface{}, 0, len(typed))
-		for _, child := range typed {
-			filtered, ok := filterNodeByFlag(child, flagKey)
-			if ok {
-				out = append(out, filtered)
-			}
+			jsonRows[i] = cells
 		}
-		if len(out) == 0 {
-			return nil, false
+		return writeInlineJSON(ctx, http.StatusOK, map[string]interface{}{
+			"columns": columns,
+			"rows":    jsonRows,
+		})
+	}
+	if len(rows) == 0 && strings.TrimSpace(fields.EmptyHTML) != "" {
+		return fields.EmptyHTML
+	}
+
+	class := strings.TrimSpace(fields.TableClass)
+	if class == "" {
+		class = "content-records-table"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "<table class=\"%s\">\n<thead><tr>", html.EscapeString(class))
+	for _, column := range columns {
+		b.WriteString("<th>" + html.EscapeString(column) + "</th>")
+	}
+	b.WriteString("</tr></thead>\n<tbody>\n")
+	for _, row := range rows {
+		b.WriteString("<tr>")
+		for _, cell := range row {
+			b.WriteString("<td>" + html.EscapeString(cell.String) + "</td>")
 		}
-		return out, true
-	default:
-		return nil, false
+		b.WriteString("</tr>\n")
 	}
+	b.WriteString("</tbody>\n</table>")
+	return b.String()
 }
 
-func resolveListFieldIDs(fieldDefs []cmsField, listBinds map[string]struct{}) []interface{} {
-	ids := make([]interface{}, 0, len(fieldDefs))
-	if len(listBinds) == 0 {
-		for _, field := range fieldDefs {
-			bindKey := field.Bind
-			if bindKey == "" {
-				bindKey = field.Name
-			}
-			ids = append(ids, bindKey)
-		}
-		return ids
+// queryTable runs query and returns its column names and rows as strings;
+// NULL cells are not Valid.
+func queryTable(db *sql.DB, query string, timeout time.Duration) (_ []string, _ [][]sql.NullString, err error) {
+	ctx, cancel := queryContext(timeout)
+	defer cancel()
+	defer func() { err = queryTimeoutError(ctx, timeout, err) }()
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, nil, err
 	}
-	remaining := map[string]struct{}{}
-	for key := range listBinds {
-		remaining[key] = struct{}{}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, nil, err
 	}
-	for _, field := range fieldDefs {
-		bindKey := field.Bind
-		if bindKey == "" {
-			bindKey = field.Name
-		}
-		if _, ok := listBinds[bindKey]; ok {
-			ids = append(ids, bindKey)
-			delete(remaining, bindKey)
+	var out [][]sql.NullString
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		holder := make([]interface{}, len(columns))
+		for i := range values {
+			holder[i] = &values[i]
 		}
-	}
-	if len(remaining) > 0 {
-		extra := make([]string, 0, len(remaining))
-		for key := range remaining {
-			extra = append(extra, key)
+		if err := rows.Scan(holder...); err != nil {
+			return nil, nil, err
 		}
-		sort.Strings(extra)
-		for _, key := range extra {
-			ids = append(ids, key)
+		row := make([]sql.NullString, len(columns))
+		for i, value := range values {
+			row[i].String, row[i].Valid = columnString(value)
 		}
+		out = append(out, row)
 	}
-	return ids
+	return columns, out, rows.Err()
 }
 
-func buildCMSValues(template map[string]interface{}, binds map[string]bindTarget, records []record, fields Fields, fieldDefs []cmsField, imageBinds map[string]struct{}, listBinds map[string]struct{}) map[string]interface{} {
-	view, action := resolveViewAction(fields)
-	recordIDs := make([]interface{}, 0, len(records))
-	recordsMap := make(map[string]interface{}, len(records))
-	for _, rec := range records {
-		idStr := strconv.FormatInt(rec.ID, 10)
-		recordIDs = append(recordIDs, idStr)
-
-		fieldMap := make(map[string]interface{}, len(rec.Fields))
-		for k, v := range rec.Fields {
-			fieldMap[k] = v
-		}
+// renderBindDebug returns how the template binds were resolved as JSON. It
+// only reports structure (no record values or store contents) and requires
+// data.debug = true so it cannot be enabled by view alone.
+func renderBindDebug(fields Fields, ctx context.Context, errors *[]error) any {
+	if !fields.Debug {
+		return "<!-- content_records_plugin view=debug requires data.debug = true -->"
+	}
+	template, binds, ok := loadTemplate(fields, errors)
+	if !ok {
+		return writeInlineJSON(ctx, http.StatusBadRequest, map[string]interface{}{
+			"error": "data.template must be a map",
+		})
+	}
 
-		recordsMap[idStr] = map[string]interface{}{
-			"id":     idStr,
-			"fields": fieldMap,
+	bindMap := make(map[string]interface{}, len(binds))
+	for key, target := range binds {
+		entry := map[string]interface{}{"path": target.Path}
+		if target.Attribute != "" {
+			entry["attribute"] = target.Attribute
 		}
+		bindMap[key] = entry
 	}
 
-	fieldIDsList := make([]interface{}, 0, len(fieldDefs))
-	fieldsMap := make(map[string]interface{}, len(fieldDefs))
+	fieldDefs := collectCMSFields(fields, binds)
+	schemaFields := make([]interface{}, 0, len(fieldDefs))
 	for _, field := range fieldDefs {
-		bindKey := field.Bind
-		if bindKey == "" {
-			bindKey = field.Name
-		}
-		fieldIDsList = append(fieldIDsList, bindKey)
-		fieldsMap[bindKey] = map[string]interface{}{
+		schemaFields = append(schemaFields, map[string]interface{}{
 			"name":  field.Name,
 			"label": field.Label,
 			"type":  field.Type,
-			"bind":  bindKey,
+			"bind":  field.Bind,
 			"path":  field.Path,
-		}
+			"order": field.Order,
+		})
 	}
 
-	listFieldIDs := resolveListFieldIDs(fieldDefs, listBinds)
-	for _, fieldID := range listFieldIDs {
-		idStr, ok := fieldID.(string)
-		if !ok {
-			continue
+	imageBinds := make([]string, 0)
+	for key := range collectImageBinds(fields, binds) {
+		imageBinds = append(imageBinds, key)
+	}
+	sort.Strings(imageBinds)
+
+	// Schema entries whose bind could not be found are silently skipped by
+	// collectCMSFields; list them so typos are easy to spot.
+	unmatched := make([]string, 0)
+	for _, field := range validateSchema(fields, binds).UnmatchedSchema {
+		unmatched = append(unmatched, field.Name)
+	}
+
+	return writeInlineJSON(ctx, http.StatusOK, map[string]interface{}{
+		"type":             resolveTypeName(resolveTemplateValue(fields)),
+		"binds":            bindMap,
+		"fields":           schemaFields,
+		"image_binds":      imageBinds,
+		"list_binds":       sortedKeys(collectFlaggedBindKeys(template, "@list")),
+		"teaser_binds":     sortedKeys(collectFlaggedBindKeys(template, "@teaser")),
+		"unmatched_schema": unmatched,
+	})
+}
+
+// schemaIssue names a schema entry and the bind/path it was resolved with.
+type schemaIssue struct {
+	Name string `json:"field"`
+	Bind string `json:"bind,omitempty"`
+	Path string `json:"path,omitempty"`
+	Type string `json:"type,omitempty"`
+}
+
+// schemaReport lists schema/template mismatches that are otherwise dropped
+// silently when building forms and lists.
+type schemaReport struct {
+	UnmatchedSchema     []schemaIssue // schema fields with no @bind
+	BindsWithoutSchema  []string      // @binds with no schema entry
+	UploadsWithoutDir   []schemaIssue // image/file fields but no upload_dir
+	ComputedWithoutExpr []schemaIssue // computed fields with an empty expr
+}
+
+func (r schemaReport) valid() bool {
+	return len(r.UnmatchedSchema) == 0 && len(r.BindsWithoutSchema) == 0 &&
+		len(r.UploadsWithoutDir) == 0 && len(r.ComputedWithoutExpr) == 0
+}
+
+// validateSchema compares the schema with the template binds. Binds without
+// a schema entry are only reported when a schema is configured.
+func validateSchema(fields Fields, binds map[string]bindTarget) schemaReport {
+	report := schemaReport{
+		UnmatchedSchema:     []schemaIssue{},
+		BindsWithoutSchema:  []string{},
+		UploadsWithoutDir:   []schemaIssue{},
+		ComputedWithoutExpr: []schemaIssue{},
+	}
+	schema := resolveSchema(fields)
+	covered := map[string]struct{}{}
+	for name, def := range schema {
+		bind := strings.TrimSpace(def.Bind)
+		if bind == "" && strings.TrimSpace(def.Path) != "" {
+			bind, _ = findBindByPath(binds, schemaBindPath(def))
 		}
-		if _, ok := fieldsMap[idStr]; ok {
+		if bind == "" {
+			bind = name
+		}
+		issue := schemaIssue{Name: name, Bind: strings.TrimSpace(def.Bind), Path: schemaBindPath(def), Type: def.Type}
+		if _, ok := binds[bind]; !ok {
+			report.UnmatchedSchema = append(report.UnmatchedSchema, issue)
 			continue
 		}
-		fieldsMap[idStr] = map[string]interface{}{
-			"name":  idStr,
-			"label": idStr,
-			"type":  "text",
-			"bind":  idStr,
-			"path":  "",
+		covered[bind] = struct{}{}
+		if isUploadFieldType(def.Type) && resolveUploadDir(fields) == "" {
+			report.UploadsWithoutDir = append(report.UploadsWithoutDir, issue)
+		}
+		if strings.EqualFold(strings.TrimSpace(def.Type), computedFieldType) && strings.TrimSpace(def.Expr) == "" {
+			report.ComputedWithoutExpr = append(report.ComputedWithoutExpr, issue)
+		}
+	}
+	if len(schema) > 0 {
+		for bind := range binds {
+			if _, ok := covered[bind]; !ok {
+				report.BindsWithoutSchema = append(report.BindsWithoutSchema, bind)
+			}
 		}
 	}
 
-	showPreview := resolveShowPreview(fields)
-	var preview map[string]interface{}
-	if showPreview {
-		preview = buildList(template, binds, records, imageBinds, false, "", "", nil)
+	byName := func(list []schemaIssue) {
+		sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
 	}
+	byName(report.UnmatchedSchema)
+	byName(report.UploadsWithoutDir)
+	byName(report.ComputedWithoutExpr)
+	sort.Strings(report.BindsWithoutSchema)
+	return report
+}
 
-	return map[string]interface{}{
-		"type":           resolveTypeName(template),
-		"view":           view,
-		"action":         action,
-		"store":          fields.Store,
-		"query":          resolveQuery(fields),
-		"edit_route":     resolveEditRoute(fields),
-		"record_param":   resolveRecordParam(fields),
-		"records":        recordsMap,
-		"record_ids":     recordIDs,
-		"fields":         fieldsMap,
-		"field_ids":      fieldIDsList,
-		"list_field_ids": listFieldIDs,
-		"show_preview":   showPreview,
-		"preview":        preview,
+// renderValidate is a dry run: it checks the schema against the template
+// and returns the report as JSON without opening the store.
+func renderValidate(fields Fields, ctx context.Context, errors *[]error) any {
+	_, binds, ok := loadTemplate(fields, errors)
+	if !ok {
+		return writeInlineJSON(ctx, http.StatusBadRequest, map[string]interface{}{
+			"valid": false,
+			"error": "data.template must be a map",
+		})
 	}
+	report := validateSchema(fields, binds)
+	return writeInlineJSON(ctx, http.StatusOK, map[string]interface{}{
+		"valid":                 report.valid(),
+		"type":                  resolveTypeName(resolveTemplateValue(fields)),
+		"unmatched_schema":      report.UnmatchedSchema,
+		"binds_without_schema":  report.BindsWithoutSchema,
+		"uploads_without_dir":   report.UploadsWithoutDir,
+		"computed_without_expr": report.ComputedWithoutExpr,
+	})
 }
 
-func buildEditValues(rec record, fieldDefs []cmsField, fields Fields, preview map[string]interface{}) map[string]interface{} {
-	view, action := resolveViewAction(fields)
-	fieldIDsList := make([]interface{}, 0, len(fieldDefs))
-	fieldsMap := make(map[string]interface{}, len(fieldDefs))
-	for _, field := range fieldDefs {
-		bindKey := field.Bind
-		if bindKey == "" {
-			bindKey = field.Name
+// validateConfig is data.validate_only: it checks the settings a render
+// would reject, plus the schema report, without opening the store, seeding,
+// reading the request or writing files.
+func validateConfig(fields Fields) []error {
+	var errs []error
+	report := func(err error) {
+		if err != nil {
+			errs = append(errs, err)
 		}
-		fieldIDsList = append(fieldIDsList, bindKey)
-		fieldsMap[bindKey] = map[string]interface{}{
-			"name":  field.Name,
-			"label": field.Label,
-			"type":  field.Type,
-			"bind":  bindKey,
-			"path":  field.Path,
+	}
+
+	view, action := resolveViewAction(fields)
+	if action != "validate" && strings.TrimSpace(fields.Store) == "" {
+		report(fmt.Errorf("content_records_plugin: data.store is required"))
+	}
+	dialect, err := resolveDialect(fields.Driver)
+	report(err)
+	if dialect != nil {
+		_, err = resolvePragmas(fields.Pragmas, dialect)
+		report(err)
+	}
+	layout, err := resolveColumnLayout(fields)
+	report(err)
+	_, err = resolveIDStrategy(fields.IDStrategy)
+	report(err)
+	_, err = parseFileModes(fields.DirMode, fields.FileMode)
+	report(err)
+	_, err = resolveListOutput(fields)
+	report(err)
+	if fields.RedirectStatus != 0 && resolveRedirectStatus(fields) != fields.RedirectStatus {
+		report(fmt.Errorf("content_records_plugin: redirect_status must be 301, 302, 303, 307 or 308, got %d", fields.RedirectStatus))
+	}
+	if _, ok := parseDelay(fields.QueryTimeout); !ok && strings.TrimSpace(fields.QueryTimeout) != "" {
+		report(fmt.Errorf("content_records_plugin: query_timeout: expected a duration such as 2s or milliseconds, got %q", fields.QueryTimeout))
+	}
+
+	if action == "health" || action == "maintenance" || view == "table" {
+		return errs
+	}
+	_, binds, ok := loadTemplate(fields, &errs)
+	if !ok {
+		return errs
+	}
+	if len(fields.Where) > 0 || strings.TrimSpace(fields.OrderBy) != "" || fields.Limit > 0 {
+		if resolveQuery(fields) != "" {
+			report(fmt.Errorf("content_records_plugin: data.where, order_by and limit cannot be combined with data.query"))
+		} else if _, _, err := compileRecordQuery(fields, resolveTypeName(resolveTemplateValue(fields)), layout); err != nil {
+			report(fmt.Errorf("content_records_plugin: %w", err))
 		}
 	}
 
-	recordID := strconv.FormatInt(rec.ID, 10)
-	showPreview := resolveShowPreview(fields)
-	return map[string]interface{}{
-		"type":         resolveTypeName(resolveTemplateValue(fields)),
-		"view":         view,
-		"action":       action,
-		"store":        fields.Store,
-		"record_id":    recordID,
-		"show_preview": showPreview,
-		"record": map[string]interface{}{
-			"id":     recordID,
-			"fields": mapStringToInterface(rec.Fields),
-		},
-		"fields":    fieldsMap,
-		"field_ids": fieldIDsList,
-		"preview":   preview,
+	schema := validateSchema(fields, binds)
+	for _, issue := range schema.UnmatchedSchema {
+		report(fmt.Errorf("content_records_plugin: schema field %s matches no @bind", issue.Name))
+	}
+	for _, issue := range schema.UploadsWithoutDir {
+		report(fmt.Errorf("content_records_plugin: %s field %s needs data.upload_dir", issue.Type, issue.Name))
 	}
+	for _, issue := range schema.ComputedWithoutExpr {
+		report(fmt.Errorf("content_records_plugin: computed field %s has no expr", issue.Name))
+	}
+	return errs
 }
 
-func mapStringToInterface(in map[string]string) map[string]interface{} {
-	out := make(map[string]interface{}, len(in))
-	for k, v := range in {
-		out[k] = v
+func sortedKeys(set map[string]struct{}) []string {
+	out := make([]string, 0, len(set))
+	for key := range set {
+		out = append(out, key)
 	}
+	sort.Strings(out)
 	return out
 }
 
-func cmsInlineTemplate() string {
-	return `
-<div class="content-records-dashboard" data-theme="dark">
-  <div class="shell">
-    <header class="hero">
-      <div class="hero-bar">
-        <div class="badge">CMS</div>
-      </div>
-      <div class="hero-brand">
-        <div class="hero-text">
-          <h1>Content Records</h1>
-          <p>Type: {{ .type }} · Store: {{ .store }}</p>
-        </div>
-        <div class="hero-actions">
-          {{ if .edit_route }}
-            <form method="get" action="{{ .edit_route }}">
-              <button class="secondary" type="submit">New</button>
-            </form>
-          {{ else }}
-            <span class="subhead">Set edit_route to enable New</span>
-          {{ end }}
-        </div>
-      </div>
-    </header>
+// exportBatchSize is how many records renderExport loads and flushes at a
+// time; only the id list and one batch are held in memory.
+var exportBatchSize = 200
 
-    <div class="grid">
-      <section class="panel">
-        <div class="panel-header">
-          <h2>Records</h2>
-          {{ if .query }}
-            <div class="mono">Query: {{ .query }}</div>
-          {{ end }}
-        </div>
-        <div class="table-wrap">
-          <table class="content-records-table">
-            <thead>
-              <tr>
-                <th>ID</th>
-                <th>Type</th>
-                <th>Fields</th>
-                <th>Actions</th>
-              </tr>
-            </thead>
-            <tbody>
-              {{ range $i, $id := .record_ids }}
-                {{ $rec := index $.records $id }}
-                <tr>
-                  <td data-label="ID">{{ $id }}</td>
-                  <td data-label="Type">{{ $.type }}</td>
-                  <td data-label="Fields">
-                    <div class="content-records-fields">
-                      {{ range $j, $fieldID := $.list_field_ids }}
-                        {{ $def := index $.fields $fieldID }}
-                        <div class="content-records-field-row">
-                          <span class="content-records-field-label">{{ $def.label }}</span>
-                          <span class="content-records-field-value">{{ index $rec.fields $fieldID }}</span>
-                        </div>
-                      {{ end }}
-                    </div>
-                  </td>
-                  <td data-label="Actions">
-                    <div class="row-actions">
-                      {{ if $.edit_route }}
-                        <form method="get" action="{{ $.edit_route }}">
-                          <input type="hidden" name="{{ $.record_param }}" value="{{ $id }}">
-                          <button class="secondary" type="submit">Edit</button>
-                        </form>
-                      {{ end }}
-                      <form method="post">
-                        <input type="hidden" name="action" value="delete">
-                        <input type="hidden" name="record_id" value="{{ $id }}">
-                        <button class="danger" type="submit">Delete</button>
-                      </form>
-                    </div>
-                  </td>
-                </tr>
-              {{ else }}
-                <tr>
-                  <td class="content-records-empty" colspan="4">No records found.</td>
-                </tr>
-              {{ end }}
-            </tbody>
-          </table>
-        </div>
-      </section>
+// renderExport streams the records selected like a list render (ids, query,
+// type and filters) to the response as JSON or CSV. Records are loaded and
+// written batch by batch and the response is flushed after each batch; a
+// cancelled request context stops the stream.
+func renderExport(fields Fields, ctx context.Context, errors *[]error) any {
+	_, binds, db, contentType, ok := loadTemplateAndDB(fields, ctx, errors)
+	if !ok {
+		return "<!-- content_records_plugin export failed -->"
+	}
+	format := strings.ToLower(strings.TrimSpace(fields.ExportFormat))
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "csv" {
+		*errors = append(*errors, fmt.Errorf("content_records_plugin: unsupported export_format %q (expected json or csv)", fields.ExportFormat))
+		return "<!-- content_records_plugin export failed -->"
+	}
+	writer, _ := ctx.Value(shared.ResponseWriter).(http.ResponseWriter)
+	if writer == nil {
+		*errors = append(*errors, fmt.Errorf("content_records_plugin: export needs a response writer"))
+		return "<!-- content_records_plugin export failed -->"
+	}
 
-      {{ if .show_preview }}
-      <section class="panel content-records-preview">
-        <h2>Preview</h2>
-        <div class="content-records-preview__body">
-          {{ .preview }}
-        </div>
-      </section>
-      {{ end }}
-    </div>
-  </div>
-</div>
-`
+	ids, err := scopedRecordIDs(db, fields, contentType, resolveFilters(fields, binds, ctx))
+	if err != nil {
+		*errors = append(*errors, fmt.Errorf("content_records_plugin: export failed: %w", err))
+		return "<!-- content_records_plugin export failed -->"
+	}
+	columns := exportColumns(fields, binds)
+
+	name := contentType
+	if name == "" {
+		name = "records"
+	}
+	if format == "csv" {
+		writer.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	}
+	writer.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, sanitizeFilename(name), format))
+	writer.WriteHeader(http.StatusOK)
+
+	enc := newExportEncoder(writer, format, columns)
+	written := 0
+	for start := 0; start < len(ids); start += exportBatchSize {
+		if err := exportCancelled(ctx); err != nil {
+			logDebug(fields, "export aborted", "written", written, "total", len(ids), "error", err)
+			return ""
+		}
+		end := start + exportBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		records, err := fetchRecordsByIDs(db, ids[start:end], contentType)
+		var stamps map[int64]recordStamps
+		if err == nil {
+			stamps, err = fetchRecordStamps(db, ids[start:end])
+		}
+		if err != nil {
+			*errors = append(*errors, fmt.Errorf("content_records_plugin: export failed after %d records: %w", written, err))
+			return ""
+		}
+		applyComputedFields(fields, binds, records)
+		for _, rec := range records {
+			if err := enc.write(rec, stamps[rec.ID]); err != nil {
+				logDebug(fields, "export aborted", "written", written, "total", len(ids), "error", err)
+				return ""
+			}
+			written++
+		}
+		if err := enc.flush(); err != nil {
+			logDebug(fields, "export aborted", "written", written, "total", len(ids), "error", err)
+			return ""
+		}
+	}
+	if err := enc.close(); err != nil {
+		logDebug(fields, "export aborted", "written", written, "total", len(ids), "error", err)
+	}
+	logDebug(fields, "export written", "format", format, "records", written)
+	return ""
 }
 
-func editInlineTemplate() string {
-	return `
-<div class="content-records-dashboard" data-theme="dark">
-  <div class="shell">
-    <header class="hero">
-      <div class="hero-bar">
-        <div class="badge">CMS</div>
-      </div>
-      <div class="hero-brand">
-        <div class="hero-text">
-          <h1>Edit Record</h1>
-          <p>Record: {{ .record_id }} · Type: {{ .type }}</p>
-        </div>
-      </div>
-    </header>
+// exportCancelled returns the error of the plugin or request context once
+// either is done, e.g. because the client disconnected.
+func exportCancelled(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if req, _ := ctx.Value(shared.Request).(*http.Request); req != nil {
+		return req.Context().Err()
+	}
+	return nil
+}
 
-    <div class="grid">
-      <section class="panel">
-        <div class="panel-header">
-          <h2>Fields</h2>
-        </div>
-        <form method="post" enctype="multipart/form-data">
-          <input type="hidden" name="record_id" value="{{ .record_id }}">
-          {{ range $j, $fieldID := .field_ids }}
-            {{ $def := index $.fields $fieldID }}
-            <div class="field" data-field="{{ $fieldID }}">
-              <label>{{ $def.label }}</label>
-              {{ if eq $def.type "image" }}
-                <div class="note-row">
-                  <span class="mono">Current: {{ index $.record.fields $fieldID }}</span>
-                </div>
-                <input type="hidden" name="{{ $fieldID }}" value="{{ index $.record.fields $fieldID }}">
-                <input type="file" name="{{ $fieldID }}">
-              {{ else if eq $def.type "markdown" }}
-                <textarea name="{{ $fieldID }}">{{ index $.record.fields $fieldID }}</textarea>
-              {{ else }}
-                <input type="text" name="{{ $fieldID }}" value="{{ index $.record.fields $fieldID }}">
-              {{ end }}
-            </div>
-          {{ end }}
+// exportColumns returns the field columns of an export in a stable order:
+// schema fields in schema order (image alt/caption keys after their image),
+// then the remaining binds sorted by name.
+func exportColumns(fields Fields, binds map[string]bindTarget) []string {
+	columns := make([]string, 0, len(binds))
+	seen := map[string]bool{}
+	add := func(key string) {
+		if key != "" && !seen[key] {
+			seen[key] = true
+			columns = append(columns, key)
+		}
+	}
+	if len(resolveSchema(fields)) > 0 {
+		for _, def := range collectCMSFields(fields, binds) {
+			add(def.Bind)
+			add(def.AltBind)
+			add(def.CaptionBind)
+		}
+	}
+	rest := make([]string, 0, len(binds))
+	for bind := range binds {
+		if !seen[bind] {
+			rest = append(rest, bind)
+		}
+	}
+	sort.Strings(rest)
+	for _, bind := range rest {
+		add(bind)
+	}
+	return columns
+}
+
+// recordStamps are a record's created_at and updated_at as stored.
+type recordStamps struct {
+	Created string
+	Updated string
+}
+
+// fetchRecordStamps returns the timestamps of ids, keyed by id.
+func fetchRecordStamps(db *sql.DB, ids []int64) (map[int64]recordStamps, error) {
+	stamps := make(map[int64]recordStamps, len(ids))
+	if len(ids) == 0 {
+		return stamps, nil
+	}
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := db.Query(`SELECT id, created_at, updated_at FROM records WHERE id IN (`+placeholders(len(ids))+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var created, updated interface{}
+		if err := rows.Scan(&id, &created, &updated); err != nil {
+			return nil, err
+		}
+		stamps[id] = recordStamps{Created: stampString(created), Updated: stampString(updated)}
+	}
+	return stamps, rows.Err()
+}
+
+// stampString formats a DATETIME column as the store wrote it,
+// "2006-01-02 15:04:05"; drivers that parse it return a time.Time.
+func stampString(value interface{}) string {
+	if t, ok := value.(time.Time); ok {
+		return t.UTC().Format("2006-01-02 15:04:05")
+	}
+	s, _ := columnString(value)
+	return s
+}
+
+// exportEncoder writes records as a JSON array or CSV rows (id, created_at,
+// updated_at, then one column per field).
+type exportEncoder struct {
+	w       http.ResponseWriter
+	csv     *csv.Writer
+	columns []string
+	count   int
+}
+
+func newExportEncoder(w http.ResponseWriter, format string, columns []string) *exportEncoder {
+	enc := &exportEncoder{w: w, columns: columns}
+	if format == "csv" {
+		enc.csv = csv.NewWriter(w)
+		_ = enc.csv.Write(append([]string{"id", "created_at", "updated_at"}, columns...))
+	}
+	return enc
+}
+
+func (e *exportEncoder) write(rec record, stamps recordStamps) error {
+	if e.csv != nil {
+		row := make([]string, 0, len(e.columns)+3)
+		row = append(row, strconv.FormatInt(rec.ID, 10), stamps.Created, stamps.Updated)
+		for _, column := range e.columns {
+			row = append(row, rec.Fields[column])
+		}
+		return e.csv.Write(row)
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `{"id":%d,"created_at":%s,"updated_at":%s,"fields":{`, rec.ID, jsonString(stamps.Created), jsonString(stamps.Updated))
+	for i, key := range e.fieldOrder(rec) {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(jsonString(key) + ":" + jsonString(rec.Fields[key]))
+	}
+	b.WriteString("}}")
+	sep := ",\n"
+	if e.count == 0 {
+		sep = "[\n"
+	}
+	e.count++
+	_, err := io.WriteString(e.w, sep+b.String())
+	return err
+}
+
+// fieldOrder lists the record's fields for a JSON object: the export
+// columns first, then stored keys without a bind, sorted.
+func (e *exportEncoder) fieldOrder(rec record) []string {
+	keys := make([]string, 0, len(rec.Fields))
+	seen := make(map[string]bool, len(e.columns))
+	for _, column := range e.columns {
+		seen[column] = true
+		if _, ok := rec.Fields[column]; ok {
+			keys = append(keys, column)
+		}
+	}
+	var extra []string
+	for key := range rec.Fields {
+		if !seen[key] {
+			extra = append(extra, key)
+		}
+	}
+	sort.Strings(extra)
+	return append(keys, extra...)
+}
+
+// jsonString encodes s as a JSON string literal.
+func jsonString(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+// flush pushes everything written so far to the client.
+func (e *exportEncoder) flush() error {
+	if e.csv != nil {
+		e.csv.Flush()
+		if err := e.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if flusher, ok := e.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+func (e *exportEncoder) close() error {
+	if e.csv == nil {
+		end := "\n]\n"
+		if e.count == 0 {
+			end = "[]\n"
+		}
+		if _, err := io.WriteString(e.w, end); err != nil {
+			return err
+		}
+	}
+	return e.flush()
+}
+
+// defaultFeedLimit caps the items of a feed when data.feed.limit is unset.
+const defaultFeedLimit = 20
+
+// renderFeed writes the records selected like a list render as an RSS 2.0
+// or Atom feed. data.feed names the binds behind each item element and the
+// channel metadata; pubdates parse with data.feed.date_format, or the
+// typed date layouts when it is empty.
+func renderFeed(fields Fields, ctx context.Context, errors *[]error) any {
+	_, binds, db, contentType, ok := loadTemplateAndDB(fields, ctx, errors)
+	if !ok {
+		return "<!-- content_records_plugin feed failed -->"
+	}
+	feed := fields.Feed
+	format := strings.ToLower(strings.TrimSpace(feed.Format))
+	if format == "" {
+		format = "rss"
+	}
+	if format != "rss" && format != "atom" {
+		*errors = append(*errors, fmt.Errorf("content_records_plugin: unsupported feed.format %q (expected rss or atom)", feed.Format))
+		return "<!-- content_records_plugin feed failed -->"
+	}
+	if strings.TrimSpace(feed.Title) == "" || strings.TrimSpace(feed.Link) == "" {
+		*errors = append(*errors, fmt.Errorf("content_records_plugin: feed needs data.feed.title and data.feed.link"))
+		return "<!-- content_records_plugin feed failed -->"
+	}
+	writer, _ := ctx.Value(shared.ResponseWriter).(http.ResponseWriter)
+	if writer == nil {
+		*errors = append(*errors, fmt.Errorf("content_records_plugin: feed needs a response writer"))
+		return "<!-- content_records_plugin feed failed -->"
+	}
+
+	ids, err := scopedRecordIDs(db, fields, contentType, resolveFilters(fields, binds, ctx))
+	if err != nil {
+		*errors = append(*errors, fmt.Errorf("content_records_plugin: feed failed: %w", err))
+		return "<!-- content_records_plugin feed failed -->"
+	}
+	limit := feed.Limit
+	if limit <= 0 {
+		limit = defaultFeedLimit
+	}
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+	records, err := fetchRecordsByIDs(db, ids, contentType)
+	if err != nil {
+		*errors = append(*errors, fmt.Errorf("content_records_plugin: feed failed: %w", err))
+		return "<!-- content_records_plugin feed failed -->"
+	}
+	applyComputedFields(fields, binds, records)
+	items := buildFeedItems(feed, records)
+
+	// The channel date is the newest item date, else the type's last write.
+	var updated time.Time
+	for _, item := range items {
+		if item.Date.After(updated) {
+			updated = item.Date
+		}
+	}
+	if updated.IsZero() {
+		if _, lastModified, err := fetchTypeStats(db, contentType); err == nil {
+			updated = lastModified
+		}
+	}
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+
+	var doc interface{}
+	if format == "atom" {
+		writer.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		doc = buildAtomFeed(feed, items, updated)
+	} else {
+		writer.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+		doc = buildRSSFeed(feed, items, updated)
+	}
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		*errors = append(*errors, fmt.Errorf("content_records_plugin: feed failed: %w", err))
+		return "<!-- content_records_plugin feed failed -->"
+	}
+	writer.WriteHeader(http.StatusOK)
+	if _, err := io.WriteString(writer, xml.Header+string(data)+"\n"); err != nil {
+		logDebug(fields, "feed aborted", "error", err)
+		return ""
+	}
+	logDebug(fields, "feed written", "format", format, "items", len(items))
+	return ""
+}
+
+// feedItem is one record mapped through data.feed.
+type feedItem struct {
+	ID          string // stable id: the link, else <feed link>#<record id>
+	Title       string
+	Link        string
+	Description string
+	Date        time.Time // zero when the pubdate bind is empty or does not parse
+}
+
+func buildFeedItems(feed FeedConfig, records []record) []feedItem {
+	titleBind := strings.TrimSpace(feed.ItemTitle)
+	if titleBind == "" {
+		titleBind = "title"
+	}
+	base, _ := url.Parse(strings.TrimSpace(feed.Link))
+	items := make([]feedItem, 0, len(records))
+	for _, rec := range records {
+		item := feedItem{
+			Title:       rec.Fields[titleBind],
+			Description: rec.Fields[strings.TrimSpace(feed.ItemDescription)],
+		}
+		if link := strings.TrimSpace(rec.Fields[strings.TrimSpace(feed.ItemLink)]); link != "" {
+			item.Link = link
+			if ref, err := url.Parse(link); err == nil && base != nil {
+				item.Link = base.ResolveReference(ref).String()
+			}
+		}
+		if bind := strings.TrimSpace(feed.ItemPubDate); bind != "" {
+			item.Date = parseFeedDate(rec.Fields[bind], feed.DateFormat)
+		}
+		item.ID = item.Link
+		if item.ID == "" {
+			ref := strconv.FormatInt(rec.ID, 10)
+			if rec.UID != "" {
+				ref = rec.UID
+			}
+			item.ID = strings.TrimSpace(feed.Link) + "#" + ref
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// parseFeedDate parses a stored date with layout, or any typed date layout
+// when layout is empty. Values that don't parse give the zero time.
+func parseFeedDate(value string, layout string) time.Time {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}
+	}
+	layouts := typedDateLayouts
+	if strings.TrimSpace(layout) != "" {
+		layouts = []string{layout}
+	}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title,omitempty"`
+	Link        string  `xml:"link,omitempty"`
+	Description string  `xml:"description,omitempty"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate,omitempty"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+func buildRSSFeed(feed FeedConfig, items []feedItem, updated time.Time) rssFeed {
+	description := feed.Description
+	if strings.TrimSpace(description) == "" {
+		description = feed.Title
+	}
+	out := rssFeed{Version: "2.0", Channel: rssChannel{
+		Title:         feed.Title,
+		Link:          feed.Link,
+		Description:   description,
+		LastBuildDate: updated.Format(time.RFC1123Z),
+	}}
+	for _, item := range items {
+		entry := rssItem{
+			Title:       item.Title,
+			Link:        item.Link,
+			Description: item.Description,
+			GUID:        rssGUID{IsPermaLink: item.Link != "", Value: item.ID},
+		}
+		if !item.Date.IsZero() {
+			entry.PubDate = item.Date.Format(time.RFC1123Z)
+		}
+		out.Channel.Items = append(out.Channel.Items, entry)
+	}
+	return out
+}
+
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	ID       string      `xml:"id"`
+	Updated  string      `xml:"updated"`
+	Author   atomAuthor  `xml:"author"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title   string     `xml:"title"`
+	ID      string     `xml:"id"`
+	Updated string     `xml:"updated"`
+	Links   []atomLink `xml:"link,omitempty"`
+	Summary string     `xml:"summary,omitempty"`
+}
+
+func buildAtomFeed(feed FeedConfig, items []feedItem, updated time.Time) atomFeed {
+	author := feed.Author
+	if strings.TrimSpace(author) == "" {
+		author = feed.Title
+	}
+	out := atomFeed{
+		Title:    feed.Title,
+		Subtitle: feed.Description,
+		ID:       feed.Link,
+		Updated:  updated.UTC().Format(time.RFC3339),
+		Author:   atomAuthor{Name: author},
+		Links:    []atomLink{{Href: feed.Link, Rel: "alternate"}},
+	}
+	for _, item := range items {
+		entry := atomEntry{
+			Title:   item.Title,
+			ID:      item.ID,
+			Summary: item.Description,
+		}
+		// Atom requires updated on every entry; undated items take the feed's.
+		date := item.Date
+		if date.IsZero() {
+			date = updated
+		}
+		entry.Updated = date.UTC().Format(time.RFC3339)
+		if item.Link != "" {
+			entry.Links = []atomLink{{Href: item.Link, Rel: "alternate"}}
+		}
+		out.Entries = append(out.Entries, entry)
+	}
+	return out
+}
+
+// requiredTables are the tables initSchema creates and every view relies on.
+var requiredTables = []string{"records", "record_fields", "record_field_versions"}
+
+// renderHistory lists the stored versions of one record as JSON.
+func renderHistory(fields Fields, ctx context.Context, errors *[]error) any {
+	_, _, db, contentType, ok := loadTemplateAndDB(fields, ctx, errors)
+	if !ok {
+		return "<!-- content_records_plugin history failed -->"
+	}
+	recordID := resolveSingleRecord(db, fields, ctx)
+	if recordID == 0 {
+		return writeInlineJSON(ctx, http.StatusBadRequest, map[string]interface{}{
+			"error": "record id is required",
+		})
+	}
+	if notModified(ctx, db, fields, contentType) {
+		return ""
+	}
+	if _, err := fetchRecordByID(db, recordID, contentType); err == errRecordNotFound {
+		return writeInlineJSON(ctx, http.StatusNotFound, map[string]interface{}{
+			"error": errRecordNotFound.Error(),
+		})
+	} else if err != nil {
+		*errors = append(*errors, fmt.Errorf("content_records_plugin: fetch record failed: %w", err))
+		return writeInlineJSON(ctx, http.StatusInternalServerError, map[string]interface{}{
+			"error": "history failed",
+		})
+	}
+
+	versions, err := fetchRecordVersions(db, recordID)
+	if err != nil {
+		*errors = append(*errors, fmt.Errorf("content_records_plugin: fetch versions failed: %w", err))
+		return writeInlineJSON(ctx, http.StatusInternalServerError, map[string]interface{}{
+			"error": "history failed",
+		})
+	}
+	items := make([]interface{}, 0, len(versions))
+	for _, v := range versions {
+		items = append(items, map[string]interface{}{
+			"version":    v.Version,
+			"created_at": v.CreatedAt,
+			"created_by": v.CreatedBy,
+			"fields":     mapStringToInterface(v.Fields),
+		})
+	}
+	return writeInlineJSON(ctx, http.StatusOK, map[string]interface{}{
+		"record_id": strconv.FormatInt(recordID, 10),
+		"versions":  items,
+	})
+}
+
+// renderRestoreVersion handles a POST with record_id and version and copies
+// that snapshot back into the live fields.
+func renderRestoreVersion(fields Fields, ctx context.Context, errors *[]error) any {
+	req, _ := ctx.Value(shared.Request).(*http.Request)
+	if req == nil || req.Method != http.MethodPost {
+		return writeInlineJSON(ctx, http.StatusMethodNotAllowed, map[string]interface{}{
+			"error": "restore_version requires POST",
+		})
+	}
+	if fields.ReadOnly {
+		return writeInlineJSON(ctx, http.StatusForbidden, map[string]interface{}{
+			"error": errReadOnly.Error(),
+		})
+	}
+	_, binds, db, contentType, ok := loadTemplateAndDB(fields, ctx, errors)
+	if !ok {
+		return "<!-- content_records_plugin restore failed -->"
+	}
+	parseRequestForm(req, errors)
+
+	recordID := lookupRecordRef(db, GetInputFromContext(ctx, "record_id"))
+	if recordID == 0 {
+		recordID = resolveSingleRecord(db, fields, ctx)
+	}
+	version, err := strconv.Atoi(strings.TrimSpace(GetInputFromContext(ctx, "version")))
+	if recordID == 0 || err != nil || version <= 0 {
+		return writeInlineJSON(ctx, http.StatusBadRequest, map[string]interface{}{
+			"error": "record_id and version are required",
+		})
+	}
+
+	if err := restoreRecordVersion(db, recordID, contentType, version, resolveWriteOptions(fields, binds, ctx)); err != nil {
+		logDebug(fields, "restore failed", "record_id", recordID, "version", version, "error", err)
+		if err == errRecordNotFound {
+			return writeInlineJSON(ctx, http.StatusNotFound, map[string]interface{}{
+				"error": errRecordNotFound.Error(),
+			})
+		}
+		*errors = append(*errors, fmt.Errorf("content_records_plugin: restore failed: %w", err))
+		return writeInlineJSON(ctx, http.StatusBadRequest, map[string]interface{}{
+			"error": "restore failed",
+		})
+	}
+	logDebug(fields, "version restored", "record_id", recordID, "version", version)
+	return writeInlineJSON(ctx, http.StatusOK, map[string]interface{}{
+		"status":    "ok",
+		"record_id": strconv.FormatInt(recordID, 10),
+		"version":   version,
+	})
+}
+
+// renderHealth is a readiness probe: it opens the store, runs SELECT 1 and
+// checks the schema without loading records or seeding.
+func renderHealth(fields Fields, ctx context.Context, errors *[]error) any {
+	tables := map[string]interface{}{}
+	for _, table := range requiredTables {
+		tables[table] = false
+	}
+	fail := func(err error) any {
+		logDebug(fields, "health check failed", "store", storeLabel(fields), "error", err)
+		return writeInlineJSON(ctx, http.StatusServiceUnavailable, map[string]interface{}{
+			"status": "error",
+			"tables": tables,
+			"error":  err.Error(),
+		})
+	}
+
+	db, err := openStore(fields)
+	if err != nil {
+		return fail(err)
+	}
+
+	var one int
+	if err := db.QueryRow(`SELECT 1`).Scan(&one); err != nil {
+		return fail(err)
+	}
+
+	var missing []string
+	for _, table := range requiredTables {
+		var name string
+		err := db.QueryRow(dialectOf(db).TableExists, table).Scan(&name)
+		switch {
+		case err == sql.ErrNoRows:
+			missing = append(missing, table)
+		case err != nil:
+			return fail(err)
+		default:
+			tables[table] = true
+		}
+	}
+	if len(missing) > 0 {
+		return fail(fmt.Errorf("missing tables: %s", strings.Join(missing, ", ")))
+	}
+
+	return writeInlineJSON(ctx, http.StatusOK, map[string]interface{}{
+		"status": "ok",
+		"tables": tables,
+		"error":  nil,
+	})
+}
+
+// maintenanceMu lets one maintenance run at a time; VACUUM needs the store
+// to itself anyway.
+var maintenanceMu sync.Mutex
+
+// renderMaintenance runs VACUUM and ANALYZE on a sqlite store and reports
+// page stats before and after as JSON. It only answers POSTs carrying
+// data.maintenance_token as a bearer token, and with data.checkpoint_wal
+// also checkpoints and truncates the WAL first.
+func renderMaintenance(fields Fields, ctx context.Context, errors *[]error) any {
+	fail := func(status int, err error) any {
+		logDebug(fields, "maintenance failed", "store", storeLabel(fields), "error", err)
+		return writeInlineJSON(ctx, status, map[string]interface{}{"ok": false, "error": err.Error()})
+	}
+	req, _ := ctx.Value(shared.Request).(*http.Request)
+	if req == nil || req.Method != http.MethodPost {
+		return fail(http.StatusMethodNotAllowed, fmt.Errorf("maintenance requires POST"))
+	}
+	if fields.ReadOnly {
+		return fail(http.StatusForbidden, errReadOnly)
+	}
+	token := strings.TrimSpace(fields.MaintenanceToken)
+	if token == "" {
+		return fail(http.StatusForbidden, fmt.Errorf("maintenance is disabled; set data.maintenance_token"))
+	}
+	if !bearerTokenMatches(req, token) {
+		return fail(http.StatusUnauthorized, fmt.Errorf("invalid maintenance token"))
+	}
+	if dialect, err := resolveDialect(fields.Driver); err != nil || dialect != sqliteDialect {
+		return fail(http.StatusBadRequest, fmt.Errorf("maintenance is only supported for sqlite stores"))
+	}
+	if isMemoryStore(fields.Store) {
+		return fail(http.StatusBadRequest, fmt.Errorf("maintenance does not run on in-memory stores"))
+	}
+	db, err := openStore(fields)
+	if err != nil {
+		return fail(http.StatusServiceUnavailable, err)
+	}
+	if !maintenanceMu.TryLock() {
+		return fail(http.StatusConflict, fmt.Errorf("maintenance is already running"))
+	}
+	defer maintenanceMu.Unlock()
+
+	// Every statement runs on one connection; VACUUM retries like a write
+	// while other connections hold the store locked.
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fail(http.StatusServiceUnavailable, err)
+	}
+	defer conn.Close()
+	opts := resolveWriteOptions(fields, nil, ctx)
+	start := time.Now()
+	before, err := sqliteStoreStats(ctx, conn)
+	if err != nil {
+		return fail(http.StatusInternalServerError, err)
+	}
+	result := map[string]interface{}{"ok": true, "before": before}
+	if fields.CheckpointWAL && before["journal_mode"] == "wal" {
+		var busy, logFrames, checkpointed int
+		err := withRetry(opts, func() error {
+			return conn.QueryRowContext(ctx, `PRAGMA wal_checkpoint(TRUNCATE)`).Scan(&busy, &logFrames, &checkpointed)
+		})
+		if err != nil {
+			return fail(http.StatusInternalServerError, fmt.Errorf("wal_checkpoint: %w", err))
+		}
+		result["checkpoint"] = map[string]interface{}{"busy": busy == 1, "log_frames": logFrames, "checkpointed": checkpointed}
+	}
+	for _, stmt := range []string{"VACUUM", "ANALYZE"} {
+		err := withRetry(opts, func() error {
+			_, err := conn.ExecContext(ctx, stmt)
+			return err
+		})
+		if err != nil {
+			return fail(http.StatusServiceUnavailable, fmt.Errorf("%s: %w", stmt, err))
+		}
+	}
+	after, err := sqliteStoreStats(ctx, conn)
+	if err != nil {
+		return fail(http.StatusInternalServerError, err)
+	}
+	duration := time.Since(start)
+	result["after"] = after
+	result["duration_ms"] = duration.Milliseconds()
+	logDebug(fields, "maintenance done", "store", storeLabel(fields), "duration", duration,
+		"pages_before", before["page_count"], "pages_after", after["page_count"])
+	return writeInlineJSON(ctx, http.StatusOK, result)
+}
+
+// renderMigrateField handles action = migrate_field: a POST with from, to and
+// mode (rename or copy) moves a bind key across every record of the
+// template's type, e.g. after a schema rename. It is authorized like
+// maintenance, with data.maintenance_token as a bearer token.
+func renderMigrateField(fields Fields, ctx context.Context, errors *[]error) any {
+	fail := func(status int, err error) any {
+		logDebug(fields, "migrate_field failed", "store", storeLabel(fields), "error", err)
+		return writeInlineJSON(ctx, status, map[string]interface{}{"ok": false, "error": err.Error()})
+	}
+	req, _ := ctx.Value(shared.Request).(*http.Request)
+	if req == nil || req.Method != http.MethodPost {
+		return fail(http.StatusMethodNotAllowed, fmt.Errorf("migrate_field requires POST"))
+	}
+	if fields.ReadOnly {
+		return fail(http.StatusForbidden, errReadOnly)
+	}
+	token := strings.TrimSpace(fields.MaintenanceToken)
+	if token == "" {
+		return fail(http.StatusForbidden, fmt.Errorf("migrate_field is disabled; set data.maintenance_token"))
+	}
+	if !bearerTokenMatches(req, token) {
+		return fail(http.StatusUnauthorized, fmt.Errorf("invalid maintenance token"))
+	}
+	if layout, err := resolveColumnLayout(fields); err != nil || layout != nil {
+		return fail(http.StatusBadRequest, fmt.Errorf("migrate_field only supports storage = fields"))
+	}
+	_, binds, db, contentType, ok := loadTemplateAndDB(fields, ctx, errors)
+	if !ok {
+		return "<!-- content_records_plugin migrate_field failed -->"
+	}
+	parseRequestForm(req, errors)
+
+	from := strings.TrimSpace(GetInputFromContext(ctx, "from"))
+	to := strings.TrimSpace(GetInputFromContext(ctx, "to"))
+	for _, key := range []string{from, to} {
+		if !identPattern.MatchString(key) {
+			return fail(http.StatusBadRequest, fmt.Errorf("invalid bind key %q: only letters, digits and _ are allowed", key))
+		}
+	}
+	if from == to {
+		return fail(http.StatusBadRequest, fmt.Errorf("from and to must differ"))
+	}
+	mode := strings.ToLower(strings.TrimSpace(GetInputFromContext(ctx, "mode")))
+	switch mode {
+	case "":
+		mode = "rename"
+	case "rename", "copy":
+	default:
+		return fail(http.StatusBadRequest, fmt.Errorf("unsupported mode %q (expected rename or copy)", mode))
+	}
+
+	migrated, conflicts, err := migrateField(db, contentType, from, to, mode == "copy", resolveWriteOptions(fields, binds, ctx))
+	if err != nil {
+		*errors = append(*errors, fmt.Errorf("content_records_plugin: migrate_field failed: %w", err))
+		return fail(http.StatusInternalServerError, fmt.Errorf("migrate_field failed"))
+	}
+	if conflicts > 0 {
+		return fail(http.StatusConflict, fmt.Errorf("%d %s records already have %q; nothing was changed", conflicts, contentType, to))
+	}
+	logDebug(fields, "field migrated", "type", contentType, "from", from, "to", to, "mode", mode, "records", migrated)
+	return writeInlineJSON(ctx, http.StatusOK, map[string]interface{}{
+		"ok":      true,
+		"type":    contentType,
+		"from":    from,
+		"to":      to,
+		"mode":    mode,
+		"records": migrated,
+	})
+}
+
+// bearerTokenMatches compares the request's bearer token with token in
+// constant time.
+func bearerTokenMatches(req *http.Request, token string) bool {
+	got, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(strings.TrimSpace(got)), []byte(token)) == 1
+}
+
+// isMemoryStore reports sqlite stores that live only in memory.
+func isMemoryStore(store string) bool {
+	store = strings.TrimSpace(store)
+	return store == ":memory:" || strings.HasPrefix(store, "file::memory:") || strings.Contains(store, "mode=memory")
+}
+
+// sqliteStoreStats reads the page counts and journal mode of a sqlite store.
+func sqliteStoreStats(ctx context.Context, conn *sql.Conn) (map[string]interface{}, error) {
+	stats := map[string]interface{}{}
+	for _, pragma := range []string{"page_size", "page_count", "freelist_count"} {
+		var n int64
+		if err := conn.QueryRowContext(ctx, "PRAGMA "+pragma).Scan(&n); err != nil {
+			return nil, fmt.Errorf("%s: %w", pragma, err)
+		}
+		stats[pragma] = n
+	}
+	var mode string
+	if err := conn.QueryRowContext(ctx, "PRAGMA journal_mode").Scan(&mode); err != nil {
+		return nil, fmt.Errorf("journal_mode: %w", err)
+	}
+	stats["journal_mode"] = strings.ToLower(mode)
+	stats["size_bytes"] = stats["page_size"].(int64) * stats["page_count"].(int64)
+	return stats, nil
+}
+
+func renderSingleRender(fields Fields, ctx context.Context, errors *[]error) any {
+	template, binds, db, contentType, ok := loadTemplateAndDB(fields, ctx, errors)
+	if !ok {
+		return fallbackMarkup(fields.ErrorHTML, "<!-- content_records_plugin single render failed -->")
+	}
+
+	if inlineMode(fields, ctx) {
+		if handled, response := handleInlineUpdate(ctx, db, contentType, binds, fields, template, errors); handled {
+			return response
+		}
+	}
+
+	recordID := resolveSingleRecord(db, fields, ctx)
+	if recordID == 0 {
+		query, args, err := resolveRecordQuery(db, fields, contentType)
+		if err != nil {
+			*errors = append(*errors, fmt.Errorf("content_records_plugin: %w", err))
+		} else if query != "" {
+			ids, scan, err := queryRecordIDs(db, query, contentType, resolveQueryTimeout(fields), args...)
+			if err != nil {
+				*errors = append(*errors, fmt.Errorf("content_records_plugin: query failed: %w", err))
+			}
+			logIDScan(fields, query, scan)
+			if len(ids) > 0 {
+				recordID = ids[0]
+			}
+		}
+	}
+	if recordID == 0 {
+		return fallbackMarkup(fields.EmptyHTML, "<!-- content_records_plugin no record id -->")
+	}
+
+	rec, err := fetchRecordByID(db, recordID, contentType)
+	if err == nil && fields.SoftDelete {
+		err = checkNotTrashed(db, rec.ID)
+	}
+	if err == errRecordNotFound {
+		// A stale link is not a server error: no component error is reported.
+		logDebug(fields, "record not found", "record_id", recordID, "type", contentType)
+		return fallbackMarkup(fields.NotFoundHTML, "<!-- content_records_plugin record not found -->")
+	}
+	if err != nil {
+		*errors = append(*errors, fmt.Errorf("content_records_plugin: fetch record failed: %w", err))
+		return fallbackMarkup(fields.ErrorHTML, "<!-- content_records_plugin fetch record failed -->")
+	}
+
+	applyFieldDefaults(fields, binds, []record{rec})
+	applyComputedFields(fields, binds, []record{rec})
+	sanitizeRawFields(fields, binds, []record{rec})
+	template = applyTeaserFilter(template, fields)
+	instance, ok := deepCopy(template).(map[string]interface{})
+	if !ok {
+		return fallbackMarkup(fields.ErrorHTML, "<!-- content_records_plugin render failed -->")
+	}
+	stripPluginMetaKeys(instance)
+	imageBinds := collectImageBinds(fields, binds)
+	for bindKey, value := range rec.Fields {
+		target, ok := binds[bindKey]
+		if !ok {
+			continue
+		}
+		if value == "" {
+			if _, isImage := imageBinds[bindKey]; isImage {
+				continue
+			}
+		}
+		_ = applyBindValue(instance, target, bindValue(target, value))
+	}
+	applyImageAlts(instance, binds, rec, imageBinds)
+	injectParentContext(instance, rec.ID, contentType)
+	inlineOpts := buildInlineOptions(fields, binds, inlineMode(fields, ctx))
+	applyInlineAttributes(instance, binds, rec, inlineOpts)
+	if fields.Editable && !fields.ReadOnly && strings.TrimSpace(resolveEditRoute(fields)) != "" {
+		addEditLink(instance, resolveEditRoute(fields), resolveRecordParam(fields), rec.ID)
+	}
+	return instance
+}
+
+// fallbackMarkup returns the configured empty/error markup, or the diagnostic
+// comment when none is set.
+func fallbackMarkup(markup string, comment string) string {
+	if strings.TrimSpace(markup) != "" {
+		return markup
+	}
+	return comment
+}
+
+func loadTemplate(fields Fields, errors *[]error) (map[string]interface{}, map[string]bindTarget, bool) {
+	template, ok := normalizeToStringMap(resolveTemplateValue(fields))
+	if !ok {
+		if name, isRef := fields.Template.(string); isRef {
+			*errors = append(*errors, fmt.Errorf("content_records_plugin: data.template must be a map or a registered template name; %q is not registered (no instance has published it to this store with data.template_name)", strings.TrimSpace(name)))
+		} else {
+			*errors = append(*errors, fmt.Errorf("content_records_plugin: data.template must be a map"))
+		}
+		return nil, nil, false
+	}
+
+	return template, templateBinds(fields, template), true
+}
+
+// templateBinds collects a template's binds and retypes its raw fields.
+func templateBinds(fields Fields, template map[string]interface{}) map[string]bindTarget {
+	binds := map[string]bindTarget{}
+	collectBinds(template, "", binds)
+	if fields.CreateMissingPaths {
+		for key, target := range binds {
+			target.CreateMissing = true
+			binds[key] = target
+		}
+	}
+	for key, fieldType := range buildBindTypeMap(fields, binds) {
+		target := binds[key]
+		target.Type = fieldType
+		binds[key] = target
+	}
+	for _, def := range collectCMSFields(fields, binds) {
+		if def.Separator != "" {
+			target := binds[def.Bind]
+			target.Separator, target.Join = def.Separator, def.Join
+			binds[def.Bind] = target
+		}
+	}
+	markRawBinds(template, binds, resolveRawBinds(fields, binds))
+	for key, target := range binds {
+		if crossesBoundary(template, target) {
+			logDebug(fields, "bind skipped: path enters a nested plugin", "field", key, "path", target.Path)
+			target.Blocked = true
+			binds[key] = target
+		}
+	}
+	return binds
+}
+
+// crossesBoundary reports whether target's path passes through or ends on a
+// boundary plugin node other than the one that declared the bind. That
+// node's config belongs to the nested plugin.
+func crossesBoundary(root map[string]interface{}, target bindTarget) bool {
+	return pathCrossesBoundary(root, "", strings.Split(target.Path, "."), target.Owner)
+}
+
+// pathCrossesBoundary walks parts from node, whose own path is at. A *
+// segment checks every element of the slice.
+func pathCrossesBoundary(node interface{}, at string, parts []string, owner string) bool {
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if elems, ok := node.([]interface{}); ok && part == wildcardSegment {
+			for idx, elem := range elems {
+				elemAt := joinPath(at, strconv.Itoa(idx))
+				if isBoundaryAt(elem, elemAt, owner) || pathCrossesBoundary(elem, elemAt, parts[i+1:], owner) {
+					return true
+				}
+			}
+			return false
+		}
+		var next interface{}
+		switch n := node.(type) {
+		case map[string]interface{}:
+			next = n[part]
+		case map[interface{}]interface{}:
+			next = n[part]
+		case []interface{}:
+			idx, err := strconv.Atoi(part)
+			if err != nil || idx < 0 || idx >= len(n) {
+				return false
+			}
+			next = n[idx]
+		default:
+			return false
+		}
+		at = joinPath(at, part)
+		if isBoundaryAt(next, at, owner) {
+			return true
+		}
+		node = next
+	}
+	return false
+}
+
+// isBoundaryAt reports whether value is a boundary plugin node other than
+// the bind's owner.
+func isBoundaryAt(value interface{}, at string, owner string) bool {
+	node, ok := normalizeToStringMap(value)
+	return ok && at != owner && isBoundaryPlugin(node)
+}
+
+// bindValue converts a stored value for its bind target. List fields are
+// split into items, written across the list node of a * path or joined for
+// display; other fields go through typedBindValue.
+func bindValue(target bindTarget, value string) interface{} {
+	if target.Type != listFieldType {
+		return typedBindValue(target.Type, value)
+	}
+	items := splitListValue(value, target.Separator)
+	if hasWildcard(target.Path) {
+		encoded, _ := json.Marshal(items)
+		return string(encoded)
+	}
+	return strings.Join(items, target.Join)
+}
+
+// listFieldType is the schema type of separator-delimited lists.
+const listFieldType = "list"
+
+// listDelimiters returns a list field's separator and display join.
+func listDelimiters(def FieldDef) (string, string) {
+	separator, join := def.Separator, ", "
+	if separator == "" {
+		separator = ","
+	}
+	if def.Join != nil {
+		join = *def.Join
+	}
+	return separator, join
+}
+
+// splitListValue splits a stored list into trimmed, non-empty items. A
+// backslash escapes the separator or itself; a JSON array (a wildcard
+// template default) is read as its items.
+func splitListValue(value, separator string) []string {
+	items := []string{}
+	if strings.HasPrefix(strings.TrimSpace(value), "[") {
+		var decoded []string
+		if err := json.Unmarshal([]byte(strings.TrimSpace(value)), &decoded); err == nil {
+			for _, item := range decoded {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			return items
+		}
+	}
+	var current strings.Builder
+	flush := func() {
+		if item := strings.TrimSpace(current.String()); item != "" {
+			items = append(items, item)
+		}
+		current.Reset()
+	}
+	for i := 0; i < len(value); {
+		switch {
+		case value[i] == '\\' && strings.HasPrefix(value[i+1:], separator):
+			current.WriteString(separator)
+			i += 1 + len(separator)
+		case value[i] == '\\' && i+1 < len(value) && value[i+1] == '\\':
+			current.WriteByte('\\')
+			i += 2
+		case strings.HasPrefix(value[i:], separator):
+			flush()
+			i += len(separator)
+		default:
+			current.WriteByte(value[i])
+			i++
+		}
+	}
+	flush()
+	return items
+}
+
+// joinListValue is the inverse of splitListValue: it escapes backslashes
+// and separators inside items and joins them with separator.
+func joinListValue(items []string, separator string) string {
+	escaped := make([]string, 0, len(items))
+	for _, item := range items {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		item = strings.ReplaceAll(item, `\`, `\\`)
+		escaped = append(escaped, strings.ReplaceAll(item, separator, `\`+separator))
+	}
+	return strings.Join(escaped, separator)
+}
+
+// typedBindValue converts a stored string back to the Go type of its schema
+// field so template conditions see a real bool or number. Empty or
+// unparseable values stay strings.
+func typedBindValue(fieldType string, value string) interface{} {
+	trimmed := strings.TrimSpace(value)
+	switch fieldType {
+	case "boolean", "bool", "checkbox":
+		if parseBoolFlag(trimmed) {
+			return true
+		}
+		switch strings.ToLower(trimmed) {
+		case "", "0", "false", "no", "off", "n":
+			return false
+		}
+	case "integer", "int":
+		if n, err := strconv.ParseInt(trimmed, 10, 64); err == nil {
+			return n
+		}
+	case "number", "float":
+		if n, err := strconv.ParseFloat(trimmed, 64); err == nil {
+			return n
+		}
+	}
+	return value
+}
+
+// isRawField reports whether a schema field holds pre-rendered HTML.
+func isRawField(def FieldDef) bool {
+	if def.Raw != nil {
+		return *def.Raw
+	}
+	switch strings.ToLower(strings.TrimSpace(def.Type)) {
+	case "markdown", "richtext", "html":
+		return true
+	}
+	return false
+}
+
+// sanitizeRawFields filters the values of raw HTML binds through the
+// data.sanitize allowlist before they are rendered unescaped.
+func sanitizeRawFields(fields Fields, binds map[string]bindTarget, records []record) {
+	if !fields.Sanitize {
+		return
+	}
+	raw := resolveRawBinds(fields, binds)
+	if len(raw) == 0 {
+		return
+	}
+	policy := newSanitizePolicy(fields.AllowTags, fields.AllowAttrs, fields.AllowSchemes)
+	for i := range records {
+		for bind := range raw {
+			if value, ok := records[i].Fields[bind]; ok {
+				records[i].Fields[bind] = policy.Sanitize(value)
+			}
+		}
+	}
+}
+
+// resolveRawBinds returns the binds whose values are HTML.
+func resolveRawBinds(fields Fields, binds map[string]bindTarget) map[string]struct{} {
+	out := map[string]struct{}{}
+	for name, def := range resolveSchema(fields) {
+		if !isRawField(def) {
+			continue
+		}
+		bind := strings.TrimSpace(def.Bind)
+		if bind == "" && strings.TrimSpace(def.Path) != "" {
+			if resolved, ok := findBindByPath(binds, schemaBindPath(def)); ok {
+				bind = resolved
+			}
+		}
+		if bind == "" {
+			bind = name
+		}
+		if _, ok := binds[bind]; ok {
+			out[bind] = struct{}{}
+		}
+	}
+	return out
+}
+
+// markRawBinds retypes <TEXT> nodes whose value is bound to a raw field as
+// <HTML>, which Hyperbricks emits without escaping. Other node types (e.g. a
+// Markdown plugin's data.content) already render their input as HTML.
+func markRawBinds(template map[string]interface{}, binds map[string]bindTarget, raw map[string]struct{}) {
+	for bindKey := range raw {
+		target := binds[bindKey]
+		if target.Attribute != "" || hasWildcard(target.Path) {
+			continue
+		}
+		nodePath, key := splitPath(target.Path)
+		if key != "value" {
+			continue
+		}
+		node := getNodeAtPath(template, nodePath)
+		if node == nil {
+			continue
+		}
+		if nodeType, _ := node["@type"].(string); strings.TrimSpace(nodeType) == "<TEXT>" {
+			node["@type"] = "<HTML>"
+		}
+	}
+}
+
+// checkUploadDir reports edit and new views whose schema has image/file
+// fields but no upload_dir; without it uploads are silently dropped.
+func checkUploadDir(fields Fields, binds map[string]bindTarget) error {
+	if _, action := resolveViewAction(fields); action != "edit" && action != "new" {
+		return nil
+	}
+	if resolveUploadDir(fields) != "" {
+		return nil
+	}
+	issues := validateSchema(fields, binds).UploadsWithoutDir
+	if len(issues) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(issues))
+	for _, issue := range issues {
+		names = append(names, fmt.Sprintf("%s (%s)", issue.Name, issue.Type))
+	}
+	return fmt.Errorf("content_records_plugin: upload_dir is not set, so uploads for %s are not saved; set data.upload_dir (e.g. {{RESOURCES}}/images/)", strings.Join(names, ", "))
+}
+
+func loadTemplateAndDB(fields Fields, ctx context.Context, errors *[]error) (map[string]interface{}, map[string]bindTarget, *sql.DB, string, bool) {
+	templateValue := resolveTemplateValue(fields)
+	template, binds, ok := loadTemplate(fields, errors)
+	if !ok {
+		return nil, nil, nil, "", false
+	}
+
+	db, err := openStoreWith(fields, memoFor(ctx))
+	if err != nil {
+		logDebug(fields, "db open failed", "store", storeLabel(fields), "error", err)
+		*errors = append(*errors, fmt.Errorf("content_records_plugin: db open failed: %w", err))
+		return nil, nil, nil, "", false
+	}
+
+	contentType := resolveTypeName(templateValue)
+	logDebug(fields, "db opened", "store", storeLabel(fields), "type", contentType, "binds", len(binds))
+	if err := checkUploadDir(fields, binds); err != nil {
+		*errors = append(*errors, err)
+	}
+	if fields.Seed && !fields.ReadOnly {
+		opts := resolveWriteOptions(fields, binds, nil)
+		opts.Actor = seedActor
+		// Seeding only runs on an empty store, so there is nothing to match.
+		opts.NaturalKey = ""
+		seeded, err := ensureSeed(db, template, binds, seedVariations(fields, binds), contentType, opts)
+		if err != nil {
+			*errors = append(*errors, fmt.Errorf("content_records_plugin: seed failed: %w", err))
+		}
+		logDebug(fields, "seed checked", "type", contentType, "seeded", seeded, "error", err)
+	}
+
+	return template, binds, db, contentType, true
+}
+
+// treeKeys numbers the items buildList generates: Start, Start+Step, ...
+type treeKeys struct {
+	Start int
+	Step  int
+}
+
+const defaultTreeKeyStep = 10
+
+// resolveTreeKeys reads data.key_start and data.key_step; both default to 10.
+func resolveTreeKeys(fields Fields) treeKeys {
+	keys := treeKeys{Start: defaultTreeKeyStep, Step: defaultTreeKeyStep}
+	if fields.KeyStep > 0 {
+		keys.Step = fields.KeyStep
+	}
+	if fields.KeyStart != nil && *fields.KeyStart >= 0 {
+		keys.Start = *fields.KeyStart
+	}
+	return keys
+}
+
+// resolveListOutput reads data.output and reports whether list renders
+// return an array instead of the <TREE>.
+func resolveListOutput(fields Fields) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(fields.Output)) {
+	case "", "tree":
+		return false, nil
+	case "array":
+		return true, nil
+	default:
+		return false, fmt.Errorf("content_records_plugin: unsupported output %q (expected tree or array)", fields.Output)
+	}
+}
+
+// listOutput returns a buildList tree in the form data.output asks for. An
+// invalid value keeps the tree; validate_only reports it.
+func listOutput(fields Fields, list map[string]interface{}) any {
+	if array, _ := resolveListOutput(fields); array {
+		return treeItems(list)
+	}
+	return list
+}
+
+// treeItems returns the instances of a buildList tree ordered by key.
+func treeItems(list map[string]interface{}) []interface{} {
+	keys := make([]int, 0, len(list))
+	for key := range list {
+		if n, err := strconv.Atoi(key); err == nil {
+			keys = append(keys, n)
+		}
+	}
+	sort.Ints(keys)
+	items := make([]interface{}, 0, len(keys))
+	for _, n := range keys {
+		items = append(items, list[strconv.Itoa(n)])
+	}
+	return items
+}
+
+func buildList(template map[string]interface{}, binds map[string]bindTarget, records []record, imageBinds map[string]string, editable bool, route string, recordParam string, inline *inlineOptions, keys treeKeys, variants *itemTemplates) map[string]interface{} {
+	list := map[string]interface{}{
+		"@type": "<TREE>",
+	}
+
+	contentType := resolveTypeName(template)
+	for i, rec := range records {
+		source, binds := variants.pick(rec, template, binds)
+		instance, ok := deepCopy(source).(map[string]interface{})
+		if !ok {
+			continue
+		}
+		stripPluginMetaKeys(instance)
+		for bindKey, value := range rec.Fields {
+			target, ok := binds[bindKey]
+			if !ok {
+				continue
+			}
+			if value == "" {
+				if _, isImage := imageBinds[bindKey]; isImage {
+					continue
+				}
+			}
+			_ = applyBindValue(instance, target, bindValue(target, value))
+		}
+		applyImageAlts(instance, binds, rec, imageBinds)
+
+		if editable && strings.TrimSpace(route) != "" {
+			addEditLink(instance, route, recordParam, rec.ID)
+		}
+		injectParentContext(instance, rec.ID, contentType)
+		applyInlineAttributes(instance, binds, rec, inline)
+
+		key := strconv.Itoa(keys.Start + i*keys.Step)
+		list[key] = instance
+	}
+
+	return list
+}
+
+const defaultItemTemplateBind = "layout"
+
+// itemTemplates renders list items with a template chosen by the value of
+// one bind (data.item_templates / data.item_template_bind).
+type itemTemplates struct {
+	Bind      string
+	Templates map[string]itemTemplate
+}
+
+type itemTemplate struct {
+	Template map[string]interface{}
+	Binds    map[string]bindTarget
+}
+
+// resolveItemTemplates prepares data.item_templates like data.template;
+// entries that are not maps are reported and skipped.
+func resolveItemTemplates(fields Fields, errors *[]error) *itemTemplates {
+	entries, ok := normalizeToStringMap(fields.ItemTemplates)
+	if !ok || len(entries) == 0 {
+		if fields.ItemTemplates != nil && !ok {
+			*errors = append(*errors, fmt.Errorf("content_records_plugin: item_templates must be a map"))
+		}
+		return nil
+	}
+	bind := strings.TrimSpace(fields.ItemTemplateBind)
+	if bind == "" {
+		bind = defaultItemTemplateBind
+	}
+	variants := &itemTemplates{Bind: bind, Templates: map[string]itemTemplate{}}
+	for value, raw := range entries {
+		template, ok := normalizeToStringMap(raw)
+		if !ok {
+			*errors = append(*errors, fmt.Errorf("content_records_plugin: item_templates.%s must be a map", value))
+			continue
+		}
+		binds := templateBinds(fields, template)
+		variants.Templates[value] = itemTemplate{Template: applyTeaserFilter(template, fields), Binds: binds}
+	}
+	return variants
+}
+
+// pick returns the template and binds for rec: the item template whose key
+// equals the record's value for the selecting bind, otherwise the list's
+// default template.
+func (v *itemTemplates) pick(rec record, template map[string]interface{}, binds map[string]bindTarget) (map[string]interface{}, map[string]bindTarget) {
+	if v == nil {
+		return template, binds
+	}
+	if variant, ok := v.Templates[strings.TrimSpace(rec.Fields[v.Bind])]; ok {
+		return variant.Template, variant.Binds
+	}
+	return template, binds
+}
+
+// computedFieldType marks schema fields whose value is derived from other
+// binds at render time instead of being stored.
+const computedFieldType = "computed"
+
+var computedExprPattern = regexp.MustCompile(`\{\{\s*([^{}\s]+)\s*\}\}`)
+
+// resolveComputedExprs maps computed binds to their expr.
+func resolveComputedExprs(fields Fields, binds map[string]bindTarget) map[string]string {
+	out := map[string]string{}
+	for name, def := range resolveSchema(fields) {
+		if !strings.EqualFold(strings.TrimSpace(def.Type), computedFieldType) {
+			continue
+		}
+		bind := strings.TrimSpace(def.Bind)
+		if bind == "" && strings.TrimSpace(def.Path) != "" {
+			if resolved, ok := findBindByPath(binds, schemaBindPath(def)); ok {
+				bind = resolved
+			}
+		}
+		if bind == "" {
+			bind = name
+		}
+		if _, ok := binds[bind]; ok {
+			out[bind] = def.Expr
+		}
+	}
+	return out
+}
+
+// evalComputedExpr substitutes {{bind}} placeholders with stored values.
+// Unknown binds become empty; no other evaluation takes place.
+func evalComputedExpr(expr string, values map[string]string) string {
+	return computedExprPattern.ReplaceAllStringFunc(expr, func(match string) string {
+		key := computedExprPattern.FindStringSubmatch(match)[1]
+		return values[key]
+	})
+}
+
+// applyComputedFields sets computed binds on each record. Expressions only
+// see stored values, so computed fields cannot reference each other.
+func applyComputedFields(fields Fields, binds map[string]bindTarget, records []record) {
+	exprs := resolveComputedExprs(fields, binds)
+	if len(exprs) == 0 {
+		return
+	}
+	for i := range records {
+		if records[i].Fields == nil {
+			records[i].Fields = map[string]string{}
+		}
+		stored := records[i].Fields
+		// Evaluate everything before assigning so results don't feed each other.
+		results := make(map[string]string, len(exprs))
+		for bind, expr := range exprs {
+			results[bind] = evalComputedExpr(expr, stored)
+		}
+		for bind, value := range results {
+			stored[bind] = value
+		}
+	}
+}
+
+// resolveFieldDefaults maps binds to their schema default values.
+func resolveFieldDefaults(fields Fields, binds map[string]bindTarget) map[string]string {
+	out := map[string]string{}
+	for name, def := range resolveSchema(fields) {
+		if def.Default == "" {
+			continue
+		}
+		bind := strings.TrimSpace(def.Bind)
+		if bind == "" && strings.TrimSpace(def.Path) != "" {
+			if resolved, ok := findBindByPath(binds, schemaBindPath(def)); ok {
+				bind = resolved
+			}
+		}
+		if bind == "" {
+			bind = name
+		}
+		if _, ok := binds[bind]; ok {
+			out[bind] = def.Default
+		}
+	}
+	return out
+}
+
+// applyFieldDefaults fills schema defaults into records without a stored
+// value for the field, e.g. one added to the schema after they were saved.
+// Only absent fields are filled: an intentionally blank value stays blank.
+func applyFieldDefaults(fields Fields, binds map[string]bindTarget, records []record) {
+	defaults := resolveFieldDefaults(fields, binds)
+	if len(defaults) == 0 {
+		return
+	}
+	for i := range records {
+		if records[i].Fields == nil {
+			records[i].Fields = map[string]string{}
+		}
+		for bind, value := range defaults {
+			if _, stored := records[i].Fields[bind]; !stored {
+				records[i].Fields[bind] = value
+			}
+		}
+	}
+}
+
+func stripPluginMetaKeys(node interface{}) {
+	switch typed := node.(type) {
+	case map[string]interface{}:
+		if isBoundaryPlugin(typed) {
+			return
+		}
+		for key, child := range typed {
+			if key == "@bind" || key == "@name" || key == "@list" || key == "@teaser" {
+				delete(typed, key)
+				continue
+			}
+			stripPluginMetaKeys(child)
+		}
+	case []interface{}:
+		for _, child := range typed {
+			stripPluginMetaKeys(child)
+		}
+	}
+}
+
+func buildInlineOptions(fields Fields, binds map[string]bindTarget, active bool) *inlineOptions {
+	if !active || fields.ReadOnly {
+		return nil
+	}
+	return &inlineOptions{
+		Enabled:      true,
+		BindTypes:    buildBindTypeMap(fields, binds),
+		Locked:       resolveInlineLockedBinds(fields, binds),
+		Wrapper:      resolveInlineWrapper(fields.InlineWrapper, defaultInlineWrapper),
+		BlockWrapper: resolveInlineWrapper(fields.InlineBlockWrapper, defaultInlineBlockWrapper),
+	}
+}
+
+// resolveInlineLockedBinds returns the binds of schema fields with
+// inline_editable = false.
+func resolveInlineLockedBinds(fields Fields, binds map[string]bindTarget) map[string]struct{} {
+	out := map[string]struct{}{}
+	for name, def := range resolveSchema(fields) {
+		if def.InlineEditable == nil || *def.InlineEditable {
+			continue
+		}
+		bind := strings.TrimSpace(def.Bind)
+		if bind == "" && strings.TrimSpace(def.Path) != "" {
+			if resolved, ok := findBindByPath(binds, schemaBindPath(def)); ok {
+				bind = resolved
+			}
+		}
+		if bind == "" {
+			bind = name
+		}
+		if _, ok := binds[bind]; ok {
+			out[bind] = struct{}{}
+		}
+	}
+	return out
+}
+
+// wrapperPrefix is the static markup before the first placeholder or marker.
+func wrapperPrefix(wrapper string) string {
+	end := len(wrapper)
+	for _, marker := range []string{"{{", "|"} {
+		if i := strings.Index(wrapper, marker); i >= 0 && i < end {
+			end = i
+		}
+	}
+	return strings.TrimSpace(wrapper[:end])
+}
+
+// resolveInlineWrapper falls back to the default when the configured wrapper
+// is empty or has no | content marker.
+func resolveInlineWrapper(wrapper, fallback string) string {
+	if strings.TrimSpace(wrapper) == "" || !strings.Contains(wrapper, "|") {
+		return fallback
+	}
+	return wrapper
+}
+
+func buildBindTypeMap(fields Fields, binds map[string]bindTarget) map[string]string {
+	out := map[string]string{}
+	schema := resolveSchema(fields)
+	for name, def := range schema {
+		bind := strings.TrimSpace(def.Bind)
+		if bind == "" && strings.TrimSpace(def.Path) != "" {
+			if resolved, ok := findBindByPath(binds, schemaBindPath(def)); ok {
+				bind = resolved
+			}
+		}
+		if bind == "" {
+			bind = name
+		}
+		if _, ok := binds[bind]; !ok {
+			continue
+		}
+		t := strings.ToLower(strings.TrimSpace(def.Type))
+		if t == "" {
+			t = "text"
+		}
+		out[bind] = t
+	}
+	return out
+}
+
+func applyInlineAttributes(instance map[string]interface{}, binds map[string]bindTarget, rec record, inline *inlineOptions) {
+	if inline == nil || !inline.Enabled {
+		return
+	}
+	for bindKey, target := range binds {
+		if target.Blocked {
+			continue
+		}
+		nodePath, _ := splitPath(target.Path)
+		node := findInlineNode(instance, nodePath)
+		if node == nil {
+			continue
+		}
+		if nodeType, ok := node["@type"].(string); ok && nodeType == "<TREE>" {
+			continue
+		}
+		value := rec.Fields[bindKey]
+		bindType := "text"
+		if inline.BindTypes != nil {
+			if t := strings.TrimSpace(inline.BindTypes[bindKey]); t != "" {
+				bindType = strings.ToLower(t)
+			}
+		}
+		if bindType == computedFieldType {
+			continue
+		}
+		if _, locked := inline.Locked[bindKey]; locked {
+			continue
+		}
+		applyInlineWrapper(node, inline, bindKey, rec.ID, bindType, value)
+	}
+}
+
+func applyInlineWrapper(node map[string]interface{}, inline *inlineOptions, bindKey string, recordID int64, bindType string, value string) {
+	replacer := strings.NewReplacer(
+		"{{bind}}", html.EscapeString(bindKey),
+		"{{id}}", strconv.FormatInt(recordID, 10),
+		"{{type}}", html.EscapeString(bindType),
+		"{{value}}", html.EscapeString(value),
+	)
+	wrapper := resolveInlineWrapper(inline.Wrapper, defaultInlineWrapper)
+	inlineWrapper := replacer.Replace(wrapper)
+	blockWrapper := replacer.Replace(resolveInlineWrapper(inline.BlockWrapper, defaultInlineBlockWrapper))
+	if existing, ok := node["enclose"].(string); ok && strings.TrimSpace(existing) != "" {
+		if strings.Contains(existing, "data-cr-bind=") || strings.Contains(existing, "cr-inline") {
+			return
+		}
+		// A custom wrapper is recognised by its markup up to the first placeholder.
+		if prefix := wrapperPrefix(wrapper); prefix != "" && strings.Contains(existing, prefix) {
+			return
+		}
+		node["enclose"] = strings.Replace(existing, "|", inlineWrapper, 1)
+		return
+	}
+	node["enclose"] = blockWrapper
+}
+
+func collectFlaggedBindKeys(template map[string]interface{}, flagKey string) map[string]struct{} {
+	out := map[string]struct{}{}
+	collectFlaggedBindKeysInto(template, flagKey, out)
+	return out
+}
+
+func collectFlaggedBindKeysInto(node interface{}, flagKey string, out map[string]struct{}) {
+	switch typed := node.(type) {
+	case map[string]interface{}:
+		if isBoundaryPlugin(typed) {
+			return
+		}
+		if hasFlag(typed, flagKey) {
+			if bindValue, ok := typed["@bind"].(map[string]interface{}); ok {
+				if field, ok := bindValue["field"].(string); ok {
+					field = strings.TrimSpace(field)
+					if field != "" {
+						out[field] = struct{}{}
+					}
+				}
+			}
+		}
+		for key, child := range typed {
+			if strings.HasPrefix(key, "@") {
+				continue
+			}
+			collectFlaggedBindKeysInto(child, flagKey, out)
+		}
+	case map[interface{}]interface{}:
+		normalized := normalizeInterfaceMap(typed)
+		collectFlaggedBindKeysInto(normalized, flagKey, out)
+	case []interface{}:
+		for _, child := range typed {
+			collectFlaggedBindKeysInto(child, flagKey, out)
+		}
+	}
+}
+
+func hasFlag(node map[string]interface{}, flagKey string) bool {
+	raw, ok := node[flagKey]
+	if !ok {
+		return false
+	}
+	switch v := raw.(type) {
+	case bool:
+		return v
+	case string:
+		val := strings.ToLower(strings.TrimSpace(v))
+		return val != "" && val != "false" && val != "0"
+	case int:
+		return v != 0
+	case int64:
+		return v != 0
+	case float64:
+		return v != 0
+	default:
+		return false
+	}
+}
+
+func filterTemplateByFlag(template map[string]interface{}, flagKey string) (map[string]interface{}, bool) {
+	filtered, ok := filterNodeByFlag(template, flagKey)
+	if !ok {
+		return nil, false
+	}
+	result, ok := filtered.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	return result, true
+}
+
+func filterNodeByFlag(node interface{}, flagKey string) (interface{}, bool) {
+	switch typed := node.(type) {
+	case map[string]interface{}:
+		if hasFlag(typed, flagKey) {
+			return deepCopy(typed), true
+		}
+		if isBoundaryPlugin(typed) {
+			return nil, false
+		}
+		out := map[string]interface{}{}
+		kept := false
+		for key, child := range typed {
+			if strings.HasPrefix(key, "@") {
+				out[key] = child
+				continue
+			}
+			filtered, ok := filterNodeByFlag(child, flagKey)
+			if ok {
+				out[key] = filtered
+				kept = true
+			}
+		}
+		if kept {
+			for key, child := range typed {
+				if strings.HasPrefix(key, "@") {
+					continue
+				}
+				if _, exists := out[key]; exists {
+					continue
+				}
+				switch child.(type) {
+				case map[string]interface{}, map[interface{}]interface{}, []interface{}:
+					continue
+				default:
+					out[key] = child
+				}
+			}
+			return out, true
+		}
+		return nil, false
+	case map[interface{}]interface{}:
+		normalized := normalizeInterfaceMap(typed)
+		return filterNodeByFlag(normalized, flagKey)
+	case []interface{}:
+		out := make([]interface{}, 0, len(typed))
+		for _, child := range typed {
+			filtered, ok := filterNodeByFlag(child, flagKey)
+			if ok {
+				out = append(out, filtered)
+			}
+		}
+		if len(out) == 0 {
+			return nil, false
+		}
+		return out, true
+	default:
+		return nil, false
+	}
+}
+
+func resolveListFieldIDs(fieldDefs []cmsField, listBinds map[string]struct{}) []interface{} {
+	ids := make([]interface{}, 0, len(fieldDefs))
+	if len(listBinds) == 0 {
+		for _, field := range fieldDefs {
+			bindKey := field.Bind
+			if bindKey == "" {
+				bindKey = field.Name
+			}
+			ids = append(ids, bindKey)
+		}
+		return ids
+	}
+	remaining := map[string]struct{}{}
+	for key := range listBinds {
+		remaining[key] = struct{}{}
+	}
+	for _, field := range fieldDefs {
+		bindKey := field.Bind
+		if bindKey == "" {
+			bindKey = field.Name
+		}
+		if _, ok := listBinds[bindKey]; ok {
+			ids = append(ids, bindKey)
+			delete(remaining, bindKey)
+		}
+	}
+	if len(remaining) > 0 {
+		extra := make([]string, 0, len(remaining))
+		for key := range remaining {
+			extra = append(extra, key)
+		}
+		sort.Strings(extra)
+		for _, key := range extra {
+			ids = append(ids, key)
+		}
+	}
+	return ids
+}
+
+// listColumn is one data.list_columns entry.
+type listColumn struct {
+	Bind  string
+	Label string // empty keeps the field's label
+}
+
+// resolveListColumns parses data.list_columns entries of the form "bind" or
+// "bind: Label", dropping blanks and repeated binds.
+func resolveListColumns(fields Fields) []listColumn {
+	var columns []listColumn
+	seen := map[string]struct{}{}
+	for _, entry := range fields.ListColumns {
+		bind, label, _ := strings.Cut(entry, ":")
+		bind, label = strings.TrimSpace(bind), strings.TrimSpace(label)
+		if bind == "" {
+			continue
+		}
+		if _, ok := seen[bind]; ok {
+			continue
+		}
+		seen[bind] = struct{}{}
+		columns = append(columns, listColumn{Bind: bind, Label: label})
+	}
+	return columns
+}
+
+func buildCMSValues(template map[string]interface{}, binds map[string]bindTarget, records []record, fields Fields, fieldDefs []cmsField, imageBinds map[string]string, listBinds map[string]struct{}) map[string]interface{} {
+	view, action := resolveViewAction(fields)
+	recordIDs := make([]interface{}, 0, len(records))
+	recordsMap := make(map[string]interface{}, len(records))
+	for _, rec := range records {
+		idStr := strconv.FormatInt(rec.ID, 10)
+		recordIDs = append(recordIDs, idStr)
+
+		fieldMap := make(map[string]interface{}, len(rec.Fields))
+		for k, v := range rec.Fields {
+			fieldMap[k] = v
+		}
+
+		recordsMap[idStr] = map[string]interface{}{
+			"id":      idStr,
+			"fields":  fieldMap,
+			"deleted": rec.Deleted,
+		}
+	}
+
+	fieldIDsList := make([]interface{}, 0, len(fieldDefs))
+	fieldsMap := make(map[string]interface{}, len(fieldDefs))
+	for _, field := range fieldDefs {
+		bindKey := field.Bind
+		if bindKey == "" {
+			bindKey = field.Name
+		}
+		fieldIDsList = append(fieldIDsList, bindKey)
+		fieldsMap[bindKey] = map[string]interface{}{
+			"name":  field.Name,
+			"label": field.Label,
+			"type":  field.Type,
+			"bind":  bindKey,
+			"path":  field.Path,
+		}
+	}
+
+	listFieldIDs := resolveListFieldIDs(fieldDefs, listBinds)
+	listLabels := map[string]interface{}{}
+	if columns := resolveListColumns(fields); len(columns) > 0 {
+		listFieldIDs = make([]interface{}, 0, len(columns))
+		for _, column := range columns {
+			_, isField := fieldsMap[column.Bind]
+			_, isBind := binds[column.Bind]
+			if !isField && !isBind {
+				logDebug(fields, "list column ignored, unknown bind", "bind", column.Bind)
+				continue
+			}
+			listFieldIDs = append(listFieldIDs, column.Bind)
+			if column.Label != "" {
+				listLabels[column.Bind] = column.Label
+			}
+		}
+	}
+	for _, fieldID := range listFieldIDs {
+		idStr, ok := fieldID.(string)
+		if !ok {
+			continue
+		}
+		if _, ok := fieldsMap[idStr]; ok {
+			continue
+		}
+		fieldsMap[idStr] = map[string]interface{}{
+			"name":  idStr,
+			"label": idStr,
+			"type":  "text",
+			"bind":  idStr,
+			"path":  "",
+		}
+	}
+
+	showPreview := resolveShowPreview(fields)
+	var preview map[string]interface{}
+	if showPreview {
+		applyFieldDefaults(fields, binds, records)
+		applyComputedFields(fields, binds, records)
+		preview = buildList(template, binds, records, imageBinds, false, "", "", nil, resolveTreeKeys(fields), nil)
+	}
+	newParam, newValue := resolveNewParam(fields)
+	params := resolveFormParams(fields)
+
+	return map[string]interface{}{
+		"type":            resolveTypeName(template),
+		"view":            view,
+		"action":          action,
+		"store":           storeLabel(fields),
+		"query":           resolveQuery(fields),
+		"edit_route":      resolveEditRoute(fields),
+		"record_param":    resolveRecordParam(fields),
+		"new_param":       newParam,
+		"new_value":       newValue,
+		"action_param":    params.Action,
+		"record_id_param": params.RecordID,
+		"records":         recordsMap,
+		"record_ids":      recordIDs,
+		"fields":          fieldsMap,
+		"field_ids":       fieldIDsList,
+		"list_field_ids":  listFieldIDs,
+		"list_labels":     listLabels,
+		"read_only":       fields.ReadOnly,
+		"show_preview":    showPreview,
+		"preview":         preview,
+		"soft_delete":     fields.SoftDelete,
+		"show_deleted":    fields.showDeleted,
+	}
+}
+
+func buildEditValues(rec record, fieldDefs []cmsField, fields Fields, preview map[string]interface{}) map[string]interface{} {
+	view, action := resolveViewAction(fields)
+	fieldIDsList := make([]interface{}, 0, len(fieldDefs))
+	fieldsMap := make(map[string]interface{}, len(fieldDefs))
+	for _, field := range fieldDefs {
+		bindKey := field.Bind
+		if bindKey == "" {
+			bindKey = field.Name
+		}
+		fieldIDsList = append(fieldIDsList, bindKey)
+		fieldsMap[bindKey] = map[string]interface{}{
+			"name":         field.Name,
+			"label":        field.Label,
+			"type":         field.Type,
+			"bind":         bindKey,
+			"path":         field.Path,
+			"alt_bind":     field.AltBind,
+			"caption_bind": field.CaptionBind,
+		}
+		if field.Separator != "" {
+			// The edit form shows a list one item per line.
+			fieldsMap[bindKey].(map[string]interface{})["lines"] = strings.Join(splitListValue(rec.Fields[bindKey], field.Separator), "\n")
+		}
+	}
+
+	// Unsaved records (action=new) have no id yet.
+	isNew := rec.ID == 0
+	recordID := ""
+	if !isNew {
+		recordID = strconv.FormatInt(rec.ID, 10)
+	}
+	showPreview := resolveShowPreview(fields)
+	params := resolveFormParams(fields)
+	return map[string]interface{}{
+		"type":            resolveTypeName(resolveTemplateValue(fields)),
+		"view":            view,
+		"action":          action,
+		"store":           storeLabel(fields),
+		"record_id":       recordID,
+		"record_uid":      rec.UID,
+		"is_new":          isNew,
+		"action_param":    params.Action,
+		"record_id_param": params.RecordID,
+		"read_only":       fields.ReadOnly,
+		"show_preview":    showPreview,
+		"record": map[string]interface{}{
+			"id":     recordID,
+			"uid":    rec.UID,
+			"fields": mapStringToInterface(rec.Fields),
+		},
+		"fields":    fieldsMap,
+		"field_ids": fieldIDsList,
+		"preview":   preview,
+	}
+}
+
+func mapStringToInterface(in map[string]string) map[string]interface{} {
+	out := make(map[string]interface{}, len(in))
+	for k, v := range in {
+		out[k] = v
+	}
+	return out
+}
+
+func cmsInlineTemplate() string {
+	return `
+<div class="content-records-dashboard" data-theme="dark">
+  <div class="shell">
+    <header class="hero">
+      <div class="hero-bar">
+        <div class="badge">CMS</div>
+      </div>
+      <div class="hero-brand">
+        <div class="hero-text">
+          <h1>Content Records</h1>
+          <p>Type: {{ .type }} · Store: {{ .store }}</p>
+        </div>
+        <div class="hero-actions">
+          {{ if .read_only }}
+            <span class="subhead">Read-only</span>
+          {{ else if .edit_route }}
+            <form method="get" action="{{ .edit_route }}">
+              <input type="hidden" name="{{ .new_param }}" value="{{ .new_value }}">
+              <button class="secondary" type="submit">New</button>
+            </form>
+          {{ else }}
+            <span class="subhead">Set edit_route to enable New</span>
+          {{ end }}
+        </div>
+      </div>
+    </header>
+
+    <div class="grid">
+      <section class="panel">
+        <div class="panel-header">
+          <h2>Records</h2>
+          {{ if .query }}
+            <div class="mono">Query: {{ .query }}</div>
+          {{ end }}
+          {{ if .filters }}
+            <div class="mono">Filters:{{ range $param, $value := .filters }} {{ $param }}={{ $value }}{{ end }}</div>
+          {{ end }}
+          {{ if .soft_delete }}
+            <form class="content-records-trash-toggle" method="get">
+              {{ range $param, $value := .filters }}<input type="hidden" name="{{ $param }}" value="{{ $value }}">{{ end }}
+              <label><input type="checkbox" name="show_deleted" value="1" onchange="this.form.submit()"{{ if .show_deleted }} checked{{ end }}> Show deleted</label>
+              <noscript><button class="secondary" type="submit">Apply</button></noscript>
+            </form>
+          {{ end }}
+        </div>
+        <div class="table-wrap">
+          <table class="content-records-table">
+            <thead>
+              <tr>
+                <th>ID</th>
+                <th>Type</th>
+                <th>Fields</th>
+                <th>Actions</th>
+              </tr>
+            </thead>
+            <tbody>
+              {{ range $i, $id := .record_ids }}
+                {{ $rec := index $.records $id }}
+                <tr{{ if $rec.deleted }} class="content-records-deleted"{{ end }}>
+                  <td data-label="ID">{{ $id }}</td>
+                  <td data-label="Type">{{ $.type }}</td>
+                  <td data-label="Fields">
+                    <div class="content-records-fields">
+                      {{ range $j, $fieldID := $.list_field_ids }}
+                        {{ $def := index $.fields $fieldID }}
+                        <div class="content-records-field-row">
+                          <span class="content-records-field-label">{{ with index $.list_labels $fieldID }}{{ . }}{{ else }}{{ $def.label }}{{ end }}</span>
+                          <span class="content-records-field-value">{{ index $rec.fields $fieldID }}</span>
+                        </div>
+                      {{ end }}
+                    </div>
+                  </td>
+                  <td data-label="Actions">
+                    {{ if and $rec.deleted (not $.read_only) }}
+                    <div class="row-actions">
+                      <span class="subhead">Deleted</span>
+                      <form method="post">
+                        <input type="hidden" name="{{ $.action_param }}" value="restore">
+                        <input type="hidden" name="{{ $.record_id_param }}" value="{{ $id }}">
+                        <button class="secondary" type="submit">Restore</button>
+                      </form>
+                    </div>
+                    {{ else if not $.read_only }}
+                    <div class="row-actions">
+                      {{ if $.edit_route }}
+                        <form method="get" action="{{ $.edit_route }}">
+                          <input type="hidden" name="{{ $.record_param }}" value="{{ $id }}">
+                          <button class="secondary" type="submit">Edit</button>
+                        </form>
+                      {{ end }}
+                      <form method="post">
+                        <input type="hidden" name="{{ $.action_param }}" value="delete">
+                        <input type="hidden" name="{{ $.record_id_param }}" value="{{ $id }}">
+                        <button class="danger" type="submit">Delete</button>
+                      </form>
+                    </div>
+                    {{ end }}
+                  </td>
+                </tr>
+              {{ else }}
+                <tr>
+                  <td class="content-records-empty" colspan="4">No records found.</td>
+                </tr>
+              {{ end }}
+            </tbody>
+          </table>
+        </div>
+        {{ if and .record_ids (not .read_only) }}
+          <form class="content-records-bulk" method="post">
+            <input type="hidden" name="{{ .action_param }}" value="bulk_set">
+            <label>Set
+              <select name="bulk_bind">
+                {{ range $j, $fieldID := .field_ids }}
+                  {{ $def := index $.fields $fieldID }}
+                  {{ if and (ne $def.type "computed") (ne $def.type "image") }}
+                    <option value="{{ $fieldID }}">{{ $def.label }}</option>
+                  {{ end }}
+                {{ end }}
+              </select>
+            </label>
+            <label>to <input type="text" name="bulk_value"></label>
+            <button class="secondary" type="submit">Apply to all listed</button>
+          </form>
+        {{ end }}
+        {{ if .bulk }}
+          <div class="mono">Updated {{ .bulk.updated }} records: {{ .bulk.bind }} = {{ .bulk.value }}</div>
+        {{ end }}
+      </section>
+
+      {{ if .show_preview }}
+      <section class="panel content-records-preview">
+        <h2>Preview</h2>
+        <div class="content-records-preview__body">
+          {{ .preview }}
+        </div>
+      </section>
+      {{ end }}
+    </div>
+  </div>
+</div>
+`
+}
+
+func editInlineTemplate() string {
+	return `
+<div class="content-records-dashboard" data-theme="dark">
+  <div class="shell">
+    <header class="hero">
+      <div class="hero-bar">
+        <div class="badge">CMS</div>
+      </div>
+      <div class="hero-brand">
+        <div class="hero-text">
+          {{ if .is_new }}
+            <h1>New Record</h1>
+            <p>Type: {{ .type }}</p>
+          {{ else }}
+            <h1>Edit Record</h1>
+            <p>Record: {{ .record_id }} · Type: {{ .type }}</p>
+          {{ end }}
+        </div>
+      </div>
+    </header>
+
+    <div class="grid">
+      <section class="panel">
+        <div class="panel-header">
+          <h2>Fields</h2>
+        </div>
+        <form method="post" enctype="multipart/form-data">
+          <input type="hidden" name="{{ .record_id_param }}" value="{{ .record_id }}">
+          {{ range $j, $fieldID := .field_ids }}
+            {{ $def := index $.fields $fieldID }}
+            <div class="field" data-field="{{ $fieldID }}">
+              <label>{{ $def.label }}</label>
+              {{ if eq $def.type "image" }}
+                <div class="note-row">
+                  <span class="mono">Current: {{ index $.record.fields $fieldID }}</span>
+                </div>
+                <input type="hidden" name="{{ $fieldID }}" value="{{ index $.record.fields $fieldID }}">
+                <input type="file" name="{{ $fieldID }}">
+                {{ with $def.alt_bind }}
+                <label class="field-meta">Alt text
+                  <input type="text" name="{{ . }}" value="{{ index $.record.fields . }}">
+                </label>
+                {{ end }}
+                {{ with $def.caption_bind }}
+                <label class="field-meta">Caption
+                  <input type="text" name="{{ . }}" value="{{ index $.record.fields . }}">
+                </label>
+                {{ end }}
+              {{ else if eq $def.type "list" }}
+                <textarea name="{{ $fieldID }}" rows="5" placeholder="One item per line">{{ $def.lines }}</textarea>
+              {{ else if eq $def.type "markdown" }}
+                <textarea name="{{ $fieldID }}">{{ index $.record.fields $fieldID }}</textarea>
+              {{ else if eq $def.type "computed" }}
+                <input type="text" value="{{ index $.record.fields $fieldID }}" readonly>
+              {{ else }}
+                <input type="text" name="{{ $fieldID }}" value="{{ index $.record.fields $fieldID }}">
+              {{ end }}
+            </div>
+          {{ end }}
 
           <div class="content-records-actions">
+            {{ if .read_only }}
+            <div class="actions-row">
+              <span class="subhead">Read-only</span>
+              <button class="ghost" type="button" onclick="window.history.back()">Back</button>
+            </div>
+            {{ else if .is_new }}
             <div class="actions-row">
-              <button type="submit" name="action" value="update">Save</button>
-              <button class="secondary" type="submit" name="action" value="create">New</button>
+              <button type="submit" name="{{ .action_param }}" value="create">Create</button>
+              <button class="ghost" type="button" onclick="window.history.back()">Cancel</button>
+            </div>
+            {{ else }}
+            <div class="actions-row">
+              <button type="submit" name="{{ .action_param }}" value="update">Save</button>
+              {{ if .show_preview }}
+              <button class="secondary" type="submit" name="{{ .action_param }}" value="preview">Preview</button>
+              {{ end }}
+              <button class="secondary" type="submit" name="{{ .action_param }}" value="create">New</button>
               <button class="ghost" type="button" onclick="window.history.back()">Cancel</button>
             </div>
             <div class="actions-row">
-              <button class="danger" type="submit" name="action" value="delete">Delete</button>
+              <button class="danger" type="submit" name="{{ .action_param }}" value="delete">Delete</button>
             </div>
+            {{ end }}
           </div>
         </form>
       </section>
 
-      {{ if .show_preview }}
-      <section class="panel content-records-preview">
-        <h2>Preview</h2>
-        <div class="content-records-preview__body">
-          {{ .preview }}
-        </div>
-      </section>
-      {{ end }}
-    </div>
-  </div>
-</div>
-`
+      {{ if .show_preview }}
+      <section class="panel content-records-preview">
+        <h2>Preview</h2>
+        <div class="content-records-preview__body">
+          {{ .preview }}
+        </div>
+      </section>
+      {{ end }}
+    </div>
+  </div>
+</div>
+`
+}
+
+func collectCMSFields(fields Fields, binds map[string]bindTarget) []cmsField {
+	var out []cmsField
+	schema := resolveSchema(fields)
+	if len(schema) > 0 {
+		hasOrder := false
+		for name, def := range schema {
+			bind := strings.TrimSpace(def.Bind)
+			if bind == "" && strings.TrimSpace(def.Path) != "" {
+				if resolved, ok := findBindByPath(binds, schemaBindPath(def)); ok {
+					bind = resolved
+				}
+			}
+			if bind == "" {
+				bind = name
+			}
+			if _, ok := binds[bind]; !ok {
+				continue
+			}
+			label := strings.TrimSpace(def.Label)
+			if label == "" {
+				label = bind
+			}
+			if def.Order != 0 {
+				hasOrder = true
+			}
+			field := cmsField{
+				Name:  name,
+				Label: label,
+				Type:  strings.TrimSpace(def.Type),
+				Bind:  bind,
+				Path:  def.Path,
+				Order: def.Order,
+			}
+			if strings.EqualFold(field.Type, "image") {
+				field.AltBind = strings.TrimSpace(def.AltBind)
+				field.CaptionBind = strings.TrimSpace(def.CaptionBind)
+			}
+			if strings.EqualFold(field.Type, listFieldType) {
+				field.Separator, field.Join = listDelimiters(def)
+			}
+			out = append(out, field)
+		}
+		if hasOrder {
+			sort.SliceStable(out, func(i, j int) bool {
+				oi := out[i].Order
+				oj := out[j].Order
+				if oi == 0 {
+					oi = 1 << 30
+				}
+				if oj == 0 {
+					oj = 1 << 30
+				}
+				if oi == oj {
+					return out[i].Name < out[j].Name
+				}
+				return oi < oj
+			})
+		} else {
+			sort.SliceStable(out, func(i, j int) bool {
+				return out[i].Name < out[j].Name
+			})
+		}
+		return out
+	}
+
+	keys := make([]string, 0, len(binds))
+	for key := range binds {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		out = append(out, cmsField{
+			Name:  key,
+			Label: key,
+			Type:  "text",
+			Bind:  key,
+			Path:  binds[key].Path,
+		})
+	}
+	return out
+}
+
+// collectImageBinds maps the binds of schema image fields to their alt_bind
+// (empty when the field has none).
+func collectImageBinds(fields Fields, binds map[string]bindTarget) map[string]string {
+	imageBinds := map[string]string{}
+	schema := resolveSchema(fields)
+	if len(schema) == 0 {
+		return imageBinds
+	}
+	for name, def := range schema {
+		if strings.ToLower(strings.TrimSpace(def.Type)) != "image" {
+			continue
+		}
+		bind := strings.TrimSpace(def.Bind)
+		if bind == "" && strings.TrimSpace(def.Path) != "" {
+			if resolved, ok := findBindByPath(binds, schemaBindPath(def)); ok {
+				bind = resolved
+			}
+		}
+		if bind == "" {
+			bind = name
+		}
+		if _, ok := binds[bind]; ok {
+			imageBinds[bind] = strings.TrimSpace(def.AltBind)
+		}
+	}
+	return imageBinds
+}
+
+// applyImageAlts sets the alt of each image node from its field's alt_bind
+// value, next to the bound src (or in the same attribute map). An alt_bind
+// the template binds itself is applied like any other bind instead.
+func applyImageAlts(instance map[string]interface{}, binds map[string]bindTarget, rec record, imageBinds map[string]string) {
+	for imageBind, altBind := range imageBinds {
+		if altBind == "" {
+			continue
+		}
+		if _, bound := binds[altBind]; bound {
+			continue
+		}
+		alt, ok := rec.Fields[altBind]
+		target, isBound := binds[imageBind]
+		if !ok || !isBound || target.Blocked || hasWildcard(target.Path) {
+			continue
+		}
+		if target.Attribute != "" {
+			setAttributeAtPath(instance, target.Path, "alt", alt)
+			continue
+		}
+		parent, _ := splitPath(target.Path)
+		if parent == "" {
+			instance["alt"] = alt
+			continue
+		}
+		setAtPath(instance, parent+".alt", alt)
+	}
+}
+
+// schemaBindPath is the path a schema entry uses to find its bind.
+func schemaBindPath(def FieldDef) string {
+	path := strings.TrimSpace(def.Path)
+	if attr := strings.TrimSpace(def.Attribute); attr != "" {
+		if path == "" {
+			return defaultAttributePath + "." + attr
+		}
+		return path + "." + attr
+	}
+	return path
+}
+
+func findBindByPath(binds map[string]bindTarget, path string) (string, bool) {
+	for key, target := range binds {
+		if target.lookupPath() == path {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+func resolveRecordID(ctx context.Context, param string) int64 {
+	key := strings.TrimSpace(param)
+	if key == "" {
+		key = "id"
+	}
+	return parseRecordID(GetInputFromContext(ctx, key))
+}
+
+// resolveIDStrategy normalizes data.id_strategy: "" for autoincrement, or
+// uuid/ulid.
+func resolveIDStrategy(value string) (string, error) {
+	switch strategy := strings.ToLower(strings.TrimSpace(value)); strategy {
+	case "", "autoincrement":
+		return "", nil
+	case "uuid", "ulid":
+		return strategy, nil
+	default:
+		return "", fmt.Errorf("content_records_plugin: unsupported id_strategy %q (expected autoincrement, uuid or ulid)", value)
+	}
+}
+
+var (
+	uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	ulidPattern = regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Za-hjkmnp-tv-z]{25}$`)
+)
+
+// isRecordUID reports whether value is shaped like a uuid or ulid record id.
+func isRecordUID(value string) bool {
+	return uuidPattern.MatchString(value) || ulidPattern.MatchString(value)
+}
+
+// newRecordUID generates a records.uid for the uuid or ulid strategy.
+func newRecordUID(strategy string) (string, error) {
+	if strategy == "ulid" {
+		return newULID(time.Now())
+	}
+	return newUUID()
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// crockford is the ULID base32 alphabet.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// newULID returns a ULID: a 48-bit millisecond timestamp followed by 80
+// random bits, so ids sort by creation time.
+func newULID(now time.Time) (string, error) {
+	var b [16]byte
+	ms := uint64(now.UnixMilli())
+	for i := 5; i >= 0; i-- {
+		b[i] = byte(ms)
+		ms >>= 8
+	}
+	if _, err := rand.Read(b[6:]); err != nil {
+		return "", err
+	}
+	// 128 bits as 26 base32 digits; the first digit carries 3 bits.
+	out := make([]byte, 26)
+	var acc uint64
+	bits := 0
+	pos := 25
+	for i := 15; i >= 0; i-- {
+		acc |= uint64(b[i]) << bits
+		bits += 8
+		for bits >= 5 && pos >= 0 {
+			out[pos] = crockford[acc&31]
+			acc >>= 5
+			bits -= 5
+			pos--
+		}
+	}
+	if pos >= 0 {
+		out[pos] = crockford[acc&31]
+	}
+	return string(out), nil
+}
+
+// lookupRecordRef resolves a record reference: an integer id, or a uid
+// generated by id_strategy uuid/ulid. It returns 0 when nothing matches.
+func lookupRecordRef(db *sql.DB, ref string) int64 {
+	ref = strings.TrimSpace(ref)
+	if id := parseRecordID(ref); id != 0 {
+		return id
+	}
+	if db == nil || !isRecordUID(ref) {
+		return 0
+	}
+	// Generated uuids are lower case and ulids upper case.
+	if ulidPattern.MatchString(ref) {
+		ref = strings.ToUpper(ref)
+	} else {
+		ref = strings.ToLower(ref)
+	}
+	var id int64
+	if err := db.QueryRow(`SELECT id FROM records WHERE uid = ?`, ref).Scan(&id); err != nil {
+		return 0
+	}
+	return id
+}
+
+func parseRecordID(value string) int64 {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return id
+}
+
+// applyCMSAction handles list edit form posts and returns the action name, or
+// an empty string when the request carried none.
+func applyCMSAction(ctx context.Context, db *sql.DB, contentType string, fieldDefs []cmsField, uploads uploadOptions, params formParams, opts writeOptions, cleanup *fileCleanup, errors *[]error) string {
+	req, _ := ctx.Value(shared.Request).(*http.Request)
+	if req == nil || req.Method != http.MethodPost {
+		return ""
+	}
+
+	parseRequestForm(req, errors)
+	action := strings.ToLower(strings.TrimSpace(GetInputFromContext(ctx, params.Action)))
+	if action == "" {
+		return ""
+	}
+	if opts.ReadOnly {
+		*errors = append(*errors, fmt.Errorf("content_records_plugin: %s rejected: %w", action, errReadOnly))
+		return action
+	}
+
+	values := readFieldValuesFromContext(ctx, fieldDefs)
+	mergeUploads(ctx, fieldDefs, uploads, values, errors)
+
+	switch action {
+	case "create":
+		if _, err := createRecord(db, contentType, values, opts); err != nil {
+			*errors = append(*errors, fmt.Errorf("content_records_plugin: create failed: %w", err))
+		}
+	case "update":
+		idStr := GetInputFromContext(ctx, params.RecordID)
+		id, err := strconv.ParseInt(strings.TrimSpace(idStr), 10, 64)
+		if err != nil {
+			*errors = append(*errors, fmt.Errorf("content_records_plugin: invalid %s", params.RecordID))
+			return action
+		}
+		previous := cleanup.snapshot(db, id, contentType)
+		if changed, err := updateRecord(db, id, contentType, values, opts); err != nil {
+			*errors = append(*errors, fmt.Errorf("content_records_plugin: update failed: %w", err))
+		} else if changed {
+			cleanup.removeReplaced(db, previous, values, errors)
+		}
+	case "delete":
+		idStr := GetInputFromContext(ctx, params.RecordID)
+		id, err := strconv.ParseInt(strings.TrimSpace(idStr), 10, 64)
+		if err != nil {
+			*errors = append(*errors, fmt.Errorf("content_records_plugin: invalid %s", params.RecordID))
+			return action
+		}
+		previous := cleanup.snapshot(db, id, contentType)
+		if err := deleteRecord(db, id, contentType, opts); err != nil {
+			*errors = append(*errors, fmt.Errorf("content_records_plugin: delete failed: %w", err))
+		} else if !opts.SoftDelete {
+			cleanup.removeReplaced(db, previous, nil, errors)
+		}
+	case "restore":
+		idStr := GetInputFromContext(ctx, params.RecordID)
+		id, err := strconv.ParseInt(strings.TrimSpace(idStr), 10, 64)
+		if err != nil {
+			*errors = append(*errors, fmt.Errorf("content_records_plugin: invalid %s", params.RecordID))
+			return action
+		}
+		if err := setRecordTrashed(db, id, contentType, false, opts); err != nil {
+			*errors = append(*errors, fmt.Errorf("content_records_plugin: restore failed: %w", err))
+		}
+	}
+	return action
+}
+
+// bulkSetAction sets one field on every record of the list editor.
+const bulkSetAction = "bulk_set"
+
+// applyBulkSet handles a list editor POST with action=bulk_set, bulk_bind and
+// bulk_value. It updates the records the list currently shows (ids, query,
+// type and active filters) and returns the outcome for the CMS template.
+func applyBulkSet(ctx context.Context, db *sql.DB, fields Fields, contentType string, fieldDefs []cmsField, filters []recordFilter, opts writeOptions, errors *[]error) map[string]interface{} {
+	bindKey := strings.TrimSpace(GetInputFromContext(ctx, "bulk_bind"))
+	value := GetInputFromContext(ctx, "bulk_value")
+	allowed := false
+	for _, def := range fieldDefs {
+		key := def.Bind
+		if key == "" {
+			key = def.Name
+		}
+		if key == bindKey && !strings.EqualFold(strings.TrimSpace(def.Type), computedFieldType) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		*errors = append(*errors, fmt.Errorf("content_records_plugin: bulk_set: unknown field %q", bindKey))
+		return nil
+	}
+
+	ids := resolveIDs(fields)
+	if len(ids) == 0 {
+		query, args, err := resolveRecordQuery(db, fields, contentType)
+		if err == nil {
+			ids, _, err = queryRecordIDs(db, query, contentType, resolveQueryTimeout(fields), args...)
+		}
+		if err != nil {
+			*errors = append(*errors, fmt.Errorf("content_records_plugin: bulk_set failed: %w", err))
+			return nil
+		}
+	}
+	ids, err := filterRecordIDs(db, ids, contentType, filters)
+	if err == nil {
+		err = bulkSetField(db, ids, bindKey, value, opts)
+	}
+	logDebug(fields, "bulk set", "bind", bindKey, "records", len(ids), "error", err)
+	if err != nil {
+		*errors = append(*errors, fmt.Errorf("content_records_plugin: bulk_set failed: %w", err))
+		return nil
+	}
+	return map[string]interface{}{
+		"bind":    bindKey,
+		"value":   value,
+		"updated": len(ids),
+	}
+}
+
+// countWrites adds n to the db_writes counter when a transaction commit
+// succeeded and passes its error through.
+func countWrites(n int, err error) error {
+	if err == nil {
+		metrics.add("db_writes", int64(n))
+	}
+	return err
+}
+
+// bulkSetField sets bindKey to value on every record in ids in a single
+// transaction; if any record fails, none are changed.
+func bulkSetField(db *sql.DB, ids []int64, bindKey string, value string, opts writeOptions) error {
+	if opts.ReadOnly {
+		return errReadOnly
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	dialect := dialectOf(db)
+	values := map[string]string{bindKey: value}
+	return withRetry(opts, func() error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = tx.Rollback() }()
+
+		for _, id := range ids {
+			res, err := tx.Exec(`UPDATE records SET updated_at = CURRENT_TIMESTAMP, updated_by = ? WHERE id = ?`, opts.Actor, id)
+			if err != nil {
+				return err
+			}
+			if rows, _ := res.RowsAffected(); rows == 0 {
+				return fmt.Errorf("record %d not found", id)
+			}
+			if err := snapshotVersion(tx, id, opts); err != nil {
+				return err
+			}
+			if err := upsertFields(tx, dialect, id, values, opts); err != nil {
+				return err
+			}
+		}
+		return countWrites(len(ids), tx.Commit())
+	})
+}
+
+// migrateField renames bind key from to to on every record of contentType
+// in one transaction, or with copyValues keeps the value under both keys. It
+// returns how many records changed. If any record already has to, nothing
+// is changed and the number of such records is returned instead.
+func migrateField(db *sql.DB, contentType string, from string, to string, copyValues bool, opts writeOptions) (int64, int, error) {
+	if opts.ReadOnly {
+		return 0, 0, errReadOnly
+	}
+	var migrated int64
+	var conflicts int
+	err := withRetry(opts, func() error {
+		migrated, conflicts = 0, 0
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = tx.Rollback() }()
+
+		err = tx.QueryRow(`SELECT COUNT(*) FROM record_fields
+			WHERE bind_key = ? AND record_id IN (SELECT id FROM records WHERE type = ?)
+			AND record_id IN (SELECT record_id FROM record_fields WHERE bind_key = ?)`, to, contentType, from).Scan(&conflicts)
+		if err != nil || conflicts > 0 {
+			return err
+		}
+
+		// updated_at moves so data.http_caching ETags change with the binds.
+		_, err = tx.Exec(`UPDATE records SET updated_at = CURRENT_TIMESTAMP, updated_by = ?
+			WHERE type = ? AND id IN (SELECT record_id FROM record_fields WHERE bind_key = ?)`, opts.Actor, contentType, from)
+		if err != nil {
+			return err
+		}
+		var res sql.Result
+		if copyValues {
+			res, err = tx.Exec(`INSERT INTO record_fields(record_id, bind_key, value, num_value, date_value)
+				SELECT record_id, ?, value, num_value, date_value FROM record_fields
+				WHERE bind_key = ? AND record_id IN (SELECT id FROM records WHERE type = ?)`, to, from, contentType)
+		} else {
+			res, err = tx.Exec(`UPDATE record_fields SET bind_key = ?
+				WHERE bind_key = ? AND record_id IN (SELECT id FROM records WHERE type = ?)`, to, from, contentType)
+		}
+		if err != nil {
+			return err
+		}
+		migrated, _ = res.RowsAffected()
+		return countWrites(int(migrated), tx.Commit())
+	})
+	return migrated, conflicts, err
+}
+
+func readFieldValuesFromContext(ctx context.Context, fieldDefs []cmsField) map[string]string {
+	values := make(map[string]string, len(fieldDefs))
+	for _, def := range fieldDefs {
+		// Computed fields are derived at render time and never stored.
+		if strings.EqualFold(strings.TrimSpace(def.Type), computedFieldType) {
+			continue
+		}
+		key := def.Bind
+		if key == "" {
+			key = def.Name
+		}
+		values[key] = GetInputFromContext(ctx, key)
+		if def.Separator != "" {
+			// List textareas post one item per line.
+			values[key] = joinListValue(strings.Split(values[key], "\n"), def.Separator)
+		}
+		for _, companion := range []string{def.AltBind, def.CaptionBind} {
+			if companion != "" {
+				values[companion] = GetInputFromContext(ctx, companion)
+			}
+		}
+	}
+	return values
+}
+
+func resolveUploadDir(fields Fields) string {
+	if strings.TrimSpace(fields.UploadDir) != "" {
+		return strings.TrimSpace(fields.UploadDir)
+	}
+	if strings.TrimSpace(fields.Upload) != "" {
+		return strings.TrimSpace(fields.Upload)
+	}
+	return ""
+}
+
+// uploadOptions are the settings for files posted to edit forms.
+type uploadOptions struct {
+	Dir       string    // data.upload_dir; empty drops image/file uploads
+	URLPrefix string    // data.upload_url_prefix; empty stores the disk path
+	Charset   string    // data.upload_charset for text-field uploads
+	Modes     fileModes // data.dir_mode / data.file_mode
+}
+
+func resolveUploadOptions(fields Fields) uploadOptions {
+	// Invalid modes already failed openStore.
+	modes, _ := parseFileModes(fields.DirMode, fields.FileMode)
+	return uploadOptions{
+		Dir:       resolveUploadDir(fields),
+		URLPrefix: strings.TrimRight(strings.TrimSpace(fields.UploadURLPrefix), "/"),
+		Charset:   fields.UploadCharset,
+		Modes:     modes,
+	}
+}
+
+// storedPath is the field value for a file saved as name in Dir: its web
+// path under URLPrefix, or the disk path when no prefix is set.
+func (u uploadOptions) storedPath(name string) string {
+	if u.URLPrefix == "" {
+		return filepath.Join(u.Dir, name)
+	}
+	return u.URLPrefix + "/" + name
+}
+
+// diskPath maps a stored field value back to the file it names. Values
+// outside URLPrefix are returned as they are, so paths stored before the
+// prefix was set still resolve.
+func (u uploadOptions) diskPath(value string) string {
+	if u.URLPrefix == "" || !strings.HasPrefix(value, u.URLPrefix+"/") {
+		return value
+	}
+	return filepath.Join(u.Dir, filepath.FromSlash(strings.TrimPrefix(value, u.URLPrefix+"/")))
+}
+
+// fileModes are the permissions for created directories and written files
+// (data.dir_mode, data.file_mode). Directory modes are subject to the umask.
+type fileModes struct {
+	Dir  os.FileMode
+	File os.FileMode
+}
+
+var defaultFileModes = fileModes{Dir: 0o755, File: 0o644}
+
+// parseFileModes reads data.dir_mode and data.file_mode as octal ("0750",
+// "750" or "0o750"); empty values keep the defaults.
+func parseFileModes(dirMode, fileMode string) (fileModes, error) {
+	modes := defaultFileModes
+	for _, option := range []struct {
+		key, value string
+		mode       *os.FileMode
+	}{{"dir_mode", dirMode, &modes.Dir}, {"file_mode", fileMode, &modes.File}} {
+		value := strings.TrimPrefix(strings.TrimSpace(option.value), "0o")
+		if value == "" {
+			continue
+		}
+		n, err := strconv.ParseUint(value, 8, 32)
+		if err != nil || n > 0o777 {
+			return modes, fmt.Errorf("content_records_plugin: %s: expected octal permissions such as 0755, got %q", option.key, option.value)
+		}
+		*option.mode = os.FileMode(n)
+	}
+	return modes, nil
+}
+
+// mergeUploads stores files posted for image/file fields under uploads.Dir
+// and reads files posted for text fields into their value as UTF-8 (see
+// decodeTextUpload). Image and file uploads are copied verbatim.
+func mergeUploads(ctx context.Context, fieldDefs []cmsField, uploads uploadOptions, values map[string]string, errors *[]error) {
+	req, _ := ctx.Value(shared.Request).(*http.Request)
+	if req == nil {
+		return
+	}
+
+	contentType := req.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "multipart/form-data") {
+		return
+	}
+
+	if err := req.ParseMultipartForm(20 << 20); err != nil {
+		*errors = append(*errors, fmt.Errorf("content_records_plugin: upload parse failed: %w", err))
+		return
+	}
+
+	for _, def := range fieldDefs {
+		key := def.Bind
+		if key == "" {
+			key = def.Name
+		}
+		if isTextFieldType(def.Type) {
+			text, ok, err := readTextUpload(req, key, uploads.Charset)
+			if err != nil {
+				*errors = append(*errors, fmt.Errorf("content_records_plugin: text upload %s rejected: %w", key, err))
+			} else if ok {
+				values[key] = text
+			}
+			continue
+		}
+		if !isUploadFieldType(def.Type) || uploads.Dir == "" {
+			continue
+		}
+		path, err := saveUploadFile(req, key, uploads)
+		if err != nil {
+			*errors = append(*errors, fmt.Errorf("content_records_plugin: upload failed: %w", err))
+			continue
+		}
+		if path != "" {
+			values[key] = path
+		}
+	}
+}
+
+func isUploadFieldType(fieldType string) bool {
+	switch strings.ToLower(strings.TrimSpace(fieldType)) {
+	case "image", "file":
+		return true
+	default:
+		return false
+	}
+}
+
+func isTextFieldType(fieldType string) bool {
+	switch strings.ToLower(strings.TrimSpace(fieldType)) {
+	case "", "text", "textarea", "markdown", "richtext", "html":
+		return true
+	default:
+		return false
+	}
+}
+
+// maxTextUpload caps a file read into a text field.
+const maxTextUpload = 1 << 20
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// readTextUpload reads the file posted as fieldName for a text field. ok is
+// false when no file was posted.
+func readTextUpload(req *http.Request, fieldName, charset string) (string, bool, error) {
+	file, header, err := req.FormFile(fieldName)
+	if err != nil {
+		if err == http.ErrMissingFile {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxTextUpload+1))
+	if err != nil {
+		return "", false, err
+	}
+	if len(data) > maxTextUpload {
+		return "", false, fmt.Errorf("file is larger than %d bytes", maxTextUpload)
+	}
+	declared := ""
+	if _, params, err := mime.ParseMediaType(header.Header.Get("Content-Type")); err == nil {
+		declared = params["charset"]
+	}
+	text, err := decodeTextUpload(data, declared, charset)
+	return text, err == nil, err
+}
+
+// decodeTextUpload returns data as UTF-8. A charset declared on the upload
+// part wins over fallback (data.upload_charset). Without either, data must
+// already be valid UTF-8; "auto" keeps valid UTF-8 and reads anything else
+// as windows-1252, the superset of Latin-1 browsers use for it. Names follow
+// the WHATWG encoding labels, so iso-8859-1 also decodes as windows-1252.
+func decodeTextUpload(data []byte, declared, fallback string) (string, error) {
+	name := strings.ToLower(strings.TrimSpace(declared))
+	if name == "" {
+		name = strings.ToLower(strings.TrimSpace(fallback))
+	}
+	switch name {
+	case "":
+		name = "utf-8"
+	case "auto":
+		name = "utf-8"
+		if !utf8.Valid(data) {
+			name = "windows-1252"
+		}
+	}
+
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		return "", fmt.Errorf("unknown charset %q", name)
+	}
+	if canonical, _ := htmlindex.Name(enc); canonical == "utf-8" {
+		if !utf8.Valid(data) {
+			return "", fmt.Errorf("file is not valid UTF-8; declare its charset or set data.upload_charset")
+		}
+		return string(bytes.TrimPrefix(data, utf8BOM)), nil
+	}
+	decoded, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return "", fmt.Errorf("decode %s: %w", name, err)
+	}
+	return string(bytes.TrimPrefix(decoded, utf8BOM)), nil
+}
+
+// fileCleanup removes uploaded files that a delete or update left orphaned
+// (data.cleanup_files). Only files inside upload_dir are touched, and never
+// while another record or the template defaults still reference them. A nil
+// *fileCleanup is a valid no-op.
+type fileCleanup struct {
+	uploads   uploadOptions
+	keys      []string
+	protected map[string]struct{}
+}
+
+func newFileCleanup(fields Fields, fieldDefs []cmsField, template map[string]interface{}, binds map[string]bindTarget) *fileCleanup {
+	uploads := resolveUploadOptions(fields)
+	if !fields.CleanupFiles || uploads.Dir == "" {
+		return nil
+	}
+	cleanup := &fileCleanup{
+		uploads:   uploads,
+		protected: map[string]struct{}{},
+	}
+	for _, def := range fieldDefs {
+		if !isUploadFieldType(def.Type) {
+			continue
+		}
+		key := def.Bind
+		if key == "" {
+			key = def.Name
+		}
+		cleanup.keys = append(cleanup.keys, key)
+	}
+	if len(cleanup.keys) == 0 {
+		return nil
+	}
+	for _, value := range defaultValuesFromTemplate(template, binds) {
+		if value != "" {
+			cleanup.protected[value] = struct{}{}
+		}
+	}
+	return cleanup
+}
+
+// snapshot returns the current file field values of a record.
+func (c *fileCleanup) snapshot(db *sql.DB, recordID int64, contentType string) map[string]string {
+	if c == nil || recordID == 0 {
+		return nil
+	}
+	rec, err := fetchRecordByID(db, recordID, contentType)
+	if err != nil {
+		return nil
+	}
+	out := make(map[string]string, len(c.keys))
+	for _, key := range c.keys {
+		if value := strings.TrimSpace(rec.Fields[key]); value != "" {
+			out[key] = value
+		}
+	}
+	return out
+}
+
+// removeReplaced deletes previous files whose field was changed. A nil
+// current map means the record was deleted, so every previous file goes.
+func (c *fileCleanup) removeReplaced(db *sql.DB, previous map[string]string, current map[string]string, errors *[]error) {
+	if c == nil {
+		return
+	}
+	for key, path := range previous {
+		if current != nil {
+			next, touched := current[key]
+			if !touched || strings.TrimSpace(next) == path {
+				continue
+			}
+		}
+		if _, ok := c.protected[path]; ok {
+			continue
+		}
+		if refs, err := countFileRefs(db, path); err != nil || refs > 0 {
+			continue
+		}
+		if err := removeUploadedFile(c.uploads.diskPath(path), c.uploads.Dir); err != nil && errors != nil {
+			*errors = append(*errors, fmt.Errorf("content_records_plugin: file cleanup failed: %w", err))
+		}
+	}
+}
+
+// countFileRefs counts the stored values, in record_fields and any columns
+// tables, that still point at path.
+func countFileRefs(db *sql.DB, path string) (int, error) {
+	var refs int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM record_fields WHERE value = ?`, path).Scan(&refs); err != nil {
+		return 0, err
+	}
+	for _, layout := range columnLayoutsOf(db) {
+		var conds []string
+		var args []interface{}
+		for _, bind := range layout.Binds {
+			if !layout.Numeric[bind] {
+				conds = append(conds, layout.ident(bind)+" = ?")
+				args = append(args, path)
+			}
+		}
+		if len(conds) == 0 {
+			continue
+		}
+		var n int
+		query := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE %s`, layout.ident(layout.Table), strings.Join(conds, " OR "))
+		if err := db.QueryRow(query, args...).Scan(&n); err != nil {
+			return 0, err
+		}
+		refs += n
+	}
+	return refs, nil
+}
+
+// removeUploadedFile deletes path only when it resolves inside uploadDir.
+// Missing files are not an error.
+func removeUploadedFile(path, uploadDir string) error {
+	absDir, err := filepath.Abs(uploadDir)
+	if err != nil {
+		return err
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(absDir, absPath)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+		return nil
+	}
+	if err := os.Remove(absPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+type inlineUpdatePayload struct {
+	Inline   string
+	RecordID string
+	Bind     string
+	Value    string
+}
+
+// rateLimit allows Burst writes per Interval, refilled continuously.
+type rateLimit struct {
+	Burst    int
+	Interval time.Duration
+}
+
+// parseRateLimit accepts "N/interval" ("30/1m", "5/10s") or a bare N per minute.
+func parseRateLimit(value string) (rateLimit, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return rateLimit{}, false
+	}
+	count, interval := value, "1m"
+	if i := strings.Index(value, "/"); i >= 0 {
+		count, interval = strings.TrimSpace(value[:i]), strings.TrimSpace(value[i+1:])
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil || n <= 0 {
+		return rateLimit{}, false
+	}
+	d, err := time.ParseDuration(interval)
+	if err != nil {
+		// Allow "30/s" and "30/m" shorthands.
+		d, err = time.ParseDuration("1" + interval)
+	}
+	if err != nil || d <= 0 {
+		return rateLimit{}, false
+	}
+	return rateLimit{Burst: n, Interval: d}, true
+}
+
+// rateLimitClient identifies the writer: the actor set by the host when known,
+// otherwise the remote address. data.actor_header and forwarded headers are
+// ignored because clients can set them.
+func rateLimitClient(req *http.Request, actor string) string {
+	if actor != "" {
+		return "actor:" + actor
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+type tokenBucket struct {
+	tokens   float64
+	last     time.Time
+	interval time.Duration
+}
+
+// rateLimiter holds token buckets keyed by store, type and client.
+type rateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+var writeLimiter = &rateLimiter{buckets: map[string]*tokenBucket{}}
+
+// rateLimitSweepInterval controls how often idle buckets are dropped.
+const rateLimitSweepInterval = time.Minute
+
+// allow takes one token for key. When the bucket is empty it reports how long
+// until the next token is available.
+func (l *rateLimiter) allow(key string, limit rateLimit, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	perToken := limit.Interval / time.Duration(limit.Burst)
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		// A bucket idle for a full interval is full again and can be dropped.
+		for k, b := range l.buckets {
+			if now.Sub(b.last) >= b.interval {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(limit.Burst), last: now, interval: limit.Interval}
+		l.buckets[key] = bucket
+	}
+	elapsed := now.Sub(bucket.last)
+	if elapsed > 0 {
+		bucket.tokens = math.Min(float64(limit.Burst), bucket.tokens+float64(elapsed)/float64(perToken))
+		bucket.last = now
+	}
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - bucket.tokens) * float64(perToken))
+	return false, wait
+}
+
+func handleInlineUpdate(ctx context.Context, db *sql.DB, contentType string, binds map[string]bindTarget, fields Fields, template map[string]interface{}, errors *[]error) (bool, any) {
+	req, _ := ctx.Value(shared.Request).(*http.Request)
+	if req == nil || req.Method != http.MethodPost {
+		return false, nil
+	}
+
+	payload, err := parseInlinePayload(req, ctx, fields, errors)
+	if err != nil {
+		logDebug(fields, "inline payload rejected", "error", err)
+		if errors != nil {
+			*errors = append(*errors, fmt.Errorf("content_records_plugin: inline parse failed: %w", err))
+		}
+		return true, writeInlineJSON(ctx, http.StatusBadRequest, map[string]interface{}{
+			"error": "invalid inline payload",
+		})
+	}
+
+	if !parseBoolFlag(payload.Inline) {
+		return false, nil
+	}
+
+	if fields.ReadOnly {
+		logDebug(fields, "inline update rejected, read-only", "type", contentType)
+		return true, writeInlineJSON(ctx, http.StatusForbidden, map[string]interface{}{
+			"error": errReadOnly.Error(),
+		})
+	}
+
+	if limit, ok := parseRateLimit(fields.RateLimit); ok {
+		client := rateLimitClient(req, hostActor(ctx))
+		key := fields.Store + "|" + contentType + "|" + client
+		if allowed, wait := writeLimiter.allow(key, limit, time.Now()); !allowed {
+			logDebug(fields, "inline update rate limited", "client", client, "type", contentType)
+			if writer, _ := ctx.Value(shared.ResponseWriter).(http.ResponseWriter); writer != nil {
+				writer.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			}
+			return true, writeInlineJSON(ctx, http.StatusTooManyRequests, map[string]interface{}{
+				"error": "rate limit exceeded",
+			})
+		}
+	}
+
+	bindKey := strings.TrimSpace(payload.Bind)
+	if bindKey == "" {
+		return true, writeInlineJSON(ctx, http.StatusBadRequest, map[string]interface{}{
+			"error": "bind is required",
+		})
+	}
+	if _, ok := binds[bindKey]; !ok {
+		// Allow nested ContentRecords plugins to handle binds outside this template.
+		if hasBoundaryPlugin(template) {
+			return false, nil
+		}
+		return true, writeInlineJSON(ctx, http.StatusBadRequest, map[string]interface{}{
+			"error": "unknown bind",
+		})
+	}
+	if _, ok := resolveComputedExprs(fields, binds)[bindKey]; ok {
+		return true, writeInlineJSON(ctx, http.StatusBadRequest, map[string]interface{}{
+			"error": "computed fields are read-only",
+		})
+	}
+	if _, locked := resolveInlineLockedBinds(fields, binds)[bindKey]; locked {
+		logDebug(fields, "inline update refused", "bind", bindKey)
+		return true, writeInlineJSON(ctx, http.StatusForbidden, map[string]interface{}{
+			"error": "field is not inline-editable",
+		})
+	}
+
+	recordID := lookupRecordRef(db, payload.RecordID)
+	if recordID == 0 {
+		recordID = resolvePathRecordID(fields, ctx)
+	}
+	if recordID == 0 {
+		recordID = lookupRecordRef(db, pathRecordSegment(fields, ctx))
+	}
+	if recordID == 0 {
+		recordID = lookupRecordRef(db, GetInputFromContext(ctx, resolveRecordParam(fields)))
+	}
+	if recordID == 0 {
+		return true, writeInlineJSON(ctx, http.StatusBadRequest, map[string]interface{}{
+			"error": "record_id is required",
+		})
+	}
+
+	value := payload.Value
+	contentTypeHeader := req.Header.Get("Content-Type")
+	if strings.HasPrefix(contentTypeHeader, "multipart/form-data") {
+		uploads := resolveUploadOptions(fields)
+		if uploads.Dir == "" && hasFileUpload(req, "file", bindKey) {
+			return true, writeInlineJSON(ctx, http.StatusBadRequest, map[string]interface{}{
+				"error": "upload_dir is required for file uploads",
+			})
+		}
+		if uploads.Dir != "" {
+			path, err := saveUploadFile(req, "file", uploads)
+			if err != nil {
+				if errors != nil {
+					*errors = append(*errors, fmt.Errorf("content_records_plugin: upload failed: %w", err))
+				}
+				return true, writeInlineJSON(ctx, http.StatusBadRequest, map[string]interface{}{
+					"error": "upload failed",
+				})
+			}
+			if path == "" {
+				path, err = saveUploadFile(req, bindKey, uploads)
+				if err != nil {
+					if errors != nil {
+						*errors = append(*errors, fmt.Errorf("content_records_plugin: upload failed: %w", err))
+					}
+					return true, writeInlineJSON(ctx, http.StatusBadRequest, map[string]interface{}{
+						"error": "upload failed",
+					})
+				}
+			}
+			if path != "" {
+				value = path
+			}
+		}
+	}
+
+	cleanup := newFileCleanup(fields, collectCMSFields(fields, binds), template, binds)
+	previous := cleanup.snapshot(db, recordID, contentType)
+	if err := updateRecordField(db, recordID, contentType, bindKey, value, resolveWriteOptions(fields, binds, ctx)); err != nil {
+		logDebug(fields, "inline update failed", "record_id", recordID, "bind", bindKey, "error", err)
+		if err == errRecordNotFound {
+			return true, writeInlineJSON(ctx, http.StatusNotFound, map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		if errors != nil {
+			*errors = append(*errors, fmt.Errorf("content_records_plugin: inline update failed: %w", err))
+		}
+		return true, writeInlineJSON(ctx, http.StatusInternalServerError, map[string]interface{}{
+			"error": "update failed",
+		})
+	}
+
+	cleanup.removeReplaced(db, previous, map[string]string{bindKey: value}, errors)
+	logDebug(fields, "inline update applied", "record_id", recordID, "bind", bindKey)
+	return true, writeInlineJSON(ctx, http.StatusOK, map[string]interface{}{
+		"status":    "ok",
+		"record_id": strconv.FormatInt(recordID, 10),
+		"bind":      bindKey,
+		"value":     value,
+	})
+}
+
+func parseInlinePayload(req *http.Request, ctx context.Context, fields Fields, errors *[]error) (inlineUpdatePayload, error) {
+	contentType := req.Header.Get("Content-Type")
+	if strings.HasPrefix(contentType, "application/json") {
+		payload, err := decodeInlineJSON(req)
+		if err != nil {
+			return inlineUpdatePayload{}, err
+		}
+		return inlineUpdatePayload{
+			Inline:   firstNonEmpty(getStringFromAny(payload["cr_inline"]), getStringFromAny(payload["inline"])),
+			RecordID: firstNonEmpty(getStringFromAny(payload["record_id"]), getStringFromAny(payload["id"])),
+			Bind:     firstNonEmpty(getStringFromAny(payload["bind"]), getStringFromAny(payload["field"])),
+			Value:    getStringFromAny(payload["value"]),
+		}, nil
+	}
+
+	parseRequestForm(req, errors)
+	return inlineUpdatePayload{
+		Inline:   firstNonEmpty(GetInputFromContext(ctx, "cr_inline"), GetInputFromContext(ctx, "inline")),
+		RecordID: firstNonEmpty(GetInputFromContext(ctx, "record_id"), GetInputFromContext(ctx, resolveRecordParam(fields))),
+		Bind:     firstNonEmpty(GetInputFromContext(ctx, "bind"), GetInputFromContext(ctx, "field")),
+		Value:    GetInputFromContext(ctx, "value"),
+	}, nil
+}
+
+// decodeInlineJSON reads the JSON payload while restoring req.Body so nested
+// ContentRecords plugins can parse the same request.
+func decodeInlineJSON(req *http.Request) (map[string]interface{}, error) {
+	payload := map[string]interface{}{}
+	if req == nil || req.Body == nil {
+		return payload, nil
+	}
+
+	bodyBytes, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	_ = req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+
+	if len(bytes.TrimSpace(bodyBytes)) == 0 {
+		return payload, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(bodyBytes))
+	decoder.UseNumber()
+	if err := decoder.Decode(&payload); err != nil {
+		if err == io.EOF {
+			return map[string]interface{}{}, nil
+		}
+		return nil, err
+	}
+	return payload, nil
+}
+
+func getStringFromAny(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 64)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case int32:
+		return strconv.FormatInt(int64(v), 10)
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func hasFileUpload(req *http.Request, fieldNames ...string) bool {
+	if req == nil {
+		return false
+	}
+	if req.MultipartForm == nil {
+		return false
+	}
+	for _, name := range fieldNames {
+		if files := req.MultipartForm.File[name]; len(files) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func writeInlineJSON(ctx context.Context, status int, payload map[string]interface{}) string {
+	writer, _ := ctx.Value(shared.ResponseWriter).(http.ResponseWriter)
+	if writer != nil {
+		writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+		writer.WriteHeader(status)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return `{"error":"inline response failed"}`
+	}
+	return string(data)
+}
+
+// saveUploadFile copies the file posted as fieldName into uploads.Dir and
+// returns the value to store for it; "" when nothing was posted.
+func saveUploadFile(req *http.Request, fieldName string, uploads uploadOptions) (string, error) {
+	file, header, err := req.FormFile(fieldName)
+	if err != nil {
+		if err == http.ErrMissingFile {
+			return "", nil
+		}
+		return "", err
+	}
+	defer file.Close()
+
+	if err := os.MkdirAll(uploads.Dir, uploads.Modes.Dir); err != nil {
+		return "", err
+	}
+
+	ext := filepath.Ext(header.Filename)
+	base := strings.TrimSuffix(filepath.Base(header.Filename), ext)
+	base = sanitizeFilename(base)
+	if base == "" {
+		base = "upload"
+	}
+	filename := fmt.Sprintf("%s-%d%s", base, time.Now().UnixNano(), ext)
+	destPath := filepath.Join(uploads.Dir, filename)
+
+	dest, err := os.Create(destPath)
+	if err != nil {
+		return "", err
+	}
+	defer dest.Close()
+	if err := dest.Chmod(uploads.Modes.File); err != nil {
+		return "", err
+	}
+
+	if _, err := io.Copy(dest, file); err != nil {
+		return "", err
+	}
+
+	return uploads.storedPath(filename), nil
+}
+
+func sanitizeFilename(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z':
+			b.WriteRune(r)
+		case r >= 'A' && r <= 'Z':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == '-' || r == '_' || r == '.':
+			b.WriteRune(r)
+		case r == ' ':
+			b.WriteRune('-')
+		}
+	}
+	return b.String()
+}
+
+func createRecord(db *sql.DB, contentType string, values map[string]string, opts writeOptions) (int64, error) {
+	ids, err := createRecords(db, contentType, []map[string]string{values}, opts)
+	if err != nil {
+		return 0, err
+	}
+	return ids[0], nil
+}
+
+// createRecords inserts every value set in one transaction: either all
+// records are created or none are. With opts.NaturalKey set, a value set
+// whose key matches an existing record updates that record instead; a
+// missing key value or a key shared by several records is an error.
+func createRecords(db *sql.DB, contentType string, batch []map[string]string, opts writeOptions) ([]int64, error) {
+	if opts.ReadOnly {
+		return nil, errReadOnly
+	}
+	var recordIDs []int64
+	dialect := dialectOf(db)
+	err := withRetry(opts, func() error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		// Rollback is a no-op once the transaction has been committed.
+		defer func() { _ = tx.Rollback() }()
+
+		ids := make([]int64, 0, len(batch))
+		for _, values := range batch {
+			if opts.NaturalKey != "" {
+				id, err := matchNaturalKey(tx, contentType, opts.NaturalKey, values, opts.Columns)
+				if err != nil {
+					return err
+				}
+				if id != 0 {
+					if err := replaceRecordFields(tx, dialect, id, values, opts); err != nil {
+						return err
+					}
+					ids = append(ids, id)
+					continue
+				}
+			}
+			var res sql.Result
+			if opts.IDStrategy != "" {
+				uid, err := newRecordUID(opts.IDStrategy)
+				if err != nil {
+					return err
+				}
+				res, err = tx.Exec(`INSERT INTO records(type, uid, created_by, updated_by) VALUES(?, ?, ?, ?)`, contentType, uid, opts.Actor, opts.Actor)
+				if err != nil {
+					return err
+				}
+			} else {
+				res, err = tx.Exec(`INSERT INTO records(type, created_by, updated_by) VALUES(?, ?, ?)`, contentType, opts.Actor, opts.Actor)
+				if err != nil {
+					return err
+				}
+			}
+			id, err := res.LastInsertId()
+			if err != nil {
+				return err
+			}
+			if err := upsertFields(tx, dialect, id, values, opts); err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		if err := evictOverCap(tx, contentType, opts); err != nil {
+			return err
+		}
+
+		if err := countWrites(len(ids), tx.Commit()); err != nil {
+			return err
+		}
+		recordIDs = ids
+		return nil
+	})
+	return recordIDs, err
+}
+
+func createRecordFromTemplate(db *sql.DB, contentType string, template map[string]interface{}, binds map[string]bindTarget, opts writeOptions) (int64, error) {
+	// Template defaults are placeholders, not business keys; never let them
+	// match an existing record.
+	opts.NaturalKey = ""
+	values := defaultValuesFromTemplate(template, binds)
+	return createRecord(db, contentType, values, opts)
+}
+
+// matchNaturalKey returns the id of the record of contentType whose key bind
+// equals the key value in values, or 0 when there is none. layout is set for
+// data.storage = columns.
+func matchNaturalKey(tx *sql.Tx, contentType string, key string, values map[string]string, layout *columnLayout) (int64, error) {
+	value := strings.TrimSpace(values[key])
+	if value == "" {
+		return 0, fmt.Errorf("natural key %q is required", key)
+	}
+	query := `SELECT rf.record_id FROM record_fields rf JOIN records r ON r.id = rf.record_id
+		WHERE rf.bind_key = ? AND rf.value = ? AND COALESCE(r.type, '') = ? LIMIT 2`
+	args := []interface{}{key, value, contentType}
+	if layout != nil {
+		if !layout.has(key) {
+			return 0, fmt.Errorf("natural key %q has no column in %s", key, layout.Table)
+		}
+		query = fmt.Sprintf(`SELECT c.record_id FROM %s c JOIN records r ON r.id = c.record_id
+		WHERE c.%s = ? AND COALESCE(r.type, '') = ? LIMIT 2`, layout.ident(layout.Table), layout.ident(key))
+		args = []interface{}{value, contentType}
+	}
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	switch len(ids) {
+	case 0:
+		return 0, nil
+	case 1:
+		return ids[0], nil
+	default:
+		return 0, fmt.Errorf("natural key %s=%q matches more than one record", key, value)
+	}
+}
+
+// replaceRecordFields writes values to an existing record inside tx,
+// honouring opts.MergeUpdate.
+func replaceRecordFields(tx *sql.Tx, dialect *storeDialect, recordID int64, values map[string]string, opts writeOptions) error {
+	if _, err := tx.Exec(`UPDATE records SET updated_at = CURRENT_TIMESTAMP, updated_by = ? WHERE id = ?`, opts.Actor, recordID); err != nil {
+		return err
+	}
+	if err := snapshotVersion(tx, recordID, opts); err != nil {
+		return err
+	}
+	if !opts.MergeUpdate {
+		if err := clearRecordFields(tx, recordID, opts); err != nil {
+			return err
+		}
+	}
+	return upsertFields(tx, dialect, recordID, values, opts)
+}
+
+// updateRecord writes values to a record and reports whether it did. With
+// opts.TouchOnChangeOnly, values that match the stored fields leave the
+// record, its updated_at and its versions alone and report false.
+func updateRecord(db *sql.DB, recordID int64, contentType string, values map[string]string, opts writeOptions) (bool, error) {
+	if opts.ReadOnly {
+		return false, errReadOnly
+	}
+	changed := true
+	err := withRetry(opts, func() error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = tx.Rollback() }()
+
+		if opts.TouchOnChangeOnly {
+			stored, err := storedFields(tx, recordID, opts)
+			if err != nil {
+				return err
+			}
+			if changed = fieldsDiffer(stored, values, opts.MergeUpdate); !changed {
+				return nil
+			}
+		}
+
+		if contentType != "" {
+			if _, err := tx.Exec(`UPDATE records SET updated_at = CURRENT_TIMESTAMP, updated_by = ? WHERE id = ? AND type = ?`, opts.Actor, recordID, contentType); err != nil {
+				return err
+			}
+		} else {
+			if _, err := tx.Exec(`UPDATE records SET updated_at = CURRENT_TIMESTAMP, updated_by = ? WHERE id = ?`, opts.Actor, recordID); err != nil {
+				return err
+			}
+		}
+
+		if err := snapshotVersion(tx, recordID, opts); err != nil {
+			return err
+		}
+
+		if !opts.MergeUpdate {
+			if err := clearRecordFields(tx, recordID, opts); err != nil {
+				return err
+			}
+		}
+
+		if err := upsertFields(tx, dialectOf(db), recordID, values, opts); err != nil {
+			return err
+		}
+
+		return countWrites(1, tx.Commit())
+	})
+	return changed && err == nil, err
+}
+
+// storedFields reads a record's current field values inside tx.
+func storedFields(tx *sql.Tx, recordID int64, opts writeOptions) (map[string]string, error) {
+	if opts.Columns != nil {
+		return fetchColumnRow(tx, opts.Columns, recordID)
+	}
+	rows, err := tx.Query(`SELECT bind_key, value FROM record_fields WHERE record_id = ?`, recordID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string]string{}
+	for rows.Next() {
+		var key string
+		var value sql.NullString
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		out[key] = value.String
+	}
+	return out, rows.Err()
+}
+
+// fieldsDiffer reports whether writing values would change stored. A merge
+// update only compares the submitted keys; a replacing update also counts
+// stored keys that would be dropped.
+func fieldsDiffer(stored, values map[string]string, merge bool) bool {
+	for key, value := range values {
+		if current, ok := stored[key]; !ok || current != value {
+			return true
+		}
+	}
+	return !merge && len(stored) != len(values)
+}
+
+func updateRecordField(db *sql.DB, recordID int64, contentType string, bindKey string, value string, opts writeOptions) error {
+	if opts.ReadOnly {
+		return errReadOnly
+	}
+	if recordID == 0 {
+		return fmt.Errorf("record id is required")
+	}
+	if strings.TrimSpace(bindKey) == "" {
+		return fmt.Errorf("bind key is required")
+	}
+
+	return withRetry(opts, func() error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = tx.Rollback() }()
+
+		if opts.TouchOnChangeOnly {
+			stored, err := storedFields(tx, recordID, opts)
+			if err != nil {
+				return err
+			}
+			if !fieldsDiffer(stored, map[string]string{bindKey: value}, true) {
+				return nil
+			}
+		}
+
+		var res sql.Result
+		if contentType != "" {
+			res, err = tx.Exec(`UPDATE records SET updated_at = CURRENT_TIMESTAMP, updated_by = ? WHERE id = ? AND type = ?`, opts.Actor, recordID, contentType)
+		} else {
+			res, err = tx.Exec(`UPDATE records SET updated_at = CURRENT_TIMESTAMP, updated_by = ? WHERE id = ?`, opts.Actor, recordID)
+		}
+		if err != nil {
+			return err
+		}
+		if rows, _ := res.RowsAffected(); rows == 0 {
+			return errRecordNotFound
+		}
+
+		if err := snapshotVersion(tx, recordID, opts); err != nil {
+			return err
+		}
+
+		if err := upsertFields(tx, dialectOf(db), recordID, map[string]string{bindKey: value}, opts); err != nil {
+			return err
+		}
+
+		return countWrites(1, tx.Commit())
+	})
+}
+
+func deleteRecord(db *sql.DB, recordID int64, contentType string, opts writeOptions) error {
+	if opts.ReadOnly {
+		return errReadOnly
+	}
+	if opts.SoftDelete {
+		return setRecordTrashed(db, recordID, contentType, true, opts)
+	}
+	return withRetry(opts, func() error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = tx.Rollback() }()
+
+		if err := clearRecordFields(tx, recordID, opts); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM record_field_versions WHERE record_id = ?`, recordID); err != nil {
+			return err
+		}
+		if contentType != "" {
+			if _, err := tx.Exec(`DELETE FROM records WHERE id = ? AND type = ?`, recordID, contentType); err != nil {
+				return err
+			}
+		} else {
+			if _, err := tx.Exec(`DELETE FROM records WHERE id = ?`, recordID); err != nil {
+				return err
+			}
+		}
+		return countWrites(1, tx.Commit())
+	})
+}
+
+// setRecordTrashed moves a record to the trash (data.soft_delete) or restores
+// it by setting or clearing records.deleted_at. Fields, versions and uploaded
+// files are left alone, so a restore brings the record back unchanged.
+func setRecordTrashed(db *sql.DB, recordID int64, contentType string, trashed bool, opts writeOptions) error {
+	if opts.ReadOnly {
+		return errReadOnly
+	}
+	query := `UPDATE records SET deleted_at = NULL, updated_at = CURRENT_TIMESTAMP, updated_by = ? WHERE id = ?`
+	if trashed {
+		query = `UPDATE records SET deleted_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP, updated_by = ? WHERE id = ?`
+	}
+	args := []interface{}{opts.Actor, recordID}
+	if contentType != "" {
+		query += ` AND type = ?`
+		args = append(args, contentType)
+	}
+	return withRetry(opts, func() error {
+		res, err := db.Exec(query, args...)
+		if err != nil {
+			return err
+		}
+		if rows, _ := res.RowsAffected(); rows == 0 {
+			return errRecordNotFound
+		}
+		return countWrites(1, nil)
+	})
+}
+
+// evictOverCap deletes the oldest records of contentType (by created_at,
+// then id) beyond opts.MaxRecords, inside the create transaction.
+func evictOverCap(tx *sql.Tx, contentType string, opts writeOptions) error {
+	if opts.MaxRecords <= 0 {
+		return nil
+	}
+	rows, err := tx.Query(`SELECT id FROM records WHERE type = ? ORDER BY created_at DESC, id DESC`, contentType)
+	if err != nil {
+		return err
+	}
+	var evict []int64
+	for kept := 0; rows.Next(); kept++ {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		if kept >= opts.MaxRecords {
+			evict = append(evict, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, id := range evict {
+		if err := clearRecordFields(tx, id, opts); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM record_field_versions WHERE record_id = ?`, id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM records WHERE id = ?`, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clearRecordFields removes a record's stored field values inside tx.
+func clearRecordFields(tx *sql.Tx, recordID int64, opts writeOptions) error {
+	query := `DELETE FROM record_fields WHERE record_id = ?`
+	if opts.Columns != nil {
+		query = fmt.Sprintf(`DELETE FROM %s WHERE record_id = ?`, opts.Columns.ident(opts.Columns.Table))
+	}
+	_, err := tx.Exec(query, recordID)
+	return err
+}
+
+// snapshotVersion copies a record's current fields into record_field_versions
+// as the next version and prunes versions beyond opts.MaxVersions. It runs in
+// the caller's update transaction, before the new values are written.
+func snapshotVersion(tx *sql.Tx, recordID int64, opts writeOptions) error {
+	if opts.MaxVersions <= 0 {
+		return nil
+	}
+	var version int
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(version), 0) + 1 FROM record_field_versions WHERE record_id = ?`, recordID).Scan(&version); err != nil {
+		return err
+	}
+	if opts.Columns != nil {
+		values, err := fetchColumnRow(tx, opts.Columns, recordID)
+		if err != nil {
+			return err
+		}
+		for key, value := range values {
+			if _, err := tx.Exec(
+				`INSERT INTO record_field_versions(record_id, version, bind_key, value, created_by) VALUES(?, ?, ?, ?, ?)`,
+				recordID, version, key, value, opts.Actor,
+			); err != nil {
+				return err
+			}
+		}
+	} else if _, err := tx.Exec(
+		`INSERT INTO record_field_versions(record_id, version, bind_key, value, created_by)
+		SELECT record_id, ?, bind_key, value, ? FROM record_fields WHERE record_id = ?`,
+		version, opts.Actor, recordID,
+	); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`DELETE FROM record_field_versions WHERE record_id = ? AND version <= ?`, recordID, version-opts.MaxVersions)
+	return err
+}
+
+// recordVersion is one snapshot from record_field_versions.
+type recordVersion struct {
+	Version   int
+	CreatedAt string
+	CreatedBy string
+	Fields    map[string]string
+}
+
+// fetchRecordVersions returns a record's snapshots, newest first.
+func fetchRecordVersions(db *sql.DB, recordID int64) ([]recordVersion, error) {
+	rows, err := db.Query(
+		`SELECT version, bind_key, value, created_at, created_by FROM record_field_versions
+		WHERE record_id = ? ORDER BY version DESC, bind_key`,
+		recordID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []recordVersion
+	for rows.Next() {
+		var (
+			version   int
+			bindKey   string
+			value     sql.NullString
+			createdAt sql.NullString
+			createdBy sql.NullString
+		)
+		if err := rows.Scan(&version, &bindKey, &value, &createdAt, &createdBy); err != nil {
+			return nil, err
+		}
+		if len(versions) == 0 || versions[len(versions)-1].Version != version {
+			versions = append(versions, recordVersion{
+				Version:   version,
+				CreatedAt: createdAt.String,
+				CreatedBy: createdBy.String,
+				Fields:    map[string]string{},
+			})
+		}
+		versions[len(versions)-1].Fields[bindKey] = value.String
+	}
+	return versions, rows.Err()
+}
+
+// restoreRecordVersion replaces a record's fields with a snapshot. The
+// current fields are snapshotted first, so a restore can itself be undone.
+func restoreRecordVersion(db *sql.DB, recordID int64, contentType string, version int, opts writeOptions) error {
+	if opts.ReadOnly {
+		return errReadOnly
+	}
+	dialect := dialectOf(db)
+	return withRetry(opts, func() error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = tx.Rollback() }()
+
+		values, err := fetchVersionFields(tx, recordID, version)
+		if err != nil {
+			return err
+		}
+		if len(values) == 0 {
+			return fmt.Errorf("version %d not found", version)
+		}
+
+		var res sql.Result
+		if contentType != "" {
+			res, err = tx.Exec(`UPDATE records SET updated_at = CURRENT_TIMESTAMP, updated_by = ? WHERE id = ? AND type = ?`, opts.Actor, recordID, contentType)
+		} else {
+			res, err = tx.Exec(`UPDATE records SET updated_at = CURRENT_TIMESTAMP, updated_by = ? WHERE id = ?`, opts.Actor, recordID)
+		}
+		if err != nil {
+			return err
+		}
+		if rows, _ := res.RowsAffected(); rows == 0 {
+			return errRecordNotFound
+		}
+
+		if err := snapshotVersion(tx, recordID, opts); err != nil {
+			return err
+		}
+		if err := clearRecordFields(tx, recordID, opts); err != nil {
+			return err
+		}
+		if err := upsertFields(tx, dialect, recordID, values, opts); err != nil {
+			return err
+		}
+		return countWrites(1, tx.Commit())
+	})
+}
+
+// fetchVersionFields reads one snapshot's values inside tx.
+func fetchVersionFields(tx *sql.Tx, recordID int64, version int) (map[string]string, error) {
+	rows, err := tx.Query(`SELECT bind_key, value FROM record_field_versions WHERE record_id = ? AND version = ?`, recordID, version)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := map[string]string{}
+	for rows.Next() {
+		var (
+			bindKey string
+			value   sql.NullString
+		)
+		if err := rows.Scan(&bindKey, &value); err != nil {
+			return nil, err
+		}
+		values[bindKey] = value.String
+	}
+	return values, rows.Err()
+}
+
+// withRetry runs fn again with exponential backoff while sqlite reports the
+// database as busy/locked. Any other error is returned immediately. With
+// opts.WriteLock each attempt holds the lock; backoff sleeps do not.
+func withRetry(opts writeOptions, fn func() error) error {
+	delay := opts.RetryDelay
+	for attempt := 0; ; attempt++ {
+		err := lockedAttempt(opts.WriteLock, fn)
+		if err == nil && opts.Changes != nil {
+			opts.Changes.Add(1)
+		}
+		if err == nil || !isLockedError(err) || attempt >= opts.MaxRetries {
+			return err
+		}
+		time.Sleep(delay)
+		delay = nextRetryDelay(delay)
+	}
+}
+
+// nextRetryDelay doubles delay up to maxRetryDelay.
+func nextRetryDelay(delay time.Duration) time.Duration {
+	return min(delay*2, maxRetryDelay)
 }
 
-func collectCMSFields(fields Fields, binds map[string]bindTarget) []cmsField {
-	var out []cmsField
-	schema := resolveSchema(fields)
-	if len(schema) > 0 {
-		hasOrder := false
-		for name, def := range schema {
-			bind := strings.TrimSpace(def.Bind)
-			if bind == "" && strings.TrimSpace(def.Path) != "" {
-				if resolved, ok := findBindByPath(binds, strings.TrimSpace(def.Path)); ok {
-					bind = resolved
-				}
-			}
-			if bind == "" {
-				bind = name
-			}
-			if _, ok := binds[bind]; !ok {
-				continue
+func lockedAttempt(lock *sync.Mutex, fn func() error) error {
+	if lock == nil {
+		return fn()
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	return fn()
+}
+
+func isLockedError(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+	return false
+}
+
+func upsertFields(tx *sql.Tx, dialect *storeDialect, recordID int64, values map[string]string, opts writeOptions) error {
+	if opts.Columns != nil {
+		return upsertColumns(tx, opts.Columns, recordID, values)
+	}
+	for key, value := range values {
+		num, date := typedValues(opts.FieldTypes[key], value)
+		if _, err := tx.Exec(
+			dialect.UpsertField,
+			recordID, key, value, num, date,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// typedDateLayouts are the formats accepted for date_value.
+var typedDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// typedValues returns the num_value and date_value for a field of the given
+// schema type. Other types, and values that do not parse, store NULL.
+func typedValues(fieldType, value string) (interface{}, interface{}) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	switch fieldType {
+	case "number", "integer", "float":
+		if n, err := strconv.ParseFloat(value, 64); err == nil && !math.IsInf(n, 0) && !math.IsNaN(n) {
+			return n, nil
+		}
+	case "date", "datetime":
+		for _, layout := range typedDateLayouts {
+			if t, err := time.Parse(layout, value); err == nil {
+				return nil, t.UTC().Format("2006-01-02 15:04:05")
 			}
-			label := strings.TrimSpace(def.Label)
-			if label == "" {
-				label = bind
+		}
+	}
+	return nil, nil
+}
+
+// Fetch value for key from context (form, query, body)
+func GetInputFromContext(ctx context.Context, key string) string {
+	if form, ok := ctx.Value(shared.FormData).(url.Values); ok && form != nil {
+		if v, exists := form[key]; exists && len(v) > 0 {
+			return v[0]
+		}
+	}
+	if req, ok := ctx.Value(shared.Request).(*http.Request); ok && req != nil {
+		if v := req.Form.Get(key); v != "" {
+			return v
+		}
+		if v := req.PostForm.Get(key); v != "" {
+			return v
+		}
+		vals := req.URL.Query()
+		if v, exists := vals[key]; exists && len(v) > 0 {
+			return v[0]
+		}
+	}
+	if data := readRequestBody(ctx); len(data) > 0 {
+		var m map[string]interface{}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		if err := decoder.Decode(&m); err == nil {
+			if v, found := m[key]; found {
+				if str, ok := v.(string); ok {
+					return str
+				}
 			}
-			if def.Order != 0 {
-				hasOrder = true
+		}
+	}
+	return ""
+}
+
+// readRequestBody reads shared.RequestBody and leaves it readable again for
+// the next lookup or plugin, like decodeInlineJSON does for req.Body:
+// seekable readers are rewound to where they were and a *bytes.Buffer is
+// refilled. Other readers, such as the host's r.Body, cannot be refilled, so
+// their bytes are kept in requestBodies for the next lookup, and a body that
+// is also req.Body is replaced by a copy.
+func readRequestBody(ctx context.Context) []byte {
+	body, ok := ctx.Value(shared.RequestBody).(io.Reader)
+	if !ok || body == nil {
+		return nil
+	}
+	if seeker, ok := body.(io.Seeker); ok {
+		if start, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			data, _ := io.ReadAll(body)
+			_, _ = seeker.Seek(start, io.SeekStart)
+			return data
+		}
+	}
+	if buf, ok := body.(*bytes.Buffer); ok {
+		data, _ := io.ReadAll(buf)
+		buf.Write(data)
+		return data
+	}
+	data, err := requestBodies.read(body)
+	if err == nil {
+		if req, _ := ctx.Value(shared.Request).(*http.Request); req != nil && req.Body != nil && interface{}(req.Body) == interface{}(body) {
+			req.Body = io.NopCloser(bytes.NewReader(data))
+		}
+	}
+	return data
+}
+
+// requestBodyCacheSize bounds how many drained bodies requestBodies keeps.
+const requestBodyCacheSize = 64
+
+// requestBodies holds the bytes of the most recently read bodies that cannot
+// be rewound, keyed on the reader the host stored in shared.RequestBody. A
+// reader stays referenced while it is cached, so a key is never reused for
+// another request's body.
+var requestBodies = &bodyCache{data: map[io.Reader][]byte{}}
+
+type bodyCache struct {
+	mu    sync.Mutex
+	order []io.Reader
+	data  map[io.Reader][]byte
+}
+
+// read returns body's bytes, reading it only on the first call. Readers
+// whose type cannot be a map key are read directly.
+func (c *bodyCache) read(body io.Reader) ([]byte, error) {
+	if !reflect.TypeOf(body).Comparable() {
+		return io.ReadAll(body)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if data, ok := c.data[body]; ok {
+		return data, nil
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return data, err
+	}
+	if len(c.order) >= requestBodyCacheSize {
+		delete(c.data, c.order[0])
+		c.order = c.order[1:]
+	}
+	c.order = append(c.order, body)
+	c.data[body] = data
+	return data, nil
+}
+
+func parseRequestForm(req *http.Request, errors *[]error) {
+	if req == nil {
+		return
+	}
+	contentType := req.Header.Get("Content-Type")
+	if strings.HasPrefix(contentType, "multipart/form-data") {
+		if req.MultipartForm != nil {
+			return
+		}
+		if err := req.ParseMultipartForm(20 << 20); err != nil {
+			if errors != nil {
+				*errors = append(*errors, fmt.Errorf("content_records_plugin: parse multipart form failed: %w", err))
 			}
-			out = append(out, cmsField{
-				Name:  name,
-				Label: label,
-				Type:  strings.TrimSpace(def.Type),
-				Bind:  bind,
-				Path:  def.Path,
-				Order: def.Order,
-			})
 		}
-		if hasOrder {
-			sort.SliceStable(out, func(i, j int) bool {
-				oi := out[i].Order
-				oj := out[j].Order
-				if oi == 0 {
-					oi = 1 << 30
-				}
-				if oj == 0 {
-					oj = 1 << 30
-				}
-				if oi == oj {
-					return out[i].Name < out[j].Name
-				}
-				return oi < oj
-			})
-		} else {
-			sort.SliceStable(out, func(i, j int) bool {
-				return out[i].Name < out[j].Name
-			})
+		return
+	}
+	if err := req.ParseForm(); err != nil {
+		if errors != nil {
+			*errors = append(*errors, fmt.Errorf("content_records_plugin: parse form failed: %w", err))
+		}
+	}
+}
+
+func resolveTypeName(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	if m, ok := value.(map[string]interface{}); ok {
+		if t, ok := m["@name"].(string); ok {
+			return t
 		}
-		return out
 	}
+	return ""
+}
 
-	keys := make([]string, 0, len(binds))
-	for key := range binds {
-		keys = append(keys, key)
+// openStore opens the store configured by data.driver and data.store.
+func openStore(fields Fields) (*sql.DB, error) {
+	return openStoreWith(fields, nil)
+}
+
+// openStoreWith is openStore taking the store handle from memo when an
+// earlier render in the same request already opened it.
+func openStoreWith(fields Fields, memo *requestMemo) (*sql.DB, error) {
+	dialect, err := resolveDialect(fields.Driver)
+	if err != nil {
+		return nil, err
 	}
-	sort.Strings(keys)
-	for _, key := range keys {
-		out = append(out, cmsField{
-			Name:  key,
-			Label: key,
-			Type:  "text",
-			Bind:  key,
-			Path:  binds[key].Path,
+	pragmas, err := resolvePragmas(fields.Pragmas, dialect)
+	if err != nil {
+		return nil, err
+	}
+	layout, err := resolveColumnLayout(fields)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := resolveIDStrategy(fields.IDStrategy); err != nil {
+		return nil, err
+	}
+	modes, err := parseFileModes(fields.DirMode, fields.FileMode)
+	if err != nil {
+		return nil, err
+	}
+	if store := strings.TrimSpace(fields.Store); dialect == sqliteDialect && store != "" && store != ":memory:" {
+		// Created here so dir_mode applies; getStoreDB finds it in place.
+		if err := os.MkdirAll(filepath.Dir(store), modes.Dir); err != nil {
+			return nil, err
+		}
+	}
+	db, err := memo.storeDB(dialect, fields.Store, pragmas)
+	if err != nil || layout == nil {
+		return db, err
+	}
+	return db, registerColumnLayout(db, layout)
+}
+
+// requestMemo holds the store handles opened while serving one request, so
+// nested and repeated renders skip getStoreDB's mutex and Ping.
+type requestMemo struct {
+	mu     sync.Mutex
+	stores map[string]storeResult
+}
+
+type storeResult struct {
+	db  *sql.DB
+	err error
+}
+
+var (
+	memoMu        sync.Mutex
+	memoByRequest = map[*http.Request]*requestMemo{}
+)
+
+// memoFor returns the memo of ctx's request, or nil when there is no request
+// or its context is never cancelled. The memo is dropped as soon as the
+// request's context is done, so nothing carries over to the next request.
+func memoFor(ctx context.Context) *requestMemo {
+	if ctx == nil {
+		return nil
+	}
+	req, _ := ctx.Value(shared.Request).(*http.Request)
+	if req == nil || req.Context().Done() == nil {
+		return nil
+	}
+	memoMu.Lock()
+	defer memoMu.Unlock()
+	memo, ok := memoByRequest[req]
+	if !ok {
+		memo = &requestMemo{stores: map[string]storeResult{}}
+		memoByRequest[req] = memo
+		context.AfterFunc(req.Context(), func() {
+			memoMu.Lock()
+			delete(memoByRequest, req)
+			memoMu.Unlock()
 		})
 	}
-	return out
-}
+	return memo
+}
+
+// storeDB returns getStoreDB's result, opening each store once per memo.
+// Errors, including schema init errors, are memoized as well.
+func (m *requestMemo) storeDB(dialect *storeDialect, store string, pragmas []string) (*sql.DB, error) {
+	if m == nil {
+		return getStoreDB(dialect, store, pragmas...)
+	}
+	key := dialect.Driver + "|" + strings.TrimSpace(store)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if result, ok := m.stores[key]; ok {
+		return result.db, result.err
+	}
+	db, err := getStoreDB(dialect, store, pragmas...)
+	m.stores[key] = storeResult{db: db, err: err}
+	return db, err
+}
+
+// getDB opens a SQLite store.
+func getDB(store string) (*sql.DB, error) {
+	return getStoreDB(sqliteDialect, store)
+}
+
+// sqlitePragmas are the pragmas data.pragmas may set, each with the values it
+// accepts. Pragmas that can corrupt or unlock the store (writable_schema,
+// journal_mode=off, ...) are deliberately absent.
+var sqlitePragmas = map[string]*regexp.Regexp{
+	"cache_size":         regexp.MustCompile(`^-?[0-9]+$`),
+	"mmap_size":          regexp.MustCompile(`^[0-9]+$`),
+	"busy_timeout":       regexp.MustCompile(`^[0-9]+$`),
+	"wal_autocheckpoint": regexp.MustCompile(`^[0-9]+$`),
+	"synchronous":        regexp.MustCompile(`(?i)^(off|normal|full|extra|[0-3])$`),
+	"temp_store":         regexp.MustCompile(`(?i)^(default|file|memory|[0-2])$`),
+	"journal_mode":       regexp.MustCompile(`(?i)^(delete|truncate|persist|memory|wal)$`),
+}
+
+// resolvePragmas validates data.pragmas and returns the PRAGMA statements in
+// name order.
+func resolvePragmas(pragmas map[string]string, dialect *storeDialect) ([]string, error) {
+	if len(pragmas) == 0 {
+		return nil, nil
+	}
+	if dialect != sqliteDialect {
+		return nil, fmt.Errorf("content_records_plugin: data.pragmas is only supported for sqlite stores")
+	}
+	names := make([]string, 0, len(pragmas))
+	for name := range pragmas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	stmts := make([]string, 0, len(names))
+	for _, name := range names {
+		key := strings.ToLower(strings.TrimSpace(name))
+		valid, ok := sqlitePragmas[key]
+		if !ok {
+			return nil, fmt.Errorf("content_records_plugin: data.pragmas: unsupported pragma %q", name)
+		}
+		value := strings.TrimSpace(pragmas[name])
+		if !valid.MatchString(value) {
+			return nil, fmt.Errorf("content_records_plugin: data.pragmas: invalid value %q for %s", pragmas[name], key)
+		}
+		stmts = append(stmts, fmt.Sprintf("PRAGMA %s = %s", key, value))
+	}
+	return stmts, nil
+}
+
+// getStoreDB returns the shared handle for a store. Drivers other than
+// sqlite3 are not linked into this plugin: the host binary (or another
+// plugin) must register them, e.g. by importing github.com/go-sql-driver/mysql.
+// pragmas run once, when the store is first initialized.
+func getStoreDB(dialect *storeDialect, store string, pragmas ...string) (*sql.DB, error) {
+	store = strings.TrimSpace(store)
+	if store == "" {
+		return nil, fmt.Errorf("content_records_plugin: data.store is required")
+	}
+
+	key := store
+	if dialect == sqliteDialect {
+		if store != ":memory:" {
+			if err := os.MkdirAll(filepath.Dir(store), 0o755); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		key = dialect.Driver + "|" + store
+	}
+
+	dbMu.Lock()
+	entry, ok := dbByPath[key]
+	if !ok {
+		db, err := sql.Open(dialect.Driver, store)
+		if err != nil {
+			dbMu.Unlock()
+			return nil, err
+		}
+		entry = &dbEntry{db: db, dialect: dialect, pragmas: pragmas}
+		dbByPath[key] = entry
+	}
+	dbMu.Unlock()
+
+	if err := entry.compatible(pragmas); err != nil {
+		return nil, fmt.Errorf("content_records_plugin: store %s: %w", storeLabel(Fields{Store: store}), err)
+	}
 
-func collectImageBinds(fields Fields, binds map[string]bindTarget) map[string]struct{} {
-	imageBinds := map[string]struct{}{}
-	schema := resolveSchema(fields)
-	if len(schema) == 0 {
-		return imageBinds
+	if err := entry.db.Ping(); err != nil {
+		return nil, err
 	}
-	for name, def := range schema {
-		if strings.ToLower(strings.TrimSpace(def.Type)) != "image" {
-			continue
-		}
-		bind := strings.TrimSpace(def.Bind)
-		if bind == "" && strings.TrimSpace(def.Path) != "" {
-			if resolved, ok := findBindByPath(binds, strings.TrimSpace(def.Path)); ok {
-				bind = resolved
+
+	entry.once.Do(func() {
+		for _, pragma := range pragmas {
+			if _, err := entry.db.Exec(pragma); err != nil {
+				entry.initErr = fmt.Errorf("%s: %w", pragma, err)
+				return
 			}
 		}
-		if bind == "" {
-			bind = name
-		}
-		if _, ok := binds[bind]; ok {
-			imageBinds[bind] = struct{}{}
-		}
+		entry.initErr = initSchema(entry.db, entry.dialect)
+	})
+
+	if entry.initErr != nil {
+		return entry.db, entry.initErr
 	}
-	return imageBinds
+
+	return entry.db, nil
 }
 
-func findBindByPath(binds map[string]bindTarget, path string) (string, bool) {
-	for key, target := range binds {
-		if target.Path == path {
-			return key, true
-		}
+// compatible checks that a config reusing an open store asks for the
+// pragmas it was initialized with; pragmas only run once, so a different set
+// would be silently ignored. A config without pragmas defers to the store's.
+// Stores of other drivers never share an entry: their key includes the driver.
+func (e *dbEntry) compatible(pragmas []string) error {
+	if len(pragmas) > 0 && strings.Join(pragmas, "; ") != strings.Join(e.pragmas, "; ") {
+		return fmt.Errorf("already open with pragmas [%s], not [%s]; configs sharing a store must set the same data.pragmas",
+			strings.Join(e.pragmas, "; "), strings.Join(pragmas, "; "))
 	}
-	return "", false
+	return nil
 }
 
-func resolveRecordID(ctx context.Context, param string) int64 {
-	key := strings.TrimSpace(param)
-	if key == "" {
-		key = "id"
+// resetStores closes and forgets every shared store handle, so tests do not
+// leak connections or cached init errors between cases.
+func resetStores() {
+	dbMu.Lock()
+	defer dbMu.Unlock()
+	for key, entry := range dbByPath {
+		_ = entry.db.Close()
+		delete(dbByPath, key)
+	}
+	publishedTemplates.Lock()
+	publishedTemplates.byStore = map[*sql.DB]map[string]string{}
+	publishedTemplates.Unlock()
+}
+
+func initSchema(db *sql.DB, dialect *storeDialect) error {
+	for _, stmt := range dialect.Schema {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
 	}
-	return parseRecordID(GetInputFromContext(ctx, key))
+
+	for _, migration := range dialect.Columns {
+		if err := ensureColumn(db, dialect, migration); err != nil {
+			return err
+		}
+	}
+
+	for _, stmt := range dialect.Indexes {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-func parseRecordID(value string) int64 {
-	value = strings.TrimSpace(value)
-	if value == "" {
-		return 0
+func ensureColumn(db *sql.DB, dialect *storeDialect, migration columnMigration) error {
+	var name string
+	err := db.QueryRow(dialect.ColumnExists, migration.Table, migration.Column).Scan(&name)
+	if err == nil {
+		return nil
 	}
-	id, err := strconv.ParseInt(value, 10, 64)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	table, err := dialect.quoteIdent(migration.Table)
 	if err != nil {
-		return 0
+		return err
 	}
-	return id
+	column, err := dialect.quoteIdent(migration.Column)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, migration.Definition))
+	return err
 }
 
-func applyCMSAction(ctx context.Context, db *sql.DB, contentType string, fieldDefs []cmsField, uploadDir string, errors *[]error) {
-	req, _ := ctx.Value(shared.Request).(*http.Request)
-	if req == nil || req.Method != http.MethodPost {
-		return
-	}
+// columnLayout is the per-type table used by data.storage = columns: one row
+// per record with a real column per bind, instead of one record_fields row
+// per value. The records table still holds ids, types and audit columns.
+type columnLayout struct {
+	Type    string
+	Table   string
+	Binds   []string        // column names, sorted
+	Numeric map[string]bool // number binds, stored in NumberColumn columns
+	dialect *storeDialect
+	quoted  map[string]string // Table and Binds passed through quoteIdent
+}
 
-	parseRequestForm(req, errors)
-	action := strings.ToLower(strings.TrimSpace(GetInputFromContext(ctx, "action")))
-	if action == "" {
-		return
-	}
+// ident returns the quoted form of the layout's table or one of its columns.
+// Callers check has first; unknown names yield "" so a query fails instead of
+// carrying an unvalidated identifier.
+func (l *columnLayout) ident(name string) string {
+	return l.quoted[name]
+}
 
-	values := readFieldValuesFromContext(ctx, fieldDefs)
-	mergeUploads(ctx, fieldDefs, uploadDir, values, errors)
+// resolveColumnLayout returns the table layout for data.storage = columns,
+// or nil for the default record_fields storage. Every template bind and
+// schema field becomes a column; number schema types get a numeric column.
+func resolveColumnLayout(fields Fields) (*columnLayout, error) {
+	switch strings.ToLower(strings.TrimSpace(fields.Storage)) {
+	case "", "fields":
+		return nil, nil
+	case "columns":
+	default:
+		return nil, fmt.Errorf("content_records_plugin: unsupported storage %q (expected fields or columns)", fields.Storage)
+	}
+	dialect, err := resolveDialect(fields.Driver)
+	if err != nil {
+		return nil, err
+	}
+	contentType := resolveTypeName(resolveTemplateValue(fields))
+	table, err := dialect.quoteIdent("records_" + strings.ToLower(contentType))
+	if err != nil || contentType == "" {
+		return nil, fmt.Errorf("content_records_plugin: storage columns needs a template @name of letters, digits and _, got %q", contentType)
+	}
 
-	switch action {
-	case "create":
-		if _, err := createRecord(db, contentType, values); err != nil {
-			*errors = append(*errors, fmt.Errorf("content_records_plugin: create failed: %w", err))
+	binds := map[string]bindTarget{}
+	if template, ok := normalizeToStringMap(resolveTemplateValue(fields)); ok {
+		collectBinds(template, "", binds)
+	}
+	types := map[string]string{}
+	for bind := range binds {
+		types[bind] = ""
+	}
+	for bind, fieldType := range buildBindTypeMap(fields, binds) {
+		types[bind] = fieldType
+	}
+	for name, def := range resolveSchema(fields) {
+		bind := strings.TrimSpace(def.Bind)
+		if bind == "" {
+			bind = name
 		}
-	case "update":
-		idStr := GetInputFromContext(ctx, "record_id")
-		id, err := strconv.ParseInt(strings.TrimSpace(idStr), 10, 64)
-		if err != nil {
-			*errors = append(*errors, fmt.Errorf("content_records_plugin: invalid record_id"))
-			return
+		if _, ok := types[bind]; !ok {
+			types[bind] = strings.ToLower(strings.TrimSpace(def.Type))
 		}
-		if err := updateRecord(db, id, contentType, values); err != nil {
-			*errors = append(*errors, fmt.Errorf("content_records_plugin: update failed: %w", err))
+	}
+
+	layout := &columnLayout{Type: contentType, Table: "records_" + strings.ToLower(contentType), Numeric: map[string]bool{}, dialect: dialect}
+	layout.quoted = map[string]string{layout.Table: table}
+	for bind, fieldType := range types {
+		if fieldType == computedFieldType {
+			continue
 		}
-	case "delete":
-		idStr := GetInputFromContext(ctx, "record_id")
-		id, err := strconv.ParseInt(strings.TrimSpace(idStr), 10, 64)
-		if err != nil {
-			*errors = append(*errors, fmt.Errorf("content_records_plugin: invalid record_id"))
-			return
+		quoted, err := dialect.quoteIdent(bind)
+		if err != nil || strings.EqualFold(bind, "record_id") {
+			return nil, fmt.Errorf("content_records_plugin: storage columns: bind %q cannot be used as a column name", bind)
 		}
-		if err := deleteRecord(db, id, contentType); err != nil {
-			*errors = append(*errors, fmt.Errorf("content_records_plugin: delete failed: %w", err))
+		layout.quoted[bind] = quoted
+		layout.Binds = append(layout.Binds, bind)
+		switch fieldType {
+		case "number", "integer", "float":
+			layout.Numeric[bind] = true
 		}
 	}
+	if len(layout.Binds) == 0 {
+		return nil, fmt.Errorf("content_records_plugin: storage columns needs template binds or data.schema fields")
+	}
+	sort.Strings(layout.Binds)
+	return layout, nil
 }
 
-func readFieldValuesFromContext(ctx context.Context, fieldDefs []cmsField) map[string]string {
-	values := make(map[string]string, len(fieldDefs))
-	for _, def := range fieldDefs {
-		key := def.Bind
-		if key == "" {
-			key = def.Name
+// has reports whether bind is a column of the layout.
+func (l *columnLayout) has(bind string) bool {
+	i := sort.SearchStrings(l.Binds, bind)
+	return i < len(l.Binds) && l.Binds[i] == bind
+}
+
+// same reports whether two layouts describe the same table.
+func (l *columnLayout) same(other *columnLayout) bool {
+	if l.Table != other.Table || len(l.Binds) != len(other.Binds) || l.dialect != other.dialect {
+		return false
+	}
+	for i, bind := range l.Binds {
+		if other.Binds[i] != bind || l.Numeric[bind] != other.Numeric[bind] {
+			return false
 		}
-		values[key] = GetInputFromContext(ctx, key)
 	}
-	return values
+	return true
 }
 
-func resolveUploadDir(fields Fields) string {
-	if strings.TrimSpace(fields.UploadDir) != "" {
-		return strings.TrimSpace(fields.UploadDir)
+// registerColumnLayout creates or extends the layout's table and records it
+// for the store, so reads of the type use the table. Columns are only ever
+// added; changing a bind's type does not alter an existing column.
+func registerColumnLayout(db *sql.DB, layout *columnLayout) error {
+	entry := entryOf(db)
+	if entry == nil {
+		return fmt.Errorf("content_records_plugin: store is not open")
+	}
+	entry.layoutMu.Lock()
+	defer entry.layoutMu.Unlock()
+	if known := entry.layouts[layout.Type]; known != nil && known.same(layout) {
+		return nil
 	}
-	if strings.TrimSpace(fields.Upload) != "" {
-		return strings.TrimSpace(fields.Upload)
+	if _, err := db.Exec(fmt.Sprintf(entry.dialect.ColumnTable, layout.ident(layout.Table))); err != nil {
+		return err
 	}
-	return ""
+	for _, bind := range layout.Binds {
+		definition := entry.dialect.TextColumn
+		if layout.Numeric[bind] {
+			definition = entry.dialect.NumberColumn
+		}
+		if err := ensureColumn(db, entry.dialect, columnMigration{layout.Table, bind, definition}); err != nil {
+			return err
+		}
+	}
+	if entry.layouts == nil {
+		entry.layouts = map[string]*columnLayout{}
+	}
+	entry.layouts[layout.Type] = layout
+	return nil
 }
 
-func mergeUploads(ctx context.Context, fieldDefs []cmsField, uploadDir string, values map[string]string, errors *[]error) {
-	uploadDir = strings.TrimSpace(uploadDir)
-	if uploadDir == "" {
-		return
+// columnLayoutOf returns the registered columns layout for a content type,
+// or nil when the type uses record_fields.
+func columnLayoutOf(db *sql.DB, contentType string) *columnLayout {
+	entry := entryOf(db)
+	if entry == nil || contentType == "" {
+		return nil
 	}
+	entry.layoutMu.Lock()
+	defer entry.layoutMu.Unlock()
+	return entry.layouts[contentType]
+}
 
-	req, _ := ctx.Value(shared.Request).(*http.Request)
-	if req == nil {
-		return
+// columnLayoutsOf returns every columns layout registered for a store.
+func columnLayoutsOf(db *sql.DB) []*columnLayout {
+	entry := entryOf(db)
+	if entry == nil {
+		return nil
+	}
+	entry.layoutMu.Lock()
+	defer entry.layoutMu.Unlock()
+	layouts := make([]*columnLayout, 0, len(entry.layouts))
+	for _, layout := range entry.layouts {
+		layouts = append(layouts, layout)
 	}
+	return layouts
+}
 
-	contentType := req.Header.Get("Content-Type")
-	if !strings.HasPrefix(contentType, "multipart/form-data") {
-		return
+// columnArg converts a form value for its column: number columns take
+// NULL for an empty value and reject anything that is not a number.
+func (l *columnLayout) columnArg(bind, value string) (interface{}, error) {
+	if !l.Numeric[bind] {
+		return value, nil
+	}
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
 	}
+	num, _ := typedValues("number", value)
+	if num == nil {
+		return nil, fmt.Errorf("%s: %q is not a number", bind, value)
+	}
+	return num, nil
+}
 
-	if err := req.ParseMultipartForm(20 << 20); err != nil {
-		*errors = append(*errors, fmt.Errorf("content_records_plugin: upload parse failed: %w", err))
-		return
+// columnString formats a scanned column value; NULL reports false so the
+// bind is left out of the record, as a missing record_fields row would be.
+func columnString(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case nil:
+		return "", false
+	case []byte:
+		return string(v), true
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	default:
+		return fmt.Sprint(v), true
 	}
+}
 
-	for _, def := range fieldDefs {
-		if strings.ToLower(strings.TrimSpace(def.Type)) != "image" {
-			continue
-		}
-		key := def.Bind
-		if key == "" {
-			key = def.Name
+// upsertColumns writes values into the record's row. Values for binds
+// without a column are rejected rather than silently dropped.
+func upsertColumns(tx *sql.Tx, layout *columnLayout, recordID int64, values map[string]string) error {
+	if len(values) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	columns := []string{"record_id"}
+	args := []interface{}{recordID}
+	assigns := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if !layout.has(key) {
+			return fmt.Errorf("bind %q has no column in %s", key, layout.Table)
 		}
-		path, err := saveUploadFile(req, key, uploadDir)
+		arg, err := layout.columnArg(key, values[key])
 		if err != nil {
-			*errors = append(*errors, fmt.Errorf("content_records_plugin: upload failed: %w", err))
-			continue
+			return err
 		}
-		if path != "" {
-			values[key] = path
+		quoted := layout.ident(key)
+		columns = append(columns, quoted)
+		args = append(args, arg)
+		assigns = append(assigns, fmt.Sprintf(layout.dialect.ColumnAssign, quoted))
+	}
+	query := fmt.Sprintf(`INSERT INTO %s(%s) VALUES(%s)`+layout.dialect.UpsertColumns,
+		layout.ident(layout.Table), strings.Join(columns, ", "), placeholders(len(columns)), strings.Join(assigns, ", "))
+	_, err := tx.Exec(query, args...)
+	return err
+}
+
+// placeholders returns n comma separated ? placeholders.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// quotedColumns returns the layout's columns qualified with alias.
+func (l *columnLayout) quotedColumns(alias string) string {
+	columns := make([]string, len(l.Binds))
+	for i, bind := range l.Binds {
+		columns[i] = alias + "." + l.ident(bind)
+	}
+	return strings.Join(columns, ", ")
+}
+
+// scanColumns scans the layout's columns after any leading destinations.
+func (l *columnLayout) scanColumns(scan func(dest ...interface{}) error, lead ...interface{}) (map[string]string, error) {
+	values := make([]interface{}, len(l.Binds))
+	dest := append(lead, make([]interface{}, len(l.Binds))...)
+	for i := range values {
+		dest[len(lead)+i] = &values[i]
+	}
+	if err := scan(dest...); err != nil {
+		return nil, err
+	}
+	fields := make(map[string]string, len(l.Binds))
+	for i, bind := range l.Binds {
+		if value, ok := columnString(values[i]); ok {
+			fields[bind] = value
 		}
 	}
+	return fields, nil
 }
 
-type inlineUpdatePayload struct {
-	Inline   string
-	RecordID string
-	Bind     string
-	Value    string
+// rowQuerier is the QueryRow method shared by *sql.DB and *sql.Tx.
+type rowQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
 }
 
-func handleInlineUpdate(ctx context.Context, db *sql.DB, contentType string, binds map[string]bindTarget, fields Fields, template map[string]interface{}, errors *[]error) (bool, any) {
-	req, _ := ctx.Value(shared.Request).(*http.Request)
-	if req == nil || req.Method != http.MethodPost {
-		return false, nil
+// fetchColumnRow reads one record's fields; a record without a row has none.
+func fetchColumnRow(q rowQuerier, layout *columnLayout, recordID int64) (map[string]string, error) {
+	row := q.QueryRow(fmt.Sprintf(`SELECT %s FROM %s c WHERE c.record_id = ?`,
+		layout.quotedColumns("c"), layout.ident(layout.Table)), recordID)
+	fields, err := layout.scanColumns(row.Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return map[string]string{}, nil
 	}
+	return fields, err
+}
 
-	payload, err := parseInlinePayload(req, ctx, fields, errors)
-	if err != nil {
-		if errors != nil {
-			*errors = append(*errors, fmt.Errorf("content_records_plugin: inline parse failed: %w", err))
+// maxColumnBatch bounds the ids per IN (...) list when loading rows.
+const maxColumnBatch = 500
+
+// fetchColumnRecords loads the records in ids, in order, with one query per
+// batch. A non-empty contentType skips ids of other types.
+func fetchColumnRecords(db *sql.DB, layout *columnLayout, ids []int64, contentType string) ([]record, error) {
+	metrics.add("db_reads", 1)
+	found := make(map[int64]map[string]string, len(ids))
+	for start := 0; start < len(ids); start += maxColumnBatch {
+		batch := ids[start:min(start+maxColumnBatch, len(ids))]
+		args := make([]interface{}, 0, len(batch)+1)
+		for _, id := range batch {
+			args = append(args, id)
+		}
+		query := fmt.Sprintf(`SELECT r.id, %s FROM records r LEFT JOIN %s c ON c.record_id = r.id WHERE r.id IN (%s)`,
+			layout.quotedColumns("c"), layout.ident(layout.Table), placeholders(len(batch)))
+		if contentType != "" {
+			query += ` AND r.type = ?`
+			args = append(args, contentType)
+		}
+		rows, err := db.Query(query, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id int64
+			fields, err := layout.scanColumns(rows.Scan, &id)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			found[id] = fields
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
 		}
-		return true, writeInlineJSON(ctx, http.StatusBadRequest, map[string]interface{}{
-			"error": "invalid inline payload",
-		})
 	}
 
-	if !parseBoolFlag(payload.Inline) {
-		return false, nil
+	records := make([]record, 0, len(found))
+	for _, id := range ids {
+		if fields, ok := found[id]; ok {
+			records = append(records, record{ID: id, Fields: fields})
+		}
 	}
+	return records, nil
+}
 
-	bindKey := strings.TrimSpace(payload.Bind)
-	if bindKey == "" {
-		return true, writeInlineJSON(ctx, http.StatusBadRequest, map[string]interface{}{
-			"error": "bind is required",
-		})
+// columnFilterQuery builds the filterRecordIDs query for a columns table.
+func columnFilterQuery(layout *columnLayout, filters []recordFilter) (string, []interface{}, error) {
+	conds := make([]string, 0, len(filters))
+	args := make([]interface{}, 0, len(filters))
+	for _, filter := range filters {
+		if !layout.has(filter.Bind) {
+			return "", nil, fmt.Errorf("filter %q: bind %q has no column in %s", filter.Param, filter.Bind, layout.Table)
+		}
+		column := "c." + layout.ident(filter.Bind)
+		var arg interface{} = filter.Value
+		if layout.Numeric[filter.Bind] && filter.Op != "like" {
+			num, _ := typedValues("number", filter.Value)
+			if num == nil {
+				return "", nil, fmt.Errorf("filter %q: %q is not a number", filter.Param, filter.Value)
+			}
+			arg = num
+		}
+		switch filter.Op {
+		case "like":
+			conds = append(conds, column+" LIKE ? ESCAPE '!'")
+			arg = "%" + likeEscaper.Replace(filter.Value) + "%"
+		case "gt":
+			conds = append(conds, column+" > ?")
+		case "lt":
+			conds = append(conds, column+" < ?")
+		default:
+			conds = append(conds, column+" = ?")
+		}
+		args = append(args, arg)
 	}
-	if _, ok := binds[bindKey]; !ok {
-		// Allow nested ContentRecords plugins to handle binds outside this template.
-		if hasBoundaryPlugin(template) {
-			return false, nil
+	query := fmt.Sprintf(`SELECT r.id FROM records r JOIN %s c ON c.record_id = r.id WHERE %s`,
+		layout.ident(layout.Table), strings.Join(conds, " AND "))
+	return query, args, nil
+}
+
+// Default UGC allowlist for the HTML sanitizer: text formatting, lists,
+// tables, links and images, with no scripting, styling or embedding.
+var (
+	defaultSanitizeTags = []string{
+		"a", "abbr", "b", "blockquote", "br", "caption", "cite", "code", "dd", "del", "details", "div",
+		"dl", "dt", "em", "figcaption", "figure", "h1", "h2", "h3", "h4", "h5", "h6", "hr", "i", "img",
+		"ins", "kbd", "li", "mark", "ol", "p", "pre", "q", "s", "small", "span", "strong", "sub",
+		"summary", "sup", "table", "tbody", "td", "tfoot", "th", "thead", "tr", "u", "ul",
+	}
+	defaultSanitizeAttrs = []string{
+		"class", "id", "title", "lang", "dir",
+		"a.href", "a.rel", "a.target", "img.src", "img.alt", "img.width", "img.height",
+		"td.colspan", "td.rowspan", "th.colspan", "th.rowspan", "th.scope", "ol.start", "blockquote.cite", "q.cite",
+	}
+	defaultSanitizeSchemes = []string{"http", "https", "mailto"}
+)
+
+// sanitizeDropContent are elements removed together with their content even
+// when allowed by mistake: their text is code or markup, not prose.
+var sanitizeDropContent = map[string]bool{
+	"script": true, "style": true, "iframe": true, "object": true, "embed": true, "noscript": true,
+	"template": true, "textarea": true, "title": true, "xmp": true, "noembed": true, "noframes": true,
+	"plaintext": true, "svg": true, "math": true, "frameset": true,
+}
+
+// sanitizeURLAttrs hold URLs and are checked against the allowed schemes.
+var sanitizeURLAttrs = map[string]bool{
+	"href": true, "src": true, "cite": true, "action": true, "formaction": true, "poster": true,
+	"background": true, "longdesc": true, "usemap": true, "xlink:href": true,
+}
+
+// sanitizePolicy is an HTML allowlist. Tags outside Tags are dropped but
+// keep their text; attributes outside Attrs are dropped; URL attributes must
+// be relative or use one of Schemes. Event handler attributes (on*) are
+// never kept.
+type sanitizePolicy struct {
+	Tags    map[string]bool
+	Attrs   map[string]map[string]bool // tag → attributes; "*" applies to every tag
+	Schemes map[string]bool
+}
+
+// newSanitizePolicy builds a policy from allow_tags, allow_attrs ("attr" for
+// every tag or "tag.attr") and allow_schemes. An empty list keeps the UGC
+// default for that part; a non-empty list replaces it.
+func newSanitizePolicy(tags, attrs, schemes []string) *sanitizePolicy {
+	if len(tags) == 0 {
+		tags = defaultSanitizeTags
+	}
+	if len(attrs) == 0 {
+		attrs = defaultSanitizeAttrs
+	}
+	if len(schemes) == 0 {
+		schemes = defaultSanitizeSchemes
+	}
+	p := &sanitizePolicy{Tags: map[string]bool{}, Attrs: map[string]map[string]bool{}, Schemes: map[string]bool{}}
+	for _, tag := range tags {
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" && !sanitizeDropContent[tag] {
+			p.Tags[tag] = true
 		}
-		return true, writeInlineJSON(ctx, http.StatusBadRequest, map[string]interface{}{
-			"error": "unknown bind",
-		})
 	}
-
-	recordID := parseRecordID(strings.TrimSpace(payload.RecordID))
-	if recordID == 0 {
-		recordID = resolveRecordID(ctx, resolveRecordParam(fields))
+	for _, attr := range attrs {
+		attr = strings.ToLower(strings.TrimSpace(attr))
+		tag := "*"
+		if i := strings.Index(attr, "."); i >= 0 {
+			tag, attr = attr[:i], attr[i+1:]
+		}
+		if attr == "" || strings.HasPrefix(attr, "on") {
+			continue
+		}
+		if p.Attrs[tag] == nil {
+			p.Attrs[tag] = map[string]bool{}
+		}
+		p.Attrs[tag][attr] = true
 	}
-	if recordID == 0 {
-		return true, writeInlineJSON(ctx, http.StatusBadRequest, map[string]interface{}{
-			"error": "record_id is required",
-		})
+	for _, scheme := range schemes {
+		if scheme = strings.ToLower(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(scheme), ":"))); scheme != "" {
+			p.Schemes[scheme] = true
+		}
 	}
+	return p
+}
 
-	value := payload.Value
-	contentTypeHeader := req.Header.Get("Content-Type")
-	if strings.HasPrefix(contentTypeHeader, "multipart/form-data") {
-		uploadDir := resolveUploadDir(fields)
-		if uploadDir == "" && hasFileUpload(req, "file", bindKey) {
-			return true, writeInlineJSON(ctx, http.StatusBadRequest, map[string]interface{}{
-				"error": "upload_dir is required for file uploads",
-			})
-		}
-		if uploadDir != "" {
-			path, err := saveUploadFile(req, "file", uploadDir)
-			if err != nil {
-				if errors != nil {
-					*errors = append(*errors, fmt.Errorf("content_records_plugin: upload failed: %w", err))
+// Sanitize returns input with everything outside the policy removed. Text is
+// re-escaped and comments are dropped, so the result is safe to emit as-is.
+func (p *sanitizePolicy) Sanitize(input string) string {
+	var out strings.Builder
+	tokenizer := xhtml.NewTokenizer(strings.NewReader(input))
+	skip := 0 // depth inside sanitizeDropContent elements
+	for {
+		switch tokenizer.Next() {
+		case xhtml.ErrorToken:
+			return out.String()
+		case xhtml.TextToken:
+			if skip == 0 {
+				out.WriteString(html.EscapeString(string(tokenizer.Text())))
+			}
+		case xhtml.StartTagToken, xhtml.SelfClosingTagToken:
+			token := tokenizer.Token()
+			if sanitizeDropContent[token.Data] {
+				if token.Type == xhtml.StartTagToken {
+					skip++
 				}
-				return true, writeInlineJSON(ctx, http.StatusBadRequest, map[string]interface{}{
-					"error": "upload failed",
-				})
+				continue
 			}
-			if path == "" {
-				path, err = saveUploadFile(req, bindKey, uploadDir)
-				if err != nil {
-					if errors != nil {
-						*errors = append(*errors, fmt.Errorf("content_records_plugin: upload failed: %w", err))
-					}
-					return true, writeInlineJSON(ctx, http.StatusBadRequest, map[string]interface{}{
-						"error": "upload failed",
-					})
+			if skip == 0 && p.Tags[token.Data] {
+				out.WriteString(p.startTag(token))
+			}
+		case xhtml.EndTagToken:
+			token := tokenizer.Token()
+			if sanitizeDropContent[token.Data] {
+				if skip > 0 {
+					skip--
 				}
+				continue
 			}
-			if path != "" {
-				value = path
+			if skip == 0 && p.Tags[token.Data] {
+				out.WriteString("</" + token.Data + ">")
 			}
 		}
 	}
+}
 
-	if err := updateRecordField(db, recordID, contentType, bindKey, value); err != nil {
-		if errors != nil {
-			*errors = append(*errors, fmt.Errorf("content_records_plugin: inline update failed: %w", err))
+// startTag renders an allowed tag with its allowed attributes.
+func (p *sanitizePolicy) startTag(token xhtml.Token) string {
+	var b strings.Builder
+	b.WriteString("<" + token.Data)
+	for _, attr := range token.Attr {
+		name := strings.ToLower(attr.Key)
+		if attr.Namespace != "" {
+			name = attr.Namespace + ":" + name
 		}
-		return true, writeInlineJSON(ctx, http.StatusInternalServerError, map[string]interface{}{
-			"error": "update failed",
-		})
+		if strings.HasPrefix(name, "on") || !(p.Attrs["*"][name] || p.Attrs[token.Data][name]) {
+			continue
+		}
+		if sanitizeURLAttrs[name] && !p.allowedURL(attr.Val) {
+			continue
+		}
+		b.WriteString(" " + name + `="` + html.EscapeString(attr.Val) + `"`)
 	}
-
-	return true, writeInlineJSON(ctx, http.StatusOK, map[string]interface{}{
-		"status":    "ok",
-		"record_id": strconv.FormatInt(recordID, 10),
-		"bind":      bindKey,
-		"value":     value,
-	})
+	if token.Type == xhtml.SelfClosingTagToken {
+		b.WriteString(" /")
+	}
+	b.WriteString(">")
+	return b.String()
 }
 
-func parseInlinePayload(req *http.Request, ctx context.Context, fields Fields, errors *[]error) (inlineUpdatePayload, error) {
-	contentType := req.Header.Get("Content-Type")
-	if strings.HasPrefix(contentType, "application/json") {
-		payload, err := decodeInlineJSON(req)
-		if err != nil {
-			return inlineUpdatePayload{}, err
-		}
-		return inlineUpdatePayload{
-			Inline:   firstNonEmpty(getStringFromAny(payload["cr_inline"]), getStringFromAny(payload["inline"])),
-			RecordID: firstNonEmpty(getStringFromAny(payload["record_id"]), getStringFromAny(payload["id"])),
-			Bind:     firstNonEmpty(getStringFromAny(payload["bind"]), getStringFromAny(payload["field"])),
-			Value:    getStringFromAny(payload["value"]),
-		}, nil
+// allowedURL accepts relative URLs and URLs whose scheme is allowed.
+// Whitespace and control characters are ignored the way browsers ignore
+// them, so "java\tscript:" is still recognised as javascript.
+func (p *sanitizePolicy) allowedURL(value string) bool {
+	cleaned := strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, value)
+	colon := strings.Index(cleaned, ":")
+	if colon < 0 {
+		return true
 	}
+	// A ':' after the path, query or fragment starts is not a scheme.
+	if sep := strings.IndexAny(cleaned, "/?#"); sep >= 0 && sep < colon {
+		return true
+	}
+	return p.Schemes[strings.ToLower(cleaned[:colon])]
+}
 
-	parseRequestForm(req, errors)
-	return inlineUpdatePayload{
-		Inline:   firstNonEmpty(GetInputFromContext(ctx, "cr_inline"), GetInputFromContext(ctx, "inline")),
-		RecordID: firstNonEmpty(GetInputFromContext(ctx, "record_id"), GetInputFromContext(ctx, resolveRecordParam(fields))),
-		Bind:     firstNonEmpty(GetInputFromContext(ctx, "bind"), GetInputFromContext(ctx, "field")),
-		Value:    GetInputFromContext(ctx, "value"),
-	}, nil
+// seedActor is recorded as the author of records inserted by data.seed.
+const seedActor = "seed"
+
+// maxSeedCount bounds data.seed_count so a typo cannot fill the store.
+const maxSeedCount = 1000
+
+// seedPlan describes how many records seeding inserts and which binds get a
+// per-record suffix so seeded records are distinguishable.
+type seedPlan struct {
+	Count  int
+	Varied map[string]struct{}
 }
 
-// decodeInlineJSON reads the JSON payload while restoring req.Body so nested
-// ContentRecords plugins can parse the same request.
-func decodeInlineJSON(req *http.Request) (map[string]interface{}, error) {
-	payload := map[string]interface{}{}
-	if req == nil || req.Body == nil {
-		return payload, nil
+// seedVariations resolves data.seed_count. Without a schema every bind is
+// treated as text; with a schema only text-like fields are varied so upload
+// paths, numbers and dates keep their template defaults.
+func seedVariations(fields Fields, binds map[string]bindTarget) seedPlan {
+	count := fields.SeedCount
+	if count < 1 {
+		count = 1
 	}
-
-	bodyBytes, err := io.ReadAll(req.Body)
-	if err != nil {
-		return nil, err
+	if count > maxSeedCount {
+		count = maxSeedCount
 	}
-	_ = req.Body.Close()
-	req.Body = io.NopCloser(bytes.NewReader(bodyBytes))
-
-	if len(bytes.TrimSpace(bodyBytes)) == 0 {
-		return payload, nil
+	plan := seedPlan{Count: count, Varied: map[string]struct{}{}}
+	if count == 1 {
+		return plan
 	}
-
-	decoder := json.NewDecoder(bytes.NewReader(bodyBytes))
-	decoder.UseNumber()
-	if err := decoder.Decode(&payload); err != nil {
-		if err == io.EOF {
-			return map[string]interface{}{}, nil
+	if len(resolveSchema(fields)) == 0 {
+		for key := range binds {
+			plan.Varied[key] = struct{}{}
 		}
-		return nil, err
+		return plan
 	}
-	return payload, nil
-}
-
-func getStringFromAny(value interface{}) string {
-	switch v := value.(type) {
-	case nil:
-		return ""
-	case string:
-		return v
-	case json.Number:
-		return v.String()
-	case float64:
-		return strconv.FormatFloat(v, 'f', -1, 64)
-	case float32:
-		return strconv.FormatFloat(float64(v), 'f', -1, 64)
-	case int:
-		return strconv.Itoa(v)
-	case int64:
-		return strconv.FormatInt(v, 10)
-	case int32:
-		return strconv.FormatInt(int64(v), 10)
-	case bool:
-		if v {
-			return "true"
+	for _, def := range collectCMSFields(fields, binds) {
+		if !isTextFieldType(def.Type) {
+			continue
 		}
-		return "false"
-	default:
-		return fmt.Sprintf("%v", v)
+		key := def.Bind
+		if key == "" {
+			key = def.Name
+		}
+		plan.Varied[key] = struct{}{}
 	}
+	return plan
 }
 
-func firstNonEmpty(values ...string) string {
-	for _, value := range values {
-		value = strings.TrimSpace(value)
-		if value != "" {
-			return value
+// seedValues returns the values for the index-th seeded record. A single
+// seed keeps the template defaults unchanged.
+func seedValues(defaults map[string]string, plan seedPlan, index int) map[string]string {
+	values := make(map[string]string, len(defaults))
+	for key, value := range defaults {
+		values[key] = value
+		if plan.Count <= 1 || value == "" {
+			continue
 		}
+		if _, ok := plan.Varied[key]; !ok {
+			continue
+		}
+		// Wildcard binds hold JSON arrays; a suffix would corrupt them.
+		if strings.HasPrefix(strings.TrimSpace(value), "[") {
+			continue
+		}
+		values[key] = fmt.Sprintf("%s %d", value, index+1)
 	}
-	return ""
+	return values
 }
 
-func hasFileUpload(req *http.Request, fieldNames ...string) bool {
-	if req == nil {
-		return false
+// ensureSeed inserts the seed records when the store has none of this type
+// and reports whether it did.
+func ensureSeed(db *sql.DB, template map[string]interface{}, binds map[string]bindTarget, plan seedPlan, contentType string, opts writeOptions) (bool, error) {
+	count, err := countRecords(db, contentType)
+	if err != nil {
+		return false, err
 	}
-	if req.MultipartForm == nil {
-		return false
+	if count > 0 {
+		return false, nil
 	}
-	for _, name := range fieldNames {
-		if files := req.MultipartForm.File[name]; len(files) > 0 {
-			return true
-		}
+	defaults := defaultValuesFromTemplate(template, binds)
+	batch := make([]map[string]string, 0, plan.Count)
+	for i := 0; i < plan.Count; i++ {
+		batch = append(batch, seedValues(defaults, plan, i))
 	}
-	return false
+	if _, err := createRecords(db, contentType, batch, opts); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
-func writeInlineJSON(ctx context.Context, status int, payload map[string]interface{}) string {
-	writer, _ := ctx.Value(shared.ResponseWriter).(http.ResponseWriter)
-	if writer != nil {
-		writer.Header().Set("Content-Type", "application/json; charset=utf-8")
-		writer.WriteHeader(status)
+func countRecords(db *sql.DB, contentType string) (int, error) {
+	if strings.TrimSpace(contentType) == "" {
+		var total int
+		err := db.QueryRow(`SELECT COUNT(*) FROM records`).Scan(&total)
+		return total, err
 	}
-	data, err := json.Marshal(payload)
-	if err != nil {
-		return `{"error":"inline response failed"}`
+	var total int
+	err := db.QueryRow(`SELECT COUNT(*) FROM records WHERE type = ?`, contentType).Scan(&total)
+	return total, err
+}
+
+// fetchRecordsForList returns the records a list shows. With data.soft_delete
+// trashed records are left out, or kept and marked Deleted when the CMS list
+// asked for them with show_deleted=1.
+func fetchRecordsForList(db *sql.DB, fields Fields, contentType string, filters []recordFilter) ([]record, error) {
+	records, err := fetchListRecords(db, fields, contentType, filters)
+	if err != nil || !fields.SoftDelete {
+		return records, err
 	}
-	return string(data)
+	return applyTrash(db, records, fields.showDeleted)
 }
 
-func saveUploadFile(req *http.Request, fieldName, uploadDir string) (string, error) {
-	file, header, err := req.FormFile(fieldName)
-	if err != nil {
-		if err == http.ErrMissingFile {
-			return "", nil
+func fetchListRecords(db *sql.DB, fields Fields, contentType string, filters []recordFilter) ([]record, error) {
+	ids := resolveIDs(fields)
+	if len(ids) > 0 {
+		ids, err := filterRecordIDs(db, ids, contentType, filters)
+		if err != nil {
+			return nil, err
 		}
-		return "", err
+		records, err := fetchRecordsByIDs(db, ids, contentType)
+		logDebug(fields, "records fetched by id", "ids", len(ids), "rows", len(records), "error", err)
+		return records, err
 	}
-	defer file.Close()
-
-	if err := os.MkdirAll(uploadDir, 0o755); err != nil {
-		return "", err
+	query, args, err := resolveRecordQuery(db, fields, contentType)
+	if err != nil {
+		return nil, err
 	}
-
-	ext := filepath.Ext(header.Filename)
-	base := strings.TrimSuffix(filepath.Base(header.Filename), ext)
-	base = sanitizeFilename(base)
-	if base == "" {
-		base = "upload"
+	ids, scan, err := queryRecordIDs(db, query, contentType, resolveQueryTimeout(fields), args...)
+	if err != nil {
+		return nil, err
 	}
-	filename := fmt.Sprintf("%s-%d%s", base, time.Now().UnixNano(), ext)
-	destPath := filepath.Join(uploadDir, filename)
+	logIDScan(fields, query, scan)
+	if len(filters) > 0 {
+		if ids, err = filterRecordIDs(db, ids, contentType, filters); err != nil {
+			return nil, err
+		}
+		// The query already applied the type scoping.
+		records, err := fetchRecordsByIDs(db, ids, "")
+		logDebug(fields, "query executed", "query", query, "type", contentType, "filters", len(filters), "rows", len(records), "error", err)
+		return records, err
+	}
+	records, err := fetchQueriedRecords(db, ids, contentType)
+	logDebug(fields, "query executed", "query", query, "type", contentType, "rows", len(records), "error", err)
+	return records, err
+}
 
-	dest, err := os.Create(destPath)
+// fetchRecordPage applies the same id/query/type/filter scoping as
+// fetchRecordsForList and returns one page plus the total number of ids.
+func fetchRecordPage(db *sql.DB, fields Fields, contentType string, filters []recordFilter, offset, limit int) ([]record, int, error) {
+	ids, err := scopedRecordIDs(db, fields, contentType, filters)
 	if err != nil {
-		return "", err
+		return nil, 0, err
 	}
-	defer dest.Close()
 
-	if _, err := io.Copy(dest, file); err != nil {
-		return "", err
+	total := len(ids)
+	if offset >= total {
+		return []record{}, total, nil
 	}
+	end := offset + limit
+	if limit <= 0 || end > total {
+		end = total
+	}
+	records, err := fetchRecordsByIDs(db, ids[offset:end], contentType)
+	return records, total, err
+}
 
-	return destPath, nil
+// scopedRecordIDs returns the ids selected by data.id(s), or the query and
+// type, narrowed by the request's filters.
+func scopedRecordIDs(db *sql.DB, fields Fields, contentType string, filters []recordFilter) ([]int64, error) {
+	ids := resolveIDs(fields)
+	if len(ids) == 0 {
+		query, args, err := resolveRecordQuery(db, fields, contentType)
+		if err != nil {
+			return nil, err
+		}
+		var scan idScan
+		ids, scan, err = queryRecordIDs(db, query, contentType, resolveQueryTimeout(fields), args...)
+		if err != nil {
+			return nil, err
+		}
+		logIDScan(fields, query, scan)
+	}
+	ids, err := filterRecordIDs(db, ids, contentType, filters)
+	if err != nil || !fields.SoftDelete {
+		return ids, err
+	}
+	return liveRecordIDs(db, ids)
 }
 
-func sanitizeFilename(name string) string {
-	var b strings.Builder
-	for _, r := range name {
-		switch {
-		case r >= 'a' && r <= 'z':
-			b.WriteRune(r)
-		case r >= 'A' && r <= 'Z':
-			b.WriteRune(r)
-		case r >= '0' && r <= '9':
-			b.WriteRune(r)
-		case r == '-' || r == '_' || r == '.':
-			b.WriteRune(r)
-		case r == ' ':
-			b.WriteRune('-')
+// showDeletedParam is the CMS list's query param that includes trashed
+// records (data.soft_delete).
+const showDeletedParam = "show_deleted"
+
+// trashedRecordIDs returns which of ids are in the trash.
+func trashedRecordIDs(db *sql.DB, ids []int64) (map[int64]bool, error) {
+	trashed := map[int64]bool{}
+	if len(ids) == 0 {
+		return trashed, nil
+	}
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := db.Query(`SELECT id FROM records WHERE deleted_at IS NOT NULL AND id IN (`+placeholders(len(ids))+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
 		}
+		trashed[id] = true
 	}
-	return b.String()
+	return trashed, rows.Err()
 }
 
-func createRecord(db *sql.DB, contentType string, values map[string]string) (int64, error) {
-	tx, err := db.Begin()
-	if err != nil {
-		return 0, err
+// liveRecordIDs drops trashed records from ids, keeping the order.
+func liveRecordIDs(db *sql.DB, ids []int64) ([]int64, error) {
+	trashed, err := trashedRecordIDs(db, ids)
+	if err != nil || len(trashed) == 0 {
+		return ids, err
 	}
-	defer func() {
-		if err != nil {
-			_ = tx.Rollback()
+	live := make([]int64, 0, len(ids)-len(trashed))
+	for _, id := range ids {
+		if !trashed[id] {
+			live = append(live, id)
 		}
-	}()
+	}
+	return live, nil
+}
 
-	res, err := tx.Exec(`INSERT INTO records(type) VALUES(?)`, contentType)
-	if err != nil {
-		return 0, err
+// applyTrash drops trashed records, or marks them Deleted when keep is set.
+func applyTrash(db *sql.DB, records []record, keep bool) ([]record, error) {
+	ids := make([]int64, len(records))
+	for i, rec := range records {
+		ids[i] = rec.ID
 	}
-	recordID, err := res.LastInsertId()
-	if err != nil {
-		return 0, err
+	trashed, err := trashedRecordIDs(db, ids)
+	if err != nil || len(trashed) == 0 {
+		return records, err
 	}
-
-	if err := upsertFields(tx, recordID, values); err != nil {
-		return 0, err
+	kept := records[:0]
+	for _, rec := range records {
+		rec.Deleted = trashed[rec.ID]
+		if keep || !rec.Deleted {
+			kept = append(kept, rec)
+		}
 	}
+	return kept, nil
+}
 
-	return recordID, tx.Commit()
+// checkNotTrashed returns errRecordNotFound for a trashed record, so single
+// views treat it like a deleted one.
+func checkNotTrashed(db *sql.DB, id int64) error {
+	trashed, err := trashedRecordIDs(db, []int64{id})
+	if err != nil {
+		return err
+	}
+	if trashed[id] {
+		return errRecordNotFound
+	}
+	return nil
 }
 
-func createRecordFromTemplate(db *sql.DB, contentType string, template map[string]interface{}, binds map[string]bindTarget) (int64, error) {
-	values := defaultValuesFromTemplate(template, binds)
-	return createRecord(db, contentType, values)
+// Filter operators, used as <bind>__<op> request params. A bare <bind>
+// param is an equality filter.
+var filterOperators = []string{"like", "gt", "lt"}
+
+// recordFilter is one active list filter taken from the request.
+type recordFilter struct {
+	Param string // request param, e.g. "price__gt"
+	Bind  string
+	Op    string // eq|like|gt|lt
+	Value string
+	Type  string // schema type; number/date compare the typed columns
 }
 
-func updateRecord(db *sql.DB, recordID int64, contentType string, values map[string]string) error {
-	tx, err := db.Begin()
-	if err != nil {
-		return err
+// resolveFilters reads filters for the binds listed in data.filterable from
+// the request. Params for other binds are ignored.
+func resolveFilters(fields Fields, binds map[string]bindTarget, ctx context.Context) []recordFilter {
+	var filters []recordFilter
+	if parent := resolveParentFilter(fields); parent != nil {
+		filters = append(filters, *parent)
 	}
-	defer func() {
-		if err != nil {
-			_ = tx.Rollback()
+	if len(fields.Filterable) == 0 || ctx == nil {
+		return filters
+	}
+	types := buildBindTypeMap(fields, binds)
+	seen := map[string]struct{}{}
+	for _, bind := range fields.Filterable {
+		bind = strings.TrimSpace(bind)
+		if bind == "" {
+			continue
 		}
-	}()
-
-	if contentType != "" {
-		if _, err := tx.Exec(`UPDATE records SET updated_at = CURRENT_TIMESTAMP WHERE id = ? AND type = ?`, recordID, contentType); err != nil {
-			return err
+		if _, ok := seen[bind]; ok {
+			continue
 		}
-	} else {
-		if _, err := tx.Exec(`UPDATE records SET updated_at = CURRENT_TIMESTAMP WHERE id = ?`, recordID); err != nil {
-			return err
+		seen[bind] = struct{}{}
+		for _, op := range append([]string{"eq"}, filterOperators...) {
+			param := bind
+			if op != "eq" {
+				param = bind + "__" + op
+			}
+			value := strings.TrimSpace(GetInputFromContext(ctx, param))
+			if value == "" {
+				continue
+			}
+			filters = append(filters, recordFilter{Param: param, Bind: bind, Op: op, Value: value, Type: types[bind]})
 		}
 	}
+	return filters
+}
 
-	if _, err := tx.Exec(`DELETE FROM record_fields WHERE record_id = ?`, recordID); err != nil {
-		return err
+// resolveParentFilter scopes a nested list to the enclosing record: with
+// data.parent_bind set, only records whose bind equals parent_id match.
+// Without a parent id (the plugin is used standalone) nothing is filtered.
+func resolveParentFilter(fields Fields) *recordFilter {
+	bind := strings.TrimSpace(fields.ParentBind)
+	parentID := parseIDValue(fields.ParentID)
+	if bind == "" || parentID == 0 {
+		return nil
 	}
+	return &recordFilter{Param: "parent_id", Bind: bind, Op: "eq", Value: strconv.FormatInt(parentID, 10)}
+}
 
-	if err := upsertFields(tx, recordID, values); err != nil {
-		return err
+// filterValues exposes the active filters to the CMS template as param → value.
+func filterValues(filters []recordFilter) map[string]interface{} {
+	out := make(map[string]interface{}, len(filters))
+	for _, filter := range filters {
+		out[filter.Param] = filter.Value
 	}
-
-	return tx.Commit()
+	return out
 }
 
-func updateRecordField(db *sql.DB, recordID int64, contentType string, bindKey string, value string) error {
-	if recordID == 0 {
-		return fmt.Errorf("record id is required")
+// likeEscaper escapes LIKE wildcards for the ESCAPE '!' clause.
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// filterRecordIDs keeps the ids, in order, whose fields match every filter.
+func filterRecordIDs(db *sql.DB, ids []int64, contentType string, filters []recordFilter) ([]int64, error) {
+	if len(filters) == 0 || len(ids) == 0 {
+		return ids, nil
 	}
-	if strings.TrimSpace(bindKey) == "" {
-		return fmt.Errorf("bind key is required")
+	query, args, err := recordFilterQuery(db, contentType, filters)
+	if err != nil {
+		return nil, err
 	}
-
-	tx, err := db.Begin()
+	rows, err := db.Query(query, args...)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer func() {
-		if err != nil {
-			_ = tx.Rollback()
+	defer rows.Close()
+	matched := map[int64]struct{}{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
 		}
-	}()
-
-	var res sql.Result
-	if contentType != "" {
-		res, err = tx.Exec(`UPDATE records SET updated_at = CURRENT_TIMESTAMP WHERE id = ? AND type = ?`, recordID, contentType)
-	} else {
-		res, err = tx.Exec(`UPDATE records SET updated_at = CURRENT_TIMESTAMP WHERE id = ?`, recordID)
+		matched[id] = struct{}{}
 	}
-	if err != nil {
-		return err
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
-	if rows, _ := res.RowsAffected(); rows == 0 {
-		return fmt.Errorf("record not found")
+
+	out := make([]int64, 0, len(matched))
+	for _, id := range ids {
+		if _, ok := matched[id]; ok {
+			out = append(out, id)
+		}
 	}
+	return out, nil
+}
 
-	res, err = tx.Exec(`UPDATE record_fields SET value = ? WHERE record_id = ? AND bind_key = ?`, value, recordID, bindKey)
-	if err != nil {
-		return err
+// recordFilterQuery selects the ids of records matching every filter: one
+// record_fields join per filter, or conditions on the type's columns table.
+func recordFilterQuery(db *sql.DB, contentType string, filters []recordFilter) (string, []interface{}, error) {
+	if layout := columnLayoutOf(db, contentType); layout != nil {
+		return columnFilterQuery(layout, filters)
 	}
-	if rows, _ := res.RowsAffected(); rows == 0 {
-		if _, err := tx.Exec(`INSERT INTO record_fields(record_id, bind_key, value) VALUES(?, ?, ?)`, recordID, bindKey, value); err != nil {
-			return err
+	var (
+		joins []string
+		args  []interface{}
+	)
+	for i, filter := range filters {
+		alias := fmt.Sprintf("f%d", i)
+		column, arg := alias+".value", interface{}(filter.Value)
+		if filter.Op == "gt" || filter.Op == "lt" {
+			if num, date := typedValues(filter.Type, filter.Value); num != nil {
+				column, arg = alias+".num_value", num
+			} else if date != nil {
+				column, arg = alias+".date_value", date
+			}
+		}
+		var cond string
+		switch filter.Op {
+		case "like":
+			cond = column + " LIKE ? ESCAPE '!'"
+			arg = "%" + likeEscaper.Replace(filter.Value) + "%"
+		case "gt":
+			cond = column + " > ?"
+		case "lt":
+			cond = column + " < ?"
+		default:
+			cond = column + " = ?"
 		}
+		joins = append(joins, fmt.Sprintf("JOIN record_fields %s ON %s.record_id = r.id AND %s.bind_key = ? AND %s", alias, alias, alias, cond))
+		args = append(args, filter.Bind, arg)
 	}
+	return `SELECT r.id FROM records r ` + strings.Join(joins, " "), args, nil
+}
 
-	return tx.Commit()
+// whereOperators maps data.where operators to their SQL comparison. contains
+// is a substring match; gt/gte/lt/lte compare the typed columns for number
+// and date schema fields and the text otherwise; in matches any listed value.
+var whereOperators = map[string]string{
+	"eq":       "=",
+	"contains": "LIKE",
+	"gt":       ">",
+	"gte":      ">=",
+	"lt":       "<",
+	"lte":      "<=",
+	"in":       "IN",
 }
 
-func deleteRecord(db *sql.DB, recordID int64, contentType string) error {
-	tx, err := db.Begin()
-	if err != nil {
-		return err
+// recordOrderColumns are the records columns order_by accepts besides binds.
+var recordOrderColumns = map[string]bool{"id": true, "created_at": true, "updated_at": true}
+
+// resolveRecordQuery returns the id query of a list: data.query as written,
+// the query compiled from data.where/order_by/limit, or "" to select every
+// record of the type.
+func resolveRecordQuery(db *sql.DB, fields Fields, contentType string) (string, []interface{}, error) {
+	query := resolveQuery(fields)
+	structured := len(fields.Where) > 0 || strings.TrimSpace(fields.OrderBy) != "" || fields.Limit > 0
+	switch {
+	case !structured:
+		return query, nil, nil
+	case query != "":
+		return "", nil, fmt.Errorf("data.where, order_by and limit cannot be combined with data.query")
 	}
-	defer func() {
-		if err != nil {
-			_ = tx.Rollback()
-		}
-	}()
+	return compileRecordQuery(fields, contentType, columnLayoutOf(db, contentType))
+}
 
-	if _, err := tx.Exec(`DELETE FROM record_fields WHERE record_id = ?`, recordID); err != nil {
-		return err
+// compileRecordQuery compiles data.where, order_by and limit into a
+// parameterized id query. Values and bind keys are passed as arguments and
+// column names come from the layout's quoted identifiers, so nothing from
+// the config is spliced into the SQL.
+func compileRecordQuery(fields Fields, contentType string, layout *columnLayout) (string, []interface{}, error) {
+	var (
+		joins    []string
+		joinArgs []interface{}
+		conds    []string
+		args     []interface{}
+	)
+	if layout != nil {
+		joins = append(joins, fmt.Sprintf("JOIN %s c ON c.record_id = r.id", layout.ident(layout.Table)))
 	}
 	if contentType != "" {
-		if _, err := tx.Exec(`DELETE FROM records WHERE id = ? AND type = ?`, recordID, contentType); err != nil {
-			return err
-		}
-	} else {
-		if _, err := tx.Exec(`DELETE FROM records WHERE id = ?`, recordID); err != nil {
-			return err
-		}
+		conds = append(conds, "r.type = ?")
+		args = append(args, contentType)
 	}
-	return tx.Commit()
-}
 
-func upsertFields(tx *sql.Tx, recordID int64, values map[string]string) error {
-	for key, value := range values {
-		if _, err := tx.Exec(
-			`INSERT INTO record_fields(record_id, bind_key, value) VALUES(?, ?, ?)`,
-			recordID, key, value,
-		); err != nil {
-			return err
-		}
+	keys := make([]string, 0, len(fields.Where))
+	for key := range fields.Where {
+		keys = append(keys, key)
 	}
-	return nil
-}
-
-// Fetch value for key from context (form, query, body)
-func GetInputFromContext(ctx context.Context, key string) string {
-	if form, ok := ctx.Value(shared.FormData).(url.Values); ok && form != nil {
-		if v, exists := form[key]; exists && len(v) > 0 {
-			return v[0]
+	sort.Slice(keys, func(i, j int) bool {
+		a, errA := strconv.Atoi(keys[i])
+		b, errB := strconv.Atoi(keys[j])
+		if errA == nil && errB == nil {
+			return a < b
 		}
-	}
-	if req, ok := ctx.Value(shared.Request).(*http.Request); ok && req != nil {
-		if v := req.Form.Get(key); v != "" {
-			return v
+		return keys[i] < keys[j]
+	})
+	for i, key := range keys {
+		cond := fields.Where[key]
+		bind := strings.TrimSpace(cond.Bind)
+		op := strings.ToLower(strings.TrimSpace(cond.Op))
+		if op == "" {
+			op = "eq"
+		}
+		sqlOp, ok := whereOperators[op]
+		if !ok {
+			return "", nil, fmt.Errorf("where.%s: unknown operator %q (expected eq, contains, gt, gte, lt, lte or in)", key, cond.Op)
 		}
-		if v := req.PostForm.Get(key); v != "" {
-			return v
+		if bind == "" {
+			return "", nil, fmt.Errorf("where.%s: bind is required", key)
 		}
-		vals := req.URL.Query()
-		if v, exists := vals[key]; exists && len(v) > 0 {
-			return v[0]
+		values := whereValues(cond.Value, op == "in")
+		if len(values) == 0 {
+			return "", nil, fmt.Errorf("where.%s: value is required", key)
 		}
-	}
-	if body, ok := ctx.Value(shared.RequestBody).(io.Reader); ok && body != nil {
-		var m map[string]interface{}
-		decoder := json.NewDecoder(body)
-		if err := decoder.Decode(&m); err == nil {
-			if v, found := m[key]; found {
-				if str, ok := v.(string); ok {
-					return str
+
+		var column string
+		fieldType := schemaTypeOf(fields, bind)
+		if layout != nil {
+			if !layout.has(bind) {
+				return "", nil, fmt.Errorf("where.%s: bind %q has no column in %s", key, bind, layout.Table)
+			}
+			column = "c." + layout.ident(bind)
+			fieldType = ""
+			if layout.Numeric[bind] {
+				fieldType = "number"
+			}
+		} else {
+			alias := fmt.Sprintf("w%d", i)
+			column = alias + ".value"
+			switch fieldType {
+			case "number", "integer", "float":
+				if op != "contains" {
+					column = alias + ".num_value"
+				}
+			case "date", "datetime":
+				if op != "contains" {
+					column = alias + ".date_value"
 				}
 			}
+			joins = append(joins, fmt.Sprintf("JOIN record_fields %s ON %s.record_id = r.id AND %s.bind_key = ?", alias, alias, alias))
+			joinArgs = append(joinArgs, bind)
 		}
-	}
-	return ""
-}
 
-func parseRequestForm(req *http.Request, errors *[]error) {
-	if req == nil {
-		return
-	}
-	contentType := req.Header.Get("Content-Type")
-	if strings.HasPrefix(contentType, "multipart/form-data") {
-		if req.MultipartForm != nil {
-			return
-		}
-		if err := req.ParseMultipartForm(20 << 20); err != nil {
-			if errors != nil {
-				*errors = append(*errors, fmt.Errorf("content_records_plugin: parse multipart form failed: %w", err))
+		typed := make([]interface{}, 0, len(values))
+		for _, value := range values {
+			arg, err := whereArg(fieldType, op, value)
+			if err != nil {
+				return "", nil, fmt.Errorf("where.%s: %w", key, err)
 			}
+			typed = append(typed, arg)
 		}
-		return
-	}
-	if err := req.ParseForm(); err != nil {
-		if errors != nil {
-			*errors = append(*errors, fmt.Errorf("content_records_plugin: parse form failed: %w", err))
-		}
-	}
-}
-
-func resolveTypeName(value interface{}) string {
-	if value == nil {
-		return ""
-	}
-	if m, ok := value.(map[string]interface{}); ok {
-		if t, ok := m["@name"].(string); ok {
-			return t
+		switch op {
+		case "contains":
+			conds = append(conds, column+" LIKE ? ESCAPE '!'")
+		case "in":
+			conds = append(conds, column+" IN ("+strings.TrimSuffix(strings.Repeat("?, ", len(typed)), ", ")+")")
+		default:
+			conds = append(conds, column+" "+sqlOp+" ?")
 		}
-	}
-	return ""
-}
-
-func getDB(store string) (*sql.DB, error) {
-	store = strings.TrimSpace(store)
-	if store == "" {
-		return nil, fmt.Errorf("content_records_plugin: data.store is required")
+		args = append(args, typed...)
 	}
 
-	if store != ":memory:" {
-		if err := os.MkdirAll(filepath.Dir(store), 0o755); err != nil {
-			return nil, err
-		}
+	order, orderJoins, orderArgs, err := compileOrderBy(fields, layout)
+	if err != nil {
+		return "", nil, err
 	}
+	joins = append(joins, orderJoins...)
+	joinArgs = append(joinArgs, orderArgs...)
 
-	dbMu.Lock()
-	entry, ok := dbByPath[store]
-	if !ok {
-		db, err := sql.Open("sqlite3", store)
-		if err != nil {
-			dbMu.Unlock()
-			return nil, err
-		}
-		entry = &dbEntry{db: db}
-		dbByPath[store] = entry
+	query := "SELECT r.id FROM records r"
+	if len(joins) > 0 {
+		query += " " + strings.Join(joins, " ")
 	}
-	dbMu.Unlock()
-
-	if err := entry.db.Ping(); err != nil {
-		return nil, err
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
 	}
-
-	entry.once.Do(func() {
-		entry.initErr = initSchema(entry.db)
-	})
-
-	if entry.initErr != nil {
-		return entry.db, entry.initErr
+	query += " ORDER BY " + order
+	args = append(joinArgs, args...)
+	if fields.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, fields.Limit)
 	}
-
-	return entry.db, nil
+	return query, args, nil
 }
 
-func initSchema(db *sql.DB) error {
-	stmts := []string{
-		`CREATE TABLE IF NOT EXISTS records (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			type TEXT,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		)`,
-		`CREATE TABLE IF NOT EXISTS record_fields (
-			record_id INTEGER,
-			bind_key TEXT,
-			value TEXT,
-			PRIMARY KEY(record_id, bind_key)
-		)`,
-		`CREATE INDEX IF NOT EXISTS idx_records_type ON records(type)`,
-		`CREATE INDEX IF NOT EXISTS idx_record_fields_record_id ON record_fields(record_id)`,
-	}
-
-	for _, stmt := range stmts {
-		if _, err := db.Exec(stmt); err != nil {
-			return err
+// compileOrderBy reads data.order_by ("bind [asc|desc], ...") into an ORDER
+// BY list. Bind orderings LEFT JOIN their value, so records without it stay
+// in the result; r.id breaks ties.
+func compileOrderBy(fields Fields, layout *columnLayout) (string, []string, []interface{}, error) {
+	var (
+		terms []string
+		joins []string
+		args  []interface{}
+	)
+	for i, part := range strings.Split(fields.OrderBy, ",") {
+		words := strings.Fields(part)
+		if len(words) == 0 {
+			continue
+		}
+		direction := "ASC"
+		if len(words) > 1 {
+			direction = strings.ToUpper(words[1])
+		}
+		if len(words) > 2 || (direction != "ASC" && direction != "DESC") {
+			return "", nil, nil, fmt.Errorf("order_by %q: expected \"bind [asc|desc]\"", strings.TrimSpace(part))
+		}
+		bind := words[0]
+		var column string
+		switch {
+		case recordOrderColumns[bind]:
+			column = "r." + bind
+		case layout != nil:
+			if !layout.has(bind) {
+				return "", nil, nil, fmt.Errorf("order_by: bind %q has no column in %s", bind, layout.Table)
+			}
+			column = "c." + layout.ident(bind)
+		default:
+			alias := fmt.Sprintf("o%d", i)
+			column = alias + ".value"
+			switch schemaTypeOf(fields, bind) {
+			case "number", "integer", "float":
+				column = alias + ".num_value"
+			case "date", "datetime":
+				column = alias + ".date_value"
+			}
+			joins = append(joins, fmt.Sprintf("LEFT JOIN record_fields %s ON %s.record_id = r.id AND %s.bind_key = ?", alias, alias, alias))
+			args = append(args, bind)
 		}
+		terms = append(terms, column+" "+direction)
 	}
-
-	return nil
+	terms = append(terms, "r.id ASC")
+	return strings.Join(terms, ", "), joins, args, nil
 }
 
-func ensureSeed(db *sql.DB, template map[string]interface{}, binds map[string]bindTarget, contentType string) error {
-	count, err := countRecords(db, contentType)
-	if err != nil {
-		return err
+// whereValues returns a condition's values: in takes a list or splits a
+// string on commas, every other operator uses the value as one string.
+func whereValues(value interface{}, list bool) []string {
+	var values []string
+	switch v := value.(type) {
+	case nil:
+	case []interface{}:
+		for _, item := range v {
+			values = append(values, strings.TrimSpace(fmt.Sprint(item)))
+		}
+	case []string:
+		values = append(values, v...)
+	default:
+		values = []string{fmt.Sprint(v)}
+		if list {
+			values = strings.Split(values[0], ",")
+		}
 	}
-	if count > 0 {
-		return nil
+	out := values[:0]
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			out = append(out, value)
+		}
 	}
-	_, err = createRecordFromTemplate(db, contentType, template, binds)
-	return err
+	if !list && len(out) > 1 {
+		return out[:1]
+	}
+	return out
 }
-
-func countRecords(db *sql.DB, contentType string) (int, error) {
-	if strings.TrimSpace(contentType) == "" {
-		var total int
-		err := db.QueryRow(`SELECT COUNT(*) FROM records`).Scan(&total)
-		return total, err
+
+// whereArg converts one condition value to its query argument: a float for
+// number fields, a normalized timestamp for date fields, and a LIKE pattern
+// for contains.
+func whereArg(fieldType, op, value string) (interface{}, error) {
+	if op == "contains" {
+		return "%" + likeEscaper.Replace(value) + "%", nil
 	}
-	var total int
-	err := db.QueryRow(`SELECT COUNT(*) FROM records WHERE type = ?`, contentType).Scan(&total)
-	return total, err
+	switch fieldType {
+	case "number", "integer", "float":
+		num, _ := typedValues("number", value)
+		if num == nil {
+			return nil, fmt.Errorf("%q is not a number", value)
+		}
+		return num, nil
+	case "date", "datetime":
+		_, date := typedValues("date", value)
+		if date == nil {
+			return nil, fmt.Errorf("%q is not a date", value)
+		}
+		return date, nil
+	}
+	return value, nil
 }
 
-func fetchRecordsForList(db *sql.DB, fields Fields, contentType string) ([]record, error) {
-	ids := resolveIDs(fields)
-	if len(ids) > 0 {
-		return fetchRecordsByIDs(db, ids, contentType)
+// schemaTypeOf returns the lower-cased schema type of bind, or "" when no
+// schema field binds it.
+func schemaTypeOf(fields Fields, bind string) string {
+	for name, def := range resolveSchema(fields) {
+		key := strings.TrimSpace(def.Bind)
+		if key == "" {
+			key = name
+		}
+		if key == bind {
+			return strings.ToLower(strings.TrimSpace(def.Type))
+		}
 	}
-	query := resolveQuery(fields)
-	return fetchRecords(db, query, contentType)
+	return ""
 }
 
 func fetchRecordsByIDs(db *sql.DB, ids []int64, contentType string) ([]record, error) {
+	if layout := columnLayoutOf(db, contentType); layout != nil {
+		return fetchColumnRecords(db, layout, ids, contentType)
+	}
 	records := make([]record, 0, len(ids))
 	for _, id := range ids {
 		rec, err := fetchRecordByID(db, id, contentType)
@@ -2123,6 +8519,15 @@ func fetchRecords(db *sql.DB, sqlQuery string, contentType string) ([]record, er
 	if err != nil {
 		return nil, err
 	}
+	return fetchQueriedRecords(db, ids, contentType)
+}
+
+// fetchQueriedRecords loads the records for ids returned by a query, which
+// already applied the type scoping.
+func fetchQueriedRecords(db *sql.DB, ids []int64, contentType string) ([]record, error) {
+	if layout := columnLayoutOf(db, contentType); layout != nil {
+		return fetchColumnRecords(db, layout, ids, "")
+	}
 
 	records := make([]record, 0, len(ids))
 	for _, id := range ids {
@@ -2140,40 +8545,104 @@ func fetchRecords(db *sql.DB, sqlQuery string, contentType string) ([]record, er
 }
 
 func fetchRecordIDs(db *sql.DB, sqlQuery string, contentType string) ([]int64, error) {
-	if strings.TrimSpace(sqlQuery) == "" {
-		if strings.TrimSpace(contentType) == "" {
-			rows, err := db.Query(`SELECT id FROM records ORDER BY id`)
-			if err != nil {
-				return nil, err
-			}
-			defer rows.Close()
-			return scanIDs(rows)
-		}
+	ids, _, err := queryRecordIDs(db, sqlQuery, contentType, 0)
+	return ids, err
+}
 
-		rows, err := db.Query(`SELECT id FROM records WHERE type = ? ORDER BY id`, contentType)
+// queryRecordIDs runs the custom query, or selects the type's ids, and
+// reports how many rows were scanned and skipped. The custom query is
+// cancelled once it runs longer than timeout (0: no limit).
+func queryRecordIDs(db *sql.DB, sqlQuery string, contentType string, timeout time.Duration, args ...interface{}) ([]int64, idScan, error) {
+	metrics.add("db_reads", 1)
+	if strings.TrimSpace(sqlQuery) != "" {
+		ctx, cancel := queryContext(timeout)
+		defer cancel()
+		rows, err := db.QueryContext(ctx, sqlQuery, args...)
 		if err != nil {
-			return nil, err
+			return nil, idScan{}, queryTimeoutError(ctx, timeout, err)
 		}
 		defer rows.Close()
-		return scanIDs(rows)
+		ids, scan, err := scanIDs(rows)
+		return ids, scan, queryTimeoutError(ctx, timeout, err)
+	}
+	var rows *sql.Rows
+	var err error
+	switch {
+	case strings.TrimSpace(contentType) == "":
+		rows, err = db.Query(`SELECT id FROM records ORDER BY id`)
+	default:
+		rows, err = db.Query(`SELECT id FROM records WHERE type = ? ORDER BY id`, contentType)
 	}
-
-	rows, err := db.Query(sqlQuery)
 	if err != nil {
-		return nil, err
+		return nil, idScan{}, err
 	}
 	defer rows.Close()
 	return scanIDs(rows)
 }
 
-func scanIDs(rows *sql.Rows) ([]int64, error) {
+// errQueryTimeout is returned when a custom query runs past data.query_timeout.
+var errQueryTimeout = errors.New("query exceeded time budget")
+
+// resolveQueryTimeout reads data.query_timeout like retry_delay: a Go
+// duration or a number of milliseconds. Empty or invalid means no limit;
+// validate_only reports invalid values.
+func resolveQueryTimeout(fields Fields) time.Duration {
+	timeout, _ := parseDelay(fields.QueryTimeout)
+	return timeout
+}
+
+// queryContext bounds a custom query by timeout; 0 means no limit.
+func queryContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.Background(), func() {}
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// queryTimeoutError reports err from a query run under ctx as
+// errQueryTimeout once ctx's deadline has passed, whatever the driver
+// returned for the interrupted statement.
+func queryTimeoutError(ctx context.Context, timeout time.Duration, err error) error {
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("%w (%s)", errQueryTimeout, timeout)
+	}
+	return err
+}
+
+// idScan counts the rows an id query returned and how many were skipped
+// because their first column was NULL or not an integer.
+type idScan struct {
+	Column  string // name of the first column, read as the record id
+	Rows    int
+	Skipped int
+}
+
+// unusable reports rows that all lacked an id, which usually means the
+// query does not select the record id first.
+func (s idScan) unusable() bool {
+	return s.Rows > 0 && s.Skipped == s.Rows
+}
+
+// logIDScan logs an id query's scan counts in debug mode, and warns even
+// without it when every row was skipped.
+func logIDScan(fields Fields, query string, scan idScan) {
+	logDebug(fields, "ids scanned", "query", query, "column", scan.Column, "rows", scan.Rows, "skipped", scan.Skipped)
+	if scan.unusable() {
+		logging.GetLogger().Warnw("ContentRecords: query returned rows but no usable record ids; select the record id as the first column",
+			"query", query, "column", scan.Column, "rows", scan.Rows)
+	}
+}
+
+func scanIDs(rows *sql.Rows) ([]int64, idScan, error) {
+	var scan idScan
 	cols, err := rows.Columns()
 	if err != nil {
-		return nil, err
+		return nil, scan, err
 	}
 	if len(cols) == 0 {
-		return nil, nil
+		return nil, scan, nil
 	}
+	scan.Column = cols[0]
 
 	var ids []int64
 	for rows.Next() {
@@ -2183,15 +8652,17 @@ func scanIDs(rows *sql.Rows) ([]int64, error) {
 			holder[i] = &values[i]
 		}
 		if err := rows.Scan(holder...); err != nil {
-			return nil, err
+			return nil, scan, err
 		}
+		scan.Rows++
 		id, ok := toInt64(values[0])
 		if !ok {
+			scan.Skipped++
 			continue
 		}
 		ids = append(ids, id)
 	}
-	return ids, rows.Err()
+	return ids, scan, rows.Err()
 }
 
 func toInt64(value interface{}) (int64, bool) {
@@ -2219,7 +8690,13 @@ func defaultValuesFromTemplate(template map[string]interface{}, binds map[string
 	values := make(map[string]string, len(binds))
 	for bindKey, target := range binds {
 		val := ""
-		if v, ok := getAtPath(template, target.Path); ok {
+		if hasWildcard(target.Path) {
+			if items, ok := getWildcardValues(template, target.Path); ok {
+				if encoded, err := json.Marshal(items); err == nil {
+					val = string(encoded)
+				}
+			}
+		} else if v, ok := getAtPath(template, target.lookupPath()); ok {
 			val = fmt.Sprintf("%v", v)
 		}
 		values[bindKey] = val
@@ -2228,6 +8705,18 @@ func defaultValuesFromTemplate(template map[string]interface{}, binds map[string
 }
 
 func fetchRecordFields(db *sql.DB, recordID int64) (map[string]string, error) {
+	metrics.add("db_reads", 1)
+	// Stores with a columns table look up the record's type to find it.
+	if layouts := columnLayoutsOf(db); len(layouts) > 0 {
+		var contentType sql.NullString
+		if err := db.QueryRow(`SELECT type FROM records WHERE id = ?`, recordID).Scan(&contentType); err == nil {
+			for _, layout := range layouts {
+				if layout.Type == contentType.String {
+					return fetchColumnRow(db, layout, recordID)
+				}
+			}
+		}
+	}
 	rows, err := db.Query(`SELECT bind_key, value FROM record_fields WHERE record_id = ?`, recordID)
 	if err != nil {
 		return nil, err
@@ -2250,15 +8739,20 @@ func fetchRecordFields(db *sql.DB, recordID int64) (map[string]string, error) {
 }
 
 func fetchRecordByID(db *sql.DB, recordID int64, contentType string) (record, error) {
+	metrics.add("db_reads", 1)
 	if recordID == 0 {
 		return record{}, fmt.Errorf("record id is required")
 	}
 	var id int64
+	var uid string
 	var err error
 	if contentType != "" {
-		err = db.QueryRow(`SELECT id FROM records WHERE id = ? AND type = ?`, recordID, contentType).Scan(&id)
+		err = db.QueryRow(`SELECT id, COALESCE(uid, '') FROM records WHERE id = ? AND type = ?`, recordID, contentType).Scan(&id, &uid)
 	} else {
-		err = db.QueryRow(`SELECT id FROM records WHERE id = ?`, recordID).Scan(&id)
+		err = db.QueryRow(`SELECT id, COALESCE(uid, '') FROM records WHERE id = ?`, recordID).Scan(&id, &uid)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return record{}, errRecordNotFound
 	}
 	if err != nil {
 		return record{}, err
@@ -2267,7 +8761,7 @@ func fetchRecordByID(db *sql.DB, recordID int64, contentType string) (record, er
 	if err != nil {
 		return record{}, err
 	}
-	return record{ID: id, Fields: fields}, nil
+	return record{ID: id, UID: uid, Fields: fields}, nil
 }
 
 func collectBinds(node map[string]interface{}, path string, binds map[string]bindTarget) {
@@ -2276,15 +8770,24 @@ func collectBinds(node map[string]interface{}, path string, binds map[string]bin
 		if ok {
 			field, _ := bindMap["field"].(string)
 			bindPath, _ := bindMap["path"].(string)
+			attribute, _ := bindMap["attribute"].(string)
 			field = strings.TrimSpace(field)
 			bindPath = strings.TrimSpace(bindPath)
+			attribute = strings.TrimSpace(attribute)
+			if bindPath == "" && attribute != "" {
+				bindPath = defaultAttributePath
+			}
 			if field != "" && bindPath != "" {
 				if _, exists := binds[field]; !exists {
 					fullPath := bindPath
 					if path != "" {
 						fullPath = path + "." + bindPath
 					}
-					binds[field] = bindTarget{Path: fullPath}
+					target := bindTarget{Path: fullPath, Attribute: attribute}
+					if isBoundaryPlugin(node) {
+						target.Owner = path
+					}
+					binds[field] = target
 				}
 			}
 		}
@@ -2390,85 +8893,371 @@ func deepCopy(value interface{}) interface{} {
 	}
 }
 
-func setAtPath(root map[string]interface{}, path string, value interface{}) bool {
-	parts := strings.Split(path, ".")
+// Paths address template nodes as dot-separated segments: map keys, or
+// indexes into slices. Blank segments and the space around a segment are
+// ignored. Templates mix map[string]interface{} with map[interface{}]interface{}
+// from nested config; a key of the latter matches a segment by its
+// fmt.Sprint form, the same key normalizeInterfaceMap gives it when binds
+// are collected.
+
+// pathSegments splits path into its trimmed, non-empty segments.
+func pathSegments(path string) []string {
+	var parts []string
+	for _, part := range strings.Split(path, ".") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// splitPath splits path into its parent path and last segment.
+func splitPath(path string) (string, string) {
+	parts := pathSegments(path)
+	if len(parts) == 0 {
+		return "", ""
+	}
+	return strings.Join(parts[:len(parts)-1], "."), parts[len(parts)-1]
+}
+
+// joinPath appends part to a dotted path.
+func joinPath(path string, part string) string {
+	if path == "" {
+		return part
+	}
+	return path + "." + part
+}
+
+// interfaceMapKey returns the key of node that segment part addresses.
+func interfaceMapKey(node map[interface{}]interface{}, part string) (interface{}, bool) {
+	if _, ok := node[part]; ok {
+		return part, true
+	}
+	for key := range node {
+		if fmt.Sprint(key) == part {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// childAt returns the child of node that segment part addresses.
+func childAt(node interface{}, part string) (interface{}, bool) {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, ok := n[part]
+		return child, ok
+	case map[interface{}]interface{}:
+		key, ok := interfaceMapKey(n, part)
+		if !ok {
+			return nil, false
+		}
+		return n[key], true
+	case []interface{}:
+		idx, err := strconv.Atoi(part)
+		if err != nil || idx < 0 || idx >= len(n) {
+			return nil, false
+		}
+		return n[idx], true
+	}
+	return nil, false
+}
+
+// setChild stores value as the child of node that segment part addresses.
+// Maps gain the key (reusing a matching map[interface{}]interface{} key);
+// slices are never grown, so an index out of range fails.
+func setChild(node interface{}, part string, value interface{}) bool {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		n[part] = value
+		return true
+	case map[interface{}]interface{}:
+		key, ok := interfaceMapKey(n, part)
+		if !ok {
+			key = part
+		}
+		n[key] = value
+		return true
+	case []interface{}:
+		idx, err := strconv.Atoi(part)
+		if err != nil || idx < 0 || idx >= len(n) {
+			return false
+		}
+		n[idx] = value
+		return true
+	}
+	return false
+}
+
+// getAtPath returns the value at path; an empty path is root itself.
+func getAtPath(root map[string]interface{}, path string) (interface{}, bool) {
 	var current interface{} = root
-	for i, part := range parts {
-		part = strings.TrimSpace(part)
-		if part == "" {
-			continue
+	for _, part := range pathSegments(path) {
+		next, ok := childAt(current, part)
+		if !ok {
+			return nil, false
 		}
-		isLast := i == len(parts)-1
-		switch node := current.(type) {
-		case map[string]interface{}:
-			if isLast {
-				node[part] = value
-				return true
-			}
-			next, ok := node[part]
-			if !ok {
-				return false
-			}
-			current = next
-		case map[interface{}]interface{}:
-			if isLast {
-				node[part] = value
-				return true
+		current = next
+	}
+	return current, true
+}
+
+// getNodeAtPath returns the map at path, or nil when there is none. A
+// map[interface{}]interface{} there is replaced by its normalized form, so
+// writes to the returned map land in root.
+func getNodeAtPath(root map[string]interface{}, path string) map[string]interface{} {
+	parentPath, last := splitPath(path)
+	if last == "" {
+		return root
+	}
+	parent, ok := getAtPath(root, parentPath)
+	if !ok {
+		return nil
+	}
+	node, _ := childAt(parent, last)
+	switch typed := node.(type) {
+	case map[string]interface{}:
+		return typed
+	case map[interface{}]interface{}:
+		normalized := normalizeInterfaceMap(typed)
+		setChild(parent, last, normalized)
+		return normalized
+	}
+	return nil
+}
+
+// findInlineNode returns the nearest node with an @type at or above path,
+// falling back to the map at path itself.
+func findInlineNode(root map[string]interface{}, path string) map[string]interface{} {
+	current := strings.Join(pathSegments(path), ".")
+	for {
+		node := getNodeAtPath(root, current)
+		if node != nil {
+			if nodeType, ok := node["@type"].(string); ok && strings.TrimSpace(nodeType) != "" {
+				return node
 			}
-			next, ok := node[part]
-			if !ok {
+		}
+		if current == "" {
+			break
+		}
+		current, _ = splitPath(current)
+	}
+	return getNodeAtPath(root, path)
+}
+
+// setAtPath replaces the value at path. The parent must exist; a wildcard
+// path maps a JSON array across a slice (setAtWildcardPath).
+func setAtPath(root map[string]interface{}, path string, value interface{}) bool {
+	if hasWildcard(path) {
+		return setAtWildcardPath(root, path, getStringFromAny(value))
+	}
+	parentPath, last := splitPath(path)
+	if last == "" {
+		return false
+	}
+	parent, ok := getAtPath(root, parentPath)
+	if !ok {
+		return false
+	}
+	return setChild(parent, last, value)
+}
+
+// ensureMapPath creates missing maps along path. Existing slices are walked
+// but never grown, and a non-map value in the way is not replaced, so it
+// returns false instead of clobbering template data.
+func ensureMapPath(root map[string]interface{}, path string) bool {
+	var current interface{} = root
+	for _, part := range pathSegments(path) {
+		next, ok := childAt(current, part)
+		if !ok {
+			if _, isSlice := current.([]interface{}); isSlice {
 				return false
 			}
-			current = next
-		case []interface{}:
-			idx, err := strconv.Atoi(part)
-			if err != nil || idx < 0 || idx >= len(node) {
+			next = map[string]interface{}{}
+			if !setChild(current, part, next) {
 				return false
 			}
-			if isLast {
-				node[idx] = value
-				return true
-			}
-			current = node[idx]
-		default:
+		}
+		current = next
+	}
+	switch current.(type) {
+	case map[string]interface{}, map[interface{}]interface{}:
+		return true
+	}
+	return false
+}
+
+// setAttributeAtPath sets key inside the attribute map at path, creating the
+// map when the node does not have one yet.
+func setAttributeAtPath(root map[string]interface{}, path string, key string, value interface{}) bool {
+	existing, ok := getAtPath(root, path)
+	if ok {
+		switch attrs := existing.(type) {
+		case map[string]interface{}:
+			attrs[key] = value
+			return true
+		case map[interface{}]interface{}:
+			attrs[key] = value
+			return true
+		}
+	}
+
+	parentPath, name := splitPath(path)
+	parent := getNodeAtPath(root, parentPath)
+	if parent == nil || name == "" {
+		return false
+	}
+	parent[name] = map[string]interface{}{key: value}
+	return true
+}
+
+// applyBindValue writes a record value to its bind target.
+func applyBindValue(root map[string]interface{}, target bindTarget, value interface{}) bool {
+	if target.Blocked {
+		return false
+	}
+	if target.CreateMissing && !hasWildcard(target.Path) {
+		parentPath, _ := splitPath(target.Path)
+		if !ensureMapPath(root, parentPath) {
 			return false
 		}
 	}
+	if target.Attribute != "" {
+		return setAttributeAtPath(root, target.Path, target.Attribute, value)
+	}
+	return setAtPath(root, target.Path, value)
+}
+
+const wildcardSegment = "*"
+
+func hasWildcard(path string) bool {
+	for _, part := range strings.Split(path, ".") {
+		if strings.TrimSpace(part) == wildcardSegment {
+			return true
+		}
+	}
 	return false
 }
 
-func getAtPath(root map[string]interface{}, path string) (interface{}, bool) {
+// splitWildcardPath splits "gallery.*.src" into "gallery" and "src".
+func splitWildcardPath(path string) (string, string) {
 	parts := strings.Split(path, ".")
-	var current interface{} = root
-	for _, part := range parts {
-		part = strings.TrimSpace(part)
-		if part == "" {
+	for i, part := range parts {
+		if strings.TrimSpace(part) == wildcardSegment {
+			return strings.Join(parts[:i], "."), strings.Join(parts[i+1:], ".")
+		}
+	}
+	return path, ""
+}
+
+// setAtWildcardPath maps a multi-value field across a slice node. The value is
+// a JSON array (a plain string counts as one item). The slice is resized to
+// the number of items: surplus elements are dropped and missing ones are
+// cloned from the last existing element. An empty slice cannot be expanded.
+func setAtWildcardPath(root map[string]interface{}, path string, value string) bool {
+	prefix, rest := splitWildcardPath(path)
+	raw, ok := getAtPath(root, prefix)
+	if !ok {
+		return false
+	}
+	nodes, ok := raw.([]interface{})
+	if !ok {
+		return false
+	}
+
+	items := parseMultiValue(value)
+	resized := make([]interface{}, 0, len(items))
+	for i := range items {
+		switch {
+		case i < len(nodes):
+			resized = append(resized, nodes[i])
+		case len(nodes) > 0:
+			resized = append(resized, deepCopy(nodes[len(nodes)-1]))
+		}
+	}
+
+	for i := range resized {
+		if strings.TrimSpace(rest) == "" {
+			resized[i] = items[i]
 			continue
 		}
-		switch node := current.(type) {
+		switch elem := resized[i].(type) {
 		case map[string]interface{}:
-			next, ok := node[part]
-			if !ok {
-				return nil, false
-			}
-			current = next
+			_ = setAtPath(elem, rest, items[i])
 		case map[interface{}]interface{}:
-			next, ok := node[part]
-			if !ok {
-				return nil, false
-			}
-			current = next
-		case []interface{}:
-			idx, err := strconv.Atoi(part)
-			if err != nil || idx < 0 || idx >= len(node) {
-				return nil, false
+			normalized := normalizeInterfaceMap(elem)
+			_ = setAtPath(normalized, rest, items[i])
+			resized[i] = normalized
+		}
+	}
+
+	if prefix == "" {
+		return false
+	}
+	return setAtPath(root, prefix, resized)
+}
+
+// getWildcardValues collects the values a wildcard path points at.
+func getWildcardValues(root map[string]interface{}, path string) ([]string, bool) {
+	prefix, rest := splitWildcardPath(path)
+	raw, ok := getAtPath(root, prefix)
+	if !ok {
+		return nil, false
+	}
+	nodes, ok := raw.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	values := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		if strings.TrimSpace(rest) == "" {
+			values = append(values, getStringFromAny(node))
+			continue
+		}
+		elem, ok := normalizeToStringMap(node)
+		if !ok {
+			values = append(values, "")
+			continue
+		}
+		if v, ok := getAtPath(elem, rest); ok {
+			values = append(values, getStringFromAny(v))
+		} else {
+			values = append(values, "")
+		}
+	}
+	return values, true
+}
+
+// parseMultiValue decodes a JSON array field value. Non-string items are
+// re-encoded as JSON; anything that is not an array is a single item.
+func parseMultiValue(value string) []string {
+	trimmed := strings.TrimSpace(value)
+	if strings.HasPrefix(trimmed, "[") {
+		var items []interface{}
+		if err := json.Unmarshal([]byte(trimmed), &items); err == nil {
+			out := make([]string, 0, len(items))
+			for _, item := range items {
+				switch v := item.(type) {
+				case string:
+					out = append(out, v)
+				case nil:
+					out = append(out, "")
+				default:
+					encoded, err := json.Marshal(v)
+					if err != nil {
+						out = append(out, fmt.Sprintf("%v", v))
+						continue
+					}
+					out = append(out, string(encoded))
+				}
 			}
-			current = node[idx]
-		default:
-			return nil, false
+			return out
 		}
 	}
-	return current, true
+	if trimmed == "" {
+		return []string{}
+	}
+	return []string{value}
 }
 
 func addEditLink(instance map[string]interface{}, route string, recordParam string, id int64) {
@@ -0,0 +1,3934 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperbricks/hyperbricks/pkg/shared"
+)
+
+// openTestDB opens a fresh store. A zero busy timeout makes sqlite report
+// "database is locked" immediately instead of waiting internally.
+func openTestDB(t *testing.T) string {
+	t.Helper()
+	store := filepath.Join(t.TempDir(), "records.db") + "?_busy_timeout=0"
+	if _, err := getDB(store); err != nil {
+		t.Fatalf("getDB: %v", err)
+	}
+	return store
+}
+
+func TestConcurrentWritesRetryOnLock(t *testing.T) {
+	store := openTestDB(t)
+	db, err := getDB(store)
+	if err != nil {
+		t.Fatalf("getDB: %v", err)
+	}
+
+	opts := writeOptions{Actor: "test", MaxRetries: 20, RetryDelay: time.Millisecond}
+	const writers = 2
+	const perWriter = 25
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers*perWriter)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				values := map[string]string{"title": fmt.Sprintf("writer %d record %d", w, i)}
+				if _, err := createRecord(db, "article", values, opts); err != nil {
+					errs <- err
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("createRecord failed under contention: %v", err)
+	}
+
+	count, err := countRecords(db, "article")
+	if err != nil {
+		t.Fatalf("countRecords: %v", err)
+	}
+	if count != writers*perWriter {
+		t.Errorf("count = %d, want %d", count, writers*perWriter)
+	}
+}
+
+func TestWithRetryReturnsNonLockErrorsImmediately(t *testing.T) {
+	calls := 0
+	err := withRetry(writeOptions{MaxRetries: 5, RetryDelay: time.Millisecond}, func() error {
+		calls++
+		return fmt.Errorf("boom")
+	})
+	if err == nil {
+		t.Fatal("withRetry returned nil, want error")
+	}
+	if calls != 1 {
+		t.Errorf("fn called %d times, want 1", calls)
+	}
+}
+
+func TestRetrySettingsAreBounded(t *testing.T) {
+	retries := 1000
+	opts := resolveWriteOptions(Fields{MaxRetries: &retries, RetryDelay: "1m"}, nil, nil)
+	if opts.MaxRetries != maxRetries || opts.RetryDelay != maxRetryDelay {
+		t.Errorf("max_retries %d, retry_delay %v; want %d, %v", opts.MaxRetries, opts.RetryDelay, maxRetries, maxRetryDelay)
+	}
+
+	delay := defaultRetryDelay
+	for i := 0; i < maxRetries; i++ {
+		delay = nextRetryDelay(delay)
+	}
+	if delay != maxRetryDelay {
+		t.Errorf("delay after %d retries = %v, want it capped at %v", maxRetries, delay, maxRetryDelay)
+	}
+}
+
+func TestSetAtWildcardPath(t *testing.T) {
+	newTemplate := func() map[string]interface{} {
+		return map[string]interface{}{
+			"gallery": []interface{}{
+				map[string]interface{}{"@type": "<IMAGE>", "src": "a.png"},
+				map[string]interface{}{"@type": "<IMAGE>", "src": "b.png"},
+			},
+		}
+	}
+	srcs := func(root map[string]interface{}) []string {
+		values, _ := getWildcardValues(root, "gallery.*.src")
+		return values
+	}
+
+	cases := []struct {
+		name  string
+		value string
+		want  []string
+	}{
+		{"same count", `["x.png", "y.png"]`, []string{"x.png", "y.png"}},
+		{"more values clone the last node", `["x.png", "y.png", "z.png"]`, []string{"x.png", "y.png", "z.png"}},
+		{"fewer values drop surplus nodes", `["x.png"]`, []string{"x.png"}},
+		{"plain string is one item", `x.png`, []string{"x.png"}},
+		{"empty array clears the slice", `[]`, []string{}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			root := newTemplate()
+			if !setAtPath(root, "gallery.*.src", tc.value) {
+				t.Fatalf("setAtPath returned false")
+			}
+			got := srcs(root)
+			if len(got) != len(tc.want) {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Errorf("src[%d] = %q, want %q", i, got[i], tc.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDefaultValuesFromTemplateEncodesWildcardBinds(t *testing.T) {
+	template := map[string]interface{}{
+		"gallery": []interface{}{
+			map[string]interface{}{"src": "a.png"},
+			map[string]interface{}{"src": "b.png"},
+		},
+	}
+	binds := map[string]bindTarget{"images": {Path: "gallery.*.src"}}
+	values := defaultValuesFromTemplate(template, binds)
+	if values["images"] != `["a.png","b.png"]` {
+		t.Errorf("images = %s", values["images"])
+	}
+}
+
+func TestAttributeBindCreatesAttributeMap(t *testing.T) {
+	template := map[string]interface{}{
+		"10": map[string]interface{}{
+			"@type": "<TEXT>",
+			"value": "Read more",
+			"@bind": map[string]interface{}{
+				"field":     "link",
+				"attribute": "href",
+			},
+		},
+	}
+	binds := map[string]bindTarget{}
+	collectBinds(template, "", binds)
+
+	target, ok := binds["link"]
+	if !ok {
+		t.Fatalf("link bind not collected")
+	}
+	if target.Path != "10.attributes" || target.Attribute != "href" {
+		t.Fatalf("target = %+v, want path 10.attributes attribute href", target)
+	}
+
+	if !applyBindValue(template, target, "/articles/1") {
+		t.Fatalf("applyBindValue returned false")
+	}
+	node := template["10"].(map[string]interface{})
+	attrs, ok := node["attributes"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("attributes map not created: %#v", node["attributes"])
+	}
+	if attrs["href"] != "/articles/1" {
+		t.Errorf("href = %v", attrs["href"])
+	}
+	if node["value"] != "Read more" {
+		t.Errorf("primary value was overwritten: %v", node["value"])
+	}
+}
+
+func TestRemoveUploadedFileStaysInsideUploadDir(t *testing.T) {
+	root := t.TempDir()
+	uploadDir := filepath.Join(root, "uploads")
+	if err := os.MkdirAll(uploadDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	inside := filepath.Join(uploadDir, "photo.png")
+	outside := filepath.Join(root, "keep.png")
+	for _, path := range []string{inside, outside} {
+		if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := removeUploadedFile(inside, uploadDir); err != nil {
+		t.Fatalf("remove inside: %v", err)
+	}
+	if _, err := os.Stat(inside); !os.IsNotExist(err) {
+		t.Errorf("file inside upload_dir was not removed")
+	}
+
+	for _, path := range []string{outside, filepath.Join(uploadDir, "..", "keep.png")} {
+		if err := removeUploadedFile(path, uploadDir); err != nil {
+			t.Fatalf("remove outside: %v", err)
+		}
+	}
+	if _, err := os.Stat(outside); err != nil {
+		t.Errorf("file outside upload_dir was removed: %v", err)
+	}
+
+	if err := removeUploadedFile(filepath.Join(uploadDir, "missing.png"), uploadDir); err != nil {
+		t.Errorf("missing file returned error: %v", err)
+	}
+}
+
+func TestEnsureSeedCreatesVariedBatchOnce(t *testing.T) {
+	store := openTestDB(t)
+	db, err := getDB(store)
+	if err != nil {
+		t.Fatalf("getDB: %v", err)
+	}
+
+	template := map[string]interface{}{
+		"title": map[string]interface{}{"@type": "<TEXT>", "value": "Hello", "@bind": map[string]interface{}{"field": "title", "path": "value"}},
+		"image": map[string]interface{}{"@type": "<IMAGE>", "src": "placeholder.png", "@bind": map[string]interface{}{"field": "image", "path": "src"}},
+	}
+	binds := map[string]bindTarget{}
+	collectBinds(template, "", binds)
+	fields := Fields{
+		SeedCount: 3,
+		Schema: map[string]FieldDef{
+			"title": {Type: "text"},
+			"image": {Type: "image"},
+		},
+	}
+	plan := seedVariations(fields, binds)
+	opts := writeOptions{Actor: seedActor}
+
+	seeded, err := ensureSeed(db, template, binds, plan, "article", opts)
+	if err != nil || !seeded {
+		t.Fatalf("ensureSeed = %v, %v", seeded, err)
+	}
+	seeded, err = ensureSeed(db, template, binds, plan, "article", opts)
+	if err != nil || seeded {
+		t.Fatalf("second ensureSeed = %v, %v; want no-op", seeded, err)
+	}
+
+	records, err := fetchRecords(db, "", "article")
+	if err != nil {
+		t.Fatalf("fetchRecords: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("seeded %d records, want 3", len(records))
+	}
+	titles := map[string]bool{}
+	for _, rec := range records {
+		titles[rec.Fields["title"]] = true
+		if rec.Fields["image"] != "placeholder.png" {
+			t.Errorf("image = %q, want template default", rec.Fields["image"])
+		}
+	}
+	for _, want := range []string{"Hello 1", "Hello 2", "Hello 3"} {
+		if !titles[want] {
+			t.Errorf("missing seeded title %q in %v", want, titles)
+		}
+	}
+}
+
+func TestUpdateRecordMergeKeepsUnsubmittedFields(t *testing.T) {
+	store := openTestDB(t)
+	db, err := getDB(store)
+	if err != nil {
+		t.Fatalf("getDB: %v", err)
+	}
+
+	for _, merge := range []bool{false, true} {
+		opts := writeOptions{Actor: "test", MergeUpdate: merge}
+		id, err := createRecord(db, "article", map[string]string{"title": "Old", "body": "Keep me"}, opts)
+		if err != nil {
+			t.Fatalf("createRecord: %v", err)
+		}
+		if _, err := updateRecord(db, id, "article", map[string]string{"title": "New"}, opts); err != nil {
+			t.Fatalf("updateRecord: %v", err)
+		}
+		values, err := fetchRecordFields(db, id)
+		if err != nil {
+			t.Fatalf("fetchRecordFields: %v", err)
+		}
+		if values["title"] != "New" {
+			t.Errorf("merge=%v: title = %q, want New", merge, values["title"])
+		}
+		_, kept := values["body"]
+		if kept != merge {
+			t.Errorf("merge=%v: body kept = %v", merge, kept)
+		}
+	}
+}
+
+func TestRateLimiterTokenBucket(t *testing.T) {
+	limit, ok := parseRateLimit("2/1s")
+	if !ok || limit.Burst != 2 || limit.Interval != time.Second {
+		t.Fatalf("parseRateLimit = %+v, %v", limit, ok)
+	}
+
+	limiter := &rateLimiter{buckets: map[string]*tokenBucket{}}
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		if allowed, _ := limiter.allow("a", limit, now); !allowed {
+			t.Fatalf("request %d rejected within burst", i)
+		}
+	}
+	allowed, wait := limiter.allow("a", limit, now)
+	if allowed {
+		t.Fatal("request beyond burst allowed")
+	}
+	if wait <= 0 || wait > 500*time.Millisecond {
+		t.Errorf("wait = %v, want (0, 500ms]", wait)
+	}
+	if allowed, _ := limiter.allow("b", limit, now); !allowed {
+		t.Error("other client shares the bucket")
+	}
+	if allowed, _ := limiter.allow("a", limit, now.Add(500*time.Millisecond)); !allowed {
+		t.Error("token not refilled after wait")
+	}
+}
+
+func TestRateLimitIgnoresActorHeader(t *testing.T) {
+	fields := Fields{Store: filepath.Join(t.TempDir(), "limit.db"), RateLimit: "2/1m", ActorHeader: "X-Actor"}
+	post := func(header, actor string) int {
+		req := httptest.NewRequest(http.MethodPost, "/cms", strings.NewReader(`{"cr_inline":"1","record_id":"1","bind":"title","value":"x"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Actor", header)
+		rec := httptest.NewRecorder()
+		ctx := context.WithValue(context.Background(), shared.Request, req)
+		ctx = context.WithValue(ctx, shared.ResponseWriter, http.ResponseWriter(rec))
+		if actor != "" {
+			ctx = WithActor(ctx, actor)
+		}
+		var errs []error
+		handleInlineUpdate(ctx, nil, "article", nil, fields, nil, &errs)
+		return rec.Code
+	}
+
+	for i, header := range []string{"alice", "bob"} {
+		if code := post(header, ""); code == http.StatusTooManyRequests {
+			t.Fatalf("request %d limited within burst", i)
+		}
+	}
+	if code := post("carol", ""); code != http.StatusTooManyRequests {
+		t.Errorf("a new actor header bypassed the limit: status %d", code)
+	}
+	if code := post("carol", "jane"); code == http.StatusTooManyRequests {
+		t.Error("the host-set actor shares the remote address bucket")
+	}
+}
+
+func TestActorRecordedOnWrites(t *testing.T) {
+	fields := Fields{Store: filepath.Join(t.TempDir(), "actor.db"), ActorHeader: "X-Remote-User"}
+	db, err := openStore(fields)
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	actors := func(id int64) (string, string) {
+		var createdBy, updatedBy string
+		if err := db.QueryRow(`SELECT created_by, updated_by FROM records WHERE id = ?`, id).Scan(&createdBy, &updatedBy); err != nil {
+			t.Fatal(err)
+		}
+		return createdBy, updatedBy
+	}
+
+	id, err := createRecord(db, "article", map[string]string{"title": "A"}, resolveWriteOptions(fields, nil, WithActor(context.Background(), "jane")))
+	if err != nil {
+		t.Fatalf("createRecord: %v", err)
+	}
+	if created, updated := actors(id); created != "jane" || updated != "jane" {
+		t.Errorf("after create: created_by %q, updated_by %q; want jane", created, updated)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/cms", nil)
+	req.Header.Set("X-Remote-User", "joe")
+	ctx := context.WithValue(context.Background(), shared.Request, req)
+	if _, err := updateRecord(db, id, "article", map[string]string{"title": "B"}, resolveWriteOptions(fields, nil, ctx)); err != nil {
+		t.Fatalf("updateRecord: %v", err)
+	}
+	if created, updated := actors(id); created != "jane" || updated != "joe" {
+		t.Errorf("after update: created_by %q, updated_by %q; want jane, joe", created, updated)
+	}
+
+	// A plain string key is not the plugin's key.
+	ctx = context.WithValue(context.Background(), "content_records_actor", "mallory")
+	if _, err := updateRecord(db, id, "article", map[string]string{"title": "C"}, resolveWriteOptions(fields, nil, ctx)); err != nil {
+		t.Fatalf("updateRecord: %v", err)
+	}
+	if _, updated := actors(id); updated != anonymousActor {
+		t.Errorf("updated_by = %q, want %q", updated, anonymousActor)
+	}
+}
+
+func TestBindDebugRequiresDebugFlag(t *testing.T) {
+	fields := Fields{
+		Store: filepath.Join(t.TempDir(), "debug.db"),
+		Template: map[string]interface{}{
+			"@name": "article",
+			"10":    map[string]interface{}{"@type": "<TEXT>", "@bind": map[string]interface{}{"field": "title", "path": "value"}},
+		},
+	}
+	db, err := openStore(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := createRecord(db, "article", map[string]string{"title": "secret draft"}, writeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	run := func(fields Fields) (string, *httptest.ResponseRecorder) {
+		rec := httptest.NewRecorder()
+		ctx := context.WithValue(context.Background(), shared.Request, httptest.NewRequest(http.MethodGet, "/debug", nil))
+		ctx = context.WithValue(ctx, shared.ResponseWriter, http.ResponseWriter(rec))
+		var errs []error
+		return fmt.Sprint(renderBindDebug(fields, ctx, &errs)), rec
+	}
+
+	out, rec := run(fields)
+	if !strings.HasPrefix(out, "<!--") || !strings.Contains(out, "data.debug") || rec.Header().Get("Content-Type") != "" {
+		t.Errorf("without data.debug: %q, headers %v", out, rec.Header())
+	}
+
+	fields.Debug = true
+	out, rec = run(fields)
+	var payload map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &payload); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("with data.debug: status %d, %q: %v", rec.Code, out, err)
+	}
+	binds, _ := payload["binds"].(map[string]interface{})
+	if payload["type"] != "article" || binds["title"] == nil {
+		t.Errorf("debug payload = %v", payload)
+	}
+	if strings.Contains(out, "secret draft") {
+		t.Error("debug output exposes record data")
+	}
+}
+
+func TestApplyComputedFields(t *testing.T) {
+	binds := map[string]bindTarget{
+		"first":     {Path: "10.value"},
+		"last":      {Path: "20.value"},
+		"full_name": {Path: "30.value"},
+	}
+	fields := Fields{Schema: map[string]FieldDef{
+		"full_name": {Type: "computed", Expr: "{{first}} {{ last }}{{missing}}"},
+	}}
+	records := []record{{ID: 1, Fields: map[string]string{"first": "Ada", "last": "Lovelace", "full_name": "stale"}}}
+	applyComputedFields(fields, binds, records)
+	if got := records[0].Fields["full_name"]; got != "Ada Lovelace" {
+		t.Errorf("full_name = %q, want %q", got, "Ada Lovelace")
+	}
+}
+
+func TestResolveDialect(t *testing.T) {
+	cases := map[string]*storeDialect{
+		"":        sqliteDialect,
+		"sqlite":  sqliteDialect,
+		"SQLite3": sqliteDialect,
+		"mysql":   mysqlDialect,
+		"mariadb": mysqlDialect,
+	}
+	for driver, want := range cases {
+		got, err := resolveDialect(driver)
+		if err != nil || got != want {
+			t.Errorf("resolveDialect(%q) = %v, %v", driver, got, err)
+		}
+	}
+	if _, err := resolveDialect("oracle"); err == nil {
+		t.Error("resolveDialect(oracle) returned no error")
+	}
+}
+
+func TestStoreLabelMasksCredentials(t *testing.T) {
+	got := storeLabel(Fields{Store: "cms:secret@tcp(127.0.0.1:3306)/cms"})
+	if got != "***@tcp(127.0.0.1:3306)/cms" {
+		t.Errorf("storeLabel = %q", got)
+	}
+	if got := storeLabel(Fields{Store: "/data/articles.db"}); got != "/data/articles.db" {
+		t.Errorf("storeLabel = %q", got)
+	}
+}
+
+func TestCreateRecordWithNaturalKey(t *testing.T) {
+	store := openTestDB(t)
+	db, err := getDB(store)
+	if err != nil {
+		t.Fatalf("getDB: %v", err)
+	}
+	opts := writeOptions{Actor: "import", NaturalKey: "external_id"}
+
+	first, err := createRecord(db, "product", map[string]string{"external_id": "A-1", "title": "One"}, opts)
+	if err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	second, err := createRecord(db, "product", map[string]string{"external_id": "A-1", "title": "Uno"}, opts)
+	if err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	if second != first {
+		t.Errorf("upsert returned id %d, want existing %d", second, first)
+	}
+	if count, _ := countRecords(db, "product"); count != 1 {
+		t.Errorf("count = %d, want 1", count)
+	}
+	values, err := fetchRecordFields(db, first)
+	if err != nil || values["title"] != "Uno" {
+		t.Errorf("fields = %v, %v; want title Uno", values, err)
+	}
+
+	// The same key in another type is a different record.
+	other, err := createRecord(db, "category", map[string]string{"external_id": "A-1"}, opts)
+	if err != nil || other == first {
+		t.Errorf("other type: id %d, err %v", other, err)
+	}
+
+	if _, err := createRecord(db, "product", map[string]string{"title": "No key"}, opts); err == nil {
+		t.Error("missing natural key accepted")
+	}
+
+	plain := writeOptions{Actor: "import"}
+	if _, err := createRecord(db, "product", map[string]string{"external_id": "A-1"}, plain); err != nil {
+		t.Fatalf("plain insert: %v", err)
+	}
+	if _, err := createRecord(db, "product", map[string]string{"external_id": "A-1"}, opts); err == nil {
+		t.Error("duplicate natural key accepted")
+	}
+}
+
+func TestRawBindRendersHTMLNode(t *testing.T) {
+	fields := Fields{
+		Template: map[string]interface{}{
+			"10": map[string]interface{}{
+				"@type": "<TEXT>",
+				"value": "Title",
+				"@bind": map[string]interface{}{"field": "title", "path": "value"},
+			},
+			"20": map[string]interface{}{
+				"@type": "<TEXT>",
+				"value": "Body",
+				"@bind": map[string]interface{}{"field": "body", "path": "value"},
+			},
+		},
+		Schema: map[string]FieldDef{
+			"title": {Type: "text", Path: "10.value"},
+			"body":  {Type: "markdown", Path: "20.value"},
+		},
+	}
+	var errs []error
+	template, binds, ok := loadTemplate(fields, &errs)
+	if !ok {
+		t.Fatalf("loadTemplate failed: %v", errs)
+	}
+	records := []record{{ID: 1, Fields: map[string]string{"title": "a < b", "body": "<strong>bold</strong>"}}}
+	list := buildList(template, binds, records, nil, false, "", "", nil, resolveTreeKeys(Fields{}), nil)
+
+	instance := list["10"].(map[string]interface{})
+	body := instance["20"].(map[string]interface{})
+	if body["@type"] != "<HTML>" || body["value"] != "<strong>bold</strong>" {
+		t.Errorf("body node = %v, want <HTML> with unescaped value", body)
+	}
+	title := instance["10"].(map[string]interface{})
+	if title["@type"] != "<TEXT>" {
+		t.Errorf("title node type = %v, want <TEXT>", title["@type"])
+	}
+}
+
+func TestApplyInlineWrapperCustomTemplate(t *testing.T) {
+	inline := &inlineOptions{
+		Enabled:      true,
+		Wrapper:      `<em data-edit="{{bind}}" data-v="{{value}}">|</em>`,
+		BlockWrapper: `<section data-edit="{{bind}}" data-id="{{id}}">|</section>`,
+	}
+
+	block := map[string]interface{}{"@type": "<TEXT>"}
+	applyInlineWrapper(block, inline, "title", 7, "text", "x")
+	if got := block["enclose"]; got != `<section data-edit="title" data-id="7">|</section>` {
+		t.Errorf("block enclose = %v", got)
+	}
+
+	node := map[string]interface{}{"@type": "<TEXT>", "enclose": `<h1>|</h1>`}
+	applyInlineWrapper(node, inline, "title", 7, "text", `"quoted" <b>`)
+	want := `<h1><em data-edit="title" data-v="&#34;quoted&#34; &lt;b&gt;">|</em></h1>`
+	if got := node["enclose"]; got != want {
+		t.Errorf("enclose = %v, want %v", got, want)
+	}
+	applyInlineWrapper(node, inline, "subtitle", 7, "text", "y")
+	if got := node["enclose"]; got != want {
+		t.Errorf("second bind wrapped again: %v", got)
+	}
+}
+
+func TestApplyBindValueCreatesMissingPaths(t *testing.T) {
+	newRoot := func() map[string]interface{} {
+		return map[string]interface{}{
+			"10":    map[string]interface{}{"@type": "<TEXT>"},
+			"items": []interface{}{map[string]interface{}{}},
+			"label": "plain",
+		}
+	}
+
+	root := newRoot()
+	if applyBindValue(root, bindTarget{Path: "10.meta.title"}, "x") {
+		t.Error("missing path written without create_missing_paths")
+	}
+
+	create := func(path string) bindTarget { return bindTarget{Path: path, CreateMissing: true} }
+	root = newRoot()
+	if !applyBindValue(root, create("10.meta.title"), "x") {
+		t.Fatal("create_missing_paths did not create 10.meta")
+	}
+	if got, _ := getAtPath(root, "10.meta.title"); got != "x" {
+		t.Errorf("10.meta.title = %v", got)
+	}
+	if !applyBindValue(root, create("items.0.meta.title"), "y") {
+		t.Error("existing slice element not walked")
+	}
+	if applyBindValue(root, create("items.1.title"), "z") {
+		t.Error("slice grown for missing index")
+	}
+	if applyBindValue(root, create("label.title"), "z") {
+		t.Error("scalar replaced by a map")
+	}
+	if root["label"] != "plain" {
+		t.Errorf("label = %v", root["label"])
+	}
+}
+
+func TestRestoreVersionRoundTrip(t *testing.T) {
+	store := openTestDB(t)
+	db, err := getDB(store)
+	if err != nil {
+		t.Fatalf("getDB: %v", err)
+	}
+	opts := writeOptions{Actor: "editor", MaxVersions: 2}
+
+	original := map[string]string{"title": "First", "body": "Original body"}
+	id, err := createRecord(db, "article", original, opts)
+	if err != nil {
+		t.Fatalf("createRecord: %v", err)
+	}
+	if _, err := updateRecord(db, id, "article", map[string]string{"title": "Second"}, opts); err != nil {
+		t.Fatalf("updateRecord: %v", err)
+	}
+
+	versions, err := fetchRecordVersions(db, id)
+	if err != nil || len(versions) != 1 || versions[0].Version != 1 {
+		t.Fatalf("versions = %+v, %v", versions, err)
+	}
+	if err := restoreRecordVersion(db, id, "article", 1, opts); err != nil {
+		t.Fatalf("restoreRecordVersion: %v", err)
+	}
+	values, err := fetchRecordFields(db, id)
+	if err != nil {
+		t.Fatalf("fetchRecordFields: %v", err)
+	}
+	for key, want := range original {
+		if values[key] != want {
+			t.Errorf("%s = %q, want %q", key, values[key], want)
+		}
+	}
+
+	// The restore snapshotted the edited state; the cap drops older versions.
+	if _, err := updateRecord(db, id, "article", map[string]string{"title": "Third"}, opts); err != nil {
+		t.Fatalf("updateRecord: %v", err)
+	}
+	versions, _ = fetchRecordVersions(db, id)
+	if len(versions) != 2 || versions[0].Version != 3 || versions[1].Version != 2 {
+		t.Fatalf("versions after cap = %+v", versions)
+	}
+	if versions[1].Fields["title"] != "Second" {
+		t.Errorf("version 2 title = %q, want Second", versions[1].Fields["title"])
+	}
+
+	if err := restoreRecordVersion(db, id, "article", 1, opts); err == nil {
+		t.Error("restoring a pruned version succeeded")
+	}
+}
+
+func TestApplyCORS(t *testing.T) {
+	fields := Fields{CORSOrigins: []interface{}{"https://admin.example.com/"}}
+	newCtx := func(method, origin string) (context.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(method, "/articles", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		rec := httptest.NewRecorder()
+		ctx := context.WithValue(context.Background(), shared.Request, req)
+		ctx = context.WithValue(ctx, shared.ResponseWriter, http.ResponseWriter(rec))
+		return ctx, rec
+	}
+
+	ctx, rec := newCtx(http.MethodOptions, "https://admin.example.com")
+	if !applyCORS(ctx, fields) {
+		t.Fatal("preflight not short-circuited")
+	}
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("status = %d, want 204", rec.Code)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://admin.example.com" {
+		t.Errorf("Allow-Origin = %q", got)
+	}
+
+	ctx, rec = newCtx(http.MethodPost, "https://evil.example.com")
+	if applyCORS(ctx, fields) || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("CORS headers set for an unlisted origin")
+	}
+
+	ctx, rec = newCtx(http.MethodPost, "https://admin.example.com")
+	if applyCORS(ctx, Fields{}) || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("CORS headers set without cors_origins")
+	}
+}
+
+func TestValidateSchemaReportsMismatches(t *testing.T) {
+	binds := map[string]bindTarget{
+		"title": {Path: "10.value"},
+		"image": {Path: "20.src"},
+		"extra": {Path: "30.value"},
+	}
+	fields := Fields{Schema: map[string]FieldDef{
+		"title":   {Type: "text", Path: "10.value"},
+		"image":   {Type: "image", Bind: "image"},
+		"summary": {Type: "text", Path: "40.value"},
+		"full":    {Type: "computed", Bind: "extra"},
+	}}
+	report := validateSchema(fields, binds)
+	if report.valid() {
+		t.Fatal("report is valid")
+	}
+	if len(report.UnmatchedSchema) != 1 || report.UnmatchedSchema[0].Name != "summary" || report.UnmatchedSchema[0].Path != "40.value" {
+		t.Errorf("unmatched = %+v", report.UnmatchedSchema)
+	}
+	if len(report.BindsWithoutSchema) != 0 {
+		t.Errorf("binds without schema = %v", report.BindsWithoutSchema)
+	}
+	if len(report.UploadsWithoutDir) != 1 || report.UploadsWithoutDir[0].Name != "image" {
+		t.Errorf("uploads without dir = %+v", report.UploadsWithoutDir)
+	}
+	if len(report.ComputedWithoutExpr) != 1 || report.ComputedWithoutExpr[0].Name != "full" {
+		t.Errorf("computed without expr = %+v", report.ComputedWithoutExpr)
+	}
+
+	fields.UploadDir = "uploads"
+	delete(fields.Schema, "full")
+	delete(fields.Schema, "summary")
+	report = validateSchema(fields, binds)
+	if len(report.BindsWithoutSchema) != 1 || report.BindsWithoutSchema[0] != "extra" {
+		t.Errorf("binds without schema = %v", report.BindsWithoutSchema)
+	}
+}
+
+func TestResolveSingleRecordIDFromPath(t *testing.T) {
+	index := func(i int) *int { return &i }
+	cases := []struct {
+		name  string
+		url   string
+		index *int
+		want  int64
+	}{
+		{"first segment", "/42/articles", index(0), 42},
+		{"last segment", "/articles/42", index(-1), 42},
+		{"trailing slash", "/articles/42/", index(1), 42},
+		{"non numeric falls back to query", "/articles/latest?id=7", index(-1), 7},
+		{"out of range falls back to query", "/articles?id=7", index(3), 7},
+		{"unset ignores path", "/articles/42?id=7", nil, 7},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.url, nil)
+			ctx := context.WithValue(context.Background(), shared.Request, req)
+			if got := resolveSingleRecordID(Fields{PathParamIndex: tc.index}, ctx); got != tc.want {
+				t.Errorf("id = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestIDStrategyResolvesByUID(t *testing.T) {
+	store := openTestDB(t)
+	db, err := getDB(store)
+	if err != nil {
+		t.Fatalf("getDB: %v", err)
+	}
+
+	legacyID, err := createRecord(db, "article", map[string]string{"title": "Legacy"}, writeOptions{})
+	if err != nil {
+		t.Fatalf("createRecord: %v", err)
+	}
+	uuidID, err := createRecord(db, "article", map[string]string{"title": "UUID"}, writeOptions{IDStrategy: "uuid"})
+	if err != nil {
+		t.Fatalf("createRecord uuid: %v", err)
+	}
+	ulidID, err := createRecord(db, "article", map[string]string{"title": "ULID"}, writeOptions{IDStrategy: "ulid"})
+	if err != nil {
+		t.Fatalf("createRecord ulid: %v", err)
+	}
+
+	legacy, _ := fetchRecordByID(db, legacyID, "article")
+	if legacy.UID != "" {
+		t.Errorf("autoincrement record uid = %q, want empty", legacy.UID)
+	}
+	withUUID, _ := fetchRecordByID(db, uuidID, "article")
+	if !uuidPattern.MatchString(withUUID.UID) {
+		t.Fatalf("uuid record uid = %q", withUUID.UID)
+	}
+	withULID, _ := fetchRecordByID(db, ulidID, "article")
+	if !ulidPattern.MatchString(withULID.UID) {
+		t.Fatalf("ulid record uid = %q", withULID.UID)
+	}
+
+	ctxFor := func(url string) context.Context {
+		return context.WithValue(context.Background(), shared.Request, httptest.NewRequest(http.MethodGet, url, nil))
+	}
+	cases := []struct {
+		name string
+		url  string
+		want int64
+	}{
+		{"uuid", "/articles?id=" + withUUID.UID, uuidID},
+		{"uuid upper case", "/articles?id=" + strings.ToUpper(withUUID.UID), uuidID},
+		{"ulid lower case", "/articles?id=" + strings.ToLower(withULID.UID), ulidID},
+		{"integer id", fmt.Sprintf("/articles?id=%d", legacyID), legacyID},
+		{"integer id of uuid record", fmt.Sprintf("/articles?id=%d", uuidID), uuidID},
+		{"unknown uuid", "/articles?id=00000000-0000-4000-8000-000000000000", 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := resolveSingleRecord(db, Fields{}, ctxFor(tc.url)); got != tc.want {
+				t.Errorf("resolveSingleRecord = %d, want %d", got, tc.want)
+			}
+		})
+	}
+
+	if _, err := resolveIDStrategy("snowflake"); err == nil {
+		t.Error("unsupported id_strategy accepted")
+	}
+}
+
+func TestNewULIDSortsByTime(t *testing.T) {
+	earlier, _ := newULID(time.UnixMilli(1_700_000_000_000))
+	later, _ := newULID(time.UnixMilli(1_700_000_000_001))
+	if !(earlier < later) {
+		t.Errorf("ulids out of order: %s >= %s", earlier, later)
+	}
+	if earlier[:10] != "01HF7YAT00" {
+		t.Errorf("timestamp prefix = %s", earlier[:10])
+	}
+}
+
+// cancelOnFlush cancels the request context on its first flush, as a client
+// disconnecting mid-export would.
+type cancelOnFlush struct {
+	*httptest.ResponseRecorder
+	cancel  context.CancelFunc
+	flushes int
+}
+
+func (w *cancelOnFlush) Flush() {
+	w.flushes++
+	w.cancel()
+}
+
+func TestExportStreamsInBatches(t *testing.T) {
+	fields := Fields{
+		Store:  filepath.Join(t.TempDir(), "export.db"),
+		Action: "export",
+		Template: map[string]interface{}{
+			"@name": "article",
+			"10":    map[string]interface{}{"@bind": map[string]interface{}{"field": "title", "path": "value"}},
+			"20":    map[string]interface{}{"@bind": map[string]interface{}{"field": "body", "path": "value"}},
+		},
+	}
+	db, err := openStore(fields)
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	for i := 1; i <= 5; i++ {
+		values := map[string]string{"title": fmt.Sprintf("Post %d", i), "body": "a, \"quoted\" body"}
+		if _, err := createRecord(db, "article", values, writeOptions{}); err != nil {
+			t.Fatalf("createRecord: %v", err)
+		}
+	}
+	defer func(size int) { exportBatchSize = size }(exportBatchSize)
+	exportBatchSize = 2
+
+	export := func(fields Fields, w http.ResponseWriter, req *http.Request) {
+		ctx := context.WithValue(context.Background(), shared.Request, req)
+		ctx = context.WithValue(ctx, shared.ResponseWriter, w)
+		var errs []error
+		if out := renderExport(fields, ctx, &errs); out != "" || len(errs) > 0 {
+			t.Fatalf("renderExport = %v, errors %v", out, errs)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	export(fields, rec, httptest.NewRequest(http.MethodGet, "/export", nil))
+	var items []struct {
+		ID     int64             `json:"id"`
+		Fields map[string]string `json:"fields"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &items); err != nil {
+		t.Fatalf("json export: %v\n%s", err, rec.Body.String())
+	}
+	if len(items) != 5 || items[4].Fields["title"] != "Post 5" {
+		t.Errorf("json export = %+v", items)
+	}
+
+	fields.ExportFormat = "csv"
+	fields.Filterable = []string{"title"}
+	rec = httptest.NewRecorder()
+	export(fields, rec, httptest.NewRequest(http.MethodGet, "/export?title=Post+2", nil))
+	rows, err := csv.NewReader(strings.NewReader(rec.Body.String())).ReadAll()
+	if err != nil {
+		t.Fatalf("csv export: %v", err)
+	}
+	if len(rows) != 2 || strings.Join(rows[0], ",") != "id,created_at,updated_at,body,title" ||
+		rows[1][0] != "2" || rows[1][1] == "" || rows[1][3] != `a, "quoted" body` || rows[1][4] != "Post 2" {
+		t.Errorf("csv export = %q", rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Disposition"); got != `attachment; filename="article.csv"` {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+
+	fields.Filterable = nil
+	reqCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w := &cancelOnFlush{ResponseRecorder: httptest.NewRecorder(), cancel: cancel}
+	export(fields, w, httptest.NewRequest(http.MethodGet, "/export", nil).WithContext(reqCtx))
+	if lines := strings.Count(w.Body.String(), "\n"); w.flushes != 1 || lines != 3 {
+		t.Errorf("cancelled export wrote %d lines in %d flushes, want header plus one batch", lines, w.flushes)
+	}
+}
+
+func TestWantsCreateForm(t *testing.T) {
+	cases := []struct {
+		name   string
+		method string
+		url    string
+		body   string
+		fields Fields
+		want   bool
+	}{
+		{"new button", http.MethodGet, "/edit?new=1", "", Fields{}, true},
+		{"no param", http.MethodGet, "/edit", "", Fields{}, false},
+		{"truthy value", http.MethodGet, "/edit?new=true", "", Fields{}, true},
+		{"custom param", http.MethodGet, "/edit?mode=create", "", Fields{NewParam: "mode", NewValue: "create"}, true},
+		{"custom param wrong value", http.MethodGet, "/edit?mode=edit", "", Fields{NewParam: "mode", NewValue: "create"}, false},
+		{"explicit id wins", http.MethodGet, "/edit?new=1&id=7", "", Fields{}, false},
+		{"create post", http.MethodPost, "/edit?new=1", "action=create&title=x", Fields{}, true},
+		{"save after create", http.MethodPost, "/edit?new=1", "action=update&record_id=7", Fields{}, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.body))
+			if tc.body != "" {
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			ctx := context.WithValue(context.Background(), shared.Request, req)
+			var errs []error
+			if got := wantsCreateForm(tc.fields, ctx, &errs); got != tc.want {
+				t.Errorf("wantsCreateForm = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+// fakeDecodeError mimics *mapstructure.Error.
+func TestNewFormCreatesOnlyOnSubmit(t *testing.T) {
+	fields := Fields{
+		Store: filepath.Join(t.TempDir(), "new.db"),
+		Template: map[string]interface{}{
+			"@name": "article",
+			"10":    map[string]interface{}{"@type": "<TEXT>", "value": "Untitled", "@bind": map[string]interface{}{"field": "title", "path": "value"}},
+		},
+	}
+	render := func(method, body string) map[string]interface{} {
+		req := httptest.NewRequest(method, "/articles/new", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		ctx := context.WithValue(context.Background(), shared.Request, req)
+		var errs []error
+		out, _ := renderSingleNew(fields, ctx, &errs).(map[string]interface{})
+		if len(errs) > 0 || out == nil {
+			t.Fatalf("%s: output %v, errors %v", method, out, errs)
+		}
+		return out["10"].(map[string]interface{})["values"].(map[string]interface{})
+	}
+	count := func() int {
+		db, err := openStore(fields)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := countRecords(db, "article")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	for i := 0; i < 2; i++ {
+		if values := render(http.MethodGet, ""); values["is_new"] != true {
+			t.Errorf("GET is_new = %v, want true", values["is_new"])
+		}
+	}
+	if n := count(); n != 0 {
+		t.Fatalf("opening the new form created %d records", n)
+	}
+
+	values := render(http.MethodPost, "action=create&title=Hello")
+	if n := count(); n != 1 {
+		t.Fatalf("submit created %d records, want 1", n)
+	}
+	if values["is_new"] != false {
+		t.Errorf("after create is_new = %v, want false", values["is_new"])
+	}
+}
+
+type fakeDecodeError []string
+
+func (e fakeDecodeError) Error() string { return fmt.Sprintf("%d error(s) decoding", len(e)) }
+
+func (e fakeDecodeError) WrappedErrors() []error {
+	out := make([]error, len(e))
+	for i, msg := range e {
+		out[i] = fmt.Errorf("%s", msg)
+	}
+	return out
+}
+
+func TestDescribeDecodeErrorNamesTheField(t *testing.T) {
+	cases := []struct {
+		msg  string
+		want string
+	}{
+		{`'data.ids': source data must be an array or slice, got string`, `data.ids: expected a list, got string`},
+		{`'data.preview' expected type 'bool', got unconvertible type 'int', value: '3'`, `data.preview: expected bool, got integer "3"`},
+		{`'data.schema' expected a map, got 'string'`, `data.schema: expected a map, got string`},
+		{`cannot parse 'data.page_size' as int: strconv.ParseInt: parsing "ten": invalid syntax`, `data.page_size: expected integer (strconv.ParseInt: parsing "ten": invalid syntax)`},
+		{`'data.max_retries' expected type '*int', got '[]interface {}'`, `data.max_retries: expected integer, got list`},
+		{`something else`, `something else`},
+	}
+	for _, tc := range cases {
+		if got := describeDecodeError([]error{fakeDecodeError{tc.msg}}); got != tc.want {
+			t.Errorf("describeDecodeError(%q)\n got %q\nwant %q", tc.msg, got, tc.want)
+		}
+	}
+
+	multi := describeDecodeError([]error{fakeDecodeError{
+		`'data.ids': source data must be an array or slice, got string`,
+		`'data.seed' expected type 'bool', got unconvertible type 'string', value: 'yes please'`,
+	}})
+	if multi != `data.ids: expected a list, got string; data.seed: expected bool, got string "yes please"` {
+		t.Errorf("multi = %q", multi)
+	}
+	if got := describeDecodeError([]error{fmt.Errorf("plain")}); got != "plain" {
+		t.Errorf("plain = %q", got)
+	}
+
+	// The host flattens the mapstructure error into a ComponentError's text.
+	var config ContentRecordsConfig
+	errs := shared.DecodeWithBasicHooks(map[string]interface{}{
+		"data": map[string]interface{}{"preview": "maybe", "max_versions": []interface{}{1, 2}},
+	}, &config)
+	if len(errs) == 0 {
+		t.Fatal("invalid data decoded without errors")
+	}
+	got := describeDecodeError(errs)
+	for _, want := range []string{"data.preview: expected bool", "data.max_versions: expected integer, got list"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("decode errors %q do not mention %q", got, want)
+		}
+	}
+}
+
+func TestTypedColumnsFollowSchemaType(t *testing.T) {
+	// A store created before typed columns gains them on open.
+	path := filepath.Join(t.TempDir(), "legacy.db")
+	legacy, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	if _, err := legacy.Exec(`CREATE TABLE record_fields (record_id INTEGER, bind_key TEXT, value TEXT, PRIMARY KEY(record_id, bind_key))`); err != nil {
+		t.Fatalf("create legacy table: %v", err)
+	}
+	legacy.Close()
+
+	db, err := getDB(path)
+	if err != nil {
+		t.Fatalf("getDB: %v", err)
+	}
+	opts := writeOptions{Actor: "test", FieldTypes: map[string]string{"price": "number", "published": "date", "title": "text"}}
+	id, err := createRecord(db, "product", map[string]string{"price": "12.5", "published": "2024-03-01", "title": "42"}, opts)
+	if err != nil {
+		t.Fatalf("createRecord: %v", err)
+	}
+	if err := updateRecordField(db, id, "product", "price", "not a number", opts); err != nil {
+		t.Fatalf("updateRecordField: %v", err)
+	}
+	other, err := createRecord(db, "product", map[string]string{"price": "9", "published": "2024-01-15T10:30:00Z"}, opts)
+	if err != nil {
+		t.Fatalf("createRecord: %v", err)
+	}
+
+	typed := func(id int64, bind string) (sql.NullFloat64, sql.NullString) {
+		var (
+			num  sql.NullFloat64
+			date sql.NullString
+		)
+		if err := db.QueryRow(`SELECT num_value, date_value FROM record_fields WHERE record_id = ? AND bind_key = ?`, id, bind).Scan(&num, &date); err != nil {
+			t.Fatalf("select %s: %v", bind, err)
+		}
+		return num, date
+	}
+	if num, _ := typed(id, "price"); num.Valid {
+		t.Errorf("unparseable price num_value = %v, want NULL", num.Float64)
+	}
+	if num, _ := typed(other, "price"); !num.Valid || num.Float64 != 9 {
+		t.Errorf("price num_value = %+v, want 9", num)
+	}
+	if num, _ := typed(id, "title"); num.Valid {
+		t.Errorf("text field num_value = %v, want NULL", num.Float64)
+	}
+	if _, date := typed(id, "published"); !date.Valid {
+		t.Error("published date_value is NULL")
+	}
+
+	ids, err := fetchRecordIDs(db, `SELECT record_id FROM record_fields WHERE bind_key = 'published' ORDER BY date_value`, "product")
+	if err != nil {
+		t.Fatalf("fetchRecordIDs: %v", err)
+	}
+	if len(ids) != 2 || ids[0] != other || ids[1] != id {
+		t.Errorf("ids ordered by date_value = %v, want [%d %d]", ids, other, id)
+	}
+}
+
+func TestListFiltersCombineWithAnd(t *testing.T) {
+	store := openTestDB(t)
+	db, err := getDB(store)
+	if err != nil {
+		t.Fatalf("getDB: %v", err)
+	}
+	fields := Fields{
+		Filterable: []string{"category", "status", "price", "title"},
+		Schema:     map[string]FieldDef{"price": {Type: "number", Bind: "price"}},
+	}
+	binds := map[string]bindTarget{"category": {}, "status": {}, "price": {}, "title": {}, "secret": {}}
+	opts := writeOptions{Actor: "test", FieldTypes: buildBindTypeMap(fields, binds)}
+	batch := []map[string]string{
+		{"category": "news", "status": "published", "price": "9", "title": "100% off"},
+		{"category": "news", "status": "draft", "price": "20", "title": "Draft news"},
+		{"category": "blog", "status": "published", "price": "30", "title": "Blog post"},
+		{"category": "news", "status": "published", "price": "40", "title": "Big news", "secret": "x"},
+	}
+	ids, err := createRecords(db, "article", batch, opts)
+	if err != nil {
+		t.Fatalf("createRecords: %v", err)
+	}
+
+	cases := []struct {
+		query string
+		want  []int64
+	}{
+		{"category=news&status=published", []int64{ids[0], ids[3]}},
+		{"category=news&price__gt=10", []int64{ids[1], ids[3]}},
+		{"price__lt=30&price__gt=10", []int64{ids[1]}},
+		{"title__like=100%25", []int64{ids[0]}},
+		{"secret=x", ids},
+		{"category=news&status=archived", nil},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/articles?"+tc.query, nil)
+		ctx := context.WithValue(context.Background(), shared.Request, req)
+		records, err := fetchRecordsForList(db, fields, "article", resolveFilters(fields, binds, ctx))
+		if err != nil {
+			t.Fatalf("%s: fetchRecordsForList: %v", tc.query, err)
+		}
+		var got []int64
+		for _, rec := range records {
+			got = append(got, rec.ID)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("%s: ids = %v, want %v", tc.query, got, tc.want)
+		}
+	}
+}
+
+func TestBuildListTreeKeys(t *testing.T) {
+	template := map[string]interface{}{"@type": "<TEXT>"}
+	records := []record{{ID: 1}, {ID: 2}, {ID: 3}}
+
+	start := 1000
+	cases := []struct {
+		fields Fields
+		want   []string
+	}{
+		{Fields{}, []string{"10", "20", "30"}},
+		{Fields{KeyStart: &start, KeyStep: 5}, []string{"1000", "1005", "1010"}},
+		{Fields{KeyStep: -1}, []string{"10", "20", "30"}},
+	}
+	for _, tc := range cases {
+		list := buildList(template, nil, records, nil, false, "", "", nil, resolveTreeKeys(tc.fields), nil)
+		if len(list) != len(tc.want)+1 {
+			t.Errorf("%+v: %d entries, want %d", tc.fields, len(list)-1, len(tc.want))
+		}
+		for _, key := range tc.want {
+			if _, ok := list[key]; !ok {
+				t.Errorf("%+v: missing key %s in %v", tc.fields, key, list)
+			}
+		}
+	}
+}
+
+func TestNestedListScopedToParentRecord(t *testing.T) {
+	comments := map[string]interface{}{
+		"@type":  "<PLUGIN>",
+		"plugin": "ContentRecords",
+		"data": map[interface{}]interface{}{
+			"parent_bind": "article_id",
+			"empty_html":  "<p>No comments on {{parent_type}} {{parent_id}}</p>",
+		},
+	}
+	template := map[string]interface{}{
+		"@name": "article",
+		"@type": "<TREE>",
+		"10":    map[string]interface{}{"@type": "<TEXT>", "@bind": map[string]interface{}{"field": "title"}},
+		"20":    comments,
+	}
+	binds := map[string]bindTarget{}
+	collectBinds(template, "", binds)
+
+	list := buildList(template, binds, []record{{ID: 7, Fields: map[string]string{"title": "Hello"}}}, nil, false, "", "", nil, resolveTreeKeys(Fields{}), nil)
+	item, _ := list["10"].(map[string]interface{})
+	nested, _ := item["20"].(map[string]interface{})
+	data, _ := nested["data"].(map[string]interface{})
+	if data["parent_id"] != "7" || data["parent_type"] != "article" {
+		t.Fatalf("nested data = %v", data)
+	}
+	if data["empty_html"] != "<p>No comments on article 7</p>" {
+		t.Errorf("empty_html = %v", data["empty_html"])
+	}
+	if _, ok := comments["data"].(map[interface{}]interface{})["parent_id"]; ok {
+		t.Error("template was modified")
+	}
+
+	store := openTestDB(t)
+	db, err := getDB(store)
+	if err != nil {
+		t.Fatalf("getDB: %v", err)
+	}
+	opts := writeOptions{Actor: "test"}
+	ids, err := createRecords(db, "comment", []map[string]string{
+		{"article_id": "7", "body": "First"},
+		{"article_id": "8", "body": "Other article"},
+		{"article_id": "7", "body": "Second"},
+	}, opts)
+	if err != nil {
+		t.Fatalf("createRecords: %v", err)
+	}
+	child := Fields{ParentBind: data["parent_bind"].(string), ParentID: data["parent_id"]}
+	records, err := fetchRecordsForList(db, child, "comment", resolveFilters(child, nil, nil))
+	if err != nil {
+		t.Fatalf("fetchRecordsForList: %v", err)
+	}
+	if len(records) != 2 || records[0].ID != ids[0] || records[1].ID != ids[2] {
+		t.Errorf("records = %+v", records)
+	}
+}
+
+func TestTemplateNamedReference(t *testing.T) {
+	article := map[string]interface{}{
+		"@name": "article",
+		"10":    map[interface{}]interface{}{"@type": "<TEXT>", "@bind": map[interface{}]interface{}{"field": "title", "path": "value"}},
+	}
+	legacy := map[string]interface{}{
+		"@name": "legacy",
+		"10":    map[string]interface{}{"@type": "<TEXT>", "@bind": map[string]interface{}{"field": "body", "path": "value"}},
+	}
+	store := filepath.Join(t.TempDir(), "templates.db")
+	t.Cleanup(resetStores)
+
+	var errs []error
+	template, binds, ok := loadTemplate(Fields{Template: article}, &errs)
+	if !ok || template["@name"] != "article" || binds["title"].Path != "10.value" {
+		t.Fatalf("inline template: %v %v %v", template, binds, errs)
+	}
+
+	ref, err := bindNamedTemplate(Fields{Store: store, Template: "shared_article"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := loadTemplate(ref, &errs); ok || len(errs) != 1 || !strings.Contains(errs[0].Error(), "is not registered") {
+		t.Fatalf("unpublished reference: ok=%v errs=%v", ok, errs)
+	}
+	errs = nil
+
+	if _, err := bindNamedTemplate(Fields{Store: store, Template: article, TemplateName: "shared_article"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// After a restart the reference resolves from the store before the
+	// publishing instance renders again.
+	resetStores()
+	ref, err = bindNamedTemplate(Fields{Store: store, Template: " shared_article "}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template, binds, ok = loadTemplate(ref, &errs)
+	if !ok || template["@name"] != "article" || binds["title"].Path != "10.value" {
+		t.Fatalf("named reference: %v %v %v", template, binds, errs)
+	}
+	if got := resolveTypeName(resolveTemplateValue(ref)); got != "article" {
+		t.Errorf("type of referenced template = %q, want article", got)
+	}
+
+	// Names are per store: another site's store does not see it.
+	other, err := bindNamedTemplate(Fields{Store: filepath.Join(t.TempDir(), "other.db"), Template: "shared_article"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, isRef := other.Template.(string); !isRef {
+		t.Errorf("reference resolved from another store: %v", other.Template)
+	}
+
+	// A reference never publishes itself, and an unknown one uses data.type.
+	if _, err := bindNamedTemplate(Fields{Store: store, Template: "shared_article", TemplateName: "alias"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	db, err := openStore(Fields{Store: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found, err := lookupNamedTemplate(db, "alias"); found || err != nil {
+		t.Errorf("a reference was published as a template: found=%v err=%v", found, err)
+	}
+	missing, err := bindNamedTemplate(Fields{Store: store, Template: "missing", Type: legacy}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template, _, ok = loadTemplate(missing, &errs)
+	if !ok || template["@name"] != "legacy" {
+		t.Errorf("fallback to data.type: %v %v", template, errs)
+	}
+}
+
+func TestBindIntoNestedPluginIsRefused(t *testing.T) {
+	comments := map[string]interface{}{
+		"@type":  "<PLUGIN>",
+		"plugin": "ContentRecords",
+		"@bind":  map[string]interface{}{"field": "heading", "path": "data.heading"},
+		"data": map[interface{}]interface{}{
+			"empty_html": "<p>No comments</p>",
+		},
+	}
+	template := map[string]interface{}{
+		"@name": "article",
+		"@type": "<TREE>",
+		"10":    map[string]interface{}{"@type": "<TEXT>", "@bind": map[string]interface{}{"field": "title", "path": "value"}},
+		"20": map[string]interface{}{
+			"@type": "<TREE>",
+			"@bind": map[string]interface{}{"field": "summary", "path": "10.data.empty_html"},
+			"10":    comments,
+		},
+	}
+	binds := templateBinds(Fields{}, template)
+	if !binds["summary"].Blocked {
+		t.Fatalf("bind into the nested plugin not refused: %+v", binds["summary"])
+	}
+	if binds["heading"].Blocked || binds["title"].Blocked {
+		t.Fatalf("binds wrongly refused: %+v", binds)
+	}
+
+	rec := record{ID: 7, Fields: map[string]string{"title": "Hello", "summary": "<b>overwritten</b>", "heading": "Comments"}}
+	list := buildList(template, binds, []record{rec}, nil, false, "", "", nil, resolveTreeKeys(Fields{}), nil)
+	item, _ := list["10"].(map[string]interface{})
+	if title, _ := item["10"].(map[string]interface{}); title["value"] != "Hello" {
+		t.Errorf("title = %v", item["10"])
+	}
+	wrapper, _ := item["20"].(map[string]interface{})
+	nested, _ := wrapper["10"].(map[string]interface{})
+	data, _ := normalizeToStringMap(nested["data"])
+	if data["empty_html"] != "<p>No comments</p>" {
+		t.Errorf("nested empty_html = %v, want the plugin's own value", data["empty_html"])
+	}
+	if data["heading"] != "Comments" {
+		t.Errorf("bind declared on the plugin node = %v, want Comments", data["heading"])
+	}
+}
+
+func TestBulkSetUpdatesListedRecords(t *testing.T) {
+	store := openTestDB(t)
+	db, err := getDB(store)
+	if err != nil {
+		t.Fatalf("getDB: %v", err)
+	}
+	opts := writeOptions{Actor: "editor"}
+	ids, err := createRecords(db, "article", []map[string]string{
+		{"category": "news", "tag": "old"},
+		{"category": "blog", "tag": "old"},
+		{"category": "news", "tag": "old"},
+	}, opts)
+	if err != nil {
+		t.Fatalf("createRecords: %v", err)
+	}
+	fields := Fields{Filterable: []string{"category"}}
+	fieldDefs := []cmsField{{Name: "tag", Bind: "tag", Type: "text"}, {Name: "category", Bind: "category", Type: "text"}}
+	binds := map[string]bindTarget{"tag": {}, "category": {}}
+
+	bulkSet := func(target, value string) map[string]interface{} {
+		t.Helper()
+		var errs []error
+		req := httptest.NewRequest(http.MethodPost, target, nil)
+		req.Form = req.URL.Query()
+		req.Form.Set("bulk_bind", "tag")
+		req.Form.Set("bulk_value", value)
+		ctx := context.WithValue(context.Background(), shared.Request, req)
+		result := applyBulkSet(ctx, db, fields, "article", fieldDefs, resolveFilters(fields, binds, ctx), opts, &errs)
+		if len(errs) > 0 {
+			t.Fatalf("applyBulkSet: %v", errs)
+		}
+		return result
+	}
+	tags := func() []string {
+		var out []string
+		for _, id := range ids {
+			values, _ := fetchRecordFields(db, id)
+			out = append(out, values["tag"])
+		}
+		return out
+	}
+
+	if result := bulkSet("/cms?category=news", "featured"); result["updated"] != 2 {
+		t.Errorf("filtered updated = %v, want 2", result["updated"])
+	}
+	if got := fmt.Sprint(tags()); got != "[featured old featured]" {
+		t.Errorf("tags after filtered bulk_set = %s", got)
+	}
+	if result := bulkSet("/cms", "archived"); result["updated"] != 3 {
+		t.Errorf("unfiltered updated = %v, want 3", result["updated"])
+	}
+	if got := fmt.Sprint(tags()); got != "[archived archived archived]" {
+		t.Errorf("tags after bulk_set = %s", got)
+	}
+
+	// A failure part-way leaves every record untouched.
+	if err := bulkSetField(db, []int64{ids[0], 999, ids[2]}, "tag", "broken", opts); err == nil {
+		t.Fatal("bulkSetField with a missing record succeeded")
+	}
+	if got := fmt.Sprint(tags()); got != "[archived archived archived]" {
+		t.Errorf("tags after failed bulk_set = %s", got)
+	}
+}
+
+func TestCheckUploadDirRequiresDirForImageFields(t *testing.T) {
+	binds := map[string]bindTarget{"title": {Path: "10.value"}, "hero": {Path: "20.src"}}
+	schema := map[string]FieldDef{
+		"title": {Type: "text", Bind: "title"},
+		"hero":  {Type: "image", Bind: "hero"},
+	}
+
+	err := checkUploadDir(Fields{Action: "edit", Schema: schema}, binds)
+	if err == nil || !strings.Contains(err.Error(), "hero (image)") || !strings.Contains(err.Error(), "upload_dir") {
+		t.Errorf("edit without upload_dir: err = %v", err)
+	}
+	if err := checkUploadDir(Fields{Action: "edit", Schema: schema, UploadDir: "/tmp/uploads"}, binds); err != nil {
+		t.Errorf("edit with upload_dir: err = %v", err)
+	}
+	if err := checkUploadDir(Fields{Action: "render", Schema: schema}, binds); err != nil {
+		t.Errorf("render view: err = %v", err)
+	}
+	textOnly := map[string]FieldDef{"title": {Type: "text", Bind: "title"}}
+	if err := checkUploadDir(Fields{Action: "new", Schema: textOnly}, binds); err != nil {
+		t.Errorf("schema without image fields: err = %v", err)
+	}
+}
+
+func TestPragmasAppliedOnceAndValidated(t *testing.T) {
+	store := filepath.Join(t.TempDir(), "pragmas.db")
+	fields := Fields{Store: store, Pragmas: map[string]string{"journal_mode": "WAL", "synchronous": "normal"}}
+	db, err := openStore(fields)
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	var mode string
+	if err := db.QueryRow(`PRAGMA journal_mode`).Scan(&mode); err != nil {
+		t.Fatal(err)
+	}
+	if mode != "wal" {
+		t.Errorf("journal_mode = %q, want wal", mode)
+	}
+
+	for _, pragmas := range []map[string]string{
+		{"writable_schema": "1"},
+		{"journal_mode": "off"},
+		{"cache_size": "1; DROP TABLE records"},
+	} {
+		if _, err := openStore(Fields{Store: store, Pragmas: pragmas}); err == nil {
+			t.Errorf("pragmas %v accepted", pragmas)
+		}
+	}
+	if _, err := openStore(Fields{Store: "user@tcp(localhost)/cms", Driver: "mysql", Pragmas: map[string]string{"cache_size": "100"}}); err == nil || !strings.Contains(err.Error(), "sqlite") {
+		t.Errorf("mysql pragmas: err = %v", err)
+	}
+}
+
+func TestQuoteIdentRejectsMaliciousNames(t *testing.T) {
+	for _, name := range []string{
+		`title"; DROP TABLE records; --`,
+		"title` = 1 OR `1",
+		"price) VALUES (1); --",
+		"a b",
+		"a.b",
+		"1price",
+		"",
+	} {
+		if quoted, err := sqliteDialect.quoteIdent(name); err == nil {
+			t.Errorf("quoteIdent(%q) = %s, want error", name, quoted)
+		}
+	}
+	if got, _ := sqliteDialect.quoteIdent("order"); got != `"order"` {
+		t.Errorf("sqlite quote = %s", got)
+	}
+	if got, _ := mysqlDialect.quoteIdent("order"); got != "`order`" {
+		t.Errorf("mysql quote = %s", got)
+	}
+
+	fields := Fields{
+		Storage: "columns",
+		Template: map[string]interface{}{
+			"@name": "product",
+			"10":    map[string]interface{}{"@bind": map[string]interface{}{"field": "title", "path": "value"}},
+		},
+		Schema: map[string]FieldDef{`x"; DROP TABLE records; --`: {Type: "text"}},
+	}
+	if _, err := resolveColumnLayout(fields); err == nil {
+		t.Error("malicious schema bind accepted as a column")
+	}
+	fields.Schema = nil
+	fields.Template.(map[string]interface{})["@name"] = "product; DROP TABLE records"
+	if _, err := resolveColumnLayout(fields); err == nil {
+		t.Error("malicious template name accepted as a table")
+	}
+}
+
+func TestColumnStorage(t *testing.T) {
+	fields := Fields{
+		Store:   filepath.Join(t.TempDir(), "columns.db"),
+		Storage: "columns",
+		Template: map[string]interface{}{
+			"@name": "product",
+			"10":    map[string]interface{}{"@bind": map[string]interface{}{"field": "title", "path": "value"}},
+			"20":    map[string]interface{}{"@bind": map[string]interface{}{"field": "price", "path": "value"}},
+		},
+		Schema:     map[string]FieldDef{"price": {Type: "number", Bind: "price"}, "sku": {Type: "text"}},
+		Filterable: []string{"price"},
+	}
+	db, err := openStore(fields)
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	binds := map[string]bindTarget{"title": {}, "price": {}, "sku": {}}
+	opts := resolveWriteOptions(fields, binds, nil)
+	if opts.Columns == nil || fmt.Sprint(opts.Columns.Binds) != "[price sku title]" {
+		t.Fatalf("layout = %+v", opts.Columns)
+	}
+
+	lamp, err := createRecord(db, "product", map[string]string{"title": "Lamp", "price": "12.5", "sku": "L1"}, opts)
+	if err != nil {
+		t.Fatalf("createRecord: %v", err)
+	}
+	chair, err := createRecord(db, "product", map[string]string{"title": "Chair", "price": "40"}, opts)
+	if err != nil {
+		t.Fatalf("createRecord: %v", err)
+	}
+
+	var price float64
+	if err := db.QueryRow(`SELECT price FROM records_product WHERE record_id = ?`, lamp).Scan(&price); err != nil || price != 12.5 {
+		t.Errorf("price column = %v, %v", price, err)
+	}
+	var eav int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM record_fields`).Scan(&eav); err != nil || eav != 0 {
+		t.Errorf("record_fields rows = %d, %v", eav, err)
+	}
+	if _, err := createRecord(db, "product", map[string]string{"title": "Bad", "price": "cheap"}, opts); err == nil {
+		t.Error("non-numeric price accepted")
+	}
+	if _, err := createRecord(db, "product", map[string]string{"color": "red"}, opts); err == nil {
+		t.Error("bind without a column accepted")
+	}
+
+	records, err := fetchRecordsForList(db, fields, "product", nil)
+	if err != nil {
+		t.Fatalf("fetchRecordsForList: %v", err)
+	}
+	if len(records) != 2 || records[0].Fields["title"] != "Lamp" || records[0].Fields["price"] != "12.5" || records[1].Fields["price"] != "40" {
+		t.Errorf("records = %+v", records)
+	}
+	if _, ok := records[1].Fields["sku"]; ok {
+		t.Errorf("unset sku present: %+v", records[1].Fields)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/products?price__gt=20", nil)
+	ctx := context.WithValue(context.Background(), shared.Request, req)
+	filtered, err := fetchRecordsForList(db, fields, "product", resolveFilters(fields, binds, ctx))
+	if err != nil || len(filtered) != 1 || filtered[0].ID != chair {
+		t.Errorf("price__gt=20: %+v, %v", filtered, err)
+	}
+
+	opts.MergeUpdate = true
+	if _, err := updateRecord(db, lamp, "product", map[string]string{"price": "15"}, opts); err != nil {
+		t.Fatalf("updateRecord: %v", err)
+	}
+	got, err := fetchRecordFields(db, lamp)
+	if err != nil || got["title"] != "Lamp" || got["price"] != "15" || got["sku"] != "L1" {
+		t.Errorf("after merge update: %v, %v", got, err)
+	}
+
+	if err := deleteRecord(db, lamp, "product", opts); err != nil {
+		t.Fatalf("deleteRecord: %v", err)
+	}
+	var rows int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM records_product`).Scan(&rows); err != nil || rows != 1 {
+		t.Errorf("rows after delete = %d, %v", rows, err)
+	}
+
+	// A bind that is not a safe identifier cannot become a column.
+	bad := fields
+	bad.Schema = map[string]FieldDef{"x": {Bind: "price; DROP TABLE records"}}
+	if _, err := openStore(bad); err == nil {
+		t.Error("unsafe bind accepted as a column")
+	}
+}
+
+func TestRequestMemoReusesStoreHandle(t *testing.T) {
+	dir := t.TempDir()
+	fields := Fields{Store: filepath.Join(dir, "memo.db")}
+	reqCtx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(reqCtx)
+	ctx := context.WithValue(context.Background(), shared.Request, req)
+
+	memo := memoFor(ctx)
+	if memo == nil || memoFor(ctx) != memo {
+		t.Fatal("renders of one request do not share a memo")
+	}
+	first, err := openStoreWith(fields, memo)
+	if err != nil {
+		t.Fatalf("openStoreWith: %v", err)
+	}
+	if again, err := openStoreWith(fields, memoFor(ctx)); err != nil || again != first || len(memo.stores) != 1 {
+		t.Errorf("second open: %p (%v), want %p from the memo", again, err, first)
+	}
+
+	// Open errors are memoized too.
+	blocker := filepath.Join(dir, "file")
+	if err := os.WriteFile(blocker, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	broken := Fields{Store: filepath.Join(blocker, "nested", "x.db")}
+	if _, err := openStoreWith(broken, memo); err == nil {
+		t.Fatal("store below a file opened")
+	}
+	if _, err := openStoreWith(broken, memo); err == nil {
+		t.Error("memoized open lost its error")
+	}
+
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for {
+		memoMu.Lock()
+		_, alive := memoByRequest[req]
+		memoMu.Unlock()
+		if !alive {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("memo outlived its request")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if memoFor(context.WithValue(context.Background(), shared.Request, httptest.NewRequest(http.MethodGet, "/", nil))) != nil {
+		t.Error("request without a cancellable context got a memo")
+	}
+}
+
+func benchmarkStoreOpens(b *testing.B, useMemo bool) {
+	fields := Fields{Store: filepath.Join(b.TempDir(), "bench.db")}
+	if _, err := openStore(fields); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		reqCtx, cancel := context.WithCancel(context.Background())
+		req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(reqCtx)
+		ctx := context.WithValue(context.Background(), shared.Request, req)
+		// One render touching the store from a list and ten nested lists.
+		for n := 0; n < 11; n++ {
+			var memo *requestMemo
+			if useMemo {
+				memo = memoFor(ctx)
+			}
+			if _, err := openStoreWith(fields, memo); err != nil {
+				b.Fatal(err)
+			}
+		}
+		cancel()
+	}
+}
+
+func BenchmarkStoreOpenPerRender(b *testing.B) { benchmarkStoreOpens(b, false) }
+func BenchmarkStoreOpenMemoized(b *testing.B)  { benchmarkStoreOpens(b, true) }
+
+func TestListOutputArray(t *testing.T) {
+	fields := Fields{
+		Store: filepath.Join(t.TempDir(), "output.db"),
+		Template: map[string]interface{}{
+			"@name": "article",
+			"10":    map[string]interface{}{"@type": "<TEXT>", "@bind": map[string]interface{}{"field": "title", "path": "value"}},
+		},
+		OrderBy: "title desc",
+	}
+	db, err := openStore(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := createRecords(db, "article", []map[string]string{{"title": "B"}, {"title": "C"}, {"title": "A"}}, writeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	// More than nine items, so string key order would differ from tree order.
+	var more []map[string]string
+	for i := 0; i < 9; i++ {
+		more = append(more, map[string]string{"title": fmt.Sprint("0", i)})
+	}
+	if _, err := createRecords(db, "article", more, writeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var errs []error
+	tree, ok := renderListRender(fields, context.Background(), &errs).(map[string]interface{})
+	if !ok || len(errs) > 0 {
+		t.Fatalf("tree output: %T %v", tree, errs)
+	}
+	fields.Output = "array"
+	items, ok := renderListRender(fields, context.Background(), &errs).([]interface{})
+	if !ok || len(errs) > 0 {
+		t.Fatalf("array output: %T %v", items, errs)
+	}
+	if len(items) != 12 || len(tree) != 13 {
+		t.Fatalf("got %d items and %d tree entries, want 12 and 12 + @type", len(items), len(tree))
+	}
+	for i, item := range items {
+		if !reflect.DeepEqual(item, tree[fmt.Sprint(10+i*10)]) {
+			t.Errorf("item %d = %v, want tree key %d", i, item, 10+i*10)
+		}
+	}
+	title := func(item interface{}) interface{} {
+		return item.(map[string]interface{})["10"].(map[string]interface{})["value"]
+	}
+	if title(items[0]) != "C" || title(items[1]) != "B" || title(items[2]) != "A" || title(items[11]) != "00" {
+		t.Errorf("array order: first %v %v %v, last %v", title(items[0]), title(items[1]), title(items[2]), title(items[11]))
+	}
+
+	fields.Output = "slice"
+	if errs := validateConfig(fields); len(errs) == 0 {
+		t.Error("unsupported output accepted")
+	}
+}
+
+func TestLoadMorePaging(t *testing.T) {
+	fields := Fields{
+		Store: filepath.Join(t.TempDir(), "more.db"),
+		Template: map[string]interface{}{
+			"@name": "article",
+			"10":    map[string]interface{}{"@type": "<TEXT>", "@bind": map[string]interface{}{"field": "title", "path": "value"}},
+		},
+		OrderBy:  "title",
+		LoadMore: true,
+		PageSize: 2,
+	}
+	db, err := openStore(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := createRecords(db, "article", []map[string]string{{"title": "A"}, {"title": "B"}, {"title": "C"}, {"title": "D"}, {"title": "E"}}, writeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	title := func(item interface{}) interface{} {
+		return item.(map[string]interface{})["10"].(map[string]interface{})["value"]
+	}
+
+	var errs []error
+	first, ok := renderListRender(fields, context.Background(), &errs).(map[string]interface{})
+	if !ok || len(errs) > 0 {
+		t.Fatalf("first page: %T %v", first, errs)
+	}
+	if title(first["10"]) != "A" || title(first["20"]) != "B" || first["30"] != nil {
+		t.Errorf("first page = %v, want A and B only", first)
+	}
+	more, _ := first["_more"].(map[string]interface{})
+	if markup := fmt.Sprint(more["value"]); !strings.Contains(markup, `data-cr-offset="2" data-cr-limit="2"`) || !strings.Contains(markup, "cr_more") {
+		t.Errorf("load more control = %q", markup)
+	}
+
+	loadMore := func(query string) (bool, any, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodGet, "/articles?cr_more=1&"+query, nil)
+		rec := httptest.NewRecorder()
+		ctx := context.WithValue(context.Background(), shared.Request, req)
+		ctx = context.WithValue(ctx, shared.ResponseWriter, http.ResponseWriter(rec))
+		template, binds, _, _, _ := loadTemplateAndDB(fields, ctx, &errs)
+		handled, out := handleLoadMore(ctx, db, "article", binds, fields, template, &errs)
+		return handled, out, rec
+	}
+
+	// Walk the remaining pages the way the client does.
+	offset, titles := "2", []interface{}{}
+	for page := 0; offset != ""; page++ {
+		if page > 2 {
+			t.Fatal("load more never reported the last page")
+		}
+		handled, out, rec := loadMore("offset=" + offset + "&limit=2")
+		tree, _ := out.(map[string]interface{})
+		if !handled || tree == nil {
+			t.Fatalf("offset %s: handled %v, output %T", offset, handled, out)
+		}
+		for _, key := range []string{"10", "20"} {
+			if item, ok := tree[key]; ok {
+				titles = append(titles, title(item))
+			}
+		}
+		if tree["_more"] != nil {
+			t.Error("a load more fragment carries its own button")
+		}
+		offset = rec.Header().Get("X-CR-Next-Offset")
+		if rec.Header().Get("X-CR-Has-More") != "true" {
+			if offset != "5" || rec.Header().Get("X-CR-Total") != "5" {
+				t.Errorf("last page headers: %v", rec.Header())
+			}
+			offset = ""
+		}
+	}
+	if fmt.Sprint(titles) != "[C D E]" {
+		t.Errorf("walked titles %v, want [C D E]", titles)
+	}
+
+	_, out, _ := loadMore("offset=1&limit=3&format=json")
+	var page struct {
+		Records    []map[string]interface{} `json:"records"`
+		Offset     int                      `json:"offset"`
+		Limit      int                      `json:"limit"`
+		NextOffset int                      `json:"next_offset"`
+		HasMore    bool                     `json:"has_more"`
+	}
+	if err := json.Unmarshal([]byte(fmt.Sprint(out)), &page); err != nil {
+		t.Fatalf("json page %v: %v", out, err)
+	}
+	if len(page.Records) != 3 || page.Offset != 1 || page.Limit != 3 || page.NextOffset != 4 || !page.HasMore {
+		t.Errorf("json page = %+v", page)
+	}
+	if _, out, _ := loadMore("offset=-4&limit=1000&format=json"); !strings.Contains(fmt.Sprint(out), `"limit":100,`) || !strings.Contains(fmt.Sprint(out), `"offset":0,`) {
+		t.Errorf("offset and limit not clamped: %v", out)
+	}
+	if len(errs) > 0 {
+		t.Errorf("errors: %v", errs)
+	}
+}
+
+func TestBuildListItemTemplates(t *testing.T) {
+	bound := func(nodeType string) map[string]interface{} {
+		return map[string]interface{}{
+			"@type": nodeType,
+			"@bind": map[string]interface{}{"field": "title", "path": "value"},
+		}
+	}
+	fields := Fields{
+		Template: map[string]interface{}{"@name": "post", "10": bound("<TEXT>")},
+		ItemTemplates: map[string]interface{}{
+			"featured": map[string]interface{}{"10": bound("<HTML>"), "20": map[string]interface{}{"@type": "<TEXT>", "value": "★"}},
+			"broken":   "not a map",
+		},
+	}
+	var errs []error
+	template, binds, ok := loadTemplate(fields, &errs)
+	if !ok {
+		t.Fatalf("loadTemplate: %v", errs)
+	}
+	variants := resolveItemTemplates(fields, &errs)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "item_templates.broken") {
+		t.Errorf("errors = %v, want one for item_templates.broken", errs)
+	}
+
+	records := []record{
+		{ID: 1, Fields: map[string]string{"title": "Big", "layout": "featured"}},
+		{ID: 2, Fields: map[string]string{"title": "Plain", "layout": "compact"}}, // no such item template
+		{ID: 3, Fields: map[string]string{"title": "Bare"}},
+	}
+	list := buildList(template, binds, records, nil, false, "", "", nil, resolveTreeKeys(Fields{}), variants)
+
+	item := func(key string) map[string]interface{} { return list[key].(map[string]interface{}) }
+	featured := item("10")["10"].(map[string]interface{})
+	if featured["@type"] != "<HTML>" || featured["value"] != "Big" || item("10")["20"] == nil {
+		t.Errorf("featured item = %v", item("10"))
+	}
+	for _, key := range []string{"20", "30"} {
+		node := item(key)["10"].(map[string]interface{})
+		if node["@type"] != "<TEXT>" || item(key)["20"] != nil {
+			t.Errorf("item %s did not fall back to the default template: %v", key, item(key))
+		}
+	}
+
+	// A custom selecting bind.
+	fields.ItemTemplateBind = "status"
+	variants = resolveItemTemplates(fields, &errs)
+	list = buildList(template, binds, []record{{ID: 4, Fields: map[string]string{"title": "S", "status": "featured"}}}, nil, false, "", "", nil, resolveTreeKeys(Fields{}), variants)
+	if node := item("10")["10"].(map[string]interface{}); node["@type"] != "<HTML>" {
+		t.Errorf("status-selected item = %v", item("10"))
+	}
+}
+
+func TestSanitizePolicyXSSVectors(t *testing.T) {
+	policy := newSanitizePolicy(nil, nil, nil)
+	vectors := []string{
+		`<script>alert(1)</script>`,
+		`<SCRIPT SRC=//evil.example/x.js></SCRIPT>`,
+		`<img src=x onerror=alert(1)>`,
+		`<img src="javascript:alert(1)">`,
+		`<a href="javascript:alert(1)">x</a>`,
+		`<a href="JaVaScRiPt:alert(1)">x</a>`,
+		`<a href="java&#x09;script:alert(1)">x</a>`,
+		`<a href="&#106;avascript:alert(1)">x</a>`,
+		`<a href=" javascript:alert(1)">x</a>`,
+		`<a href="vbscript:msgbox(1)">x</a>`,
+		`<a href="data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==">x</a>`,
+		`<svg onload=alert(1)><circle/></svg>`,
+		`<iframe src="https://evil.example"></iframe>`,
+		`<body onload=alert(1)>`,
+		`<div style="background:url(javascript:alert(1))">x</div>`,
+		`<p onclick="alert(1)">x</p>`,
+		`<style>@import "javascript:alert(1)";</style>`,
+		`<object data="javascript:alert(1)"></object>`,
+		`<math><mi xlink:href="javascript:alert(1)">x</mi></math>`,
+		`<form action="javascript:alert(1)"><button>x</button></form>`,
+		`<!--<img src=x onerror=alert(1)>-->`,
+		`<scr<script>ipt>alert(1)</script>`,
+		`"><script>alert(1)</script>`,
+		`<img src=x:alert(1) onerror=eval(src)>`,
+		`<noscript><p title="</noscript><img src=x onerror=alert(1)>">`,
+		`<textarea><script>alert(1)</script></textarea>`,
+	}
+	for _, vector := range vectors {
+		out := strings.ToLower(policy.Sanitize(vector))
+		for _, bad := range []string{"<script", "javascript:", "vbscript:", "data:", "onerror", "onload", "onclick", "<iframe", "<svg", "<style", "<object", "style=", "<img src=\"x:"} {
+			if strings.Contains(out, bad) {
+				t.Errorf("Sanitize(%q) = %q, contains %q", vector, out, bad)
+			}
+		}
+	}
+
+	keep := `<p class="lead">Hi <a href="https://example.com/a?b=1&amp;c=2" title="t">link</a> <img src="/x.png" alt="x"> <a href="#top">top</a></p>`
+	if got := policy.Sanitize(keep); got != keep {
+		t.Errorf("safe markup changed:\n got %s\nwant %s", got, keep)
+	}
+	if got := policy.Sanitize(`<custom>text <b>bold</b></custom>`); got != "text <b>bold</b>" {
+		t.Errorf("unknown tag = %q", got)
+	}
+
+	custom := newSanitizePolicy([]string{"p", "a"}, []string{"a.href"}, []string{"https", "tel"})
+	if got := custom.Sanitize(`<p class="x"><a href="tel:123" title="t">call</a> <b>b</b></p>`); got != `<p><a href="tel:123">call</a> b</p>` {
+		t.Errorf("custom policy = %q", got)
+	}
+	if got := custom.Sanitize(`<a href="http://example.com">x</a>`); got != `<a>x</a>` {
+		t.Errorf("disallowed scheme kept: %q", got)
+	}
+	if got := newSanitizePolicy([]string{"script"}, []string{"onclick"}, nil).Sanitize(`<script>alert(1)</script><p onclick="x">`); got != "" {
+		t.Errorf("script or handler allowed by config: %q", got)
+	}
+}
+
+func TestSanitizeRawFields(t *testing.T) {
+	binds := map[string]bindTarget{"body": {Path: "10.value"}, "title": {Path: "20.value"}}
+	fields := Fields{Schema: map[string]FieldDef{"body": {Type: "richtext"}, "title": {Type: "text"}}}
+	newRecords := func() []record {
+		return []record{{ID: 1, Fields: map[string]string{
+			"body":  `<p>Hi<script>alert(1)</script></p>`,
+			"title": `<b>kept</b>`,
+		}}}
+	}
+
+	records := newRecords()
+	sanitizeRawFields(fields, binds, records)
+	if records[0].Fields["body"] != `<p>Hi<script>alert(1)</script></p>` {
+		t.Errorf("sanitized without data.sanitize: %q", records[0].Fields["body"])
+	}
+
+	fields.Sanitize = true
+	records = newRecords()
+	sanitizeRawFields(fields, binds, records)
+	if got := records[0].Fields["body"]; got != "<p>Hi</p>" {
+		t.Errorf("body = %q", got)
+	}
+	// Text fields are escaped on render, not sanitized.
+	if got := records[0].Fields["title"]; got != "<b>kept</b>" {
+		t.Errorf("title = %q", got)
+	}
+}
+
+func TestTableView(t *testing.T) {
+	fields := Fields{
+		Store: filepath.Join(t.TempDir(), "table.db"),
+		View:  "table",
+		Query: `SELECT r.id, rf.value AS title, NULL AS note FROM records r LEFT JOIN record_fields rf ON rf.record_id = r.id AND rf.bind_key = 'title' ORDER BY r.id`,
+	}
+	db, err := openStore(fields)
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	if _, err := createRecord(db, "article", map[string]string{"title": "<b>Fish & Chips</b>"}, writeOptions{}); err != nil {
+		t.Fatalf("createRecord: %v", err)
+	}
+
+	var errs []error
+	out := renderTable(fields, context.Background(), &errs)
+	want := "<table class=\"content-records-table\">\n<thead><tr><th>id</th><th>title</th><th>note</th></tr></thead>\n<tbody>\n" +
+		"<tr><td>1</td><td>&lt;b&gt;Fish &amp; Chips&lt;/b&gt;</td><td></td></tr>\n</tbody>\n</table>"
+	if out != want || len(errs) > 0 {
+		t.Errorf("html table = %q, errors %v", out, errs)
+	}
+
+	fields.TableFormat = "json"
+	out = renderTable(fields, context.Background(), &errs)
+	if want := `{"columns":["id","title","note"],"rows":[["1","\u003cb\u003eFish \u0026 Chips\u003c/b\u003e",null]]}`; out != want {
+		t.Errorf("json table = %s", out)
+	}
+
+	fields.Query = ""
+	if out := renderTable(fields, context.Background(), &errs); !strings.Contains(fmt.Sprint(out), "table failed") || len(errs) == 0 {
+		t.Errorf("missing query: %v, errors %v", out, errs)
+	}
+}
+
+func TestInlineEditableFalseLocksField(t *testing.T) {
+	locked := false
+	fields := Fields{
+		Store: filepath.Join(t.TempDir(), "inline.db"),
+		Schema: map[string]FieldDef{
+			"title": {Type: "text"},
+			"sku":   {Type: "text", InlineEditable: &locked},
+		},
+	}
+	template := map[string]interface{}{
+		"@name": "product",
+		"10":    map[string]interface{}{"@type": "<TEXT>", "@bind": map[string]interface{}{"field": "title", "path": "value"}},
+		"20":    map[string]interface{}{"@type": "<TEXT>", "@bind": map[string]interface{}{"field": "sku", "path": "value"}},
+	}
+	binds := map[string]bindTarget{}
+	collectBinds(template, "", binds)
+
+	instance := map[string]interface{}{
+		"10": map[string]interface{}{"@type": "<TEXT>", "value": "Lamp"},
+		"20": map[string]interface{}{"@type": "<TEXT>", "value": "L-1"},
+	}
+	rec := record{ID: 1, Fields: map[string]string{"title": "Lamp", "sku": "L-1"}}
+	applyInlineAttributes(instance, binds, rec, buildInlineOptions(fields, binds, true))
+	if _, ok := instance["10"].(map[string]interface{})["enclose"]; !ok {
+		t.Error("editable title not wrapped")
+	}
+	if enclose, ok := instance["20"].(map[string]interface{})["enclose"]; ok {
+		t.Errorf("locked sku wrapped: %v", enclose)
+	}
+
+	db, err := openStore(fields)
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	id, err := createRecord(db, "product", map[string]string{"title": "Lamp", "sku": "L-1"}, writeOptions{})
+	if err != nil {
+		t.Fatalf("createRecord: %v", err)
+	}
+	body := fmt.Sprintf(`{"cr_inline":"1","record_id":"%d","bind":"sku","value":"hacked"}`, id)
+	req := httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	ctx := context.WithValue(context.Background(), shared.Request, req)
+	ctx = context.WithValue(ctx, shared.ResponseWriter, http.ResponseWriter(w))
+	var errs []error
+	handled, response := handleInlineUpdate(ctx, db, "product", binds, fields, template, &errs)
+	if !handled || w.Code != http.StatusForbidden || !strings.Contains(fmt.Sprint(response), "not inline-editable") {
+		t.Errorf("locked update: handled %v, status %d, response %v", handled, w.Code, response)
+	}
+	stored, _ := fetchRecordByID(db, id, "product")
+	if stored.Fields["sku"] != "L-1" {
+		t.Errorf("sku = %q, want it unchanged", stored.Fields["sku"])
+	}
+}
+
+func TestTypedBindValuesAfterReload(t *testing.T) {
+	fields := Fields{
+		Store: filepath.Join(t.TempDir(), "typed.db"),
+		Template: map[string]interface{}{
+			"@name": "product",
+			"10": map[string]interface{}{
+				"@type":    "<TEMPLATE>",
+				"template": "{{if .featured}}featured{{end}}",
+				"values":   map[string]interface{}{"featured": false},
+				"@bind":    map[string]interface{}{"field": "featured", "path": "values.featured"},
+			},
+			"20": map[string]interface{}{"@type": "<TEXT>", "@bind": map[string]interface{}{"field": "stock", "path": "value"}},
+			"30": map[string]interface{}{"@type": "<TEXT>", "@bind": map[string]interface{}{"field": "price", "path": "value"}},
+		},
+		Schema: map[string]FieldDef{
+			"featured": {Type: "boolean"},
+			"stock":    {Type: "integer"},
+			"price":    {Type: "number"},
+		},
+	}
+	var errs []error
+	template, binds, ok := loadTemplate(fields, &errs)
+	if !ok {
+		t.Fatalf("loadTemplate failed: %v", errs)
+	}
+	db, err := openStore(fields)
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	var records []record
+	for _, values := range []map[string]string{
+		{"featured": "false", "stock": "3", "price": "9.5"},
+		{"featured": "on", "stock": "", "price": "n/a"},
+	} {
+		id, err := createRecord(db, "product", values, writeOptions{})
+		if err != nil {
+			t.Fatalf("createRecord: %v", err)
+		}
+		rec, err := fetchRecordByID(db, id, "product")
+		if err != nil {
+			t.Fatalf("fetchRecordByID: %v", err)
+		}
+		records = append(records, rec)
+	}
+
+	list := buildList(template, binds, records, nil, false, "", "", nil, resolveTreeKeys(Fields{}), nil)
+	bound := func(item string) (interface{}, interface{}, interface{}) {
+		instance := list[item].(map[string]interface{})
+		values := instance["10"].(map[string]interface{})["values"].(map[string]interface{})
+		return values["featured"], instance["20"].(map[string]interface{})["value"], instance["30"].(map[string]interface{})["value"]
+	}
+	if featured, stock, price := bound("10"); featured != false || stock != int64(3) || price != 9.5 {
+		t.Errorf("first record = %#v, %#v, %#v; want false, 3, 9.5", featured, stock, price)
+	}
+	if featured, stock, price := bound("20"); featured != true || stock != "" || price != "n/a" {
+		t.Errorf("second record = %#v, %#v, %#v; want true and unparseable values kept as strings", featured, stock, price)
+	}
+}
+
+func TestMaxRecordsEvictsOldest(t *testing.T) {
+	fields := Fields{Store: filepath.Join(t.TempDir(), "capped.db"), MaxRecords: 2}
+	db, err := openStore(fields)
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	other, err := createRecord(db, "note", map[string]string{"title": "other type"}, writeOptions{})
+	if err != nil {
+		t.Fatalf("createRecord: %v", err)
+	}
+	opts := resolveWriteOptions(fields, nil, context.Background())
+	var ids []int64
+	for _, title := range []string{"one", "two", "three", "four"} {
+		id, err := createRecord(db, "demo", map[string]string{"title": title}, opts)
+		if err != nil {
+			t.Fatalf("createRecord %s: %v", title, err)
+		}
+		ids = append(ids, id)
+	}
+
+	for i, id := range ids {
+		_, err := fetchRecordByID(db, id, "demo")
+		if kept := i >= 2; kept != (err == nil) {
+			t.Errorf("record %d: kept = %v, fetch err = %v", i+1, kept, err)
+		}
+	}
+	var orphans int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM record_fields WHERE record_id IN (?, ?)`, ids[0], ids[1]).Scan(&orphans); err != nil || orphans != 0 {
+		t.Errorf("evicted field rows = %d (err %v), want 0", orphans, err)
+	}
+	if _, err := fetchRecordByID(db, other, "note"); err != nil {
+		t.Errorf("other type evicted: %v", err)
+	}
+}
+
+func TestFeedIsWellFormed(t *testing.T) {
+	fields := Fields{
+		Store:  filepath.Join(t.TempDir(), "feed.db"),
+		Action: "feed",
+		Template: map[string]interface{}{
+			"@name": "post",
+			"10":    map[string]interface{}{"@bind": map[string]interface{}{"field": "title", "path": "value"}},
+			"20":    map[string]interface{}{"@bind": map[string]interface{}{"field": "summary", "path": "value"}},
+			"30":    map[string]interface{}{"@bind": map[string]interface{}{"field": "slug", "path": "value"}},
+			"40":    map[string]interface{}{"@bind": map[string]interface{}{"field": "published", "path": "value"}},
+		},
+		Feed: FeedConfig{
+			Title:           "News & notes",
+			Link:            "https://example.com/news/",
+			ItemLink:        "slug",
+			ItemDescription: "summary",
+			ItemPubDate:     "published",
+			DateFormat:      "02.01.2006",
+		},
+	}
+	db, err := openStore(fields)
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	for _, values := range []map[string]string{
+		{"title": "First <post>", "summary": "a & b", "slug": "first", "published": "03.02.2024"},
+		{"title": "Undated", "summary": "no date", "slug": "", "published": ""},
+	} {
+		if _, err := createRecord(db, "post", values, writeOptions{}); err != nil {
+			t.Fatalf("createRecord: %v", err)
+		}
+	}
+
+	feed := func(format string) (*httptest.ResponseRecorder, []string) {
+		fields.Feed.Format = format
+		rec := httptest.NewRecorder()
+		ctx := context.WithValue(context.Background(), shared.Request, httptest.NewRequest(http.MethodGet, "/feed", nil))
+		ctx = context.WithValue(ctx, shared.ResponseWriter, http.ResponseWriter(rec))
+		var errs []error
+		if out := renderFeed(fields, ctx, &errs); out != "" || len(errs) > 0 {
+			t.Fatalf("renderFeed(%s) = %v, errors %v", format, out, errs)
+		}
+		// Walk every token so malformed XML fails the test.
+		var elements []string
+		dec := xml.NewDecoder(bytes.NewReader(rec.Body.Bytes()))
+		for {
+			tok, err := dec.Token()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s feed is not well-formed: %v\n%s", format, err, rec.Body.String())
+			}
+			if start, ok := tok.(xml.StartElement); ok {
+				elements = append(elements, start.Name.Local)
+			}
+		}
+		return rec, elements
+	}
+
+	rec, elements := feed("rss")
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/rss+xml") {
+		t.Errorf("rss content type = %q", ct)
+	}
+	var rss rssFeed
+	if err := xml.Unmarshal(rec.Body.Bytes(), &rss); err != nil {
+		t.Fatalf("rss unmarshal: %v", err)
+	}
+	ch := rss.Channel
+	if rss.Version != "2.0" || ch.Title != "News & notes" || ch.Link == "" || ch.Description == "" || len(ch.Items) != 2 {
+		t.Errorf("rss channel = %+v (elements %v)", ch, elements)
+	}
+	first := ch.Items[0]
+	if first.Title != "First <post>" || first.Link != "https://example.com/news/first" || !first.GUID.IsPermaLink {
+		t.Errorf("first item = %+v", first)
+	}
+	if want := "Sat, 03 Feb 2024 00:00:00 +0000"; first.PubDate != want {
+		t.Errorf("pubDate = %q, want %q", first.PubDate, want)
+	}
+	if undated := ch.Items[1]; undated.PubDate != "" || undated.GUID.IsPermaLink || undated.GUID.Value != "https://example.com/news/#2" {
+		t.Errorf("undated item = %+v", undated)
+	}
+
+	rec, _ = feed("atom")
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/atom+xml") {
+		t.Errorf("atom content type = %q", ct)
+	}
+	var atom atomFeed
+	if err := xml.Unmarshal(rec.Body.Bytes(), &atom); err != nil {
+		t.Fatalf("atom unmarshal: %v", err)
+	}
+	if atom.ID == "" || atom.Title == "" || atom.Updated != "2024-02-03T00:00:00Z" || atom.Author.Name == "" || len(atom.Entries) != 2 {
+		t.Errorf("atom feed = %+v", atom)
+	}
+	for _, entry := range atom.Entries {
+		if entry.ID == "" || entry.Updated == "" || entry.Title == "" {
+			t.Errorf("atom entry missing required elements: %+v", entry)
+		}
+	}
+
+	fields.Feed.Link = ""
+	var errs []error
+	renderFeed(fields, context.WithValue(context.Background(), shared.ResponseWriter, http.ResponseWriter(httptest.NewRecorder())), &errs)
+	if len(errs) == 0 {
+		t.Error("feed without a link: want an error")
+	}
+}
+
+func TestTouchOnChangeOnly(t *testing.T) {
+	fields := Fields{Store: filepath.Join(t.TempDir(), "touch.db"), TouchOnChangeOnly: true, MaxVersions: 5}
+	db, err := openStore(fields)
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	opts := resolveWriteOptions(fields, nil, context.Background())
+	id, err := createRecord(db, "article", map[string]string{"title": "Same", "body": "Text"}, opts)
+	if err != nil {
+		t.Fatalf("createRecord: %v", err)
+	}
+	const old = "2000-01-01 00:00:00"
+	if _, err := db.Exec(`UPDATE records SET updated_at = ? WHERE id = ?`, old, id); err != nil {
+		t.Fatalf("backdate: %v", err)
+	}
+	state := func() (string, int) {
+		var updated string
+		var versions int
+		if err := db.QueryRow(`SELECT updated_at FROM records WHERE id = ?`, id).Scan(&updated); err != nil {
+			t.Fatalf("updated_at: %v", err)
+		}
+		if err := db.QueryRow(`SELECT COUNT(DISTINCT version) FROM record_field_versions WHERE record_id = ?`, id).Scan(&versions); err != nil {
+			t.Fatalf("versions: %v", err)
+		}
+		return strings.Replace(strings.TrimSuffix(updated, "Z"), "T", " ", 1), versions
+	}
+
+	changed, err := updateRecord(db, id, "article", map[string]string{"title": "Same", "body": "Text"}, opts)
+	if err != nil || changed {
+		t.Fatalf("no-op save: changed %v, err %v", changed, err)
+	}
+	if err := updateRecordField(db, id, "article", "title", "Same", opts); err != nil {
+		t.Fatalf("no-op inline save: %v", err)
+	}
+	if updated, versions := state(); updated != old || versions != 0 {
+		t.Errorf("after no-op saves: updated_at %s, versions %d; want %s, 0", updated, versions, old)
+	}
+
+	// Dropping a stored field is a change for a replacing update.
+	changed, err = updateRecord(db, id, "article", map[string]string{"title": "Same"}, opts)
+	if err != nil || !changed {
+		t.Fatalf("real change: changed %v, err %v", changed, err)
+	}
+	if updated, versions := state(); updated == old || versions != 1 {
+		t.Errorf("after change: updated_at %s, versions %d; want bumped, 1", updated, versions)
+	}
+}
+
+func TestQueryRecordIDsCountsSkippedRows(t *testing.T) {
+	db, err := openStore(Fields{Store: filepath.Join(t.TempDir(), "scan.db")})
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := createRecord(db, "article", map[string]string{"title": fmt.Sprint(i)}, writeOptions{}); err != nil {
+			t.Fatalf("createRecord: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		ids      int
+		scan     idScan
+		unusable bool
+	}{
+		{"type ids", "", 3, idScan{Column: "id", Rows: 3}, false},
+		{"no rows", `SELECT id FROM records WHERE type = 'none'`, 0, idScan{Column: "id"}, false},
+		{"some null ids", `SELECT CASE WHEN id = 2 THEN NULL ELSE id END AS rid FROM records ORDER BY id`, 2, idScan{Column: "rid", Rows: 3, Skipped: 1}, false},
+		{"wrong column", `SELECT type, id FROM records`, 0, idScan{Column: "type", Rows: 3, Skipped: 3}, true},
+	}
+	for _, tc := range tests {
+		ids, scan, err := queryRecordIDs(db, tc.query, "article", 0)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if len(ids) != tc.ids || scan != tc.scan || scan.unusable() != tc.unusable {
+			t.Errorf("%s: ids %v, scan %+v (unusable %v); want %d ids, %+v", tc.name, ids, scan, scan.unusable(), tc.ids, tc.scan)
+		}
+	}
+	if _, _, err := queryRecordIDs(db, `SELECT nope FROM records`, "article", 0); err == nil {
+		t.Error("invalid query: want an error, not an empty result")
+	}
+}
+
+func TestHealthStatusCodes(t *testing.T) {
+	run := func(fields Fields) (int, map[string]interface{}) {
+		rec := httptest.NewRecorder()
+		ctx := context.WithValue(context.Background(), shared.Request, httptest.NewRequest(http.MethodGet, "/health", nil))
+		ctx = context.WithValue(ctx, shared.ResponseWriter, http.ResponseWriter(rec))
+		var errs []error
+		var payload map[string]interface{}
+		out := renderHealth(fields, ctx, &errs)
+		if err := json.Unmarshal([]byte(fmt.Sprint(out)), &payload); err != nil {
+			t.Fatalf("response %v: %v", out, err)
+		}
+		return rec.Code, payload
+	}
+
+	fields := Fields{
+		Store:    filepath.Join(t.TempDir(), "health.db"),
+		Seed:     true,
+		Template: map[string]interface{}{"@name": "article"},
+	}
+	if code, payload := run(fields); code != http.StatusOK || payload["status"] != "ok" || payload["error"] != nil {
+		t.Errorf("healthy store: status %d, payload %v", code, payload)
+	}
+	db, err := openStore(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := countRecords(db, "article"); n != 0 {
+		t.Errorf("health check seeded %d records", n)
+	}
+
+	if _, err := db.Exec(`DROP TABLE record_field_versions`); err != nil {
+		t.Fatal(err)
+	}
+	code, payload := run(fields)
+	tables, _ := payload["tables"].(map[string]interface{})
+	if code != http.StatusServiceUnavailable || payload["status"] != "error" || tables["record_field_versions"] != false || tables["records"] != true {
+		t.Errorf("missing table: status %d, payload %v", code, payload)
+	}
+
+	blocker := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(blocker, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if code, payload := run(Fields{Store: filepath.Join(blocker, "store.db")}); code != http.StatusServiceUnavailable || payload["error"] == nil {
+		t.Errorf("unreachable store: status %d, payload %v", code, payload)
+	}
+}
+
+func TestMaintenanceVacuumsStore(t *testing.T) {
+	fields := Fields{Store: filepath.Join(t.TempDir(), "vacuum.db"), Action: "maintenance", MaintenanceToken: "s3cret"}
+	db, err := openStore(fields)
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	body := strings.Repeat("x", 2000)
+	var ids []int64
+	for i := 0; i < 200; i++ {
+		id, err := createRecord(db, "article", map[string]string{"body": body}, writeOptions{})
+		if err != nil {
+			t.Fatalf("createRecord: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	for _, id := range ids {
+		if err := deleteRecord(db, id, "article", writeOptions{}); err != nil {
+			t.Fatalf("deleteRecord: %v", err)
+		}
+	}
+
+	run := func(fields Fields, method, auth string) (int, map[string]interface{}) {
+		req := httptest.NewRequest(method, "/maintenance", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		ctx := context.WithValue(context.Background(), shared.Request, req)
+		ctx = context.WithValue(ctx, shared.ResponseWriter, http.ResponseWriter(w))
+		var errs []error
+		out := renderMaintenance(fields, ctx, &errs)
+		var payload map[string]interface{}
+		if err := json.Unmarshal([]byte(fmt.Sprint(out)), &payload); err != nil {
+			t.Fatalf("response %v: %v", out, err)
+		}
+		return w.Code, payload
+	}
+
+	if code, _ := run(fields, http.MethodGet, "Bearer s3cret"); code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status %d", code)
+	}
+	if code, _ := run(fields, http.MethodPost, "Bearer wrong"); code != http.StatusUnauthorized {
+		t.Errorf("wrong token: status %d", code)
+	}
+	if code, _ := run(Fields{Store: fields.Store}, http.MethodPost, "Bearer "); code != http.StatusForbidden {
+		t.Errorf("no configured token: status %d", code)
+	}
+	if code, _ := run(Fields{Store: ":memory:", MaintenanceToken: "s3cret"}, http.MethodPost, "Bearer s3cret"); code != http.StatusBadRequest {
+		t.Errorf(":memory: store: status %d", code)
+	}
+
+	code, payload := run(fields, http.MethodPost, "Bearer s3cret")
+	if code != http.StatusOK || payload["ok"] != true {
+		t.Fatalf("maintenance: status %d, payload %v", code, payload)
+	}
+	before := payload["before"].(map[string]interface{})
+	after := payload["after"].(map[string]interface{})
+	if before["freelist_count"].(float64) == 0 || after["freelist_count"].(float64) != 0 {
+		t.Errorf("freelist before %v, after %v; want free pages reclaimed", before["freelist_count"], after["freelist_count"])
+	}
+	if after["page_count"].(float64) >= before["page_count"].(float64) {
+		t.Errorf("page_count before %v, after %v; want it to shrink", before["page_count"], after["page_count"])
+	}
+}
+
+func TestMigrateFieldRenamesBindKey(t *testing.T) {
+	fields := Fields{
+		Store:            filepath.Join(t.TempDir(), "migrate.db"),
+		Action:           "migrate_field",
+		MaintenanceToken: "s3cret",
+		Template: map[string]interface{}{
+			"@name": "article",
+			"10":    map[string]interface{}{"@type": "<TEXT>", "@bind": map[string]interface{}{"field": "headline", "path": "value"}},
+		},
+	}
+	db, err := openStore(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := createRecord(db, "article", map[string]string{"title": "Renamed schema"}, writeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pageID, err := createRecord(db, "page", map[string]string{"title": "Other type"}, writeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(form url.Values) (int, map[string]interface{}) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/admin/migrate", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Authorization", "Bearer s3cret")
+		w := httptest.NewRecorder()
+		ctx := context.WithValue(context.Background(), shared.Request, req)
+		ctx = context.WithValue(ctx, shared.ResponseWriter, http.ResponseWriter(w))
+		var errs []error
+		out := renderMigrateField(fields, ctx, &errs)
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		var payload map[string]interface{}
+		if err := json.Unmarshal([]byte(fmt.Sprint(out)), &payload); err != nil {
+			t.Fatalf("response %v: %v", out, err)
+		}
+		return w.Code, payload
+	}
+
+	for _, form := range []url.Values{
+		{"from": {"title"}, "to": {"head line"}},
+		{"from": {""}, "to": {"headline"}},
+		{"from": {"title"}, "to": {"title"}},
+		{"from": {"title"}, "to": {"headline"}, "mode": {"move"}},
+	} {
+		if code, payload := run(form); code != http.StatusBadRequest {
+			t.Errorf("%v: status %d, payload %v", form, code, payload)
+		}
+	}
+
+	code, payload := run(url.Values{"from": {"title"}, "to": {"headline"}})
+	if code != http.StatusOK || payload["records"] != float64(1) {
+		t.Fatalf("rename: status %d, payload %v", code, payload)
+	}
+	rec, err := fetchRecordByID(db, id, "article")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rec.Fields["title"]; ok {
+		t.Errorf("old key kept after rename: %v", rec.Fields)
+	}
+	binds := templateBinds(fields, fields.Template.(map[string]interface{}))
+	list := buildList(fields.Template.(map[string]interface{}), binds, []record{rec}, nil, false, "", "", nil, resolveTreeKeys(fields), nil)
+	item, _ := list["10"].(map[string]interface{})
+	if text, _ := item["10"].(map[string]interface{}); text["value"] != "Renamed schema" {
+		t.Errorf("rendered headline = %v", item["10"])
+	}
+	if other, _ := fetchRecordFields(db, pageID); other["title"] != "Other type" {
+		t.Errorf("record of another type changed: %v", other)
+	}
+
+	if code, payload := run(url.Values{"from": {"headline"}, "to": {"title"}, "mode": {"copy"}}); code != http.StatusOK || payload["records"] != float64(1) {
+		t.Fatalf("copy: status %d, payload %v", code, payload)
+	}
+	if values, _ := fetchRecordFields(db, id); values["title"] != "Renamed schema" || values["headline"] != "Renamed schema" {
+		t.Errorf("after copy = %v", values)
+	}
+	if code, _ := run(url.Values{"from": {"headline"}, "to": {"title"}}); code != http.StatusConflict {
+		t.Errorf("rename onto an existing key: status %d, want 409", code)
+	}
+}
+
+func TestSharedStoreRejectsConflictingPragmas(t *testing.T) {
+	resetStores()
+	t.Cleanup(resetStores)
+	store := filepath.Join(t.TempDir(), "shared.db")
+	cms := Fields{Store: store, Pragmas: map[string]string{"cache_size": "-2000"}}
+	if _, err := openStore(cms); err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	if _, err := openStore(Fields{Store: store, Pragmas: map[string]string{"cache_size": "-2000"}}); err != nil {
+		t.Errorf("same pragmas: %v", err)
+	}
+	if _, err := openStore(Fields{Store: store}); err != nil {
+		t.Errorf("config without pragmas: %v", err)
+	}
+	_, err := openStore(Fields{Store: store, Pragmas: map[string]string{"synchronous": "off"}})
+	if err == nil || !strings.Contains(err.Error(), "pragmas") {
+		t.Errorf("conflicting pragmas: err = %v, want a mismatch error", err)
+	}
+
+	resetStores()
+	if _, err := openStore(Fields{Store: store, Pragmas: map[string]string{"synchronous": "off"}}); err != nil {
+		t.Errorf("after resetStores: %v", err)
+	}
+}
+
+func TestNamespacedFormParams(t *testing.T) {
+	fields := Fields{Store: filepath.Join(t.TempDir(), "params.db"), ActionParam: "cr_action", RecordIDParam: "cr_record_id"}
+	db, err := openStore(fields)
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	id, err := createRecord(db, "article", map[string]string{"title": "Keep"}, writeOptions{})
+	if err != nil {
+		t.Fatalf("createRecord: %v", err)
+	}
+	post := func(body string) string {
+		req := httptest.NewRequest(http.MethodPost, "/cms", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		ctx := context.WithValue(context.Background(), shared.Request, req)
+		var errs []error
+		action := applyCMSAction(ctx, db, "article", nil, uploadOptions{}, resolveFormParams(fields), writeOptions{}, nil, &errs)
+		if len(errs) > 0 {
+			t.Fatalf("applyCMSAction(%s): %v", body, errs)
+		}
+		return action
+	}
+
+	// A host form's own action/record_id fields must not reach the plugin.
+	if action := post(fmt.Sprintf("action=delete&record_id=%d", id)); action != "" {
+		t.Errorf("host form fields applied action %q", action)
+	}
+	if _, err := fetchRecordByID(db, id, "article"); err != nil {
+		t.Fatalf("record deleted by host form: %v", err)
+	}
+	if action := post(fmt.Sprintf("cr_action=delete&cr_record_id=%d", id)); action != "delete" {
+		t.Errorf("namespaced action = %q, want delete", action)
+	}
+	if _, err := fetchRecordByID(db, id, "article"); err == nil {
+		t.Error("namespaced delete did not remove the record")
+	}
+
+	values := buildEditValues(record{ID: id}, nil, fields, nil)
+	if values["action_param"] != "cr_action" || values["record_id_param"] != "cr_record_id" {
+		t.Errorf("edit values params = %v, %v", values["action_param"], values["record_id_param"])
+	}
+	if defaults := resolveFormParams(Fields{}); defaults != (formParams{Action: "action", RecordID: "record_id"}) {
+		t.Errorf("default params = %+v", defaults)
+	}
+}
+
+func TestFieldDefaultFillsAbsentFieldsOnly(t *testing.T) {
+	fields := Fields{
+		Store: filepath.Join(t.TempDir(), "defaults.db"),
+		Template: map[string]interface{}{
+			"@name": "article",
+			"10":    map[string]interface{}{"@type": "<TEXT>", "@bind": map[string]interface{}{"field": "title", "path": "value"}},
+			"20":    map[string]interface{}{"@type": "<TEXT>", "value": "", "@bind": map[string]interface{}{"field": "status", "path": "value"}},
+		},
+		Schema: map[string]FieldDef{
+			"title":  {Type: "text"},
+			"status": {Type: "text", Default: "draft"},
+		},
+	}
+	var errs []error
+	template, binds, ok := loadTemplate(fields, &errs)
+	if !ok {
+		t.Fatalf("loadTemplate failed: %v", errs)
+	}
+	db, err := openStore(fields)
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	var records []record
+	// The first record predates the status field; the second left it blank on purpose.
+	for _, values := range []map[string]string{{"title": "Old"}, {"title": "Blank", "status": ""}} {
+		id, err := createRecord(db, "article", values, writeOptions{})
+		if err != nil {
+			t.Fatalf("createRecord: %v", err)
+		}
+		rec, err := fetchRecordByID(db, id, "article")
+		if err != nil {
+			t.Fatalf("fetchRecordByID: %v", err)
+		}
+		records = append(records, rec)
+	}
+
+	applyFieldDefaults(fields, binds, records)
+	list := buildList(template, binds, records, nil, false, "", "", nil, resolveTreeKeys(Fields{}), nil)
+	status := func(item string) interface{} {
+		return list[item].(map[string]interface{})["20"].(map[string]interface{})["value"]
+	}
+	if got := status("10"); got != "draft" {
+		t.Errorf("absent status rendered %q, want the default", got)
+	}
+	if got := status("20"); got != "" {
+		t.Errorf("blank status rendered %q, want it kept blank", got)
+	}
+
+	values := buildEditValues(records[0], collectCMSFields(fields, binds), fields, nil)
+	stored := values["record"].(map[string]interface{})["fields"].(map[string]interface{})
+	if stored["status"] != "draft" {
+		t.Errorf("edit form status = %v, want the default", stored["status"])
+	}
+}
+
+func TestMetricsCountWritesOnceEnabled(t *testing.T) {
+	store := openTestDB(t)
+	db, err := getDB(store)
+	if err != nil {
+		t.Fatalf("getDB: %v", err)
+	}
+
+	metrics.enable()
+	before := metrics.value("db_writes")
+	if _, err := createRecord(db, "article", map[string]string{"title": "Counted"}, writeOptions{}); err != nil {
+		t.Fatalf("createRecord: %v", err)
+	}
+	if got := metrics.value("db_writes") - before; got != 1 {
+		t.Errorf("db_writes grew by %d, want 1", got)
+	}
+}
+
+func TestHTTPCachingValidators(t *testing.T) {
+	fields := Fields{Store: filepath.Join(t.TempDir(), "caching.db"), HTTPCaching: true, LoadMore: true}
+	db, err := openStore(fields)
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	opts := resolveWriteOptions(fields, nil, nil)
+	id, err := createRecord(db, "article", map[string]string{"title": "First"}, opts)
+	if err != nil {
+		t.Fatalf("createRecord: %v", err)
+	}
+	get := func(header, value string) (bool, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodGet, "/articles?cr_more=1", nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		rec := httptest.NewRecorder()
+		ctx := context.WithValue(context.Background(), shared.Request, req)
+		ctx = context.WithValue(ctx, shared.ResponseWriter, http.ResponseWriter(rec))
+		return notModified(ctx, db, fields, "article"), rec
+	}
+
+	fresh, rec := get("", "")
+	etag := rec.Header().Get("ETag")
+	if fresh || etag == "" {
+		t.Fatalf("first request: fresh %v, ETag %q", fresh, etag)
+	}
+	if fresh, rec := get("If-None-Match", etag); !fresh || rec.Code != http.StatusNotModified {
+		t.Errorf("matching If-None-Match: fresh %v, status %d; want 304", fresh, rec.Code)
+	}
+
+	// A second edit within the same second of updated_at still moves the ETag.
+	if _, err := updateRecord(db, id, "article", map[string]string{"title": "Second"}, opts); err != nil {
+		t.Fatalf("updateRecord: %v", err)
+	}
+	fresh, rec = get("If-None-Match", etag)
+	updated := rec.Header().Get("ETag")
+	if fresh || updated == etag {
+		t.Errorf("stale ETag %q still matched after an update", etag)
+	}
+	if _, _, err := migrateField(db, "article", "title", "headline", false, opts); err != nil {
+		t.Fatalf("migrateField: %v", err)
+	}
+	if fresh, _ := get("If-None-Match", updated); fresh {
+		t.Error("migrate_field left the ETag unchanged")
+	}
+
+	// Last-Modified is only sent, and If-Modified-Since honoured, once the
+	// newest updated_at second has passed.
+	if _, err := db.Exec(`UPDATE records SET updated_at = datetime('now', '-1 hour')`); err != nil {
+		t.Fatal(err)
+	}
+	_, rec = get("", "")
+	lastModified := rec.Header().Get("Last-Modified")
+	if lastModified == "" {
+		t.Fatal("no Last-Modified for an hour-old record")
+	}
+	if fresh, rec := get("If-Modified-Since", lastModified); !fresh || rec.Code != http.StatusNotModified {
+		t.Errorf("If-Modified-Since %s: fresh %v, status %d; want 304", lastModified, fresh, rec.Code)
+	}
+	if fresh, _ := get("If-Modified-Since", time.Now().Add(-2*time.Hour).UTC().Format(http.TimeFormat)); fresh {
+		t.Error("an older If-Modified-Since answered 304")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/articles?cr_more=1", nil)
+	req.Header.Set("If-None-Match", rec.Header().Get("ETag"))
+	w := httptest.NewRecorder()
+	ctx := context.WithValue(context.Background(), shared.Request, req)
+	ctx = context.WithValue(ctx, shared.ResponseWriter, http.ResponseWriter(w))
+	var errs []error
+	if handled, _ := handleLoadMore(ctx, db, "article", nil, fields, nil, &errs); !handled || w.Code != http.StatusNotModified {
+		t.Errorf("load more: handled %v, status %d; want 304", handled, w.Code)
+	}
+}
+
+func TestMetricsSurviveTakenName(t *testing.T) {
+	expvar.Publish("content_records_test_func", expvar.Func(func() any { return 1 }))
+	taken := newPluginMetrics("content_records_test_func")
+	taken.enable()
+	taken.add("writes", 1)
+	if got := taken.value("writes"); got != 1 {
+		t.Errorf("writes = %d under a name taken by a non-map var, want 1", got)
+	}
+
+	copies := make([]*pluginMetrics, 8)
+	var wg sync.WaitGroup
+	for i := range copies {
+		copies[i] = newPluginMetrics("content_records_test_shared")
+		wg.Add(1)
+		go func(m *pluginMetrics) {
+			defer wg.Done()
+			m.enable()
+		}(copies[i])
+	}
+	wg.Wait()
+	for _, m := range copies {
+		if m.vars != copies[0].vars {
+			t.Fatal("concurrent copies published separate maps")
+		}
+	}
+}
+
+func TestReadOnlyRejectsPosts(t *testing.T) {
+	fields := Fields{Store: filepath.Join(t.TempDir(), "readonly.db"), ReadOnly: true}
+	db, err := openStore(fields)
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	id, err := createRecord(db, "article", map[string]string{"title": "Keep"}, writeOptions{})
+	if err != nil {
+		t.Fatalf("createRecord: %v", err)
+	}
+	newPost := func(body string) (context.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPost, "/cms", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		ctx := context.WithValue(context.Background(), shared.Request, req)
+		return context.WithValue(ctx, shared.ResponseWriter, http.ResponseWriter(rec)), rec
+	}
+
+	ctx, _ := newPost(fmt.Sprintf("action=delete&record_id=%d", id))
+	var errs []error
+	applyCMSAction(ctx, db, "article", nil, uploadOptions{}, resolveFormParams(fields), resolveWriteOptions(fields, nil, ctx), nil, &errs)
+	if len(errs) != 1 || !errors.Is(errs[0], errReadOnly) {
+		t.Errorf("cms delete errors = %v, want errReadOnly", errs)
+	}
+
+	ctx, rec := newPost(fmt.Sprintf("inline=1&record_id=%d&bind=title&value=Changed", id))
+	errs = nil
+	if handled, _ := handleInlineUpdate(ctx, db, "article", nil, fields, nil, &errs); !handled || rec.Code != http.StatusForbidden {
+		t.Errorf("inline update: handled = %v, status = %d, want 403", handled, rec.Code)
+	}
+
+	stored, err := fetchRecordByID(db, id, "article")
+	if err != nil {
+		t.Fatalf("record deleted in read-only mode: %v", err)
+	}
+	if stored.Fields["title"] != "Keep" {
+		t.Errorf("title = %q, want it unchanged", stored.Fields["title"])
+	}
+	if _, err := createRecord(db, "article", nil, resolveWriteOptions(fields, nil, nil)); !errors.Is(err, errReadOnly) {
+		t.Errorf("createRecord err = %v, want errReadOnly", err)
+	}
+}
+
+func TestCompileRecordQuery(t *testing.T) {
+	fields := Fields{
+		Store:  filepath.Join(t.TempDir(), "where.db"),
+		Schema: map[string]FieldDef{"price": {Type: "number"}},
+		Where: WhereConditions{
+			"10": {Bind: "status", Value: "published"},
+			"20": {Bind: "price", Op: "gt", Value: "10"},
+		},
+		OrderBy: "price desc",
+		Limit:   2,
+	}
+	query, args, err := compileRecordQuery(fields, "product", nil)
+	if err != nil {
+		t.Fatalf("compileRecordQuery: %v", err)
+	}
+	wantQuery := "SELECT r.id FROM records r" +
+		" JOIN record_fields w0 ON w0.record_id = r.id AND w0.bind_key = ?" +
+		" JOIN record_fields w1 ON w1.record_id = r.id AND w1.bind_key = ?" +
+		" LEFT JOIN record_fields o0 ON o0.record_id = r.id AND o0.bind_key = ?" +
+		" WHERE r.type = ? AND w0.value = ? AND w1.num_value > ?" +
+		" ORDER BY o0.num_value DESC, r.id ASC LIMIT ?"
+	if query != wantQuery {
+		t.Errorf("query =\n%s\nwant\n%s", query, wantQuery)
+	}
+	wantArgs := []interface{}{"status", "price", "price", "product", "published", 10.0, 2}
+	if fmt.Sprint(args) != fmt.Sprint(wantArgs) {
+		t.Errorf("args = %v, want %v", args, wantArgs)
+	}
+
+	db, err := openStore(fields)
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	opts := writeOptions{FieldTypes: map[string]string{"price": "number"}}
+	for _, values := range []map[string]string{
+		{"status": "published", "price": "5"},
+		{"status": "published", "price": "30"},
+		{"status": "draft", "price": "50"},
+		{"status": "published", "price": "20"},
+		{"status": "published", "price": "40"},
+	} {
+		if _, err := createRecord(db, "product", values, opts); err != nil {
+			t.Fatalf("createRecord: %v", err)
+		}
+	}
+	records, err := fetchRecordsForList(db, fields, "product", nil)
+	if err != nil {
+		t.Fatalf("fetchRecordsForList: %v", err)
+	}
+	var prices []string
+	for _, rec := range records {
+		prices = append(prices, rec.Fields["price"])
+	}
+	if got := strings.Join(prices, ","); got != "40,30" {
+		t.Errorf("prices = %s, want 40,30", got)
+	}
+
+	fields.Where = WhereConditions{"10": {Bind: "status", Op: "matches", Value: "x"}}
+	if _, _, err := compileRecordQuery(fields, "product", nil); err == nil || !strings.Contains(err.Error(), `unknown operator "matches"`) {
+		t.Errorf("unknown operator err = %v", err)
+	}
+}
+
+func TestListColumnsOrderCMSTable(t *testing.T) {
+	fields := Fields{
+		Template: map[string]interface{}{
+			"@name": "article",
+			"10":    map[string]interface{}{"@type": "<TEXT>", "@list": true, "@bind": map[string]interface{}{"field": "title", "path": "value"}},
+			"20":    map[string]interface{}{"@type": "<TEXT>", "@bind": map[string]interface{}{"field": "status", "path": "value"}},
+			"30":    map[string]interface{}{"@type": "<TEXT>", "@bind": map[string]interface{}{"field": "author", "path": "value"}},
+		},
+		ListColumns: []string{"status: State", "missing", "title", "status"},
+	}
+	var errs []error
+	template, binds, ok := loadTemplate(fields, &errs)
+	if !ok {
+		t.Fatalf("loadTemplate failed: %v", errs)
+	}
+	fieldDefs := collectCMSFields(fields, binds)
+	values := buildCMSValues(template, binds, nil, fields, fieldDefs, nil, collectFlaggedBindKeys(template, "@list"))
+
+	if got := fmt.Sprint(values["list_field_ids"]); got != "[status title]" {
+		t.Errorf("list_field_ids = %s, want [status title]", got)
+	}
+	labels := values["list_labels"].(map[string]interface{})
+	if labels["status"] != "State" || labels["title"] != nil {
+		t.Errorf("list_labels = %v", labels)
+	}
+}
+
+func TestGetInputFromContextRestoresJSONBody(t *testing.T) {
+	const body = `{"title":"Hello","status":"draft"}`
+	for name, reader := range map[string]io.Reader{
+		"seeker": strings.NewReader(body),
+		"buffer": bytes.NewBufferString(body),
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), shared.RequestBody, reader)
+			if got := GetInputFromContext(ctx, "title"); got != "Hello" {
+				t.Errorf("first read = %q, want Hello", got)
+			}
+			if got := GetInputFromContext(ctx, "status"); got != "draft" {
+				t.Errorf("second read = %q, want draft", got)
+			}
+			// Another plugin reading the raw body still gets all of it.
+			if rest, _ := io.ReadAll(reader); string(rest) != body {
+				t.Errorf("body left = %q, want it restored", rest)
+			}
+		})
+	}
+
+	// The host stores the request's own, non-seekable r.Body.
+	req := httptest.NewRequest(http.MethodPost, "/cms", io.NopCloser(strings.NewReader(body)))
+	ctx := context.WithValue(context.Background(), shared.Request, req)
+	ctx = context.WithValue(ctx, shared.RequestBody, io.Reader(req.Body))
+	if got := GetInputFromContext(ctx, "title"); got != "Hello" {
+		t.Errorf("request body, first read = %q, want Hello", got)
+	}
+	if got := GetInputFromContext(ctx, "status"); got != "draft" {
+		t.Errorf("request body, second read = %q, want draft", got)
+	}
+	if rest, _ := io.ReadAll(req.Body); string(rest) != body {
+		t.Errorf("req.Body left = %q, want a full copy", rest)
+	}
+}
+
+func TestPlaceholderTemplateUntilFirstRecord(t *testing.T) {
+	fields := Fields{
+		Store:       filepath.Join(t.TempDir(), "placeholder.db"),
+		Placeholder: true,
+		Template: map[string]interface{}{
+			"@name": "post",
+			"10": map[string]interface{}{
+				"@type": "<TEXT>",
+				"value": "Sample title",
+				"@bind": map[string]interface{}{"field": "title", "path": "value"},
+			},
+		},
+	}
+	render := func() map[string]interface{} {
+		var errs []error
+		list, ok := renderListRender(fields, context.Background(), &errs).(map[string]interface{})
+		if !ok || len(errs) > 0 {
+			t.Fatalf("render = %v, errors %v", list, errs)
+		}
+		return list
+	}
+
+	list := render()
+	item, ok := list["10"].(map[string]interface{})
+	if !ok || list["20"] != nil {
+		t.Fatalf("want exactly one placeholder item, got %v", list)
+	}
+	if node := item["10"].(map[string]interface{}); node["value"] != "Sample title" {
+		t.Errorf("placeholder value = %v, want template default", node["value"])
+	}
+
+	db, err := openStore(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := createRecord(db, "post", map[string]string{"title": "Real"}, writeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	list = render()
+	node := list["10"].(map[string]interface{})["10"].(map[string]interface{})
+	if node["value"] != "Real" || list["20"] != nil {
+		t.Errorf("placeholder still rendered after a record exists: %v", list)
+	}
+}
+
+func TestSerializeWritesConcurrentCreates(t *testing.T) {
+	store := openTestDB(t)
+	db, err := getDB(store)
+	if err != nil {
+		t.Fatalf("getDB: %v", err)
+	}
+	noRetries := 0
+	fields := Fields{Store: store, SerializeWrites: true, MaxRetries: &noRetries}
+	opts := resolveWriteOptions(fields, nil, nil)
+	if opts.WriteLock == nil || opts.WriteLock != storeWriteLock(" "+store) {
+		t.Fatalf("write lock = %p, want the shared lock for %s", opts.WriteLock, store)
+	}
+
+	const writers = 8
+	const perWriter = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, writers*perWriter)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				values := map[string]string{"title": fmt.Sprintf("writer %d record %d", w, i)}
+				if _, err := createRecord(db, "article", values, opts); err != nil {
+					errs <- err
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("serialized createRecord failed: %v", err)
+	}
+
+	count, err := countRecords(db, "article")
+	if err != nil || count != writers*perWriter {
+		t.Errorf("count = %d, %v; want %d", count, err, writers*perWriter)
+	}
+}
+
+func TestTextUploadTranscodesLatin1(t *testing.T) {
+	latin1 := []byte("Caf\xe9 na\xefve \xa9")
+	upload := func(charset string, contentType string) (map[string]string, []error) {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", `form-data; name="body"; filename="import.txt"`)
+		header.Set("Content-Type", contentType)
+		part, _ := form.CreatePart(header)
+		part.Write(latin1)
+		form.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/cms", &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		ctx := context.WithValue(context.Background(), shared.Request, req)
+		fieldDefs := []cmsField{{Name: "body", Bind: "body", Type: "textarea"}, {Name: "cover", Bind: "cover", Type: "image"}}
+		values := map[string]string{}
+		var errs []error
+		mergeUploads(ctx, fieldDefs, uploadOptions{Charset: charset}, values, &errs)
+		return values, errs
+	}
+
+	values, errs := upload("", "text/plain; charset=iso-8859-1")
+	if len(errs) > 0 || values["body"] != "Café naïve ©" {
+		t.Errorf("declared latin-1: body = %q, errors %v", values["body"], errs)
+	}
+	values, errs = upload("latin1", "text/plain")
+	if len(errs) > 0 || values["body"] != "Café naïve ©" {
+		t.Errorf("upload_charset latin1: body = %q, errors %v", values["body"], errs)
+	}
+	values, errs = upload("auto", "text/plain")
+	if len(errs) > 0 || values["body"] != "Café naïve ©" {
+		t.Errorf("upload_charset auto: body = %q, errors %v", values["body"], errs)
+	}
+	values, errs = upload("", "text/plain")
+	if _, ok := values["body"]; ok || len(errs) != 1 || !strings.Contains(errs[0].Error(), "not valid UTF-8") {
+		t.Errorf("undeclared non-UTF-8: values %v, errors %v; want one rejection", values, errs)
+	}
+
+	if text, err := decodeTextUpload([]byte("\xef\xbb\xbfAlready UTF-8 ✓"), "", "auto"); err != nil || text != "Already UTF-8 ✓" {
+		t.Errorf("utf-8 with BOM = %q, %v", text, err)
+	}
+}
+
+func TestValidateOnlyReportsWithoutSideEffects(t *testing.T) {
+	dir := t.TempDir()
+	store := filepath.Join(dir, "db", "records.db")
+	bad := Fields{
+		Store:      store,
+		Seed:       true,
+		IDStrategy: "serial",
+		Pragmas:    map[string]string{"journal_mode": "sometimes"},
+		Template:   "not a map",
+	}
+	errs := validateConfig(bad)
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	joined := strings.Join(messages, "\n")
+	for _, want := range []string{"id_strategy", "journal_mode", "data.template must be a map"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("errors %q do not mention %s", joined, want)
+		}
+	}
+
+	good := Fields{
+		Store: store,
+		Seed:  true,
+		Template: map[string]interface{}{
+			"@name": "post",
+			"10":    map[string]interface{}{"@type": "<TEXT>", "@bind": map[string]interface{}{"field": "title", "path": "value"}},
+			"20":    map[string]interface{}{"@type": "<IMAGE>", "@bind": map[string]interface{}{"field": "cover", "path": "src"}},
+		},
+		Schema: map[string]FieldDef{"title": {Type: "text"}, "cover": {Type: "image"}, "subtitle": {Type: "text"}},
+	}
+	errs = validateConfig(good)
+	if len(errs) != 2 || !strings.Contains(fmt.Sprint(errs), "subtitle matches no @bind") || !strings.Contains(fmt.Sprint(errs), "cover needs data.upload_dir") {
+		t.Errorf("errors = %v, want unmatched subtitle and missing upload_dir for cover", errs)
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("validate_only created files: %v", entries)
+	}
+}
+
+func TestDirAndFileModesForStoreAndUploads(t *testing.T) {
+	root := t.TempDir()
+	fields := Fields{
+		Store:     filepath.Join(root, "data", "db", "records.db"),
+		UploadDir: filepath.Join(root, "uploads", "images"),
+		DirMode:   "0750",
+		FileMode:  "0600",
+	}
+	if _, err := openStore(fields); err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	if info, err := os.Stat(filepath.Dir(fields.Store)); err != nil || info.Mode().Perm()&^0o750 != 0 {
+		t.Errorf("store dir = %v, %v; want mode at most 0750", info, err)
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("cover", "photo.jpg")
+	part.Write([]byte("jpeg"))
+	form.Close()
+	req := httptest.NewRequest(http.MethodPost, "/cms", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if err := req.ParseMultipartForm(1 << 20); err != nil {
+		t.Fatal(err)
+	}
+	path, err := saveUploadFile(req, "cover", resolveUploadOptions(fields))
+	if err != nil {
+		t.Fatalf("saveUploadFile: %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("upload = %v, %v; want mode 0600", info, err)
+	}
+
+	fields.FileMode = "rw-r--r--"
+	if _, err := openStore(fields); err == nil || !strings.Contains(err.Error(), "file_mode") {
+		t.Errorf("openStore with an invalid file_mode = %v, want a file_mode error", err)
+	}
+}
+
+func TestEmptyAndErrorFallbacks(t *testing.T) {
+	fields := Fields{
+		Store: filepath.Join(t.TempDir(), "fallback.db"),
+		Template: map[string]interface{}{
+			"@name": "article",
+			"10":    map[string]interface{}{"@type": "<TEXT>", "@bind": map[string]interface{}{"field": "title", "path": "value"}},
+		},
+	}
+	broken := fields
+	broken.Template = "not a template"
+	render := func(fn func(Fields, context.Context, *[]error) any, fields Fields) string {
+		var errs []error
+		return fmt.Sprint(fn(fields, context.Background(), &errs))
+	}
+
+	// Unset: the comments stay for backward compatibility.
+	if got := render(renderSingleRender, fields); got != "<!-- content_records_plugin no record id -->" {
+		t.Errorf("single without id = %q", got)
+	}
+	for name, fn := range map[string]func(Fields, context.Context, *[]error) any{"list": renderListRender, "single": renderSingleRender} {
+		if got := render(fn, broken); !strings.HasPrefix(got, "<!-- content_records_plugin") {
+			t.Errorf("%s failure = %q, want the comment", name, got)
+		}
+	}
+
+	fields.EmptyHTML = `<p class="empty">Nothing yet</p>`
+	fields.ErrorHTML = `<p class="error">Unavailable</p>`
+	broken.ErrorHTML = fields.ErrorHTML
+	if got := render(renderListRender, fields); got != fields.EmptyHTML {
+		t.Errorf("empty list = %q, want empty_html", got)
+	}
+	if got := render(renderSingleRender, fields); got != fields.EmptyHTML {
+		t.Errorf("single without id = %q, want empty_html", got)
+	}
+	for name, fn := range map[string]func(Fields, context.Context, *[]error) any{"list": renderListRender, "single": renderSingleRender} {
+		if got := render(fn, broken); got != fields.ErrorHTML {
+			t.Errorf("%s failure = %q, want error_html", name, got)
+		}
+	}
+}
+
+func TestMissingRecordNotFound(t *testing.T) {
+	fields := Fields{
+		Store:        filepath.Join(t.TempDir(), "missing.db"),
+		Inline:       true,
+		NotFoundHTML: "<p>This article no longer exists.</p>",
+		Template: map[string]interface{}{
+			"@name": "article",
+			"10":    map[string]interface{}{"@type": "<TEXT>", "@bind": map[string]interface{}{"field": "title", "path": "value"}},
+		},
+	}
+	var errs []error
+	template, binds, ok := loadTemplate(fields, &errs)
+	if !ok {
+		t.Fatal(errs)
+	}
+	db, err := openStore(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fetchRecordByID(db, 99, "article"); err != errRecordNotFound {
+		t.Fatalf("fetchRecordByID(99) = %v, want errRecordNotFound", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/articles", strings.NewReader(`{"cr_inline":"1","record_id":"99","bind":"title","value":"x"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	ctx := context.WithValue(context.Background(), shared.Request, req)
+	ctx = context.WithValue(ctx, shared.ResponseWriter, http.ResponseWriter(w))
+	handled, response := handleInlineUpdate(ctx, db, "article", binds, fields, template, &errs)
+	if !handled || w.Code != http.StatusNotFound || !strings.Contains(fmt.Sprint(response), "record not found") {
+		t.Errorf("inline update of a missing id: handled %v, status %d, response %v", handled, w.Code, response)
+	}
+
+	fields.Inline = false
+	fields.ID = 99
+	out := renderSingleRender(fields, context.Background(), &errs)
+	if out != fields.NotFoundHTML {
+		t.Errorf("render of a missing id = %v, want not_found_html", out)
+	}
+	if len(errs) > 0 {
+		t.Errorf("a missing record reported errors: %v", errs)
+	}
+}
+
+func TestImageAltTextRoundTrip(t *testing.T) {
+	fields := Fields{
+		Store: filepath.Join(t.TempDir(), "alt.db"),
+		Template: map[string]interface{}{
+			"@name": "article",
+			"10":    map[string]interface{}{"@type": "<TEXT>", "@bind": map[string]interface{}{"field": "title", "path": "value"}},
+			"20": map[string]interface{}{
+				"@type": "<IMAGE>",
+				"src":   "placeholder.jpg",
+				"@bind": map[string]interface{}{"field": "cover", "path": "src"},
+			},
+			"30": map[string]interface{}{"@type": "<TEXT>", "@bind": map[string]interface{}{"field": "cover_caption", "path": "value"}},
+		},
+		Schema: map[string]FieldDef{
+			"title": {Type: "text"},
+			"cover": {Type: "image", AltBind: "cover_alt", CaptionBind: "cover_caption"},
+		},
+	}
+	var errs []error
+	template, binds, ok := loadTemplate(fields, &errs)
+	if !ok {
+		t.Fatal(errs)
+	}
+	fieldDefs := collectCMSFields(fields, binds)
+
+	form := url.Values{
+		"title":         {"Harbour"},
+		"cover":         {"uploads/harbour.jpg"},
+		"cover_alt":     {"Boats moored in the harbour at dusk"},
+		"cover_caption": {"The old harbour"},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/cms", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if err := req.ParseForm(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.WithValue(context.Background(), shared.Request, req)
+	values := readFieldValuesFromContext(ctx, fieldDefs)
+
+	db, err := openStore(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := createRecord(db, "article", values, writeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := fetchRecordByID(db, id, "article")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Fields["cover_alt"] != "Boats moored in the harbour at dusk" {
+		t.Fatalf("stored alt = %q", rec.Fields["cover_alt"])
+	}
+
+	list := buildList(template, binds, []record{rec}, collectImageBinds(fields, binds), false, "", "", nil, resolveTreeKeys(fields), nil)
+	item := list["10"].(map[string]interface{})
+	image := item["20"].(map[string]interface{})
+	if image["src"] != "uploads/harbour.jpg" || image["alt"] != "Boats moored in the harbour at dusk" {
+		t.Errorf("image node = %v, want src and alt from the record", image)
+	}
+	if caption := item["30"].(map[string]interface{}); caption["value"] != "The old harbour" {
+		t.Errorf("caption node = %v", caption)
+	}
+
+	edit := buildEditValues(rec, fieldDefs, fields, nil)
+	cover := edit["fields"].(map[string]interface{})["cover"].(map[string]interface{})
+	if cover["alt_bind"] != "cover_alt" || cover["caption_bind"] != "cover_caption" {
+		t.Errorf("edit field = %v, want alt and caption binds for the form inputs", cover)
+	}
+}
+
+func TestEditRedirectAfterSave(t *testing.T) {
+	fields := Fields{
+		Store:     filepath.Join(t.TempDir(), "redirect.db"),
+		ListRoute: "/cms/articles",
+		Template: map[string]interface{}{
+			"@name": "article",
+			"10":    map[string]interface{}{"@type": "<TEXT>", "@bind": map[string]interface{}{"field": "title", "path": "value"}},
+		},
+		Schema: map[string]FieldDef{"title": {Type: "text"}},
+	}
+	db, err := openStore(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := createRecord(db, "article", map[string]string{"title": "Stored"}, writeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	save := func(fields Fields, title string, headers map[string]string) (any, *httptest.ResponseRecorder) {
+		t.Helper()
+		form := url.Values{"action": {"update"}, "record_id": {fmt.Sprint(id)}, "title": {title}}
+		req := httptest.NewRequest(http.MethodPost, "/cms/edit", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		w := httptest.NewRecorder()
+		ctx := context.WithValue(context.Background(), shared.Request, req)
+		ctx = context.WithValue(ctx, shared.ResponseWriter, http.ResponseWriter(w))
+		var errs []error
+		out := renderSingleEdit(fields, ctx, &errs)
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		return out, w
+	}
+
+	if out, w := save(fields, "Form post", nil); out != "" || w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/cms/articles" {
+		t.Errorf("form post: status %d, location %q", w.Code, w.Header().Get("Location"))
+	}
+	found := fields
+	found.RedirectStatus = http.StatusFound
+	if _, w := save(found, "Found", nil); w.Code != http.StatusFound {
+		t.Errorf("redirect_status 302: status %d", w.Code)
+	}
+
+	for _, headers := range []map[string]string{
+		{"X-Requested-With": "XMLHttpRequest"},
+		{"HX-Request": "true"},
+		{"Accept": "application/json"},
+	} {
+		out, w := save(fields, "Saved via AJAX", headers)
+		if w.Code != http.StatusOK || w.Header().Get("Location") != "" {
+			t.Errorf("%v: status %d, location %q; want the view without a redirect", headers, w.Code, w.Header().Get("Location"))
+			continue
+		}
+		tree, _ := out.(map[string]interface{})
+		edit, _ := tree["10"].(map[string]interface{})
+		values, _ := edit["values"].(map[string]interface{})
+		if !strings.Contains(fmt.Sprint(values), "Saved via AJAX") {
+			t.Errorf("%v: view does not show the saved record: %v", headers, out)
+		}
+	}
+
+	always, never := true, false
+	forced := fields
+	forced.Redirect = &always
+	if _, w := save(forced, "Forced", map[string]string{"HX-Request": "true"}); w.Code != http.StatusSeeOther {
+		t.Errorf("redirect = true on AJAX: status %d", w.Code)
+	}
+	inPlace := fields
+	inPlace.Redirect = &never
+	if _, w := save(inPlace, "In place", nil); w.Code != http.StatusOK {
+		t.Errorf("redirect = false: status %d", w.Code)
+	}
+	if values, _ := fetchRecordFields(db, id); values["title"] != "In place" {
+		t.Errorf("title = %q after the last save", values["title"])
+	}
+
+	inPlace.RedirectStatus = 200
+	if errs := validateConfig(inPlace); !strings.Contains(fmt.Sprint(errs), "redirect_status") {
+		t.Errorf("redirect_status 200 not reported: %v", errs)
+	}
+}
+
+func TestPreviewLeavesStoreUntouched(t *testing.T) {
+	store := filepath.Join(t.TempDir(), "preview.db")
+	fields := Fields{
+		Store: store,
+		Template: map[string]interface{}{
+			"@name": "article",
+			"10":    map[string]interface{}{"@type": "<TEXT>", "@bind": map[string]interface{}{"field": "title", "path": "value"}},
+			"20":    map[string]interface{}{"@type": "<TEXT>", "value": "Anonymous", "@bind": map[string]interface{}{"field": "author", "path": "value"}},
+		},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/preview", strings.NewReader("title=Draft&action=create"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	ctx := context.WithValue(context.Background(), shared.Request, req)
+	var errs []error
+	out, _ := renderPreview(fields, ctx, &errs).(map[string]interface{})
+	if out == nil || len(errs) > 0 {
+		t.Fatalf("preview: %v %v", out, errs)
+	}
+	item := out["10"].(map[string]interface{})
+	if got := item["10"].(map[string]interface{})["value"]; got != "Draft" {
+		t.Errorf("title = %v, want the posted Draft", got)
+	}
+	if got := item["20"].(map[string]interface{})["value"]; got != "Anonymous" {
+		t.Errorf("author = %v, want the template default", got)
+	}
+	if _, err := os.Stat(store); !os.IsNotExist(err) {
+		t.Errorf("preview opened the store: stat err = %v", err)
+	}
+}
+
+func TestEditPreviewShowsUnsavedValues(t *testing.T) {
+	fields := Fields{
+		Store: filepath.Join(t.TempDir(), "preview.db"),
+		Template: map[string]interface{}{
+			"@name": "article",
+			"10":    map[string]interface{}{"@type": "<TEXT>", "@bind": map[string]interface{}{"field": "title", "path": "value"}},
+			"20": map[string]interface{}{
+				"@type": "<IMAGE>",
+				"src":   "placeholder.jpg",
+				"@bind": map[string]interface{}{"field": "cover", "path": "src"},
+			},
+		},
+		Schema: map[string]FieldDef{
+			"title": {Type: "text"},
+			"cover": {Type: "image"},
+		},
+	}
+	db, err := openStore(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := createRecord(db, "article", map[string]string{"title": "Stored title", "cover": "uploads/stored.jpg"}, writeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The cover is posted empty, as when the file input is left blank.
+	form := url.Values{"action": {"preview"}, "record_id": {fmt.Sprint(id)}, "title": {"Draft title"}, "cover": {""}}
+	req := httptest.NewRequest(http.MethodPost, "/cms/edit", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	ctx := context.WithValue(context.Background(), shared.Request, req)
+	var errs []error
+	out := renderSingleEdit(fields, ctx, &errs)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	values := out.(map[string]interface{})["10"].(map[string]interface{})["values"].(map[string]interface{})
+	preview := fmt.Sprint(values["preview"])
+	if !strings.Contains(preview, "Draft title") || strings.Contains(preview, "Stored title") {
+		t.Errorf("preview = %s, want the unsaved title", preview)
+	}
+	if !strings.Contains(preview, "uploads/stored.jpg") {
+		t.Errorf("preview = %s, want the stored cover without a new upload", preview)
+	}
+
+	rec, err := fetchRecordByID(db, id, "article")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Fields["title"] != "Stored title" {
+		t.Errorf("preview saved the title: %q", rec.Fields["title"])
+	}
+}
+
+func TestQueryTimeout(t *testing.T) {
+	fields := Fields{Store: filepath.Join(t.TempDir(), "slow.db"), QueryTimeout: "50ms"}
+	db, err := openStore(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Counts to a billion before finding nothing.
+	slow := `WITH RECURSIVE n(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM n WHERE x < 1000000000)
+		SELECT x FROM n WHERE x = 0`
+
+	start := time.Now()
+	_, _, err = queryRecordIDs(db, slow, "", resolveQueryTimeout(fields))
+	if !errors.Is(err, errQueryTimeout) {
+		t.Fatalf("slow query: err = %v, want errQueryTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("slow query ran %v past a 50ms budget", elapsed)
+	}
+	if _, _, err := queryTable(db, slow, resolveQueryTimeout(fields)); !errors.Is(err, errQueryTimeout) {
+		t.Errorf("view table: err = %v, want errQueryTimeout", err)
+	}
+
+	// The built-in id fetch is not bounded.
+	if _, _, err := queryRecordIDs(db, "", "article", time.Nanosecond); err != nil {
+		t.Errorf("type id fetch: %v", err)
+	}
+}
+
+func TestExportColumnOrderIsStable(t *testing.T) {
+	fields := Fields{
+		Store:  filepath.Join(t.TempDir(), "order.db"),
+		Action: "export",
+		Template: map[string]interface{}{
+			"@name": "article",
+			"10":    map[string]interface{}{"@bind": map[string]interface{}{"field": "title", "path": "value"}},
+			"20":    map[string]interface{}{"@bind": map[string]interface{}{"field": "body", "path": "value"}},
+			"30":    map[string]interface{}{"@bind": map[string]interface{}{"field": "author", "path": "value"}},
+			"40":    map[string]interface{}{"@bind": map[string]interface{}{"field": "slug", "path": "value"}},
+		},
+		Schema: map[string]FieldDef{
+			"title": {Order: 1},
+			"body":  {Order: 2},
+		},
+	}
+	db, err := openStore(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 3; i++ {
+		values := map[string]string{"title": fmt.Sprintf("Post %d", i), "body": "text", "author": "Ann", "slug": fmt.Sprintf("post-%d", i)}
+		if _, err := createRecord(db, "article", values, writeOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	export := func(format string) string {
+		fields.ExportFormat = format
+		w := httptest.NewRecorder()
+		ctx := context.WithValue(context.Background(), shared.Request, httptest.NewRequest(http.MethodGet, "/export", nil))
+		ctx = context.WithValue(ctx, shared.ResponseWriter, http.ResponseWriter(w))
+		var errs []error
+		if out := renderExport(fields, ctx, &errs); out != "" || len(errs) > 0 {
+			t.Fatalf("renderExport = %v, errors %v", out, errs)
+		}
+		return w.Body.String()
+	}
+
+	for _, format := range []string{"csv", "json"} {
+		first := export(format)
+		for i := 0; i < 5; i++ {
+			if again := export(format); again != first {
+				t.Fatalf("%s exports differ:\n%s\n%s", format, first, again)
+			}
+		}
+	}
+	if header := strings.SplitN(export("csv"), "\n", 2)[0]; header != "id,created_at,updated_at,title,body,author,slug" {
+		t.Errorf("csv header = %q, want schema order then sorted binds", header)
+	}
+	if out := export("json"); !strings.Contains(out, `"fields":{"title":"Post 1","body":"text","author":"Ann","slug":"post-1"}`) {
+		t.Errorf("json export fields out of column order:\n%s", out)
+	}
+}
+
+func TestUploadURLPrefixStoresWebPath(t *testing.T) {
+	root := t.TempDir()
+	fields := Fields{
+		UploadDir:       filepath.Join(root, "public", "uploads"),
+		UploadURLPrefix: "/static/uploads/",
+	}
+	uploads := resolveUploadOptions(fields)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("cover", "Harbour at dusk.png")
+	part.Write([]byte("png"))
+	form.Close()
+	req := httptest.NewRequest(http.MethodPost, "/cms", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if err := req.ParseMultipartForm(1 << 20); err != nil {
+		t.Fatal(err)
+	}
+	value, err := saveUploadFile(req, "cover", uploads)
+	if err != nil {
+		t.Fatalf("saveUploadFile: %v", err)
+	}
+	if !strings.HasPrefix(value, "/static/uploads/Harbour-at-dusk-") || !strings.HasSuffix(value, ".png") {
+		t.Fatalf("stored value = %q, want a web path under /static/uploads/", value)
+	}
+
+	disk := uploads.diskPath(value)
+	if filepath.Dir(disk) != fields.UploadDir {
+		t.Errorf("disk path = %q, want a file in %q", disk, fields.UploadDir)
+	}
+	if data, err := os.ReadFile(disk); err != nil || string(data) != "png" {
+		t.Errorf("uploaded file = %q, %v", data, err)
+	}
+
+	// cleanup_files maps the web path back to the file.
+	if err := removeUploadedFile(uploads.diskPath(value), uploads.Dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(disk); !os.IsNotExist(err) {
+		t.Errorf("file not removed: %v", err)
+	}
+}
+
+func TestListFieldSplitJoin(t *testing.T) {
+	items := []string{"go", "a|b", `C:\tmp`, "sql"}
+	stored := joinListValue(append([]string{"  ", ""}, items...), "|")
+	if want := `go|a\|b|C:\\tmp|sql`; stored != want {
+		t.Errorf("joinListValue = %q, want %q", stored, want)
+	}
+	if got := splitListValue(stored, "|"); !reflect.DeepEqual(got, items) {
+		t.Errorf("splitListValue(%q) = %q, want %q", stored, got, items)
+	}
+	if got := splitListValue(" | ", "|"); len(got) != 0 || got == nil {
+		t.Errorf("blank list = %#v, want an empty list", got)
+	}
+
+	join := " · "
+	fields := Fields{
+		Template: map[string]interface{}{
+			"@name": "article",
+			"10": map[string]interface{}{
+				"@type": "<TREE>",
+				"tags":  []interface{}{map[string]interface{}{"@type": "<TEXT>", "value": "tag"}},
+				"@bind": map[string]interface{}{"field": "tags", "path": "tags.*.value"},
+			},
+			"20": map[string]interface{}{"@type": "<TEXT>", "@bind": map[string]interface{}{"field": "keywords", "path": "value"}},
+		},
+		Schema: map[string]FieldDef{
+			"tags":     {Type: "list", Separator: "|"},
+			"keywords": {Type: "list", Separator: "|", Join: &join},
+		},
+	}
+	var errs []error
+	template, binds, ok := loadTemplate(fields, &errs)
+	if !ok {
+		t.Fatal(errs)
+	}
+	rec := record{ID: 1, Fields: map[string]string{"tags": stored, "keywords": "seo|web"}}
+	list := buildList(template, binds, []record{rec}, nil, false, "", "", nil, resolveTreeKeys(fields), nil)
+	item := list["10"].(map[string]interface{})
+	var got []string
+	for _, node := range item["10"].(map[string]interface{})["tags"].([]interface{}) {
+		got = append(got, node.(map[string]interface{})["value"].(string))
+	}
+	if !reflect.DeepEqual(got, items) {
+		t.Errorf("tree items = %q, want %q", got, items)
+	}
+	if keywords := item["20"].(map[string]interface{})["value"]; keywords != "seo · web" {
+		t.Errorf("joined keywords = %q", keywords)
+	}
+
+	// The edit form posts one item per line and stores the separator form.
+	fieldDefs := collectCMSFields(fields, binds)
+	edit := buildEditValues(rec, fieldDefs, fields, nil)
+	lines := edit["fields"].(map[string]interface{})["tags"].(map[string]interface{})["lines"]
+	if lines != "go\na|b\nC:\\tmp\nsql" {
+		t.Errorf("edit lines = %q", lines)
+	}
+	form := url.Values{"tags": {"go\r\na|b\r\n\r\nC:\\tmp\r\nsql\r\n"}, "keywords": {""}}
+	req := httptest.NewRequest(http.MethodPost, "/cms", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if err := req.ParseForm(); err != nil {
+		t.Fatal(err)
+	}
+	values := readFieldValuesFromContext(context.WithValue(context.Background(), shared.Request, req), fieldDefs)
+	if values["tags"] != stored || values["keywords"] != "" {
+		t.Errorf("posted values = %q", values)
+	}
+}
+
+func TestPathHelpers(t *testing.T) {
+	newRoot := func() map[string]interface{} {
+		return map[string]interface{}{
+			"10": map[string]interface{}{
+				"value": "title",
+				"items": []interface{}{"a", map[string]interface{}{"value": "b"}},
+			},
+			"20": map[interface{}]interface{}{
+				10: map[interface{}]interface{}{"@type": "<TEXT>", "value": "nested"},
+			},
+		}
+	}
+
+	root := newRoot()
+	gets := []struct {
+		path string
+		want interface{}
+		ok   bool
+	}{
+		{"10.value", "title", true},
+		{" 10 . value ", "title", true},
+		{"10..value", "title", true},
+		{"10.items.0", "a", true},
+		{"10.items.1.value", "b", true},
+		{"10.items.2", nil, false},
+		{"10.items.-1", nil, false},
+		{"10.items.first", nil, false},
+		{"10.missing.value", nil, false},
+		{"10.value.more", nil, false},
+		{"20.10.value", "nested", true},
+		{"20.30", nil, false},
+	}
+	for _, tc := range gets {
+		got, ok := getAtPath(root, tc.path)
+		if ok != tc.ok || (ok && !reflect.DeepEqual(got, tc.want)) {
+			t.Errorf("getAtPath(%q) = %v, %v; want %v, %v", tc.path, got, ok, tc.want, tc.ok)
+		}
+	}
+	if got, ok := getAtPath(root, ""); !ok || !reflect.DeepEqual(got, root) {
+		t.Errorf("getAtPath(\"\") did not return the root")
+	}
+
+	for path, want := range map[string][2]string{
+		"10.20.value": {"10.20", "value"},
+		"value":       {"", "value"},
+		"10.value.":   {"10", "value"},
+		" . ":         {"", ""},
+	} {
+		if parent, last := splitPath(path); parent != want[0] || last != want[1] {
+			t.Errorf("splitPath(%q) = %q, %q; want %q, %q", path, parent, last, want[0], want[1])
+		}
+	}
+
+	sets := []struct {
+		path string
+		ok   bool
+	}{
+		{"10.value.", true},
+		{"10.items.1.value", true},
+		{"10.items.0", true},
+		{"20.10.value", true},
+		{"10.items.2", false},
+		{"10.missing.value", false},
+		{"", false},
+	}
+	for _, tc := range sets {
+		root := newRoot()
+		if ok := setAtPath(root, tc.path, "set"); ok != tc.ok {
+			t.Errorf("setAtPath(%q) = %v, want %v", tc.path, ok, tc.ok)
+			continue
+		}
+		if got, _ := getAtPath(root, tc.path); tc.ok && got != "set" {
+			t.Errorf("after setAtPath(%q) the value is %v", tc.path, got)
+		}
+	}
+	// The int key of an interface map is reused, not shadowed by "10".
+	root = newRoot()
+	setAtPath(root, "20.10", "replaced")
+	if inner := root["20"].(map[interface{}]interface{}); len(inner) != 1 || inner[10] != "replaced" {
+		t.Errorf("interface map after setAtPath = %v", inner)
+	}
+
+	// Interface maps are normalized in place, so writes to the node stick.
+	root = newRoot()
+	node := getNodeAtPath(root, "20.10")
+	if node == nil {
+		t.Fatal("getNodeAtPath(20.10) = nil")
+	}
+	node["value"] = "changed"
+	if got, _ := getAtPath(root, "20.10.value"); got != "changed" {
+		t.Errorf("write through getNodeAtPath lost, value = %v", got)
+	}
+	if getNodeAtPath(root, "10.value") != nil || getNodeAtPath(root, "10.missing") != nil {
+		t.Error("getNodeAtPath returned a map for a scalar or missing path")
+	}
+	if inline := findInlineNode(newRoot(), "20.10.value"); inline == nil || inline["@type"] != "<TEXT>" {
+		t.Errorf("findInlineNode(20.10.value) = %v", inline)
+	}
+
+	root = newRoot()
+	if !ensureMapPath(root, "30.attributes") {
+		t.Error("ensureMapPath did not create missing maps")
+	}
+	if _, ok := root["30"].(map[string]interface{})["attributes"].(map[string]interface{}); !ok {
+		t.Errorf("ensureMapPath created %v", root["30"])
+	}
+	if ensureMapPath(root, "10.value.attributes") {
+		t.Error("ensureMapPath replaced a scalar")
+	}
+	if ensureMapPath(root, "10.items.5") || len(root["10"].(map[string]interface{})["items"].([]interface{})) != 2 {
+		t.Error("ensureMapPath grew a slice")
+	}
+}
+
+func TestSoftDeleteToggleAndRestore(t *testing.T) {
+	fields := Fields{
+		Store:      filepath.Join(t.TempDir(), "trash.db"),
+		SoftDelete: true,
+		Template: map[string]interface{}{
+			"@name": "article",
+			"10":    map[string]interface{}{"@type": "<TEXT>", "@bind": map[string]interface{}{"field": "title", "path": "value"}},
+		},
+		Schema: map[string]FieldDef{"title": {Type: "text"}},
+	}
+	db, err := openStore(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keep, err := createRecord(db, "article", map[string]string{"title": "Kept"}, writeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	trash, err := createRecord(db, "article", map[string]string{"title": "Trashed"}, writeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(method string, target string, form url.Values) map[string]interface{} {
+		t.Helper()
+		req := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		var errs []error
+		out := renderListEdit(fields, context.WithValue(context.Background(), shared.Request, req), &errs)
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		return out.(map[string]interface{})["10"].(map[string]interface{})["values"].(map[string]interface{})
+	}
+	listed := func(values map[string]interface{}) map[string]bool {
+		deleted := map[string]bool{}
+		for id, rec := range values["records"].(map[string]interface{}) {
+			deleted[id] = rec.(map[string]interface{})["deleted"].(bool)
+		}
+		return deleted
+	}
+	keepID, trashID := fmt.Sprint(keep), fmt.Sprint(trash)
+
+	values := list(http.MethodPost, "/cms", url.Values{"action": {"delete"}, "record_id": {trashID}})
+	if got := listed(values); len(got) != 1 || got[trashID] {
+		t.Errorf("after delete the list shows %v, want only %s", got, keepID)
+	}
+	if rec, err := fetchRecordByID(db, trash, "article"); err != nil || rec.Fields["title"] != "Trashed" {
+		t.Fatalf("soft delete removed the record: %v, %v", rec, err)
+	}
+
+	values = list(http.MethodGet, "/cms?show_deleted=1", nil)
+	if got := listed(values); len(got) != 2 || !got[trashID] || got[keepID] {
+		t.Errorf("show_deleted=1 lists %v, want %s marked deleted", got, trashID)
+	}
+	if values["show_deleted"] != true {
+		t.Error("show_deleted not passed to the template")
+	}
+
+	list(http.MethodPost, "/cms?show_deleted=1", url.Values{"action": {"restore"}, "record_id": {trashID}})
+	if got := listed(list(http.MethodGet, "/cms", nil)); len(got) != 2 || got[trashID] {
+		t.Errorf("after restore the list shows %v", got)
+	}
+	if err := checkNotTrashed(db, trash); err != nil {
+		t.Errorf("restored record still trashed: %v", err)
+	}
+}
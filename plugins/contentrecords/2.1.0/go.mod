@@ -3,12 +3,16 @@ module github.com/hyperbricks/plugins/contentrecords
 go 1.23.4
 
 require (
+	github.com/go-sql-driver/mysql v1.8.1
 	github.com/hyperbricks/hyperbricks v0.8.0-alpha
 	github.com/mattn/go-sqlite3 v1.14.24
+	golang.org/x/net v0.33.0
+	golang.org/x/text v0.22.0
 )
 
 require (
 	dario.cat/mergo v1.0.1 // indirect
+	filippo.io/edwards25519 v1.1.0 // indirect
 	github.com/Masterminds/goutils v1.1.1 // indirect
 	github.com/Masterminds/semver/v3 v3.3.0 // indirect
 	github.com/Masterminds/sprig/v3 v3.3.0 // indirect
@@ -48,8 +52,6 @@ require (
 	go.uber.org/multierr v1.10.0 // indirect
 	go.uber.org/zap v1.27.0 // indirect
 	golang.org/x/crypto v0.33.0 // indirect
-	golang.org/x/net v0.33.0 // indirect
 	golang.org/x/sync v0.11.0 // indirect
 	golang.org/x/sys v0.31.0 // indirect
-	golang.org/x/text v0.22.0 // indirect
 )
@@ -1,21 +1,40 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha512"
+	"encoding/base64"
 	"encoding/json"
+	"expvar"
 	"fmt"
+	"io"
+	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/andybalholm/brotli"
 	"github.com/evanw/esbuild/pkg/api"
 	"github.com/hyperbricks/hyperbricks/pkg/logging"
 	"github.com/hyperbricks/hyperbricks/pkg/shared"
 )
 
 // ---- Cache Setup ----
-var esbuildCache sync.Map // key: cacheKey string, value: result string
+// Bundles are reused while every file the last build read (from esbuild's
+// metafile) and the outfile are unchanged.
+var esbuildArtifacts = newArtifactTracker()
+
+// metrics counts renders, builds, cache hits/misses and errors under the
+// expvar name "esbuild" (data.metrics).
+var metrics = newPluginMetrics("esbuild")
 
 // ---- Plugin Structs ----
 type Fields struct {
@@ -28,7 +47,23 @@ type Fields struct {
 	Mangle            bool   `mapstructure:"mangle"`
 	Sourcemap         bool   `mapstructure:"sourcemap"`
 	Debug             bool   `mapstructure:"debug"`
-	Cache             bool   `mapstructure:"cache"` // <-- Added field
+	Cache             bool   `mapstructure:"cache"`             // <-- Added field
+	Inline            *bool  `mapstructure:"inline"`            // true: <script>…</script>, false: <script src>; ignored with enclose
+	Manifest          string `mapstructure:"manifest"`          // JSON manifest to record the bundle's web path in (relative to static)
+	ManifestName      string `mapstructure:"manifest_name"`     // manifest key (default: outfile base name)
+	Metrics           bool   `mapstructure:"metrics"`           // count operations in the expvar map "esbuild"
+	Compress          string `mapstructure:"compress"`          // gzip | brotli | both: write outfile.gz / outfile.br next to the bundle
+	ValidateOnly      bool   `mapstructure:"validate_only"`     // check the config and report errors; no build, no files written
+	DirMode           string `mapstructure:"dir_mode"`          // octal permissions for created directories (default 0755)
+	FileMode          string `mapstructure:"file_mode"`         // octal permissions for written files (default 0644)
+	Tsconfig          string `mapstructure:"tsconfig"`          // tsconfig.json for paths/baseUrl (relative to resources)
+	AbsWorkingDir     string `mapstructure:"absworkingdir"`     // directory imports and node_modules resolve from
+	JSX               string `mapstructure:"jsx"`               // transform (default) | automatic | preserve
+	JSXFactory        string `mapstructure:"jsx_factory"`       // e.g. h (transform mode)
+	JSXFragment       string `mapstructure:"jsx_fragment"`      // e.g. Fragment (transform mode)
+	JSXImportSource   string `mapstructure:"jsx_import_source"` // e.g. preact (automatic mode)
+	Placeholder       string `mapstructure:"placeholder"`       // marker in enclose replaced by the web path (default "|"); {{js}} and {{css}} always work
+	Touch             bool   `mapstructure:"touch"`             // bump the outfile's mtime on a cache hit, for external watchers
 }
 
 type Config struct {
@@ -42,7 +77,7 @@ type EsbuildPlugin struct{}
 var _ shared.PluginRenderer = (*EsbuildPlugin)(nil)
 
 // ---- Render Implementation ----
-func (p *EsbuildPlugin) Render(instance interface{}, ctx context.Context) (any, []error) {
+func (p *EsbuildPlugin) Render(instance interface{}, ctx context.Context) (_ any, renderErrs []error) {
 	var decodeErrs []shared.ComponentError
 	var cfg Config
 
@@ -52,7 +87,7 @@ func (p *EsbuildPlugin) Render(instance interface{}, ctx context.Context) (any,
 			Path:     cfg.HyperBricksPath,
 			Key:      cfg.HyperBricksKey,
 			Rejected: true,
-			Err:      fmt.Sprintf("decode error: %v", err),
+			Err:      fmt.Sprintf("decode error: %s", describeDecodeError(err)),
 		})
 		errs := make([]error, len(decodeErrs))
 		for i, e := range decodeErrs {
@@ -61,6 +96,21 @@ func (p *EsbuildPlugin) Render(instance interface{}, ctx context.Context) (any,
 		return "", errs
 	}
 
+	if cfg.Fields.ValidateOnly {
+		return "", validateConfig(cfg, shared.GetHyperBricksConfiguration().Directories)
+	}
+
+	if cfg.Fields.Metrics {
+		metrics.enable()
+	}
+	metrics.add("renders", 1)
+	defer func() {
+		metrics.add("errors", int64(len(renderErrs)))
+		if cfg.Fields.Debug {
+			metrics.logSnapshot()
+		}
+	}()
+
 	log := logging.GetLogger()
 	bin := cfg.Fields.Binary
 	entry := cfg.Fields.Entry
@@ -72,21 +122,37 @@ func (p *EsbuildPlugin) Render(instance interface{}, ctx context.Context) (any,
 	sourcemap := cfg.Fields.Sourcemap
 	debug := cfg.Fields.Debug
 	cache := cfg.Fields.Cache // <-- Added field
+	inline := cfg.Fields.Inline
 
 	if entry == "" || out == "" {
 		return "", []error{configErr(cfg, "both entry and outfile must be set")}
 	}
+	compress, err := parseCompress(cfg.Fields.Compress)
+	if err != nil {
+		return "", []error{configErr(cfg, err.Error())}
+	}
+	modes, err := parseFileModes(cfg.Fields.DirMode, cfg.Fields.FileMode)
+	if err != nil {
+		return "", []error{configErr(cfg, err.Error())}
+	}
+	if _, err := parseJSXMode(cfg.Fields.JSX); err != nil {
+		return "", []error{configErr(cfg, err.Error())}
+	}
 
 	// ---- Caching logic ----
-	cacheKey := entry // You could hash more options here if desired
+	cacheKey := renderCacheKey(cfg.Fields, compress)
 	if cache {
-		if cached, ok := esbuildCache.Load(cacheKey); ok {
-			if str, ok := cached.(string); ok {
-				if debug {
-					log.Info("EsbuildPlugin cache hit for:", cacheKey)
+		if cached, ok := cachedResult(cacheKey); ok {
+			if debug {
+				log.Info("EsbuildPlugin cache hit for:", cacheKey)
+			}
+			if cfg.Fields.Touch {
+				// A live-reload watcher on the outfile still sees a change.
+				if err := esbuildArtifacts.Touch(cacheKey); err != nil {
+					return cached, []error{fmt.Errorf("esbuild touch error: %v", err)}
 				}
-				return str, nil // Return cached output
 			}
+			return cached, nil // Return cached output
 		}
 	}
 
@@ -110,23 +176,33 @@ func (p *EsbuildPlugin) Render(instance interface{}, ctx context.Context) (any,
 	entryPath := filepath.Join(resourcesDir, entry)
 	outPath := filepath.Join(staticDir, out)
 
-	if bin == "" {
-		buildOpts := api.BuildOptions{
-			EntryPoints:       []string{entryPath},
-			Bundle:            true,
-			Outfile:           outPath,
-			Write:             true,
-			Sourcemap:         api.SourceMapNone,
-			MinifyWhitespace:  minify,
-			MinifySyntax:      minify,
-			MinifyIdentifiers: minifyIdentifiers,
-		}
-		if sourcemap {
-			buildOpts.Sourcemap = api.SourceMapLinked
-		}
-		if mangle {
-			buildOpts.MangleProps = ".*"
+	tsconfig, err := resolveTsconfig(resourcesDir, cfg.Fields.Tsconfig)
+	if err != nil {
+		return "", []error{configErr(cfg, err.Error())}
+	}
+	workDir, err := resolveWorkingDir(cfg.Fields.AbsWorkingDir)
+	if err != nil {
+		return "", []error{configErr(cfg, err.Error())}
+	}
+	if workDir != "" {
+		// esbuild resolves relative paths against its working directory, so
+		// the plugin's own paths are pinned to the process directory first.
+		for _, path := range []*string{&entryPath, &outPath, &tsconfig} {
+			if *path != "" && !filepath.IsAbs(*path) {
+				if abs, err := filepath.Abs(*path); err == nil {
+					*path = abs
+				}
+			}
 		}
+	}
+
+	// Files the bundle was built from, read from esbuild's metafile.
+	var inputs []string
+	// Stylesheet esbuild emitted next to the bundle for imported CSS.
+	var cssPath string
+
+	if bin == "" {
+		buildOpts := apiBuildOptions(cfg.Fields, entryPath, outPath, tsconfig, workDir)
 		if debug {
 			optsJson, err := json.MarshalIndent(buildOpts, "", "  ")
 			if err != nil {
@@ -135,6 +211,7 @@ func (p *EsbuildPlugin) Render(instance interface{}, ctx context.Context) (any,
 				log.Info("Esbuild API options:\n" + string(optsJson))
 			}
 		}
+		metrics.add("builds", 1)
 		res := api.Build(buildOpts)
 		if len(res.Errors) > 0 {
 			var errs []error
@@ -143,8 +220,34 @@ func (p *EsbuildPlugin) Render(instance interface{}, ctx context.Context) (any,
 			}
 			return "", errs
 		}
+		written := make([]string, 0, len(res.OutputFiles))
+		for _, file := range res.OutputFiles {
+			if err := writeFileAtomic(file.Path, file.Contents, modes); err != nil {
+				return "", []error{fmt.Errorf("esbuild write error: %v", err)}
+			}
+			written = append(written, file.Path)
+		}
+		cssPath = cssOutput(written)
+		inputs = metafileInputs([]byte(res.Metafile), entryPath, workDir)
 	} else {
-		args := []string{"--bundle", "--outfile=" + outPath}
+		// The CLI builds into a scratch directory next to the output; the
+		// files are moved into place only once the build has succeeded.
+		if err := os.MkdirAll(filepath.Dir(outPath), modes.Dir); err != nil {
+			return "", []error{fmt.Errorf("esbuild CLI error: %v", err)}
+		}
+		stageDir, err := os.MkdirTemp(filepath.Dir(outPath), ".esbuild-")
+		if err != nil {
+			return "", []error{fmt.Errorf("esbuild CLI error: %v", err)}
+		}
+		defer os.RemoveAll(stageDir)
+
+		args := []string{"--bundle", "--outfile=" + filepath.Join(stageDir, filepath.Base(outPath))}
+		// The metafile goes next to the stage dir so it is not moved into static.
+		metaPath := stageDir + ".meta.json"
+		if cache {
+			args = append(args, "--metafile="+metaPath)
+			defer os.Remove(metaPath)
+		}
 		if minify {
 			args = append(args, "--minify")
 		}
@@ -157,15 +260,35 @@ func (p *EsbuildPlugin) Render(instance interface{}, ctx context.Context) (any,
 		if sourcemap {
 			args = append(args, "--sourcemap")
 		}
+		if tsconfig != "" {
+			args = append(args, "--tsconfig="+tsconfig)
+		}
+		args = append(args, jsxCLIArgs(cfg.Fields)...)
 		args = append(args, entryPath)
 
 		if debug {
 			log.Info("Running esbuild CLI:", bin, args)
 		}
+		metrics.add("builds", 1)
 		cmd := exec.CommandContext(ctx, bin, args...)
+		cmd.Dir = workDir
 		if err := cmd.Run(); err != nil {
 			return "", []error{fmt.Errorf("esbuild CLI error: %v", err)}
 		}
+		moved, err := moveStagedFiles(stageDir, filepath.Dir(outPath), modes.File)
+		if err != nil {
+			return "", []error{fmt.Errorf("esbuild write error: %v", err)}
+		}
+		cssPath = cssOutput(moved)
+		if cache {
+			meta, _ := os.ReadFile(metaPath)
+			inputs = metafileInputs(meta, entryPath, workDir)
+		}
+	}
+
+	// The metafile does not list the tsconfig, but editing it changes the build.
+	if tsconfig != "" && len(inputs) > 0 {
+		inputs = append(inputs, tsconfig)
 	}
 
 	// Compute the static web path (relative to the "static/" dir)
@@ -178,29 +301,820 @@ func (p *EsbuildPlugin) Render(instance interface{}, ctx context.Context) (any,
 		// fallback: just outfile
 		webPath = "static/" + filepath.ToSlash(out)
 	}
+	var cssWebPath string
+	if cssPath != "" {
+		cssWebPath = path.Join(path.Dir(webPath), filepath.Base(cssPath))
+		if debug {
+			log.Info("EsbuildPlugin CSS output:", cssWebPath)
+		}
+	}
+
+	if manifest := strings.TrimSpace(cfg.Fields.Manifest); manifest != "" {
+		if !filepath.IsAbs(manifest) {
+			manifest = filepath.Join(staticDir, manifest)
+		}
+		name := strings.TrimSpace(cfg.Fields.ManifestName)
+		if name == "" {
+			name = filepath.Base(out)
+		}
+		if err := updateManifest(manifest, name, webPath, modes); err != nil {
+			return "", []error{fmt.Errorf("esbuild manifest error: %v", err)}
+		}
+		if cssWebPath != "" {
+			cssName := strings.TrimSuffix(name, filepath.Ext(name)) + ".css"
+			if err := updateManifest(manifest, cssName, cssWebPath, modes); err != nil {
+				return "", []error{fmt.Errorf("esbuild manifest error: %v", err)}
+			}
+		}
+		if debug {
+			log.Info("EsbuildPlugin manifest entry:", manifest, name, webPath)
+		}
+	}
+
+	// Compressed siblings are a convenience for the static server: a failure
+	// is reported, but the bundle and its result are still returned.
+	var compressErrs []error
+	if len(compress) > 0 {
+		for _, file := range []string{outPath, cssPath} {
+			if file == "" {
+				continue
+			}
+			data, err := os.ReadFile(file)
+			if err == nil {
+				compressErrs = append(compressErrs, writeCompressed(file, data, compress, modes)...)
+			} else {
+				compressErrs = append(compressErrs, err)
+			}
+		}
+		for i, err := range compressErrs {
+			compressErrs[i] = fmt.Errorf("esbuild compress error: %v", err)
+		}
+	}
 
 	var result string
-	if enclose != "" {
-		result = shared.EncloseContent(enclose, webPath)
-	} else {
+	switch {
+	case enclose != "":
+		result = encloseResult(enclose, cfg.Fields.Placeholder, webPath, cssWebPath)
+	case inline != nil:
+		js, err := os.ReadFile(outPath)
+		if err != nil {
+			return "", []error{fmt.Errorf("esbuild read error: %v", err)}
+		}
+		var css []byte
+		if cssPath != "" {
+			if css, err = os.ReadFile(cssPath); err != nil {
+				return "", []error{fmt.Errorf("esbuild read error: %v", err)}
+			}
+		}
+		if *inline {
+			if css != nil {
+				result = "<style>" + strings.ReplaceAll(string(css), "</style", `<\/style`) + "</style>"
+			}
+			// Keep a "</script" inside the bundle from closing the tag early.
+			result += "<script>" + strings.ReplaceAll(string(js), "</script", `<\/script`) + "</script>"
+		} else {
+			if css != nil {
+				result = fmt.Sprintf(`<link rel="stylesheet" href="%s" integrity="%s">`, cssWebPath, sriHash(css))
+			}
+			result += fmt.Sprintf(`<script src="%s" integrity="%s" defer></script>`, webPath, sriHash(js))
+		}
+	default:
 		result = webPath
 	}
 
 	// ---- Save to cache if enabled ----
-	if cache {
-		esbuildCache.Store(cacheKey, result)
+	// A failed compression is retried by the next render instead of cached.
+	if cache && len(compressErrs) == 0 {
+		esbuildArtifacts.Record(cacheKey, inputs, outPath, result)
 		if debug {
 			log.Info("EsbuildPlugin cache save for:", cacheKey)
 		}
 	}
 
-	return result, nil
+	return result, compressErrs
+}
+
+// renderCacheKey identifies a render's output: the entry plus every option
+// that changes the bundle or the returned markup.
+func renderCacheKey(f Fields, compress []string) string {
+	key := f.Entry
+	if f.Inline != nil {
+		key = fmt.Sprintf("%s|inline=%v", f.Entry, *f.Inline)
+	}
+	if len(compress) > 0 {
+		key += "|compress=" + strings.Join(compress, ",")
+	}
+	if f.Tsconfig != "" || f.AbsWorkingDir != "" {
+		key += "|tsconfig=" + f.Tsconfig + "|workdir=" + f.AbsWorkingDir
+	}
+	if f.JSX != "" || f.JSXFactory != "" || f.JSXFragment != "" || f.JSXImportSource != "" {
+		key += "|jsx=" + f.JSX + "|jsx_factory=" + f.JSXFactory + "|jsx_fragment=" + f.JSXFragment + "|jsx_import_source=" + f.JSXImportSource
+	}
+	if f.Enclose != "" {
+		key += "|enclose=" + f.Enclose + "|placeholder=" + f.Placeholder
+	}
+	return key
+}
+
+// cachedResult returns the cached output for key while it is still current,
+// counting the lookup as a cache hit or miss.
+func cachedResult(key string) (string, bool) {
+	cached, ok := esbuildArtifacts.Current(key)
+	if ok {
+		metrics.add("cache_hits", 1)
+	} else {
+		metrics.add("cache_misses", 1)
+	}
+	return cached, ok
+}
+
+// metricsLogInterval is the minimum time between two counter snapshots in
+// the debug log.
+const metricsLogInterval = time.Minute
+
+// pluginMetrics counts plugin operations in an expvar map, served on
+// /debug/vars when the host mounts expvar's handler. Counting starts once a
+// config sets data.metrics; until then add returns after one atomic load.
+type pluginMetrics struct {
+	name    string
+	enabled atomic.Bool
+	once    sync.Once
+	vars    *expvar.Map
+	lastLog atomic.Int64 // unix nanoseconds of the last debug snapshot
+}
+
+func newPluginMetrics(name string) *pluginMetrics {
+	return &pluginMetrics{name: name}
+}
+
+// enable publishes the expvar map on first use. A map of the same name that
+// is already published, e.g. by another version of the plugin, is shared.
+func (m *pluginMetrics) enable() {
+	m.once.Do(func() {
+		m.vars = publishMap(m.name)
+		m.enabled.Store(true)
+	})
+}
+
+// publishMap returns the expvar map published as name, publishing one if
+// there is none. expvar.NewMap panics when name is taken: by another plugin
+// copy publishing between the Get and the NewMap, whose map is then shared,
+// or by a var that is not a map, in which case the counters stay unpublished.
+func publishMap(name string) (vars *expvar.Map) {
+	if existing, ok := expvar.Get(name).(*expvar.Map); ok {
+		return existing
+	}
+	defer func() {
+		if recover() == nil {
+			return
+		}
+		if existing, ok := expvar.Get(name).(*expvar.Map); ok {
+			vars = existing
+		} else {
+			vars = new(expvar.Map)
+		}
+	}()
+	return expvar.NewMap(name)
+}
+
+// add increments counter by delta while metrics are enabled.
+func (m *pluginMetrics) add(counter string, delta int64) {
+	if delta == 0 || !m.enabled.Load() {
+		return
+	}
+	m.vars.Add(counter, delta)
+}
+
+// value returns counter, or 0 while metrics are disabled.
+func (m *pluginMetrics) value(counter string) int64 {
+	if !m.enabled.Load() {
+		return 0
+	}
+	if v, ok := m.vars.Get(counter).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+// logSnapshot writes every counter to the shared logger, at most once per
+// metricsLogInterval.
+func (m *pluginMetrics) logSnapshot() {
+	if !m.enabled.Load() {
+		return
+	}
+	now := time.Now().UnixNano()
+	last := m.lastLog.Load()
+	if now-last < int64(metricsLogInterval) || !m.lastLog.CompareAndSwap(last, now) {
+		return
+	}
+	var keysAndValues []interface{}
+	m.vars.Do(func(kv expvar.KeyValue) {
+		keysAndValues = append(keysAndValues, kv.Key, kv.Value.String())
+	})
+	logging.GetLogger().Infow(m.name+" metrics", keysAndValues...)
+}
+
+// decodeErrorPatterns rewrite mapstructure's type mismatch messages into
+// "<field>: expected <type>, got <type>" so the offending data.* key is clear.
+var decodeErrorPatterns = []struct {
+	re     *regexp.Regexp
+	format func(m []string) string
+}{
+	{regexp.MustCompile(`^'([^']*)' expected type '([^']*)', got unconvertible type '([^']*)', value: '(.*)'$`), func(m []string) string {
+		return fmt.Sprintf("%s: expected %s, got %s %q", m[1], friendlyType(m[2]), friendlyType(m[3]), m[4])
+	}},
+	{regexp.MustCompile(`^'([^']*)' expected type '([^']*)', got '([^']*)'$`), func(m []string) string {
+		return fmt.Sprintf("%s: expected %s, got %s", m[1], friendlyType(m[2]), friendlyType(m[3]))
+	}},
+	{regexp.MustCompile(`^'([^']*)':? source data must be an array or slice, got (\S+)$`), func(m []string) string {
+		return fmt.Sprintf("%s: expected a list, got %s", m[1], friendlyType(m[2]))
+	}},
+	{regexp.MustCompile(`^'([^']*)' expected a map, got '([^']*)'$`), func(m []string) string {
+		return fmt.Sprintf("%s: expected a map, got %s", m[1], friendlyType(m[2]))
+	}},
+	{regexp.MustCompile(`^cannot parse '([^']*)' as (\w+): (.*)$`), func(m []string) string {
+		return fmt.Sprintf("%s: expected %s (%s)", m[1], friendlyType(m[2]), m[3])
+	}},
+}
+
+// describeDecodeError lists every field-level failure in the errors
+// shared.DecodeWithBasicHooks returned, rewritten by decodeErrorPatterns
+// where the message is recognised.
+func describeDecodeError(errs []error) string {
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, decodeMessages(err)...)
+	}
+	for i, msg := range messages {
+		for _, pattern := range decodeErrorPatterns {
+			if m := pattern.re.FindStringSubmatch(msg); m != nil {
+				messages[i] = pattern.format(m)
+				break
+			}
+		}
+	}
+	return strings.Join(messages, "; ")
+}
+
+// decodeMessages splits one decode error into its field-level messages. The
+// host keeps only the text of a *mapstructure.Error in its ComponentError
+// ("N error(s) decoding:\n\n* msg\n* msg"), so that form is split as well.
+func decodeMessages(err error) []string {
+	var messages []string
+	switch wrapped := err.(type) {
+	case interface{ WrappedErrors() []error }: // *mapstructure.Error
+		for _, e := range wrapped.WrappedErrors() {
+			messages = append(messages, decodeMessages(e)...)
+		}
+		return messages
+	case interface{ Unwrap() []error }:
+		for _, e := range wrapped.Unwrap() {
+			messages = append(messages, decodeMessages(e)...)
+		}
+		return messages
+	}
+	text := err.Error()
+	_, list, ok := strings.Cut(text, "decoding:\n\n")
+	if !ok {
+		return []string{text}
+	}
+	for _, line := range strings.Split(list, "\n") {
+		if line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "* ")); line != "" {
+			messages = append(messages, line)
+		}
+	}
+	return messages
+}
+
+// friendlyType names Go kinds the way config authors think of them.
+func friendlyType(goType string) string {
+	goType = strings.TrimPrefix(goType, "*")
+	switch {
+	case strings.HasPrefix(goType, "[]"), goType == "slice", goType == "array":
+		return "list"
+	case strings.HasPrefix(goType, "map"):
+		return "map"
+	case strings.HasPrefix(goType, "int"), strings.HasPrefix(goType, "uint"):
+		return "integer"
+	case strings.HasPrefix(goType, "float"):
+		return "number"
+	}
+	return goType
+}
+
+// Markers in data.enclose for the bundle's and its stylesheet's web paths.
+const (
+	jsMarker  = "{{js}}"
+	cssMarker = "{{css}}"
+)
+
+// encloseResult fills in data.enclose with the bundle's web path. The default
+// "|" marker keeps shared.EncloseContent's prefix|suffix split; a custom
+// data.placeholder is replaced literally, so pipes in the markup survive.
+// An enclose with {{js}} or {{css}} is filled in literally as well; {{css}}
+// is empty when the entry imports no CSS.
+func encloseResult(enclose, placeholder, webPath, cssWebPath string) string {
+	if strings.Contains(enclose, jsMarker) || strings.Contains(enclose, cssMarker) {
+		pairs := []string{jsMarker, webPath, cssMarker, cssWebPath}
+		if placeholder != "" && placeholder != "|" {
+			pairs = append(pairs, placeholder, webPath)
+		}
+		return strings.NewReplacer(pairs...).Replace(enclose)
+	}
+	if placeholder == "" || placeholder == "|" {
+		return shared.EncloseContent(enclose, webPath)
+	}
+	return strings.ReplaceAll(enclose, placeholder, webPath)
+}
+
+// cssOutput returns the stylesheet among a build's written files: esbuild
+// emits one next to the bundle (outfile with a .css extension) when the entry
+// imports CSS. It returns "" when there is none.
+func cssOutput(files []string) string {
+	for _, file := range files {
+		if strings.EqualFold(filepath.Ext(file), ".css") {
+			return file
+		}
+	}
+	return ""
+}
+
+// sriHash returns the Subresource Integrity value for data.
+func sriHash(data []byte) string {
+	sum := sha512.Sum384(data)
+	return "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// Manifest writers take a lock file next to the manifest, so builds from
+// both asset plugins (and several processes) never interleave their writes.
+const (
+	manifestLockTimeout = 10 * time.Second
+	manifestLockStale   = 30 * time.Second
+)
+
+// updateManifest merges name → webPath into the JSON manifest at path.
+func updateManifest(path, name, webPath string, modes fileModes) error {
+	unlock, err := lockManifest(path, modes.Dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	entries := map[string]string{}
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil && len(bytes.TrimSpace(data)) > 0:
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return fmt.Errorf("parse %s: %v", path, err)
+		}
+	case err != nil && !os.IsNotExist(err):
+		return err
+	}
+	if current, ok := entries[name]; ok && current == webPath {
+		return nil
+	}
+	entries[name] = webPath
+	data, err = json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(data, '\n'), modes)
+}
+
+// lockManifest creates path.lock exclusively, waiting for other writers. A
+// lock older than manifestLockStale was left by a crashed build and is taken
+// over.
+func lockManifest(path string, dirMode os.FileMode) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(path), dirMode); err != nil {
+		return nil, err
+	}
+	lock := path + ".lock"
+	deadline := time.Now().Add(manifestLockTimeout)
+	for {
+		f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lock) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if info, err := os.Stat(lock); err == nil && time.Since(info.ModTime()) > manifestLockStale {
+			os.Remove(lock)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for %s", lock)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// metafileInputs lists the input files recorded in an esbuild metafile,
+// falling back to just the entry point when the metafile is unreadable.
+// Metafile paths are relative to workDir when one is set.
+func metafileInputs(meta []byte, entryPath, workDir string) []string {
+	var parsed struct {
+		Inputs map[string]json.RawMessage `json:"inputs"`
+	}
+	if err := json.Unmarshal(meta, &parsed); err != nil || len(parsed.Inputs) == 0 {
+		return []string{entryPath}
+	}
+	inputs := make([]string, 0, len(parsed.Inputs))
+	for path := range parsed.Inputs {
+		if workDir != "" && !filepath.IsAbs(path) {
+			path = filepath.Join(workDir, path)
+		}
+		inputs = append(inputs, path)
+	}
+	return inputs
+}
+
+// fileModes are the permissions for created directories and written files
+// (data.dir_mode, data.file_mode). Directory modes are subject to the umask.
+type fileModes struct {
+	Dir  os.FileMode
+	File os.FileMode
+}
+
+var defaultFileModes = fileModes{Dir: 0o755, File: 0o644}
+
+// parseFileModes reads data.dir_mode and data.file_mode as octal ("0750",
+// "750" or "0o750"); empty values keep the defaults.
+func parseFileModes(dirMode, fileMode string) (fileModes, error) {
+	modes := defaultFileModes
+	for _, option := range []struct {
+		key, value string
+		mode       *os.FileMode
+	}{{"dir_mode", dirMode, &modes.Dir}, {"file_mode", fileMode, &modes.File}} {
+		value := strings.TrimPrefix(strings.TrimSpace(option.value), "0o")
+		if value == "" {
+			continue
+		}
+		n, err := strconv.ParseUint(value, 8, 32)
+		if err != nil || n > 0o777 {
+			return modes, fmt.Errorf("%s: expected octal permissions such as 0755, got %q", option.key, option.value)
+		}
+		*option.mode = os.FileMode(n)
+	}
+	return modes, nil
+}
+
+// writeFileAtomic writes data to a temp file in path's directory and renames
+// it over path, so readers never see a partially written file. Missing
+// parent directories are created.
+func writeFileAtomic(path string, data []byte, modes fileModes) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, modes.Dir); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Chmod(tmpName, modes.File); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return nil
+}
+
+// compressExtensions maps data.compress encodings to the sibling file
+// extension they produce.
+var compressExtensions = map[string]string{"gzip": ".gz", "brotli": ".br"}
+
+// parseCompress reads data.compress: gzip, brotli, both, or a comma list.
+// It returns the sibling extensions to write, gzip first.
+func parseCompress(value string) ([]string, error) {
+	want := map[string]bool{}
+	for _, part := range strings.Split(strings.ToLower(value), ",") {
+		switch part = strings.TrimSpace(part); part {
+		case "", "none":
+		case "both":
+			want["gzip"], want["brotli"] = true, true
+		case "gzip", "brotli":
+			want[part] = true
+		default:
+			return nil, fmt.Errorf("unsupported compress %q (expected gzip, brotli or both)", part)
+		}
+	}
+	var exts []string
+	for _, encoding := range []string{"gzip", "brotli"} {
+		if want[encoding] {
+			exts = append(exts, compressExtensions[encoding])
+		}
+	}
+	return exts, nil
+}
+
+// writeCompressed writes pre-compressed siblings of path (path.gz, path.br)
+// for a static server that negotiates Content-Encoding. Each sibling is
+// replaced atomically; one that can't be written is removed so a stale copy
+// never outlives the output it was made from.
+func writeCompressed(path string, data []byte, exts []string, modes fileModes) []error {
+	var errs []error
+	for _, ext := range exts {
+		var buf bytes.Buffer
+		var w io.WriteCloser
+		if ext == ".br" {
+			w = brotli.NewWriterLevel(&buf, brotli.BestCompression)
+		} else {
+			w, _ = gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		}
+		_, err := w.Write(data)
+		if closeErr := w.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = writeFileAtomic(path+ext, buf.Bytes(), modes)
+		}
+		if err != nil {
+			os.Remove(path + ext)
+			errs = append(errs, fmt.Errorf("%s: %v", path+ext, err))
+		}
+	}
+	return errs
+}
+
+// moveStagedFiles renames every file the CLI wrote into stageDir (the bundle,
+// its source map and stylesheet) into dir and returns their new paths. Both
+// are on the same filesystem, so each rename is atomic.
+func moveStagedFiles(stageDir, dir string, fileMode os.FileMode) ([]string, error) {
+	entries, err := os.ReadDir(stageDir)
+	if err != nil {
+		return nil, err
+	}
+	var moved []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if err := os.Chmod(filepath.Join(stageDir, entry.Name()), fileMode); err != nil {
+			return moved, err
+		}
+		if err := os.Rename(filepath.Join(stageDir, entry.Name()), filepath.Join(dir, entry.Name())); err != nil {
+			return moved, err
+		}
+		moved = append(moved, filepath.Join(dir, entry.Name()))
+	}
+	return moved, nil
+}
+
+// artifactStamp identifies the state of a file by size and modification
+// time; a missing file has the zero stamp.
+type artifactStamp struct {
+	Size    int64
+	ModTime time.Time
+}
+
+func stampFile(path string) artifactStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return artifactStamp{}
+	}
+	return artifactStamp{Size: info.Size(), ModTime: info.ModTime()}
+}
+
+// artifactRecord is what one build read and produced.
+type artifactRecord struct {
+	inputs map[string]artifactStamp
+	output string
+	stamp  artifactStamp
+	result string
+}
+
+// artifactTracker remembers, per cache key, the input files a build read and
+// the output file it produced, so a later render can cheaply ask whether the
+// output is still current instead of rebuilding.
+type artifactTracker struct {
+	mu      sync.Mutex
+	records map[string]artifactRecord
+}
+
+func newArtifactTracker() *artifactTracker {
+	return &artifactTracker{records: map[string]artifactRecord{}}
+}
+
+// Record stamps inputs and output after a successful build and stores the
+// rendered result under key.
+func (t *artifactTracker) Record(key string, inputs []string, output, result string) {
+	record := artifactRecord{
+		inputs: make(map[string]artifactStamp, len(inputs)),
+		output: output,
+		stamp:  stampFile(output),
+		result: result,
+	}
+	for _, input := range inputs {
+		record.inputs[input] = stampFile(input)
+	}
+	t.mu.Lock()
+	t.records[key] = record
+	t.mu.Unlock()
+}
+
+// Current returns the result recorded under key when the output and every
+// input still match their recorded stamps.
+func (t *artifactTracker) Current(key string) (string, bool) {
+	t.mu.Lock()
+	record, ok := t.records[key]
+	t.mu.Unlock()
+	if !ok || record.stamp == (artifactStamp{}) || stampFile(record.output) != record.stamp {
+		return "", false
+	}
+	for input, stamp := range record.inputs {
+		if stampFile(input) != stamp {
+			return "", false
+		}
+	}
+	return record.result, true
+}
+
+// Touch sets the modification time of the output recorded under key to now
+// and restamps it, so the touched output still counts as current.
+func (t *artifactTracker) Touch(key string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	record, ok := t.records[key]
+	if !ok {
+		return nil
+	}
+	now := time.Now()
+	if err := os.Chtimes(record.output, now, now); err != nil {
+		return err
+	}
+	record.stamp = stampFile(record.output)
+	t.records[key] = record
+	return nil
 }
 
 func Plugin() (shared.PluginRenderer, error) {
 	return &EsbuildPlugin{}, nil
 }
 
+// validateConfig is data.validate_only: it reports what a build would
+// reject without running esbuild or touching the output directory. dirs are
+// the host's configured directories (hbConfig.Directories).
+func validateConfig(cfg Config, dirs map[string]string) []error {
+	var errs []error
+	if cfg.Fields.Entry == "" || cfg.Fields.Outfile == "" {
+		errs = append(errs, configErr(cfg, "both entry and outfile must be set"))
+	}
+	if _, err := parseCompress(cfg.Fields.Compress); err != nil {
+		errs = append(errs, configErr(cfg, err.Error()))
+	}
+	if _, err := parseFileModes(cfg.Fields.DirMode, cfg.Fields.FileMode); err != nil {
+		errs = append(errs, configErr(cfg, err.Error()))
+	}
+	if _, err := parseJSXMode(cfg.Fields.JSX); err != nil {
+		errs = append(errs, configErr(cfg, err.Error()))
+	}
+	if bin := cfg.Fields.Binary; bin != "" {
+		if _, err := exec.LookPath(bin); err != nil {
+			errs = append(errs, configErr(cfg, fmt.Sprintf("esbuild binary not found: %v", err)))
+		}
+	}
+	resourcesDir, okRes := dirs["resources"]
+	_, okStat := dirs["static"]
+	if !okRes || !okStat {
+		return append(errs, configErr(cfg, "Could not find 'resources' or 'static' directories in hbConfig.Directories"))
+	}
+	if cfg.Fields.Entry != "" {
+		if _, err := os.Stat(filepath.Join(resourcesDir, cfg.Fields.Entry)); err != nil {
+			errs = append(errs, configErr(cfg, fmt.Sprintf("entry not found: %v", err)))
+		}
+	}
+	if _, err := resolveTsconfig(resourcesDir, cfg.Fields.Tsconfig); err != nil {
+		errs = append(errs, configErr(cfg, err.Error()))
+	}
+	if _, err := resolveWorkingDir(cfg.Fields.AbsWorkingDir); err != nil {
+		errs = append(errs, configErr(cfg, err.Error()))
+	}
+	return errs
+}
+
+// apiBuildOptions maps the plugin fields onto esbuild's BuildOptions for an
+// in-process build. tsconfig and workDir are already resolved; empty leaves
+// esbuild's defaults (nearest tsconfig.json, the process directory).
+func apiBuildOptions(f Fields, entryPath, outPath, tsconfig, workDir string) api.BuildOptions {
+	opts := api.BuildOptions{
+		EntryPoints:       []string{entryPath},
+		Bundle:            true,
+		Outfile:           outPath,
+		Write:             false, // written atomically by Render
+		Metafile:          f.Cache,
+		Sourcemap:         api.SourceMapNone,
+		MinifyWhitespace:  f.Minify,
+		MinifySyntax:      f.Minify,
+		MinifyIdentifiers: f.MinifyIdentifiers,
+		Tsconfig:          tsconfig,
+		AbsWorkingDir:     workDir,
+		JSXFactory:        f.JSXFactory,
+		JSXFragment:       f.JSXFragment,
+		JSXImportSource:   f.JSXImportSource,
+	}
+	opts.JSX, _ = parseJSXMode(f.JSX) // validated by Render
+	if f.Sourcemap {
+		opts.Sourcemap = api.SourceMapLinked
+	}
+	if f.Mangle {
+		opts.MangleProps = ".*"
+	}
+	return opts
+}
+
+// jsxModes are esbuild's JSX modes by their data.jsx / --jsx= name.
+var jsxModes = map[string]api.JSX{
+	"transform": api.JSXTransform,
+	"automatic": api.JSXAutomatic,
+	"preserve":  api.JSXPreserve,
+}
+
+// parseJSXMode reads data.jsx; empty keeps esbuild's default (transform).
+func parseJSXMode(value string) (api.JSX, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return api.JSXTransform, nil
+	}
+	mode, ok := jsxModes[value]
+	if !ok {
+		return api.JSXTransform, fmt.Errorf("unsupported jsx %q (expected transform, automatic or preserve)", value)
+	}
+	return mode, nil
+}
+
+// jsxCLIArgs are the CLI flags for the data.jsx* fields that are set.
+func jsxCLIArgs(f Fields) []string {
+	var args []string
+	if mode := strings.ToLower(strings.TrimSpace(f.JSX)); mode != "" {
+		args = append(args, "--jsx="+mode)
+	}
+	if f.JSXFactory != "" {
+		args = append(args, "--jsx-factory="+f.JSXFactory)
+	}
+	if f.JSXFragment != "" {
+		args = append(args, "--jsx-fragment="+f.JSXFragment)
+	}
+	if f.JSXImportSource != "" {
+		args = append(args, "--jsx-import-source="+f.JSXImportSource)
+	}
+	return args
+}
+
+// resolveTsconfig returns data.tsconfig joined to the resources directory
+// when relative. A missing file is reported before esbuild runs.
+func resolveTsconfig(resourcesDir, tsconfig string) (string, error) {
+	tsconfig = strings.TrimSpace(tsconfig)
+	if tsconfig == "" {
+		return "", nil
+	}
+	if !filepath.IsAbs(tsconfig) {
+		tsconfig = filepath.Join(resourcesDir, tsconfig)
+	}
+	info, err := os.Stat(tsconfig)
+	if err != nil {
+		return "", fmt.Errorf("tsconfig not found: %v", err)
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("tsconfig %s is a directory", tsconfig)
+	}
+	return tsconfig, nil
+}
+
+// resolveWorkingDir returns data.absworkingdir as an absolute path; esbuild
+// rejects a relative one. A relative value is taken from the process directory.
+func resolveWorkingDir(dir string) (string, error) {
+	dir = strings.TrimSpace(dir)
+	if dir == "" {
+		return "", nil
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("absworkingdir: %v", err)
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return "", fmt.Errorf("absworkingdir not found: %v", err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("absworkingdir %s is not a directory", abs)
+	}
+	return abs, nil
+}
+
 func configErr(cfg Config, msg string) shared.ComponentError {
 	return shared.ComponentError{
 		Hash:     shared.GenerateHash(),
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"expvar"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+func TestArtifactTrackerFreshness(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input")
+	output := filepath.Join(dir, "output")
+	if err := os.WriteFile(input, []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(output, []byte("built"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tracker := newArtifactTracker()
+	if _, ok := tracker.Current("k"); ok {
+		t.Fatal("unrecorded key reported current")
+	}
+	tracker.Record("k", []string{input}, output, "result")
+	if got, ok := tracker.Current("k"); !ok || got != "result" {
+		t.Fatalf("fresh build: got %q, %v", got, ok)
+	}
+
+	// An edited input makes the output stale.
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(input, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tracker.Current("k"); ok {
+		t.Error("touched input still reported current")
+	}
+
+	// So does a removed output.
+	tracker.Record("k", []string{input}, output, "result")
+	if err := os.Remove(output); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tracker.Current("k"); ok {
+		t.Error("missing output still reported current")
+	}
+}
+
+func TestCachedResultCountsHits(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "bundle.js")
+	if err := os.WriteFile(output, []byte("built"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics.enable()
+	hits, misses := metrics.value("cache_hits"), metrics.value("cache_misses")
+	if _, ok := cachedResult("metrics-test"); ok {
+		t.Fatal("unrecorded key reported cached")
+	}
+	esbuildArtifacts.Record("metrics-test", nil, output, "result")
+	if got, ok := cachedResult("metrics-test"); !ok || got != "result" {
+		t.Fatalf("cachedResult = %q, %v", got, ok)
+	}
+	if got := metrics.value("cache_hits") - hits; got != 1 {
+		t.Errorf("cache_hits grew by %d, want 1", got)
+	}
+	if got := metrics.value("cache_misses") - misses; got != 1 {
+		t.Errorf("cache_misses grew by %d, want 1", got)
+	}
+}
+
+func TestMetricsSurviveTakenName(t *testing.T) {
+	expvar.Publish("esbuild_test_func", expvar.Func(func() any { return 1 }))
+	taken := newPluginMetrics("esbuild_test_func")
+	taken.enable()
+	taken.add("builds", 1)
+	if got := taken.value("builds"); got != 1 {
+		t.Errorf("builds = %d under a name taken by a non-map var, want 1", got)
+	}
+
+	copies := make([]*pluginMetrics, 8)
+	var wg sync.WaitGroup
+	for i := range copies {
+		copies[i] = newPluginMetrics("esbuild_test_shared")
+		wg.Add(1)
+		go func(m *pluginMetrics) {
+			defer wg.Done()
+			m.enable()
+		}(copies[i])
+	}
+	wg.Wait()
+	for _, m := range copies {
+		if m.vars != copies[0].vars {
+			t.Fatal("concurrent copies published separate maps")
+		}
+	}
+}
+
+func TestWriteCompressedGzip(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "bundle.js")
+	data := bytes.Repeat([]byte("console.log('bundle');\n"), 100)
+	if err := os.WriteFile(output, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	exts, err := parseCompress("both")
+	if err != nil || len(exts) != 2 {
+		t.Fatalf("parseCompress(both) = %v, %v", exts, err)
+	}
+	if errs := writeCompressed(output, data, exts, defaultFileModes); len(errs) > 0 {
+		t.Fatalf("writeCompressed: %v", errs)
+	}
+	if _, err := os.Stat(output + ".br"); err != nil {
+		t.Errorf("brotli sibling: %v", err)
+	}
+
+	f, err := os.Open(output + ".gz")
+	if err != nil {
+		t.Fatalf("gzip sibling: %v", err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("gzip.NewReader: %v", err)
+	}
+	got, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("decompress: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("decompressed .gz does not match the output")
+	}
+
+	if _, err := parseCompress("zstd"); err == nil {
+		t.Error("parseCompress(zstd) accepted an unknown encoding")
+	}
+}
+
+func TestValidateConfigWritesNothing(t *testing.T) {
+	dir := t.TempDir()
+	cfg := Config{Fields: Fields{
+		Outfile:  filepath.Join(dir, "bundle.js"),
+		Binary:   filepath.Join(dir, "missing-esbuild"),
+		Compress: "zip",
+		Tsconfig: "missing.json",
+	}}
+	errs := validateConfig(cfg, map[string]string{"resources": dir, "static": dir})
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	joined := strings.Join(messages, "\n")
+	for _, want := range []string{"entry and outfile", "compress", "binary not found", "tsconfig not found"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("errors %q do not mention %q", joined, want)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("validate_only wrote files: %v", entries)
+	}
+}
+
+func TestWriteFileAtomicCreatesNestedOutdir(t *testing.T) {
+	static := t.TempDir()
+	outPath := filepath.Join(static, "js", "app", "bundle.js")
+	modes, err := parseFileModes("0750", "640")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(outPath, []byte("console.log(1)"), modes); err != nil {
+		t.Fatalf("writeFileAtomic into a missing outdir: %v", err)
+	}
+
+	info, err := os.Stat(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o640 {
+		t.Errorf("file mode = %v, want 0640", info.Mode().Perm())
+	}
+	dirInfo, err := os.Stat(filepath.Join(static, "js", "app"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dirInfo.Mode().Perm()&^0o750 != 0 {
+		t.Errorf("dir mode = %v, want at most 0750", dirInfo.Mode().Perm())
+	}
+
+	if _, err := parseFileModes("rwx", ""); err == nil {
+		t.Error("non-octal dir_mode accepted")
+	}
+}
+
+func TestTsconfigPathAlias(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"tsconfig.json":    `{"compilerOptions": {"baseUrl": ".", "paths": {"@lib/*": ["src/lib/*"]}}}`,
+		"src/main.ts":      `import { greet } from "@lib/greet"; console.log(greet());`,
+		"src/lib/greet.ts": `export const greet = (): string => "hello from alias";`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := resolveTsconfig(dir, "missing.json"); err == nil || !strings.Contains(err.Error(), "tsconfig not found") {
+		t.Fatalf("missing tsconfig: err = %v", err)
+	}
+	tsconfig, err := resolveTsconfig(dir, "tsconfig.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	workDir, err := resolveWorkingDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := apiBuildOptions(Fields{}, filepath.Join(dir, "src", "main.ts"), filepath.Join(dir, "out", "bundle.js"), tsconfig, workDir)
+	res := api.Build(opts)
+	for _, e := range res.Errors {
+		t.Errorf("esbuild error: %s", e.Text)
+	}
+	if len(res.OutputFiles) != 1 {
+		t.Fatalf("got %d output files, want 1", len(res.OutputFiles))
+	}
+	if !strings.Contains(string(res.OutputFiles[0].Contents), "hello from alias") {
+		t.Errorf("aliased module not bundled:\n%s", res.OutputFiles[0].Contents)
+	}
+}
+
+func TestJSXAutomaticRuntime(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"app.tsx":                            `const App = () => <><p>hi</p></>; console.log(<App />);`,
+		"node_modules/preact/jsx-runtime.js": `export const jsx = (type) => "preact-runtime:" + type; export const jsxs = jsx; export const Fragment = "frag";`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := parseJSXMode("classic"); err == nil {
+		t.Error("unknown jsx mode accepted")
+	}
+	fields := Fields{JSX: "automatic", JSXImportSource: "preact"}
+	if got := strings.Join(jsxCLIArgs(fields), " "); got != "--jsx=automatic --jsx-import-source=preact" {
+		t.Errorf("CLI args = %q", got)
+	}
+
+	res := api.Build(apiBuildOptions(fields, filepath.Join(dir, "app.tsx"), filepath.Join(dir, "out.js"), "", ""))
+	for _, e := range res.Errors {
+		t.Errorf("esbuild error: %s", e.Text)
+	}
+	if len(res.OutputFiles) != 1 {
+		t.Fatalf("got %d output files, want 1", len(res.OutputFiles))
+	}
+	if out := string(res.OutputFiles[0].Contents); !strings.Contains(out, "preact-runtime:") {
+		t.Errorf("automatic runtime from preact not bundled:\n%s", out)
+	}
+}
+
+func TestEnclosePlaceholderKeepsLiteralPipes(t *testing.T) {
+	got := encloseResult(`<script src="%src%" data-env="dev|prod" defer></script>`, "%src%", "static/js/app.js", "")
+	want := `<script src="static/js/app.js" data-env="dev|prod" defer></script>`
+	if got != want {
+		t.Errorf("encloseResult:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestImportedCSSIsEmittedAndEnclosed(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"app.js":    `import "./style.css"; console.log("app");`,
+		"style.css": `body { color: rebeccapurple; }`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	outPath := filepath.Join(dir, "out", "bundle.js")
+	res := api.Build(apiBuildOptions(Fields{}, filepath.Join(dir, "app.js"), outPath, "", ""))
+	for _, e := range res.Errors {
+		t.Errorf("esbuild error: %s", e.Text)
+	}
+	var written []string
+	for _, file := range res.OutputFiles {
+		written = append(written, file.Path)
+	}
+	cssPath := cssOutput(written)
+	if cssPath != filepath.Join(dir, "out", "bundle.css") {
+		t.Fatalf("cssOutput(%v) = %q, want the bundle.css sibling", written, cssPath)
+	}
+	if cssOutput([]string{outPath}) != "" {
+		t.Error("cssOutput found a stylesheet in a JS-only build")
+	}
+
+	enclose := `<link rel="stylesheet" href="{{css}}"><script src="{{js}}" defer></script>`
+	got := encloseResult(enclose, "", "static/js/bundle.js", "static/js/bundle.css")
+	want := `<link rel="stylesheet" href="static/js/bundle.css"><script src="static/js/bundle.js" defer></script>`
+	if got != want {
+		t.Errorf("encloseResult:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestTouchOnCacheHit(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "bundle.js")
+	if err := os.WriteFile(output, []byte("built"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(output, past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	tracker := newArtifactTracker()
+	tracker.Record("k", nil, output, "result")
+	if err := tracker.Touch("k"); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().After(past.Add(time.Minute)) {
+		t.Errorf("mtime = %v, want it bumped", info.ModTime())
+	}
+	if data, _ := os.ReadFile(output); string(data) != "built" {
+		t.Errorf("touch changed the content: %q", data)
+	}
+	if got, ok := tracker.Current("k"); !ok || got != "result" {
+		t.Errorf("touched output no longer current: %q, %v", got, ok)
+	}
+}
+
+func TestValidateConfigWithoutDirectories(t *testing.T) {
+	errs := validateConfig(Config{Fields: Fields{Entry: "app.js", Outfile: "app.js"}}, nil)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "'resources' or 'static'") {
+		t.Errorf("errors = %v, want the missing directories reported", errs)
+	}
+}
+
+func TestCacheKeyCoversEnclosePlaceholder(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "bundle.js")
+	if err := os.WriteFile(output, []byte("built"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	first := Fields{Entry: "placeholder.js", Enclose: `<script src="%src%"></script>`, Placeholder: "%src%"}
+	esbuildArtifacts.Record(renderCacheKey(first, nil), nil, output, encloseResult(first.Enclose, first.Placeholder, "static/bundle.js", ""))
+
+	second := first
+	second.Placeholder = "[src]"
+	second.Enclose = `<script src="[src]"></script>`
+	if got, ok := cachedResult(renderCacheKey(second, nil)); ok {
+		t.Errorf("a new placeholder reused the first render: %q", got)
+	}
+	third := first
+	third.Enclose = `<script src="%src%" defer></script>`
+	if got, ok := cachedResult(renderCacheKey(third, nil)); ok {
+		t.Errorf("a new enclose reused the first render: %q", got)
+	}
+	if _, ok := cachedResult(renderCacheKey(first, nil)); !ok {
+		t.Error("the unchanged config missed the cache")
+	}
+}
+
+func TestCacheKeyCoversJSXOptions(t *testing.T) {
+	base := Fields{Entry: "app.jsx"}
+	seen := map[string]string{renderCacheKey(base, nil): "default"}
+	for name, f := range map[string]Fields{
+		"jsx":               {Entry: "app.jsx", JSX: "automatic"},
+		"jsx_factory":       {Entry: "app.jsx", JSXFactory: "h"},
+		"jsx_fragment":      {Entry: "app.jsx", JSXFragment: "Fragment"},
+		"jsx_import_source": {Entry: "app.jsx", JSX: "automatic", JSXImportSource: "preact"},
+	} {
+		key := renderCacheKey(f, nil)
+		if other, dup := seen[key]; dup {
+			t.Errorf("%s shares its cache key with %s: %q", name, other, key)
+		}
+		seen[key] = name
+	}
+}
@@ -3,6 +3,10 @@ package main
 import (
 	"context"
 	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"unicode/utf8"
 
 	lorem "github.com/drhodes/golorem"
 	"github.com/hyperbricks/hyperbricks/pkg/shared"
@@ -10,7 +14,13 @@ import (
 
 // The plugin field definition
 type Fields struct {
-	Paragraphs int `mapstructure:"paragraphs"`
+	Paragraphs int    `mapstructure:"paragraphs"`
+	Class      string `mapstructure:"class"`
+	// MaxChars and MaxWords cap the generated text at a word boundary; 0 means no limit.
+	MaxChars int `mapstructure:"max_chars"`
+	MaxWords int `mapstructure:"max_words"`
+	// ValidateOnly decodes and checks the config without generating text.
+	ValidateOnly bool `mapstructure:"validate_only"`
 }
 
 // Basic config for ComponentRenderers
@@ -43,15 +53,154 @@ func (p *LoremIpsumPlugin) Render(instance interface{}, ctx context.Context) (an
 			Path:     config.HyperBricksPath,
 			Key:      config.HyperBricksKey,
 			Rejected: true,
-			Err:      fmt.Sprintf("Failed to decode plugin instance: %v", err),
+			Err:      fmt.Sprintf("Failed to decode plugin instance: %s", describeDecodeError(err)),
 		})
 		return "<!--Failed to render lorem_ipsum_plugin  -->", errors
 	}
+	if config.Fields.ValidateOnly {
+		return "", errors
+	}
 
 	// The Field values can be referenced like this...
 	paragraphs := int(config.Fields.Paragraphs)
 
-	return fmt.Sprintf("<div class=\"lorem_ipsum_plugin-content\">%s</div>\n", lorem.Paragraph(paragraphs, paragraphs)), errors
+	// Truncate the text before it is wrapped so the markup is never cut.
+	text := truncateText(lorem.Paragraph(paragraphs, paragraphs), config.Fields.MaxChars, config.Fields.MaxWords)
+
+	return wrapContent(config.Fields.Class, text), errors
+}
+
+// wrapContent places body in the container div, escaping the class attribute.
+func wrapContent(class, body string) string {
+	if class == "" {
+		class = "lorem_ipsum_plugin-content"
+	}
+	return fmt.Sprintf("<div class=\"%s\">%s</div>\n", html.EscapeString(class), body)
+}
+
+// truncateText cuts text to at most maxWords words and maxChars characters
+// (ellipsis included), breaking at a word boundary and appending "…" when
+// anything was dropped. Limits of 0 or less are ignored.
+func truncateText(text string, maxChars, maxWords int) string {
+	words := strings.Fields(text)
+	truncated := false
+	if maxWords > 0 && len(words) > maxWords {
+		words = words[:maxWords]
+		truncated = true
+	}
+	if maxChars > 0 && utf8.RuneCountInString(strings.Join(words, " ")) > maxChars {
+		budget := maxChars - 1 // room for the ellipsis
+		length := 0
+		for i, word := range words {
+			n := utf8.RuneCountInString(word)
+			if i > 0 {
+				n++
+			}
+			if length+n > budget {
+				if i == 0 {
+					// A single word longer than the limit is cut mid-word.
+					words = []string{string([]rune(word)[:max(budget, 0)])}
+				} else {
+					words = words[:i]
+				}
+				break
+			}
+			length += n
+		}
+		truncated = true
+	}
+	if !truncated {
+		return text
+	}
+	return strings.TrimRight(strings.Join(words, " "), ",;:.") + "…"
+}
+
+// decodeErrorPatterns rewrite mapstructure's type mismatch messages into
+// "<field>: expected <type>, got <type>" so the offending data.* key is clear.
+var decodeErrorPatterns = []struct {
+	re     *regexp.Regexp
+	format func(m []string) string
+}{
+	{regexp.MustCompile(`^'([^']*)' expected type '([^']*)', got unconvertible type '([^']*)', value: '(.*)'$`), func(m []string) string {
+		return fmt.Sprintf("%s: expected %s, got %s %q", m[1], friendlyType(m[2]), friendlyType(m[3]), m[4])
+	}},
+	{regexp.MustCompile(`^'([^']*)' expected type '([^']*)', got '([^']*)'$`), func(m []string) string {
+		return fmt.Sprintf("%s: expected %s, got %s", m[1], friendlyType(m[2]), friendlyType(m[3]))
+	}},
+	{regexp.MustCompile(`^'([^']*)':? source data must be an array or slice, got (\S+)$`), func(m []string) string {
+		return fmt.Sprintf("%s: expected a list, got %s", m[1], friendlyType(m[2]))
+	}},
+	{regexp.MustCompile(`^'([^']*)' expected a map, got '([^']*)'$`), func(m []string) string {
+		return fmt.Sprintf("%s: expected a map, got %s", m[1], friendlyType(m[2]))
+	}},
+	{regexp.MustCompile(`^cannot parse '([^']*)' as (\w+): (.*)$`), func(m []string) string {
+		return fmt.Sprintf("%s: expected %s (%s)", m[1], friendlyType(m[2]), m[3])
+	}},
+}
+
+// describeDecodeError lists every field-level failure in the errors
+// shared.DecodeWithBasicHooks returned, rewritten by decodeErrorPatterns
+// where the message is recognised.
+func describeDecodeError(errs []error) string {
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, decodeMessages(err)...)
+	}
+	for i, msg := range messages {
+		for _, pattern := range decodeErrorPatterns {
+			if m := pattern.re.FindStringSubmatch(msg); m != nil {
+				messages[i] = pattern.format(m)
+				break
+			}
+		}
+	}
+	return strings.Join(messages, "; ")
+}
+
+// decodeMessages splits one decode error into its field-level messages. The
+// host keeps only the text of a *mapstructure.Error in its ComponentError
+// ("N error(s) decoding:\n\n* msg\n* msg"), so that form is split as well.
+func decodeMessages(err error) []string {
+	var messages []string
+	switch wrapped := err.(type) {
+	case interface{ WrappedErrors() []error }: // *mapstructure.Error
+		for _, e := range wrapped.WrappedErrors() {
+			messages = append(messages, decodeMessages(e)...)
+		}
+		return messages
+	case interface{ Unwrap() []error }:
+		for _, e := range wrapped.Unwrap() {
+			messages = append(messages, decodeMessages(e)...)
+		}
+		return messages
+	}
+	text := err.Error()
+	_, list, ok := strings.Cut(text, "decoding:\n\n")
+	if !ok {
+		return []string{text}
+	}
+	for _, line := range strings.Split(list, "\n") {
+		if line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "* ")); line != "" {
+			messages = append(messages, line)
+		}
+	}
+	return messages
+}
+
+// friendlyType names Go kinds the way config authors think of them.
+func friendlyType(goType string) string {
+	goType = strings.TrimPrefix(goType, "*")
+	switch {
+	case strings.HasPrefix(goType, "[]"), goType == "slice", goType == "array":
+		return "list"
+	case strings.HasPrefix(goType, "map"):
+		return "map"
+	case strings.HasPrefix(goType, "int"), strings.HasPrefix(goType, "uint"):
+		return "integer"
+	case strings.HasPrefix(goType, "float"):
+		return "number"
+	}
+	return goType
 }
 
 // var Plugin shared.PluginRenderer = &MyPlugin{}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateText(t *testing.T) {
+	text := "Lorem ipsum dolor sit amet, consectetur adipiscing elit."
+	cases := []struct {
+		name               string
+		maxChars, maxWords int
+		want               string
+	}{
+		{"no limits", 0, 0, text},
+		{"shorter than char limit", 200, 0, text},
+		{"shorter than word limit", 0, 20, text},
+		{"word limit", 0, 5, "Lorem ipsum dolor sit amet…"},
+		{"char limit at word boundary", 20, 0, "Lorem ipsum dolor…"},
+		{"both limits, words tighter", 100, 2, "Lorem ipsum…"},
+		{"both limits, chars tighter", 12, 5, "Lorem ipsum…"},
+		{"single long word", 4, 0, "Lor…"},
+	}
+	for _, tc := range cases {
+		got := truncateText(text, tc.maxChars, tc.maxWords)
+		if got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+		if tc.maxChars > 0 && utf8.RuneCountInString(got) > tc.maxChars {
+			t.Errorf("%s: %q exceeds %d characters", tc.name, got, tc.maxChars)
+		}
+	}
+}
+
+func TestWrapContentEscapesClass(t *testing.T) {
+	got := wrapContent(`slot" data-x="1`, "Lorem")
+	want := "<div class=\"slot&#34; data-x=&#34;1\">Lorem</div>\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := wrapContent("", "Lorem"); got != "<div class=\"lorem_ipsum_plugin-content\">Lorem</div>\n" {
+		t.Errorf("default class: got %q", got)
+	}
+}
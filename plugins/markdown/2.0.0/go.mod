@@ -5,6 +5,7 @@ go 1.23.4
 require (
 	github.com/hyperbricks/hyperbricks v0.7.8-alpha
 	github.com/russross/blackfriday/v2 v2.1.0
+	golang.org/x/net v0.33.0
 )
 
 require (
@@ -48,7 +49,6 @@ require (
 	go.uber.org/multierr v1.10.0 // indirect
 	go.uber.org/zap v1.27.0 // indirect
 	golang.org/x/crypto v0.33.0 // indirect
-	golang.org/x/net v0.33.0 // indirect
 	golang.org/x/sync v0.11.0 // indirect
 	golang.org/x/sys v0.31.0 // indirect
 	golang.org/x/text v0.22.0 // indirect
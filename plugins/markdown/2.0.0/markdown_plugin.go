@@ -3,9 +3,14 @@ package main
 import (
 	"context"
 	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strings"
 
 	"github.com/hyperbricks/hyperbricks/pkg/shared"
 	"github.com/russross/blackfriday/v2"
+	xhtml "golang.org/x/net/html"
 )
 
 // HOW TO USE THIS PLUGIN:
@@ -15,10 +20,34 @@ import (
 
 // Fields defines the configuration fields for the Markdown plugin.
 type Fields struct {
-	Content string `mapstructure:"content"`
-	Class   string `mapstructure:"class"`
+	Content   string `mapstructure:"content"`
+	Class     string `mapstructure:"class"`
+	AllowHTML string `mapstructure:"allow_html"` // allow (default) | escape | strip | sanitize
+	// Allowlist for allow_html = sanitize; empty lists keep the UGC defaults.
+	AllowTags    []string `mapstructure:"allow_tags"`
+	AllowAttrs   []string `mapstructure:"allow_attrs"` // "attr" or "tag.attr"
+	AllowSchemes []string `mapstructure:"allow_schemes"`
+	// HeadingOffset shifts rendered heading levels, clamped to h1-h6.
+	HeadingOffset int `mapstructure:"heading_offset"`
+	// DefinitionLists renders "Term\n: definition" as <dl>.
+	DefinitionLists bool `mapstructure:"definition_lists"`
+	// Admonitions renders "> [!NOTE]" blockquotes as <div class="admonition note">.
+	Admonitions bool `mapstructure:"admonitions"`
+	// Smartypants renders straight quotes, dashes, ellipses and fractions as
+	// typographic glyphs. Code spans and blocks are left alone.
+	Smartypants bool `mapstructure:"smartypants"`
+	// ValidateOnly checks the options and reports errors instead of rendering.
+	ValidateOnly bool `mapstructure:"validate_only"`
 }
 
+// Raw HTML handling modes for data.allow_html.
+const (
+	htmlAllow    = "allow"
+	htmlEscape   = "escape"
+	htmlStrip    = "strip"
+	htmlSanitize = "sanitize"
+)
+
 // MarkdownConfig holds the complete configuration for the Markdown plugin.
 type MarkdownConfig struct {
 	shared.Component `mapstructure:",squash"`
@@ -44,20 +73,440 @@ func (p *MarkdownPlugin) Render(instance interface{}, ctx context.Context) (any,
 			Path:     config.HyperBricksPath,
 			Key:      config.HyperBricksKey,
 			Rejected: true,
-			Err:      fmt.Sprintf("Failed to decode plugin instance: %v", err),
+			Err:      fmt.Sprintf("Failed to decode plugin instance: %s", describeDecodeError(err)),
 		})
 		return "<!-- Failed to render markdown_plugin -->", errs
 	}
 
-	// Convert the Markdown content to HTML.
-	htmlBytes := blackfriday.Run([]byte(config.Fields.Content))
-	htmlContent := string(htmlBytes)
-	if config.Fields.Class == "" {
-		config.Fields.Class = "markdown_plugin-content"
+	if config.Fields.ValidateOnly {
+		if _, err := htmlMode(config.Fields.AllowHTML); err != nil {
+			errs = append(errs, shared.ComponentError{
+				Hash:     shared.GenerateHash(),
+				Path:     config.HyperBricksPath,
+				Key:      config.HyperBricksKey,
+				Rejected: true,
+				Err:      err.Error(),
+			})
+		}
+		return "", errs
 	}
 
+	// Convert the Markdown content to HTML.
+	htmlContent, renderErr := renderMarkdown(config.Fields)
+	if renderErr != nil {
+		errs = append(errs, shared.ComponentError{
+			Hash:     shared.GenerateHash(),
+			Path:     config.HyperBricksPath,
+			Key:      config.HyperBricksKey,
+			Rejected: true,
+			Err:      renderErr.Error(),
+		})
+		return "<!-- Failed to render markdown_plugin -->", errs
+	}
 	// Wrap the HTML content in a container div.
-	return fmt.Sprintf("<div class=\"%s\">\n%s\n</div>\n", config.Fields.Class, htmlContent), errs
+	return wrapContent(config.Fields.Class, htmlContent), errs
+}
+
+// wrapContent places body in the container div, escaping the class attribute.
+func wrapContent(class, body string) string {
+	if class == "" {
+		class = "markdown_plugin-content"
+	}
+	return fmt.Sprintf("<div class=\"%s\">\n%s\n</div>\n", html.EscapeString(class), body)
+}
+
+// renderMarkdown converts fields.Content to HTML with the configured options.
+func renderMarkdown(fields Fields) (string, error) {
+	params := blackfriday.HTMLRendererParameters{
+		Flags:              blackfriday.CommonHTMLFlags &^ smartypantsFlags,
+		HeadingLevelOffset: fields.HeadingOffset,
+	}
+	if fields.Smartypants {
+		params.Flags |= smartypantsFlags
+	}
+	mode, err := htmlMode(fields.AllowHTML)
+	if err != nil {
+		return "", err
+	}
+	if mode == htmlStrip {
+		params.Flags |= blackfriday.SkipHTML
+	}
+
+	// CommonExtensions includes definition lists; they are opt-in here.
+	extensions := blackfriday.CommonExtensions &^ blackfriday.DefinitionLists
+	if fields.DefinitionLists {
+		extensions |= blackfriday.DefinitionLists
+	}
+
+	var renderer blackfriday.Renderer = blackfriday.NewHTMLRenderer(params)
+	if mode == htmlEscape || fields.Admonitions {
+		renderer = &htmlRenderer{
+			HTMLRenderer: blackfriday.NewHTMLRenderer(params),
+			escapeHTML:   mode == htmlEscape,
+			admonitions:  fields.Admonitions,
+		}
+	}
+	out := string(blackfriday.Run([]byte(fields.Content), blackfriday.WithRenderer(renderer), blackfriday.WithExtensions(extensions)))
+	if mode == htmlSanitize {
+		// Sanitize the rendered output, so markdown links and images are
+		// held to the same policy as embedded HTML.
+		out = newSanitizePolicy(fields.AllowTags, fields.AllowAttrs, fields.AllowSchemes).Sanitize(out)
+	}
+	return out, nil
+}
+
+// smartypantsFlags are the typography flags blackfriday's CommonHTMLFlags
+// enable; they are opt-in here through data.smartypants.
+const smartypantsFlags = blackfriday.Smartypants | blackfriday.SmartypantsFractions |
+	blackfriday.SmartypantsDashes | blackfriday.SmartypantsLatexDashes
+
+// htmlMode normalizes data.allow_html; empty means allow.
+func htmlMode(value string) (string, error) {
+	switch mode := strings.ToLower(strings.TrimSpace(value)); mode {
+	case "", htmlAllow:
+		return htmlAllow, nil
+	case htmlEscape, htmlStrip, htmlSanitize:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("allow_html: expected allow, escape, strip or sanitize, got %q", value)
+	}
+}
+
+// htmlRenderer adds the optional node handling on top of blackfriday's HTML
+// renderer: raw HTML rendered as visible text, and admonition blockquotes.
+type htmlRenderer struct {
+	*blackfriday.HTMLRenderer
+	escapeHTML  bool
+	admonitions bool
+	// quotes holds the admonition type of each open blockquote ("" for a
+	// plain one), so the closing tag matches the opening one.
+	quotes []string
+}
+
+func (r *htmlRenderer) RenderNode(w io.Writer, node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+	switch node.Type {
+	case blackfriday.HTMLBlock:
+		if r.escapeHTML {
+			io.WriteString(w, "<p>"+html.EscapeString(strings.TrimSpace(string(node.Literal)))+"</p>\n")
+			return blackfriday.GoToNext
+		}
+	case blackfriday.HTMLSpan:
+		if r.escapeHTML {
+			io.WriteString(w, html.EscapeString(string(node.Literal)))
+			return blackfriday.GoToNext
+		}
+	case blackfriday.BlockQuote:
+		if r.admonitions {
+			return r.renderAdmonition(w, node, entering)
+		}
+	}
+	return r.HTMLRenderer.RenderNode(w, node, entering)
+}
+
+// admonitionMarker matches the "[!TYPE]" line opening a callout blockquote.
+var admonitionMarker = regexp.MustCompile(`^\[!([A-Za-z]+)\][ \t]*(\n|$)`)
+
+// renderAdmonition renders a blockquote whose first paragraph starts with
+// [!TYPE] as <div class="admonition type"> with a title; other blockquotes
+// render as usual.
+func (r *htmlRenderer) renderAdmonition(w io.Writer, node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+	if !entering {
+		kind := r.quotes[len(r.quotes)-1]
+		r.quotes = r.quotes[:len(r.quotes)-1]
+		if kind == "" {
+			return r.HTMLRenderer.RenderNode(w, node, entering)
+		}
+		io.WriteString(w, "</div>\n")
+		return blackfriday.GoToNext
+	}
+
+	kind := takeAdmonitionMarker(node)
+	r.quotes = append(r.quotes, kind)
+	if kind == "" {
+		return r.HTMLRenderer.RenderNode(w, node, entering)
+	}
+	title := strings.ToUpper(kind[:1]) + kind[1:]
+	fmt.Fprintf(w, "<div class=\"admonition %s\">\n<p class=\"admonition-title\">%s</p>\n", kind, title)
+	return blackfriday.GoToNext
+}
+
+// takeAdmonitionMarker strips the [!TYPE] marker from the blockquote's first
+// paragraph and returns the lower-cased type, or "" when there is none. A
+// paragraph left empty by the marker is dropped.
+func takeAdmonitionMarker(quote *blackfriday.Node) string {
+	para := quote.FirstChild
+	if para == nil || para.Type != blackfriday.Paragraph {
+		return ""
+	}
+	text := para.FirstChild
+	if text == nil || text.Type != blackfriday.Text {
+		return ""
+	}
+	m := admonitionMarker.FindSubmatchIndex(text.Literal)
+	if m == nil {
+		return ""
+	}
+	kind := strings.ToLower(string(text.Literal[m[2]:m[3]]))
+	text.Literal = text.Literal[m[1]:]
+	if len(text.Literal) == 0 && text.Next == nil {
+		para.Unlink()
+	}
+	return kind
+}
+
+// Default UGC allowlist for the HTML sanitizer: text formatting, lists,
+// tables, links and images, with no scripting, styling or embedding.
+var (
+	defaultSanitizeTags = []string{
+		"a", "abbr", "b", "blockquote", "br", "caption", "cite", "code", "dd", "del", "details", "div",
+		"dl", "dt", "em", "figcaption", "figure", "h1", "h2", "h3", "h4", "h5", "h6", "hr", "i", "img",
+		"ins", "kbd", "li", "mark", "ol", "p", "pre", "q", "s", "small", "span", "strong", "sub",
+		"summary", "sup", "table", "tbody", "td", "tfoot", "th", "thead", "tr", "u", "ul",
+	}
+	defaultSanitizeAttrs = []string{
+		"class", "id", "title", "lang", "dir",
+		"a.href", "a.rel", "a.target", "img.src", "img.alt", "img.width", "img.height",
+		"td.colspan", "td.rowspan", "th.colspan", "th.rowspan", "th.scope", "ol.start", "blockquote.cite", "q.cite",
+	}
+	defaultSanitizeSchemes = []string{"http", "https", "mailto"}
+)
+
+// sanitizeDropContent are elements removed together with their content even
+// when allowed by mistake: their text is code or markup, not prose.
+var sanitizeDropContent = map[string]bool{
+	"script": true, "style": true, "iframe": true, "object": true, "embed": true, "noscript": true,
+	"template": true, "textarea": true, "title": true, "xmp": true, "noembed": true, "noframes": true,
+	"plaintext": true, "svg": true, "math": true, "frameset": true,
+}
+
+// sanitizeURLAttrs hold URLs and are checked against the allowed schemes.
+var sanitizeURLAttrs = map[string]bool{
+	"href": true, "src": true, "cite": true, "action": true, "formaction": true, "poster": true,
+	"background": true, "longdesc": true, "usemap": true, "xlink:href": true,
+}
+
+// sanitizePolicy is an HTML allowlist. Tags outside Tags are dropped but
+// keep their text; attributes outside Attrs are dropped; URL attributes must
+// be relative or use one of Schemes. Event handler attributes (on*) are
+// never kept.
+type sanitizePolicy struct {
+	Tags    map[string]bool
+	Attrs   map[string]map[string]bool // tag → attributes; "*" applies to every tag
+	Schemes map[string]bool
+}
+
+// newSanitizePolicy builds a policy from allow_tags, allow_attrs ("attr" for
+// every tag or "tag.attr") and allow_schemes. An empty list keeps the UGC
+// default for that part; a non-empty list replaces it.
+func newSanitizePolicy(tags, attrs, schemes []string) *sanitizePolicy {
+	if len(tags) == 0 {
+		tags = defaultSanitizeTags
+	}
+	if len(attrs) == 0 {
+		attrs = defaultSanitizeAttrs
+	}
+	if len(schemes) == 0 {
+		schemes = defaultSanitizeSchemes
+	}
+	p := &sanitizePolicy{Tags: map[string]bool{}, Attrs: map[string]map[string]bool{}, Schemes: map[string]bool{}}
+	for _, tag := range tags {
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" && !sanitizeDropContent[tag] {
+			p.Tags[tag] = true
+		}
+	}
+	for _, attr := range attrs {
+		attr = strings.ToLower(strings.TrimSpace(attr))
+		tag := "*"
+		if i := strings.Index(attr, "."); i >= 0 {
+			tag, attr = attr[:i], attr[i+1:]
+		}
+		if attr == "" || strings.HasPrefix(attr, "on") {
+			continue
+		}
+		if p.Attrs[tag] == nil {
+			p.Attrs[tag] = map[string]bool{}
+		}
+		p.Attrs[tag][attr] = true
+	}
+	for _, scheme := range schemes {
+		if scheme = strings.ToLower(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(scheme), ":"))); scheme != "" {
+			p.Schemes[scheme] = true
+		}
+	}
+	return p
+}
+
+// Sanitize returns input with everything outside the policy removed. Text is
+// re-escaped and comments are dropped, so the result is safe to emit as-is.
+func (p *sanitizePolicy) Sanitize(input string) string {
+	var out strings.Builder
+	tokenizer := xhtml.NewTokenizer(strings.NewReader(input))
+	skip := 0 // depth inside sanitizeDropContent elements
+	for {
+		switch tokenizer.Next() {
+		case xhtml.ErrorToken:
+			return out.String()
+		case xhtml.TextToken:
+			if skip == 0 {
+				out.WriteString(html.EscapeString(string(tokenizer.Text())))
+			}
+		case xhtml.StartTagToken, xhtml.SelfClosingTagToken:
+			token := tokenizer.Token()
+			if sanitizeDropContent[token.Data] {
+				if token.Type == xhtml.StartTagToken {
+					skip++
+				}
+				continue
+			}
+			if skip == 0 && p.Tags[token.Data] {
+				out.WriteString(p.startTag(token))
+			}
+		case xhtml.EndTagToken:
+			token := tokenizer.Token()
+			if sanitizeDropContent[token.Data] {
+				if skip > 0 {
+					skip--
+				}
+				continue
+			}
+			if skip == 0 && p.Tags[token.Data] {
+				out.WriteString("</" + token.Data + ">")
+			}
+		}
+	}
+}
+
+// startTag renders an allowed tag with its allowed attributes.
+func (p *sanitizePolicy) startTag(token xhtml.Token) string {
+	var b strings.Builder
+	b.WriteString("<" + token.Data)
+	for _, attr := range token.Attr {
+		name := strings.ToLower(attr.Key)
+		if attr.Namespace != "" {
+			name = attr.Namespace + ":" + name
+		}
+		if strings.HasPrefix(name, "on") || !(p.Attrs["*"][name] || p.Attrs[token.Data][name]) {
+			continue
+		}
+		if sanitizeURLAttrs[name] && !p.allowedURL(attr.Val) {
+			continue
+		}
+		b.WriteString(" " + name + `="` + html.EscapeString(attr.Val) + `"`)
+	}
+	if token.Type == xhtml.SelfClosingTagToken {
+		b.WriteString(" /")
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+// allowedURL accepts relative URLs and URLs whose scheme is allowed.
+// Whitespace and control characters are ignored the way browsers ignore
+// them, so "java\tscript:" is still recognised as javascript.
+func (p *sanitizePolicy) allowedURL(value string) bool {
+	cleaned := strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, value)
+	colon := strings.Index(cleaned, ":")
+	if colon < 0 {
+		return true
+	}
+	// A ':' after the path, query or fragment starts is not a scheme.
+	if sep := strings.IndexAny(cleaned, "/?#"); sep >= 0 && sep < colon {
+		return true
+	}
+	return p.Schemes[strings.ToLower(cleaned[:colon])]
+}
+
+// decodeErrorPatterns rewrite mapstructure's type mismatch messages into
+// "<field>: expected <type>, got <type>" so the offending data.* key is clear.
+var decodeErrorPatterns = []struct {
+	re     *regexp.Regexp
+	format func(m []string) string
+}{
+	{regexp.MustCompile(`^'([^']*)' expected type '([^']*)', got unconvertible type '([^']*)', value: '(.*)'$`), func(m []string) string {
+		return fmt.Sprintf("%s: expected %s, got %s %q", m[1], friendlyType(m[2]), friendlyType(m[3]), m[4])
+	}},
+	{regexp.MustCompile(`^'([^']*)' expected type '([^']*)', got '([^']*)'$`), func(m []string) string {
+		return fmt.Sprintf("%s: expected %s, got %s", m[1], friendlyType(m[2]), friendlyType(m[3]))
+	}},
+	{regexp.MustCompile(`^'([^']*)':? source data must be an array or slice, got (\S+)$`), func(m []string) string {
+		return fmt.Sprintf("%s: expected a list, got %s", m[1], friendlyType(m[2]))
+	}},
+	{regexp.MustCompile(`^'([^']*)' expected a map, got '([^']*)'$`), func(m []string) string {
+		return fmt.Sprintf("%s: expected a map, got %s", m[1], friendlyType(m[2]))
+	}},
+	{regexp.MustCompile(`^cannot parse '([^']*)' as (\w+): (.*)$`), func(m []string) string {
+		return fmt.Sprintf("%s: expected %s (%s)", m[1], friendlyType(m[2]), m[3])
+	}},
+}
+
+// describeDecodeError lists every field-level failure in the errors
+// shared.DecodeWithBasicHooks returned, rewritten by decodeErrorPatterns
+// where the message is recognised.
+func describeDecodeError(errs []error) string {
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, decodeMessages(err)...)
+	}
+	for i, msg := range messages {
+		for _, pattern := range decodeErrorPatterns {
+			if m := pattern.re.FindStringSubmatch(msg); m != nil {
+				messages[i] = pattern.format(m)
+				break
+			}
+		}
+	}
+	return strings.Join(messages, "; ")
+}
+
+// decodeMessages splits one decode error into its field-level messages. The
+// host keeps only the text of a *mapstructure.Error in its ComponentError
+// ("N error(s) decoding:\n\n* msg\n* msg"), so that form is split as well.
+func decodeMessages(err error) []string {
+	var messages []string
+	switch wrapped := err.(type) {
+	case interface{ WrappedErrors() []error }: // *mapstructure.Error
+		for _, e := range wrapped.WrappedErrors() {
+			messages = append(messages, decodeMessages(e)...)
+		}
+		return messages
+	case interface{ Unwrap() []error }:
+		for _, e := range wrapped.Unwrap() {
+			messages = append(messages, decodeMessages(e)...)
+		}
+		return messages
+	}
+	text := err.Error()
+	_, list, ok := strings.Cut(text, "decoding:\n\n")
+	if !ok {
+		return []string{text}
+	}
+	for _, line := range strings.Split(list, "\n") {
+		if line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "* ")); line != "" {
+			messages = append(messages, line)
+		}
+	}
+	return messages
+}
+
+// friendlyType names Go kinds the way config authors think of them.
+func friendlyType(goType string) string {
+	goType = strings.TrimPrefix(goType, "*")
+	switch {
+	case strings.HasPrefix(goType, "[]"), goType == "slice", goType == "array":
+		return "list"
+	case strings.HasPrefix(goType, "map"):
+		return "map"
+	case strings.HasPrefix(goType, "int"), strings.HasPrefix(goType, "uint"):
+		return "integer"
+	case strings.HasPrefix(goType, "float"):
+		return "number"
+	}
+	return goType
 }
 
 // Plugin is the exported function that returns an instance of MarkdownPlugin.
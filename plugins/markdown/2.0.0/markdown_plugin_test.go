@@ -0,0 +1,195 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const rawHTMLFixture = "Intro with <span class=\"x\">inline</span> HTML.\n\n<div class=\"box\">boxed</div>\n\n<script>alert(1)</script>\n\nOutro.\n"
+
+func TestAllowHTMLModes(t *testing.T) {
+	cases := []struct {
+		mode    string
+		want    []string
+		notWant []string
+	}{
+		{"", []string{`<div class="box">boxed</div>`, "<script>alert(1)</script>", `<span class="x">`}, nil},
+		{"allow", []string{`<div class="box">boxed</div>`, "<script>alert(1)</script>"}, nil},
+		{"escape", []string{"&lt;div class=&#34;box&#34;&gt;boxed&lt;/div&gt;", "&lt;script&gt;alert(1)&lt;/script&gt;", "&lt;span class=&#34;x&#34;&gt;"}, []string{"<div", "<script", "<span"}},
+		{"strip", []string{"Intro with", "Outro."}, []string{"<div", "boxed", "<script", "alert(1)", "<span"}},
+		{"sanitize", []string{`<div class="box">boxed</div>`, `<span class="x">inline</span>`, "Outro."}, []string{"<script", "alert(1)"}},
+	}
+	for _, tc := range cases {
+		out, err := renderMarkdown(Fields{Content: rawHTMLFixture, AllowHTML: tc.mode})
+		if err != nil {
+			t.Fatalf("%q: %v", tc.mode, err)
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(out, want) {
+				t.Errorf("%q: output lacks %q:\n%s", tc.mode, want, out)
+			}
+		}
+		for _, notWant := range tc.notWant {
+			if strings.Contains(out, notWant) {
+				t.Errorf("%q: output contains %q:\n%s", tc.mode, notWant, out)
+			}
+		}
+	}
+
+	if _, err := renderMarkdown(Fields{Content: rawHTMLFixture, AllowHTML: "bogus"}); err == nil {
+		t.Error("unknown allow_html mode accepted")
+	}
+}
+
+func TestHeadingOffset(t *testing.T) {
+	out, err := renderMarkdown(Fields{Content: "# Title\n\n###### Deep\n", HeadingOffset: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "<h2>Title</h2>") {
+		t.Errorf("h1 not shifted to h2:\n%s", out)
+	}
+	if !strings.Contains(out, "<h6>Deep</h6>") || strings.Contains(out, "<h7") {
+		t.Errorf("h6 not clamped:\n%s", out)
+	}
+
+	out, err = renderMarkdown(Fields{Content: "# Title\n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "<h1>Title</h1>") {
+		t.Errorf("zero offset changed heading:\n%s", out)
+	}
+}
+
+func TestWrapContentEscapesClass(t *testing.T) {
+	got := wrapContent(`box" onclick="alert(1)`, "<p>x</p>")
+	want := "<div class=\"box&#34; onclick=&#34;alert(1)\">\n<p>x</p>\n</div>\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestDefinitionLists(t *testing.T) {
+	content := "Term\n: The definition.\n"
+	out, err := renderMarkdown(Fields{Content: content, DefinitionLists: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "<dl>") || !strings.Contains(out, "<dt>Term</dt>") || !strings.Contains(out, "<dd>The definition.</dd>") {
+		t.Errorf("definition list not rendered:\n%s", out)
+	}
+
+	out, _ = renderMarkdown(Fields{Content: content})
+	if strings.Contains(out, "<dl>") {
+		t.Errorf("definition list rendered while disabled:\n%s", out)
+	}
+}
+
+func TestAdmonitions(t *testing.T) {
+	// Blockquotes separated only by a blank line are merged, so a paragraph
+	// keeps the plain quote apart.
+	content := "> [!WARNING]\n> Mind the **gap**.\n\nBetween.\n\n> Plain quote.\n"
+	out, err := renderMarkdown(Fields{Content: content, Admonitions: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"<div class=\"admonition warning\">",
+		"<p class=\"admonition-title\">Warning</p>",
+		"<p>Mind the <strong>gap</strong>.</p>",
+		"<blockquote>\n<p>Plain quote.</p>\n</blockquote>",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "[!WARNING]") {
+		t.Errorf("marker left in output:\n%s", out)
+	}
+
+	out, _ = renderMarkdown(Fields{Content: content})
+	if strings.Contains(out, "admonition") {
+		t.Errorf("admonition rendered while disabled:\n%s", out)
+	}
+}
+
+func TestSanitizePolicyXSSVectors(t *testing.T) {
+	policy := newSanitizePolicy(nil, nil, nil)
+	vectors := []string{
+		`<script>alert(1)</script>`,
+		`<SCRIPT SRC=//evil.example/x.js></SCRIPT>`,
+		`<img src=x onerror=alert(1)>`,
+		`<img src="javascript:alert(1)">`,
+		`<a href="javascript:alert(1)">x</a>`,
+		`<a href="JaVaScRiPt:alert(1)">x</a>`,
+		`<a href="java&#x09;script:alert(1)">x</a>`,
+		`<a href="&#106;avascript:alert(1)">x</a>`,
+		`<a href=" javascript:alert(1)">x</a>`,
+		`<a href="vbscript:msgbox(1)">x</a>`,
+		`<a href="data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==">x</a>`,
+		`<svg onload=alert(1)><circle/></svg>`,
+		`<iframe src="https://evil.example"></iframe>`,
+		`<body onload=alert(1)>`,
+		`<div style="background:url(javascript:alert(1))">x</div>`,
+		`<p onclick="alert(1)">x</p>`,
+		`<style>@import "javascript:alert(1)";</style>`,
+		`<object data="javascript:alert(1)"></object>`,
+		`<math><mi xlink:href="javascript:alert(1)">x</mi></math>`,
+		`<form action="javascript:alert(1)"><button>x</button></form>`,
+		`<!--<img src=x onerror=alert(1)>-->`,
+		`<scr<script>ipt>alert(1)</script>`,
+		`"><script>alert(1)</script>`,
+		`<img src=x:alert(1) onerror=eval(src)>`,
+		`<noscript><p title="</noscript><img src=x onerror=alert(1)>">`,
+		`<textarea><script>alert(1)</script></textarea>`,
+	}
+	for _, vector := range vectors {
+		out := strings.ToLower(policy.Sanitize(vector))
+		for _, bad := range []string{"<script", "javascript:", "vbscript:", "data:", "onerror", "onload", "onclick", "<iframe", "<svg", "<style", "<object", "style=", "<img src=\"x:"} {
+			if strings.Contains(out, bad) {
+				t.Errorf("Sanitize(%q) = %q, contains %q", vector, out, bad)
+			}
+		}
+	}
+
+	keep := `<p class="lead">Hi <a href="https://example.com/a?b=1&amp;c=2" title="t">link</a> <img src="/x.png" alt="x"> <a href="#top">top</a></p>`
+	if got := policy.Sanitize(keep); got != keep {
+		t.Errorf("safe markup changed:\n got %s\nwant %s", got, keep)
+	}
+	if got := policy.Sanitize(`<custom>text <b>bold</b></custom>`); got != "text <b>bold</b>" {
+		t.Errorf("unknown tag = %q", got)
+	}
+
+	custom := newSanitizePolicy([]string{"p", "a"}, []string{"a.href"}, []string{"https", "tel"})
+	if got := custom.Sanitize(`<p class="x"><a href="tel:123" title="t">call</a> <b>b</b></p>`); got != `<p><a href="tel:123">call</a> b</p>` {
+		t.Errorf("custom policy = %q", got)
+	}
+	if got := custom.Sanitize(`<a href="http://example.com">x</a>`); got != `<a>x</a>` {
+		t.Errorf("disallowed scheme kept: %q", got)
+	}
+	if got := newSanitizePolicy([]string{"script"}, []string{"onclick"}, nil).Sanitize(`<script>alert(1)</script><p onclick="x">`); got != "" {
+		t.Errorf("script or handler allowed by config: %q", got)
+	}
+}
+
+func TestSmartypants(t *testing.T) {
+	content := "She said \"hello\" -- then left... `\"raw\" -- code`\n"
+	out, err := renderMarkdown(Fields{Content: content, Smartypants: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"&ldquo;hello&rdquo;", "&ndash;", "&hellip;", "<code>&quot;raw&quot; -- code</code>"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+
+	out, err = renderMarkdown(Fields{Content: content})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out, "&ldquo;") || strings.Contains(out, "&ndash;") || strings.Contains(out, "&hellip;") {
+		t.Errorf("smart typography applied by default:\n%s", out)
+	}
+}
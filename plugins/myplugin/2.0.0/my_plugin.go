@@ -3,6 +3,11 @@ package main
 import (
 	"context"
 	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
 
 	"github.com/hyperbricks/hyperbricks/pkg/shared"
 )
@@ -10,6 +15,15 @@ import (
 // The plugin field definition
 type Fields struct {
 	Message string `mapstructure:"message"`
+	Class   string `mapstructure:"class"`
+	// Escape HTML-escapes Message instead of rendering it as markup.
+	Escape bool `mapstructure:"escape"`
+	// Key names a request input (form or query parameter) to render instead
+	// of Message; Default is used when the request does not carry it.
+	Key     string `mapstructure:"key"`
+	Default string `mapstructure:"default"`
+	// ValidateOnly decodes the config and reports errors without rendering.
+	ValidateOnly bool `mapstructure:"validate_only"`
 }
 
 // Basic config for ComponentRenderers
@@ -38,12 +52,149 @@ func (p *MyPlugin) Render(instance interface{}, ctx context.Context) (any, []err
 			Path:     config.HyperBricksPath,
 			Key:      config.HyperBricksKey,
 			Rejected: true,
-			Err:      fmt.Sprintf("Failed to decode plugin instance: %v", err),
+			Err:      fmt.Sprintf("Failed to decode plugin instance: %s", describeDecodeError(err)),
 		})
 		return "<!--Failed to render MyPlugin -->", errors
 	}
+	if config.Fields.ValidateOnly {
+		return "", errors
+	}
+
+	return wrapContent(config.Fields.Class, resolveContent(ctx, config.Fields)), errors
+}
+
+// resolveContent returns the request input named by Key, or Message.
+func resolveContent(ctx context.Context, fields Fields) string {
+	if key := strings.TrimSpace(fields.Key); key != "" {
+		// Request input is untrusted, so it is always escaped.
+		value, ok := inputFromContext(ctx, key)
+		if !ok {
+			value = fields.Default
+		}
+		return html.EscapeString(value)
+	}
+	if fields.Escape {
+		return html.EscapeString(fields.Message)
+	}
+	return fields.Message
+}
+
+// wrapContent places body in the container div, escaping the class attribute.
+func wrapContent(class, body string) string {
+	if class == "" {
+		class = "my_plugin-content"
+	}
+	return fmt.Sprintf("<div class=\"%s\">%s</div>\n", html.EscapeString(class), body)
+}
+
+// inputFromContext looks key up in the posted form data, then the request
+// form and query string. The boolean reports whether the key was present.
+func inputFromContext(ctx context.Context, key string) (string, bool) {
+	if form, ok := ctx.Value(shared.FormData).(url.Values); ok && form != nil {
+		if v, exists := form[key]; exists && len(v) > 0 {
+			return v[0], true
+		}
+	}
+	if req, ok := ctx.Value(shared.Request).(*http.Request); ok && req != nil {
+		if v, exists := req.Form[key]; exists && len(v) > 0 {
+			return v[0], true
+		}
+		if v, exists := req.PostForm[key]; exists && len(v) > 0 {
+			return v[0], true
+		}
+		if v, exists := req.URL.Query()[key]; exists && len(v) > 0 {
+			return v[0], true
+		}
+	}
+	return "", false
+}
+
+// decodeErrorPatterns rewrite mapstructure's type mismatch messages into
+// "<field>: expected <type>, got <type>" so the offending data.* key is clear.
+var decodeErrorPatterns = []struct {
+	re     *regexp.Regexp
+	format func(m []string) string
+}{
+	{regexp.MustCompile(`^'([^']*)' expected type '([^']*)', got unconvertible type '([^']*)', value: '(.*)'$`), func(m []string) string {
+		return fmt.Sprintf("%s: expected %s, got %s %q", m[1], friendlyType(m[2]), friendlyType(m[3]), m[4])
+	}},
+	{regexp.MustCompile(`^'([^']*)' expected type '([^']*)', got '([^']*)'$`), func(m []string) string {
+		return fmt.Sprintf("%s: expected %s, got %s", m[1], friendlyType(m[2]), friendlyType(m[3]))
+	}},
+	{regexp.MustCompile(`^'([^']*)':? source data must be an array or slice, got (\S+)$`), func(m []string) string {
+		return fmt.Sprintf("%s: expected a list, got %s", m[1], friendlyType(m[2]))
+	}},
+	{regexp.MustCompile(`^'([^']*)' expected a map, got '([^']*)'$`), func(m []string) string {
+		return fmt.Sprintf("%s: expected a map, got %s", m[1], friendlyType(m[2]))
+	}},
+	{regexp.MustCompile(`^cannot parse '([^']*)' as (\w+): (.*)$`), func(m []string) string {
+		return fmt.Sprintf("%s: expected %s (%s)", m[1], friendlyType(m[2]), m[3])
+	}},
+}
+
+// describeDecodeError lists every field-level failure in the errors
+// shared.DecodeWithBasicHooks returned, rewritten by decodeErrorPatterns
+// where the message is recognised.
+func describeDecodeError(errs []error) string {
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, decodeMessages(err)...)
+	}
+	for i, msg := range messages {
+		for _, pattern := range decodeErrorPatterns {
+			if m := pattern.re.FindStringSubmatch(msg); m != nil {
+				messages[i] = pattern.format(m)
+				break
+			}
+		}
+	}
+	return strings.Join(messages, "; ")
+}
 
-	return fmt.Sprintf("<div class=\"my_plugin-content\">%s</div>\n", config.Fields.Message), errors
+// decodeMessages splits one decode error into its field-level messages. The
+// host keeps only the text of a *mapstructure.Error in its ComponentError
+// ("N error(s) decoding:\n\n* msg\n* msg"), so that form is split as well.
+func decodeMessages(err error) []string {
+	var messages []string
+	switch wrapped := err.(type) {
+	case interface{ WrappedErrors() []error }: // *mapstructure.Error
+		for _, e := range wrapped.WrappedErrors() {
+			messages = append(messages, decodeMessages(e)...)
+		}
+		return messages
+	case interface{ Unwrap() []error }:
+		for _, e := range wrapped.Unwrap() {
+			messages = append(messages, decodeMessages(e)...)
+		}
+		return messages
+	}
+	text := err.Error()
+	_, list, ok := strings.Cut(text, "decoding:\n\n")
+	if !ok {
+		return []string{text}
+	}
+	for _, line := range strings.Split(list, "\n") {
+		if line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "* ")); line != "" {
+			messages = append(messages, line)
+		}
+	}
+	return messages
+}
+
+// friendlyType names Go kinds the way config authors think of them.
+func friendlyType(goType string) string {
+	goType = strings.TrimPrefix(goType, "*")
+	switch {
+	case strings.HasPrefix(goType, "[]"), goType == "slice", goType == "array":
+		return "list"
+	case strings.HasPrefix(goType, "map"):
+		return "map"
+	case strings.HasPrefix(goType, "int"), strings.HasPrefix(goType, "uint"):
+		return "integer"
+	case strings.HasPrefix(goType, "float"):
+		return "number"
+	}
+	return goType
 }
 
 // var Plugin shared.PluginRenderer = &MyPlugin{}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestWrapContentEscapesClass(t *testing.T) {
+	got := wrapContent(`note" onmouseover="x()`, "Hello")
+	want := "<div class=\"note&#34; onmouseover=&#34;x()\">Hello</div>\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestEscapeMessage(t *testing.T) {
+	for _, tc := range []struct {
+		escape bool
+		want   string
+	}{
+		{false, "<b>Hi</b>"},
+		{true, "&lt;b&gt;Hi&lt;/b&gt;"},
+	} {
+		got := resolveContent(context.Background(), Fields{Message: "<b>Hi</b>", Escape: tc.escape})
+		if got != tc.want {
+			t.Errorf("escape=%v: got %q, want %q", tc.escape, got, tc.want)
+		}
+	}
+}
@@ -3,6 +3,7 @@ module github.com/hyperbricks/plugins/tailwindcss
 go 1.23.4
 
 require (
+	github.com/andybalholm/brotli v1.1.1
 	github.com/hyperbricks/hyperbricks v0.7.8-alpha
 	go.uber.org/zap v1.27.0
 )
@@ -45,6 +46,7 @@ require (
 	github.com/spf13/cast v1.7.0 // indirect
 	github.com/spf13/cobra v1.8.1 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
+	github.com/xyproto/randomstring v1.0.5 // indirect
 	go.uber.org/multierr v1.10.0 // indirect
 	golang.org/x/crypto v0.33.0 // indirect
 	golang.org/x/net v0.33.0 // indirect
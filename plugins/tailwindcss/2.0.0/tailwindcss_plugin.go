@@ -3,33 +3,65 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"expvar"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/andybalholm/brotli"
 	"github.com/hyperbricks/hyperbricks/pkg/logging"
 	"github.com/hyperbricks/hyperbricks/pkg/shared"
 	"go.uber.org/zap"
 )
 
 // ---- Cache setup ----
-var tailwindCache sync.Map // key: cacheKey string, value: result string
+// Builds are reused while input_css, config, postcss and output_css are unchanged.
+// Without data.cache_dir results are kept in process memory.
+var tailwindArtifacts = newArtifactTracker(newMemoryCache())
+
+// metrics counts renders, builds, cache hits/misses and errors under the
+// expvar name "tailwindcss" (data.metrics).
+var metrics = newPluginMetrics("tailwindcss")
 
 type Fields struct {
-	InputCSS  string `mapstructure:"input_css"`  // Input CSS file
-	OutputCSS string `mapstructure:"output_css"` // Output CSS file
-	Config    string `mapstructure:"config"`     // Optional config path
-	Binary    string `mapstructure:"binary"`     // Optional Tailwind CLI binary path
-	Signal    bool   `mapstructure:"signal"`     // Run signal test before build
-	Enclose   string `mapstructure:"enclose"`    // (Optional) Wrap output (not recommended for static file usage)
-	Minify    bool   `mapstructure:"minify"`     // Pass --minify to CLI
-	Debug     bool   `mapstructure:"debug"`      // Show verbose CLI/stdout/stderr logging
-	Cache     bool   `mapstructure:"cache"`      // Enable memory caching
+	InputCSS       string `mapstructure:"input_css"`       // Input CSS file
+	OutputCSS      string `mapstructure:"output_css"`      // Output CSS file
+	Config         string `mapstructure:"config"`          // Optional config path
+	Binary         string `mapstructure:"binary"`          // Optional Tailwind CLI binary path
+	Signal         bool   `mapstructure:"signal"`          // Run signal test before build
+	Enclose        string `mapstructure:"enclose"`         // (Optional) Wrap output (not recommended for static file usage)
+	Minify         bool   `mapstructure:"minify"`          // Pass --minify to CLI
+	Debug          bool   `mapstructure:"debug"`           // Show verbose CLI/stdout/stderr logging
+	Cache          bool   `mapstructure:"cache"`           // Enable memory caching
+	CacheDir       string `mapstructure:"cache_dir"`       // Keep cached results as files here (implies cache)
+	CacheTTL       string `mapstructure:"cache_ttl"`       // Optional lifetime of a cached result, e.g. 24h
+	PostCSS        string `mapstructure:"postcss"`         // Optional postcss.config.js, passed as --postcss
+	Inline         *bool  `mapstructure:"inline"`          // true: <style>…</style>, false: <link>; ignored with enclose
+	Manifest       string `mapstructure:"manifest"`        // JSON manifest to record the stylesheet's web path in
+	ManifestName   string `mapstructure:"manifest_name"`   // manifest key (default: output_css base name)
+	Metrics        bool   `mapstructure:"metrics"`         // Count operations in the expvar map "tailwindcss"
+	Compress       string `mapstructure:"compress"`        // gzip | brotli | both: write output_css.gz / .br next to the output
+	ValidateOnly   bool   `mapstructure:"validate_only"`   // Check the config and report errors; no CLI run, no files written
+	DirMode        string `mapstructure:"dir_mode"`        // Octal permissions for created directories (default 0755)
+	FileMode       string `mapstructure:"file_mode"`       // Octal permissions for written files (default 0644)
+	Placeholder    string `mapstructure:"placeholder"`     // Marker in enclose replaced by the web path (default "|")
+	CSSPlaceholder string `mapstructure:"css_placeholder"` // Marker in enclose replaced by the CSS (default "{{css}}")
+	Touch          bool   `mapstructure:"touch"`           // Bump output_css's mtime on a cache hit, for external watchers
 }
 
 type TailwindConfig struct {
@@ -67,8 +99,7 @@ func dumpPipe(logger *zap.SugaredLogger, prefix string, r io.Reader, wg *sync.Wa
 	}
 }
 
-func (p *TailwindPlugin) Render(instance interface{}, ctx context.Context) (any, []error) {
-	var errs []error
+func (p *TailwindPlugin) Render(instance interface{}, ctx context.Context) (_ any, errs []error) {
 	var cfg TailwindConfig
 	if err := shared.DecodeWithBasicHooks(instance, &cfg); err != nil {
 		errs = append(errs, shared.ComponentError{
@@ -76,7 +107,56 @@ func (p *TailwindPlugin) Render(instance interface{}, ctx context.Context) (any,
 			Path:     cfg.HyperBricksPath,
 			Key:      cfg.HyperBricksKey,
 			Rejected: true,
-			Err:      fmt.Sprintf("decode error: %v", err),
+			Err:      fmt.Sprintf("decode error: %s", describeDecodeError(err)),
+		})
+		return "", errs
+	}
+
+	if cfg.Fields.ValidateOnly {
+		return "", validateConfig(cfg)
+	}
+
+	if cfg.Fields.Metrics {
+		metrics.enable()
+	}
+	metrics.add("renders", 1)
+	defer func() {
+		metrics.add("errors", int64(len(errs)))
+		if cfg.Fields.Debug {
+			metrics.logSnapshot()
+		}
+	}()
+
+	compress, err := parseCompress(cfg.Fields.Compress)
+	if err != nil {
+		errs = append(errs, shared.ComponentError{
+			Hash:     shared.GenerateHash(),
+			Path:     cfg.HyperBricksPath,
+			Key:      cfg.HyperBricksKey,
+			Rejected: true,
+			Err:      err.Error(),
+		})
+		return "", errs
+	}
+	modes, err := parseFileModes(cfg.Fields.DirMode, cfg.Fields.FileMode)
+	if err != nil {
+		errs = append(errs, shared.ComponentError{
+			Hash:     shared.GenerateHash(),
+			Path:     cfg.HyperBricksPath,
+			Key:      cfg.HyperBricksKey,
+			Rejected: true,
+			Err:      err.Error(),
+		})
+		return "", errs
+	}
+	cacheTTL, err := parseCacheTTL(cfg.Fields.CacheTTL)
+	if err != nil {
+		errs = append(errs, shared.ComponentError{
+			Hash:     shared.GenerateHash(),
+			Path:     cfg.HyperBricksPath,
+			Key:      cfg.HyperBricksKey,
+			Rejected: true,
+			Err:      err.Error(),
 		})
 		return "", errs
 	}
@@ -88,19 +168,31 @@ func (p *TailwindPlugin) Render(instance interface{}, ctx context.Context) (any,
 	logger := logging.GetLogger()
 
 	// ---- Cache logic ----
-	cache := cfg.Fields.Cache
-	// Key includes relevant fields; extend if you want
-	cacheKey := fmt.Sprintf("%s|%s|%s|%v|%v",
-		cfg.Fields.InputCSS, cfg.Fields.OutputCSS, cfg.Fields.Config, cfg.Fields.Minify, cfg.Fields.Enclose)
+	cacheDir := strings.TrimSpace(cfg.Fields.CacheDir)
+	cache := cfg.Fields.Cache || cacheDir != ""
+	artifacts := tailwindArtifacts
+	if cacheDir != "" {
+		artifacts = newArtifactTracker(newFileCache(cacheDir, modes))
+	}
+	cacheKey := renderCacheKey(cfg.Fields, compress)
 
 	if cache {
-		if cached, ok := tailwindCache.Load(cacheKey); ok {
-			if str, ok := cached.(string); ok {
-				if cfg.Fields.Debug {
-					logger.Info("TailwindPlugin cache hit for:", cacheKey)
+		if cached, ok := cachedResult(artifacts, cacheKey); ok {
+			if cfg.Fields.Debug {
+				logger.Info("TailwindPlugin cache hit for:", cacheKey)
+			}
+			if cfg.Fields.Touch {
+				// A live-reload watcher on output_css still sees a change.
+				if err := artifacts.Touch(cacheKey, cacheTTL); err != nil {
+					return cached, []error{shared.ComponentError{
+						Hash: shared.GenerateHash(),
+						Path: cfg.HyperBricksPath,
+						Key:  cfg.HyperBricksKey,
+						Err:  fmt.Sprintf("failed to touch output_css: %v", err),
+					}}
 				}
-				return str, nil
 			}
+			return cached, nil
 		}
 	}
 
@@ -137,11 +229,48 @@ func (p *TailwindPlugin) Render(instance interface{}, ctx context.Context) (any,
 		return "", errs
 	}
 
-	args := []string{"-i", cfg.Fields.InputCSS, "-o", cfg.Fields.OutputCSS}
+	postcss := strings.TrimSpace(cfg.Fields.PostCSS)
+	if postcss != "" {
+		if info, err := os.Stat(postcss); err != nil || info.IsDir() {
+			errs = append(errs, shared.ComponentError{
+				Hash:     shared.GenerateHash(),
+				Path:     cfg.HyperBricksPath,
+				Key:      cfg.HyperBricksKey,
+				Rejected: true,
+				Err:      fmt.Sprintf("postcss config not found: %s", postcss),
+			})
+			return "", errs
+		}
+	}
+
+	// Build into a temp file next to output_css and rename it into place on
+	// success, so a failed or in-progress build never replaces the last good
+	// stylesheet.
+	tmpOut, err := stageOutput(cfg.Fields.OutputCSS, modes)
+	if err != nil {
+		errs = append(errs, shared.ComponentError{
+			Hash:     shared.GenerateHash(),
+			Path:     cfg.HyperBricksPath,
+			Key:      cfg.HyperBricksKey,
+			Rejected: true,
+			Err:      fmt.Sprintf("failed to create temp output: %v", err),
+		})
+		return "", errs
+	}
+	defer os.Remove(tmpOut) // no-op once renamed
+
+	args := []string{"-i", cfg.Fields.InputCSS, "-o", tmpOut}
 	if cfg.Fields.Minify {
 		args = append(args, "--minify")
 	}
+	if postcss != "" {
+		args = append(args, "--postcss", postcss)
+		if cfg.Fields.Debug {
+			logger.Info("→ PostCSS config: --postcss " + postcss)
+		}
+	}
 
+	metrics.add("builds", 1)
 	cmd := exec.CommandContext(ctx, bin, args...)
 	if cfg.Fields.Debug {
 		logger.Info("→ Running tailwind CLI: " + strings.Join(args, " "))
@@ -190,8 +319,70 @@ func (p *TailwindPlugin) Render(instance interface{}, ctx context.Context) (any,
 		}
 	}
 
+	// The CLI may have replaced the staged file, so its mode is set again.
+	err = os.Chmod(tmpOut, modes.File)
+	if err == nil {
+		err = os.Rename(tmpOut, cfg.Fields.OutputCSS)
+	}
+	if err != nil {
+		errs = append(errs, shared.ComponentError{
+			Hash:     shared.GenerateHash(),
+			Path:     cfg.HyperBricksPath,
+			Key:      cfg.HyperBricksKey,
+			Rejected: true,
+			Err:      fmt.Sprintf("failed to write output CSS: %v", err),
+		})
+		return "", errs
+	}
+
+	relPath := staticWebPath(cfg.Fields.OutputCSS)
+	if manifest := strings.TrimSpace(cfg.Fields.Manifest); manifest != "" {
+		name := strings.TrimSpace(cfg.Fields.ManifestName)
+		if name == "" {
+			name = filepath.Base(cfg.Fields.OutputCSS)
+		}
+		webPath := relPath
+		if webPath == "" {
+			webPath = filepath.ToSlash(cfg.Fields.OutputCSS)
+		}
+		if err := updateManifest(manifest, name, webPath, modes); err != nil {
+			errs = append(errs, shared.ComponentError{
+				Hash:     shared.GenerateHash(),
+				Path:     cfg.HyperBricksPath,
+				Key:      cfg.HyperBricksKey,
+				Rejected: true,
+				Err:      fmt.Sprintf("failed to update manifest: %v", err),
+			})
+			return "", errs
+		}
+		if cfg.Fields.Debug {
+			logger.Info("TailwindPlugin manifest entry:", manifest, name, webPath)
+		}
+	}
+
+	// Compressed siblings are a convenience for the static server: failures
+	// are reported without rejecting the build.
+	compressFailed := false
+	if len(compress) > 0 {
+		var compressErrs []error
+		if cssBytes, err := os.ReadFile(cfg.Fields.OutputCSS); err == nil {
+			compressErrs = writeCompressed(cfg.Fields.OutputCSS, cssBytes, compress, modes)
+		} else {
+			compressErrs = []error{err}
+		}
+		for _, err := range compressErrs {
+			compressFailed = true
+			errs = append(errs, shared.ComponentError{
+				Hash: shared.GenerateHash(),
+				Path: cfg.HyperBricksPath,
+				Key:  cfg.HyperBricksKey,
+				Err:  fmt.Sprintf("failed to compress output CSS: %v", err),
+			})
+		}
+	}
+
 	result := ""
-	if cfg.Fields.Enclose != "" {
+	if cfg.Fields.Enclose != "" || cfg.Fields.Inline != nil {
 		cssBytes, err := os.ReadFile(cfg.Fields.OutputCSS)
 		if err != nil {
 			errs = append(errs, shared.ComponentError{
@@ -204,37 +395,38 @@ func (p *TailwindPlugin) Render(instance interface{}, ctx context.Context) (any,
 			return "", errs
 		}
 
-		hbConfig := shared.GetHyperBricksConfiguration()
-		staticDir := ""
-		if tbstatic, ok := hbConfig.Directories["static"]; ok {
-			staticDir = filepath.Clean(tbstatic)
-			staticDir = filepath.ToSlash(staticDir)
+		switch {
+		case cfg.Fields.Enclose != "":
+			result = encloseOutput(cfg.Fields.Enclose, cfg.Fields.Placeholder, cfg.Fields.CSSPlaceholder, relPath, cssBytes)
+		case *cfg.Fields.Inline:
+			// Keep a "</style" inside the CSS from closing the tag early.
+			result = "<style>" + strings.ReplaceAll(string(cssBytes), "</style", `<\/style`) + "</style>"
+		default:
+			result = fmt.Sprintf(`<link rel="stylesheet" href="%s" integrity="%s">`, relPath, sriHash(cssBytes))
 		}
-		absOut, _ := filepath.Abs(cfg.Fields.OutputCSS)
-		absOut = filepath.ToSlash(absOut)
 
-		relPath := ""
-		if staticDir != "" {
-			idx := strings.Index(absOut, staticDir)
-			if idx >= 0 {
-				relPath = absOut[idx+len(staticDir):]
-				relPath = strings.TrimLeft(relPath, "/")
-				relPath = "static/" + relPath
-			}
-		}
-		result = cfg.Fields.Enclose
-		result = strings.ReplaceAll(result, "|", relPath)
-		result = strings.ReplaceAll(result, "{{css}}", string(cssBytes))
-
-		logger.Info("Enclose | absOut:", absOut)
-		logger.Info("Enclose | staticDir:", staticDir)
 		logger.Info("Enclose | relPath (for link):", relPath)
 	}
 
 	// ---- Save to cache if enabled ----
-	if cache {
-		tailwindCache.Store(cacheKey, result)
-		if cfg.Fields.Debug {
+	// A failed compression is retried by the next render instead of cached.
+	if cache && !compressFailed {
+		inputs := []string{cfg.Fields.InputCSS}
+		for _, path := range []string{cfg.Fields.Config, postcss} {
+			if path != "" {
+				inputs = append(inputs, path)
+			}
+		}
+		// The CSS was built; a cache that can't be written only costs the
+		// next render a rebuild.
+		if err := artifacts.Record(cacheKey, inputs, cfg.Fields.OutputCSS, result, cacheTTL); err != nil {
+			errs = append(errs, shared.ComponentError{
+				Hash: shared.GenerateHash(),
+				Path: cfg.HyperBricksPath,
+				Key:  cfg.HyperBricksKey,
+				Err:  fmt.Sprintf("failed to save cache: %v", err),
+			})
+		} else if cfg.Fields.Debug {
 			logger.Info("TailwindPlugin cache save for:", cacheKey)
 		}
 	}
@@ -242,6 +434,698 @@ func (p *TailwindPlugin) Render(instance interface{}, ctx context.Context) (any,
 	return result, errs
 }
 
+// validateConfig is data.validate_only: it reports what a build would
+// reject without running the Tailwind CLI or touching output_css.
+func validateConfig(cfg TailwindConfig) []error {
+	var errs []error
+	report := func(msg string) {
+		errs = append(errs, shared.ComponentError{
+			Hash:     shared.GenerateHash(),
+			Path:     cfg.HyperBricksPath,
+			Key:      cfg.HyperBricksKey,
+			Rejected: true,
+			Err:      msg,
+		})
+	}
+
+	if cfg.Fields.OutputCSS == "" {
+		report("output_css field must be provided")
+	}
+	if _, err := parseCompress(cfg.Fields.Compress); err != nil {
+		report(err.Error())
+	}
+	if _, err := parseFileModes(cfg.Fields.DirMode, cfg.Fields.FileMode); err != nil {
+		report(err.Error())
+	}
+	if _, err := parseCacheTTL(cfg.Fields.CacheTTL); err != nil {
+		report(err.Error())
+	}
+	bin := cfg.Fields.Binary
+	if bin == "" {
+		bin = "tailwindcss"
+	}
+	if _, err := exec.LookPath(bin); err != nil {
+		report(fmt.Sprintf("tailwind binary not found: %v", err))
+	}
+	for _, file := range []struct{ key, path string }{
+		{"input_css", cfg.Fields.InputCSS},
+		{"config", cfg.Fields.Config},
+		{"postcss", strings.TrimSpace(cfg.Fields.PostCSS)},
+	} {
+		if file.path == "" {
+			continue
+		}
+		if info, err := os.Stat(file.path); err != nil || info.IsDir() {
+			report(fmt.Sprintf("%s not found: %s", file.key, file.path))
+		}
+	}
+	return errs
+}
+
+// renderCacheKey identifies a render's output: every field that changes
+// the built CSS or the returned markup.
+func renderCacheKey(f Fields, compress []string) string {
+	inline := "unset"
+	if f.Inline != nil {
+		inline = fmt.Sprint(*f.Inline)
+	}
+	return fmt.Sprintf("%s|%s|%s|%v|%v|%s|%s|%s|%s|%s",
+		f.InputCSS, f.OutputCSS, f.Config, f.Minify, f.Enclose, f.PostCSS, inline, strings.Join(compress, ","), f.Placeholder, f.CSSPlaceholder)
+}
+
+// cachedResult returns the output cached in artifacts for key while it is
+// still current, counting the lookup as a cache hit or miss.
+func cachedResult(artifacts *artifactTracker, key string) (string, bool) {
+	cached, ok := artifacts.Current(key)
+	if ok {
+		metrics.add("cache_hits", 1)
+	} else {
+		metrics.add("cache_misses", 1)
+	}
+	return cached, ok
+}
+
+// metricsLogInterval is the minimum time between two counter snapshots in
+// the debug log.
+const metricsLogInterval = time.Minute
+
+// pluginMetrics counts plugin operations in an expvar map, served on
+// /debug/vars when the host mounts expvar's handler. Counting starts once a
+// config sets data.metrics; until then add returns after one atomic load.
+type pluginMetrics struct {
+	name    string
+	enabled atomic.Bool
+	once    sync.Once
+	vars    *expvar.Map
+	lastLog atomic.Int64 // unix nanoseconds of the last debug snapshot
+}
+
+func newPluginMetrics(name string) *pluginMetrics {
+	return &pluginMetrics{name: name}
+}
+
+// enable publishes the expvar map on first use. A map of the same name that
+// is already published, e.g. by another version of the plugin, is shared.
+func (m *pluginMetrics) enable() {
+	m.once.Do(func() {
+		m.vars = publishMap(m.name)
+		m.enabled.Store(true)
+	})
+}
+
+// publishMap returns the expvar map published as name, publishing one if
+// there is none. expvar.NewMap panics when name is taken: by another plugin
+// copy publishing between the Get and the NewMap, whose map is then shared,
+// or by a var that is not a map, in which case the counters stay unpublished.
+func publishMap(name string) (vars *expvar.Map) {
+	if existing, ok := expvar.Get(name).(*expvar.Map); ok {
+		return existing
+	}
+	defer func() {
+		if recover() == nil {
+			return
+		}
+		if existing, ok := expvar.Get(name).(*expvar.Map); ok {
+			vars = existing
+		} else {
+			vars = new(expvar.Map)
+		}
+	}()
+	return expvar.NewMap(name)
+}
+
+// add increments counter by delta while metrics are enabled.
+func (m *pluginMetrics) add(counter string, delta int64) {
+	if delta == 0 || !m.enabled.Load() {
+		return
+	}
+	m.vars.Add(counter, delta)
+}
+
+// value returns counter, or 0 while metrics are disabled.
+func (m *pluginMetrics) value(counter string) int64 {
+	if !m.enabled.Load() {
+		return 0
+	}
+	if v, ok := m.vars.Get(counter).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+// logSnapshot writes every counter to the shared logger, at most once per
+// metricsLogInterval.
+func (m *pluginMetrics) logSnapshot() {
+	if !m.enabled.Load() {
+		return
+	}
+	now := time.Now().UnixNano()
+	last := m.lastLog.Load()
+	if now-last < int64(metricsLogInterval) || !m.lastLog.CompareAndSwap(last, now) {
+		return
+	}
+	var keysAndValues []interface{}
+	m.vars.Do(func(kv expvar.KeyValue) {
+		keysAndValues = append(keysAndValues, kv.Key, kv.Value.String())
+	})
+	logging.GetLogger().Infow(m.name+" metrics", keysAndValues...)
+}
+
+// decodeErrorPatterns rewrite mapstructure's type mismatch messages into
+// "<field>: expected <type>, got <type>" so the offending data.* key is clear.
+var decodeErrorPatterns = []struct {
+	re     *regexp.Regexp
+	format func(m []string) string
+}{
+	{regexp.MustCompile(`^'([^']*)' expected type '([^']*)', got unconvertible type '([^']*)', value: '(.*)'$`), func(m []string) string {
+		return fmt.Sprintf("%s: expected %s, got %s %q", m[1], friendlyType(m[2]), friendlyType(m[3]), m[4])
+	}},
+	{regexp.MustCompile(`^'([^']*)' expected type '([^']*)', got '([^']*)'$`), func(m []string) string {
+		return fmt.Sprintf("%s: expected %s, got %s", m[1], friendlyType(m[2]), friendlyType(m[3]))
+	}},
+	{regexp.MustCompile(`^'([^']*)':? source data must be an array or slice, got (\S+)$`), func(m []string) string {
+		return fmt.Sprintf("%s: expected a list, got %s", m[1], friendlyType(m[2]))
+	}},
+	{regexp.MustCompile(`^'([^']*)' expected a map, got '([^']*)'$`), func(m []string) string {
+		return fmt.Sprintf("%s: expected a map, got %s", m[1], friendlyType(m[2]))
+	}},
+	{regexp.MustCompile(`^cannot parse '([^']*)' as (\w+): (.*)$`), func(m []string) string {
+		return fmt.Sprintf("%s: expected %s (%s)", m[1], friendlyType(m[2]), m[3])
+	}},
+}
+
+// describeDecodeError lists every field-level failure in the errors
+// shared.DecodeWithBasicHooks returned, rewritten by decodeErrorPatterns
+// where the message is recognised.
+func describeDecodeError(errs []error) string {
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, decodeMessages(err)...)
+	}
+	for i, msg := range messages {
+		for _, pattern := range decodeErrorPatterns {
+			if m := pattern.re.FindStringSubmatch(msg); m != nil {
+				messages[i] = pattern.format(m)
+				break
+			}
+		}
+	}
+	return strings.Join(messages, "; ")
+}
+
+// decodeMessages splits one decode error into its field-level messages. The
+// host keeps only the text of a *mapstructure.Error in its ComponentError
+// ("N error(s) decoding:\n\n* msg\n* msg"), so that form is split as well.
+func decodeMessages(err error) []string {
+	var messages []string
+	switch wrapped := err.(type) {
+	case interface{ WrappedErrors() []error }: // *mapstructure.Error
+		for _, e := range wrapped.WrappedErrors() {
+			messages = append(messages, decodeMessages(e)...)
+		}
+		return messages
+	case interface{ Unwrap() []error }:
+		for _, e := range wrapped.Unwrap() {
+			messages = append(messages, decodeMessages(e)...)
+		}
+		return messages
+	}
+	text := err.Error()
+	_, list, ok := strings.Cut(text, "decoding:\n\n")
+	if !ok {
+		return []string{text}
+	}
+	for _, line := range strings.Split(list, "\n") {
+		if line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "* ")); line != "" {
+			messages = append(messages, line)
+		}
+	}
+	return messages
+}
+
+// friendlyType names Go kinds the way config authors think of them.
+func friendlyType(goType string) string {
+	goType = strings.TrimPrefix(goType, "*")
+	switch {
+	case strings.HasPrefix(goType, "[]"), goType == "slice", goType == "array":
+		return "list"
+	case strings.HasPrefix(goType, "map"):
+		return "map"
+	case strings.HasPrefix(goType, "int"), strings.HasPrefix(goType, "uint"):
+		return "integer"
+	case strings.HasPrefix(goType, "float"):
+		return "number"
+	}
+	return goType
+}
+
+// staticWebPath returns output's path below the HyperBricks static directory
+// as a web path ("static/css/app.css"), or "" when it is outside it.
+func staticWebPath(output string) string {
+	hbConfig := shared.GetHyperBricksConfiguration()
+	staticDir := ""
+	if tbstatic, ok := hbConfig.Directories["static"]; ok {
+		staticDir = filepath.Clean(tbstatic)
+		staticDir = filepath.ToSlash(staticDir)
+	}
+	absOut, _ := filepath.Abs(output)
+	absOut = filepath.ToSlash(absOut)
+
+	relPath := ""
+	if staticDir != "" {
+		idx := strings.Index(absOut, staticDir)
+		if idx >= 0 {
+			relPath = absOut[idx+len(staticDir):]
+			relPath = strings.TrimLeft(relPath, "/")
+			relPath = "static/" + relPath
+		}
+	}
+	return relPath
+}
+
+// Manifest writers take a lock file next to the manifest, so builds from
+// both asset plugins (and several processes) never interleave their writes.
+const (
+	manifestLockTimeout = 10 * time.Second
+	manifestLockStale   = 30 * time.Second
+)
+
+// updateManifest merges name → webPath into the JSON manifest at path.
+func updateManifest(path, name, webPath string, modes fileModes) error {
+	unlock, err := lockManifest(path, modes.Dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	entries := map[string]string{}
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil && len(bytes.TrimSpace(data)) > 0:
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return fmt.Errorf("parse %s: %v", path, err)
+		}
+	case err != nil && !os.IsNotExist(err):
+		return err
+	}
+	if current, ok := entries[name]; ok && current == webPath {
+		return nil
+	}
+	entries[name] = webPath
+	data, err = json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(data, '\n'), modes)
+}
+
+// lockManifest creates path.lock exclusively, waiting for other writers. A
+// lock older than manifestLockStale was left by a crashed build and is taken
+// over.
+func lockManifest(path string, dirMode os.FileMode) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(path), dirMode); err != nil {
+		return nil, err
+	}
+	lock := path + ".lock"
+	deadline := time.Now().Add(manifestLockTimeout)
+	for {
+		f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lock) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if info, err := os.Stat(lock); err == nil && time.Since(info.ModTime()) > manifestLockStale {
+			os.Remove(lock)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for %s", lock)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// fileModes are the permissions for created directories and written files
+// (data.dir_mode, data.file_mode). Directory modes are subject to the umask.
+type fileModes struct {
+	Dir  os.FileMode
+	File os.FileMode
+}
+
+var defaultFileModes = fileModes{Dir: 0o755, File: 0o644}
+
+// parseFileModes reads data.dir_mode and data.file_mode as octal ("0750",
+// "750" or "0o750"); empty values keep the defaults.
+func parseFileModes(dirMode, fileMode string) (fileModes, error) {
+	modes := defaultFileModes
+	for _, option := range []struct {
+		key, value string
+		mode       *os.FileMode
+	}{{"dir_mode", dirMode, &modes.Dir}, {"file_mode", fileMode, &modes.File}} {
+		value := strings.TrimPrefix(strings.TrimSpace(option.value), "0o")
+		if value == "" {
+			continue
+		}
+		n, err := strconv.ParseUint(value, 8, 32)
+		if err != nil || n > 0o777 {
+			return modes, fmt.Errorf("%s: expected octal permissions such as 0755, got %q", option.key, option.value)
+		}
+		*option.mode = os.FileMode(n)
+	}
+	return modes, nil
+}
+
+// writeFileAtomic writes data next to path and renames it into place.
+func writeFileAtomic(path string, data []byte, modes fileModes) error {
+	tmp, err := stageOutput(path, modes)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(tmp, data, modes.File); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// compressExtensions maps data.compress encodings to the sibling file
+// extension they produce.
+var compressExtensions = map[string]string{"gzip": ".gz", "brotli": ".br"}
+
+// parseCompress reads data.compress: gzip, brotli, both, or a comma list.
+// It returns the sibling extensions to write, gzip first.
+func parseCompress(value string) ([]string, error) {
+	want := map[string]bool{}
+	for _, part := range strings.Split(strings.ToLower(value), ",") {
+		switch part = strings.TrimSpace(part); part {
+		case "", "none":
+		case "both":
+			want["gzip"], want["brotli"] = true, true
+		case "gzip", "brotli":
+			want[part] = true
+		default:
+			return nil, fmt.Errorf("unsupported compress %q (expected gzip, brotli or both)", part)
+		}
+	}
+	var exts []string
+	for _, encoding := range []string{"gzip", "brotli"} {
+		if want[encoding] {
+			exts = append(exts, compressExtensions[encoding])
+		}
+	}
+	return exts, nil
+}
+
+// writeCompressed writes pre-compressed siblings of path (path.gz, path.br)
+// for a static server that negotiates Content-Encoding. Each sibling is
+// replaced atomically; one that can't be written is removed so a stale copy
+// never outlives the output it was made from.
+func writeCompressed(path string, data []byte, exts []string, modes fileModes) []error {
+	var errs []error
+	for _, ext := range exts {
+		var buf bytes.Buffer
+		var w io.WriteCloser
+		if ext == ".br" {
+			w = brotli.NewWriterLevel(&buf, brotli.BestCompression)
+		} else {
+			w, _ = gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		}
+		_, err := w.Write(data)
+		if closeErr := w.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = writeFileAtomic(path+ext, buf.Bytes(), modes)
+		}
+		if err != nil {
+			os.Remove(path + ext)
+			errs = append(errs, fmt.Errorf("%s: %v", path+ext, err))
+		}
+	}
+	return errs
+}
+
+// encloseOutput fills in data.enclose: the placeholder (default "|") becomes
+// the stylesheet's web path and the CSS placeholder (default "{{css}}") its
+// contents. Both are replaced in one pass, so neither value is rescanned.
+func encloseOutput(enclose, placeholder, cssPlaceholder, relPath string, css []byte) string {
+	if placeholder == "" {
+		placeholder = "|"
+	}
+	if cssPlaceholder == "" {
+		cssPlaceholder = "{{css}}"
+	}
+	return strings.NewReplacer(placeholder, relPath, cssPlaceholder, string(css)).Replace(enclose)
+}
+
+// sriHash returns the Subresource Integrity value for data.
+func sriHash(data []byte) string {
+	sum := sha512.Sum384(data)
+	return "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// stageOutput creates an empty temp file in output's directory for the CLI
+// to write to. Being on the same filesystem, it can be renamed over output
+// atomically.
+func stageOutput(output string, modes fileModes) (string, error) {
+	dir := filepath.Dir(output)
+	if err := os.MkdirAll(dir, modes.Dir); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(output)+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	name := tmp.Name()
+	if err := tmp.Close(); err != nil {
+		os.Remove(name)
+		return "", err
+	}
+	if err := os.Chmod(name, modes.File); err != nil {
+		os.Remove(name)
+		return "", err
+	}
+	return name, nil
+}
+
+// artifactStamp identifies the state of a file by size and modification
+// time; a missing file has the zero stamp.
+type artifactStamp struct {
+	Size    int64 `json:"size"`
+	ModTime int64 `json:"mtime"` // UnixNano, so stamps compare equal after a file cache round trip
+}
+
+func stampFile(path string) artifactStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return artifactStamp{}
+	}
+	return artifactStamp{Size: info.Size(), ModTime: info.ModTime().UnixNano()}
+}
+
+// artifactRecord is what one build read and produced.
+type artifactRecord struct {
+	Inputs map[string]artifactStamp `json:"inputs"`
+	Output string                   `json:"output"`
+	Stamp  artifactStamp            `json:"stamp"`
+	Result string                   `json:"result"`
+	Built  int64                    `json:"built"` // UnixNano of the build, so a touch keeps the entry's cache_ttl
+}
+
+// artifactTracker remembers, per cache key, the input files a build read and
+// the output file it produced, so a later render can cheaply ask whether the
+// output is still current instead of rebuilding.
+type artifactTracker struct {
+	cache Cache
+}
+
+func newArtifactTracker(cache Cache) *artifactTracker {
+	return &artifactTracker{cache: cache}
+}
+
+// Record stamps inputs and output after a successful build and stores the
+// rendered result under key for ttl (0: until replaced).
+func (t *artifactTracker) Record(key string, inputs []string, output, result string, ttl time.Duration) error {
+	record := artifactRecord{
+		Inputs: make(map[string]artifactStamp, len(inputs)),
+		Output: output,
+		Stamp:  stampFile(output),
+		Result: result,
+		Built:  time.Now().UnixNano(),
+	}
+	for _, input := range inputs {
+		record.Inputs[input] = stampFile(input)
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return t.cache.Set(key, data, ttl)
+}
+
+// Touch sets the modification time of the output recorded under key to now
+// and restamps it, so the touched output still counts as current. The entry
+// keeps what is left of ttl rather than starting a new one.
+func (t *artifactTracker) Touch(key string, ttl time.Duration) error {
+	data, ok := t.cache.Get(key)
+	if !ok {
+		return nil
+	}
+	var record artifactRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return err
+	}
+	now := time.Now()
+	if ttl > 0 && record.Built != 0 {
+		ttl -= now.Sub(time.Unix(0, record.Built))
+		if ttl <= 0 {
+			return nil
+		}
+	}
+	if err := os.Chtimes(record.Output, now, now); err != nil {
+		return err
+	}
+	record.Stamp = stampFile(record.Output)
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return t.cache.Set(key, data, ttl)
+}
+
+// Current returns the result recorded under key when the output and every
+// input still match their recorded stamps.
+func (t *artifactTracker) Current(key string) (string, bool) {
+	data, ok := t.cache.Get(key)
+	if !ok {
+		return "", false
+	}
+	var record artifactRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return "", false
+	}
+	if record.Stamp == (artifactStamp{}) || stampFile(record.Output) != record.Stamp {
+		return "", false
+	}
+	for input, stamp := range record.Inputs {
+		if stampFile(input) != stamp {
+			return "", false
+		}
+	}
+	return record.Result, true
+}
+
+// Cache stores build results by key. Get reports a missing or expired entry
+// as not found; Set with a zero ttl keeps the entry until it is replaced.
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte, ttl time.Duration) error
+}
+
+// cacheEntry is a cached value with its expiry; the zero time never expires.
+type cacheEntry struct {
+	Value   []byte    `json:"value"`
+	Expires time.Time `json:"expires"`
+}
+
+func newCacheEntry(value []byte, ttl time.Duration) cacheEntry {
+	entry := cacheEntry{Value: value}
+	if ttl > 0 {
+		entry.Expires = time.Now().Add(ttl)
+	}
+	return entry
+}
+
+func (e cacheEntry) expired() bool {
+	return !e.Expires.IsZero() && time.Now().After(e.Expires)
+}
+
+// memoryCache is the default Cache: process memory, lost on restart.
+type memoryCache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+func newMemoryCache() *memoryCache {
+	return &memoryCache{entries: map[string]cacheEntry{}}
+}
+
+func (c *memoryCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || entry.expired() {
+		return nil, false
+	}
+	return entry.Value, true
+}
+
+func (c *memoryCache) Set(key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	c.entries[key] = newCacheEntry(value, ttl)
+	c.mu.Unlock()
+	return nil
+}
+
+// fileCache is the data.cache_dir Cache: one JSON file per key, so results
+// survive restarts and are shared by every process using the directory.
+type fileCache struct {
+	dir   string
+	modes fileModes
+}
+
+func newFileCache(dir string, modes fileModes) *fileCache {
+	return &fileCache{dir: dir, modes: modes}
+}
+
+// path names the entry file after a hash of key, which holds file paths.
+func (c *fileCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (c *fileCache) Get(key string) ([]byte, bool) {
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.expired() {
+		return nil, false
+	}
+	return entry.Value, true
+}
+
+// Set replaces the entry file atomically, so concurrent readers never see a
+// partial entry.
+func (c *fileCache) Set(key string, value []byte, ttl time.Duration) error {
+	data, err := json.Marshal(newCacheEntry(value, ttl))
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(c.path(key), data, c.modes)
+}
+
+// parseCacheTTL reads data.cache_ttl; empty means results don't expire.
+func parseCacheTTL(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl < 0 {
+		return 0, fmt.Errorf("cache_ttl: expected a duration such as 24h, got %q", value)
+	}
+	return ttl, nil
+}
+
 func Plugin() (shared.PluginRenderer, error) {
 	return &TailwindPlugin{}, nil
 }
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"expvar"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestArtifactTrackerFreshness(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input")
+	output := filepath.Join(dir, "output")
+	if err := os.WriteFile(input, []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(output, []byte("built"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tracker := newArtifactTracker(newMemoryCache())
+	if _, ok := tracker.Current("k"); ok {
+		t.Fatal("unrecorded key reported current")
+	}
+	if err := tracker.Record("k", []string{input}, output, "result", 0); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := tracker.Current("k"); !ok || got != "result" {
+		t.Fatalf("fresh build: got %q, %v", got, ok)
+	}
+
+	// An edited input makes the output stale.
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(input, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tracker.Current("k"); ok {
+		t.Error("touched input still reported current")
+	}
+
+	// So does a removed output.
+	if err := tracker.Record("k", []string{input}, output, "result", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(output); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tracker.Current("k"); ok {
+		t.Error("missing output still reported current")
+	}
+}
+
+func TestCachedResultCountsHits(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "output.css")
+	if err := os.WriteFile(output, []byte("built"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics.enable()
+	hits, misses := metrics.value("cache_hits"), metrics.value("cache_misses")
+	if _, ok := cachedResult(tailwindArtifacts, "metrics-test"); ok {
+		t.Fatal("unrecorded key reported cached")
+	}
+	if err := tailwindArtifacts.Record("metrics-test", nil, output, "result", 0); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := cachedResult(tailwindArtifacts, "metrics-test"); !ok || got != "result" {
+		t.Fatalf("cachedResult = %q, %v", got, ok)
+	}
+	if got := metrics.value("cache_hits") - hits; got != 1 {
+		t.Errorf("cache_hits grew by %d, want 1", got)
+	}
+	if got := metrics.value("cache_misses") - misses; got != 1 {
+		t.Errorf("cache_misses grew by %d, want 1", got)
+	}
+}
+
+func TestMetricsSurviveTakenName(t *testing.T) {
+	expvar.Publish("tailwindcss_test_func", expvar.Func(func() any { return 1 }))
+	taken := newPluginMetrics("tailwindcss_test_func")
+	taken.enable()
+	taken.add("builds", 1)
+	if got := taken.value("builds"); got != 1 {
+		t.Errorf("builds = %d under a name taken by a non-map var, want 1", got)
+	}
+
+	copies := make([]*pluginMetrics, 8)
+	var wg sync.WaitGroup
+	for i := range copies {
+		copies[i] = newPluginMetrics("tailwindcss_test_shared")
+		wg.Add(1)
+		go func(m *pluginMetrics) {
+			defer wg.Done()
+			m.enable()
+		}(copies[i])
+	}
+	wg.Wait()
+	for _, m := range copies {
+		if m.vars != copies[0].vars {
+			t.Fatal("concurrent copies published separate maps")
+		}
+	}
+}
+
+func TestWriteCompressedGzip(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "output.css")
+	data := bytes.Repeat([]byte(".text-red-500{color:red}\n"), 100)
+	if err := os.WriteFile(output, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	exts, err := parseCompress("gzip")
+	if err != nil {
+		t.Fatalf("parseCompress: %v", err)
+	}
+	if errs := writeCompressed(output, data, exts, defaultFileModes); len(errs) > 0 {
+		t.Fatalf("writeCompressed: %v", errs)
+	}
+	if _, err := os.Stat(output + ".br"); !os.IsNotExist(err) {
+		t.Errorf("brotli sibling written for compress = gzip: %v", err)
+	}
+
+	f, err := os.Open(output + ".gz")
+	if err != nil {
+		t.Fatalf("gzip sibling: %v", err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("gzip.NewReader: %v", err)
+	}
+	got, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("decompress: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("decompressed .gz does not match the output")
+	}
+}
+
+func TestValidateConfigWritesNothing(t *testing.T) {
+	dir := t.TempDir()
+	cfg := TailwindConfig{Fields: Fields{
+		InputCSS: filepath.Join(dir, "missing.css"),
+		Binary:   filepath.Join(dir, "missing-tailwindcss"),
+		Compress: "zip",
+	}}
+	errs := validateConfig(cfg)
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	joined := strings.Join(messages, "\n")
+	for _, want := range []string{"output_css", "compress", "binary not found", "input_css not found"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("errors %q do not mention %q", joined, want)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("validate_only wrote files: %v", entries)
+	}
+}
+
+func TestStageOutputCreatesNestedDir(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "css", "site", "app.css")
+	modes, err := parseFileModes("0750", "0640")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(output, []byte("body{}"), modes); err != nil {
+		t.Fatalf("writeFileAtomic into a missing directory: %v", err)
+	}
+	info, err := os.Stat(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o640 {
+		t.Errorf("file mode = %v, want 0640", info.Mode().Perm())
+	}
+	if dirInfo, err := os.Stat(filepath.Dir(output)); err != nil || dirInfo.Mode().Perm()&^0o750 != 0 {
+		t.Errorf("dir = %v, %v; want mode at most 0750", dirInfo, err)
+	}
+}
+
+func TestFileCacheSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "output.css")
+	if err := os.WriteFile(output, []byte("built"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cacheDir := filepath.Join(dir, "cache")
+
+	before := newArtifactTracker(newFileCache(cacheDir, defaultFileModes))
+	if err := before.Record("k", nil, output, `<link rel="stylesheet" href="/output.css">`, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new process starts with an empty memory cache but reads the file.
+	after := newArtifactTracker(newFileCache(cacheDir, defaultFileModes))
+	if got, ok := after.Current("k"); !ok || got != `<link rel="stylesheet" href="/output.css">` {
+		t.Fatalf("after restart: got %q, %v", got, ok)
+	}
+	if _, ok := newArtifactTracker(newMemoryCache()).Current("k"); ok {
+		t.Error("memory cache shared a result it never recorded")
+	}
+
+	expiring := newFileCache(cacheDir, defaultFileModes)
+	if err := expiring.Set("short", []byte("v"), time.Nanosecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	if _, ok := expiring.Get("short"); ok {
+		t.Error("expired entry still returned")
+	}
+}
+
+func TestEnclosePlaceholderKeepsLiteralPipes(t *testing.T) {
+	css := []byte("a[lang|=en]{color:red}")
+	got := encloseOutput(`<link href="%path%" title="a|b"><style>{{css}}</style>`, "%path%", "", "static/css/app.css", css)
+	want := `<link href="static/css/app.css" title="a|b"><style>a[lang|=en]{color:red}</style>`
+	if got != want {
+		t.Errorf("custom placeholder:\n got %s\nwant %s", got, want)
+	}
+
+	got = encloseOutput(`<link href="|">/*[[css]]*/`, "", "[[css]]", "static/css/app.css", css)
+	if want := `<link href="static/css/app.css">/*a[lang|=en]{color:red}*/`; got != want {
+		t.Errorf("default placeholder:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestTouchOnCacheHit(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "output.css")
+	if err := os.WriteFile(output, []byte("built"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(output, past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	tracker := newArtifactTracker(newFileCache(filepath.Join(dir, "cache"), defaultFileModes))
+	if err := tracker.Record("k", nil, output, "result", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := tracker.Touch("k", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().After(past.Add(time.Minute)) {
+		t.Errorf("mtime = %v, want it bumped", info.ModTime())
+	}
+	if data, _ := os.ReadFile(output); string(data) != "built" {
+		t.Errorf("touch changed the content: %q", data)
+	}
+	if got, ok := tracker.Current("k"); !ok || got != "result" {
+		t.Errorf("touched output no longer current: %q, %v", got, ok)
+	}
+}
+
+func TestCacheKeyCoversPlaceholders(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "output.css")
+	if err := os.WriteFile(output, []byte("a{color:red}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	first := Fields{InputCSS: "placeholder.css", OutputCSS: output, Enclose: `<link href="%path%"><style>{{css}}</style>`, Placeholder: "%path%"}
+	result := encloseOutput(first.Enclose, first.Placeholder, first.CSSPlaceholder, "static/css/output.css", []byte("a{color:red}"))
+	if err := tailwindArtifacts.Record(renderCacheKey(first, nil), nil, output, result, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	second := first
+	second.Placeholder = "|"
+	if got, ok := cachedResult(tailwindArtifacts, renderCacheKey(second, nil)); ok {
+		t.Errorf("a new placeholder reused the first render: %q", got)
+	}
+	third := first
+	third.CSSPlaceholder = "[[css]]"
+	if got, ok := cachedResult(tailwindArtifacts, renderCacheKey(third, nil)); ok {
+		t.Errorf("a new css_placeholder reused the first render: %q", got)
+	}
+	if got, ok := cachedResult(tailwindArtifacts, renderCacheKey(first, nil)); !ok || got != result {
+		t.Errorf("the unchanged config = %q, %v; want the first render", got, ok)
+	}
+}
@@ -1,11 +1,19 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
 )
 
 type PluginManifest struct {
@@ -15,11 +23,137 @@ type PluginManifest struct {
 	CompatibleHyperbricks []string `json:"compatible_hyperbricks"`
 	Description           string   `json:"description,omitempty"`
 	// Add other fields as needed
+
+	// Integrity data computed from the source file, not read from manifest.json.
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+
+	// Latest marks the highest stable version of the plugin. Readers of the
+	// nested index that don't know the field simply ignore it.
+	Latest bool `json:"latest,omitempty"`
 }
 
-func main() {
-	root := "plugins"
-	index := make(map[string]map[string]PluginManifest)
+// PluginEntry groups all versions of a single plugin. Versions are emitted in
+// semver order and Latest points at the highest stable (non pre-release) one.
+type PluginEntry struct {
+	Latest   string
+	Versions VersionList
+}
+
+// MarshalJSON writes only the version map, so plugins.index.json keeps its
+// plugin → version → manifest shape.
+func (e PluginEntry) MarshalJSON() ([]byte, error) {
+	return e.Versions.MarshalJSON()
+}
+
+// VersionList keeps manifests ordered by semver so the JSON output does not
+// depend on map key ordering.
+type VersionList []PluginManifest
+
+func (v VersionList) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, manifest := range v {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := encodeJSON(&buf, manifest.Version); err != nil {
+			return nil, err
+		}
+		buf.WriteByte(':')
+		if err := encodeJSON(&buf, manifest); err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// encodeJSON writes value without HTML escaping so constraints like ">=" stay
+// readable in the generated index.
+func encodeJSON(buf *bytes.Buffer, value interface{}) error {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(value); err != nil {
+		return err
+	}
+	// Encode appends a newline; drop it to keep the object compact.
+	buf.Truncate(buf.Len() - 1)
+	return nil
+}
+
+// FlatIndex is the registry-friendly listing written to plugins.flat.json.
+// GeneratedAt and Total let clients detect a stale or truncated copy.
+type FlatIndex struct {
+	GeneratedAt time.Time        `json:"generated_at"`
+	Total       int              `json:"total"`
+	Plugins     []PluginManifest `json:"plugins"`
+}
+
+// flattenIndex lists every manifest sorted by plugin name, then by semver.
+func flattenIndex(index map[string]*PluginEntry, generatedAt time.Time) FlatIndex {
+	plugins := make([]string, 0, len(index))
+	for plugin := range index {
+		plugins = append(plugins, plugin)
+	}
+	sort.Strings(plugins)
+
+	flat := FlatIndex{
+		GeneratedAt: generatedAt.UTC(),
+		Plugins:     []PluginManifest{},
+	}
+	for _, plugin := range plugins {
+		flat.Plugins = append(flat.Plugins, index[plugin].Versions...)
+	}
+	flat.Total = len(flat.Plugins)
+	return flat
+}
+
+// parseSemver parses a plugin or Hyperbricks version. A leading "v" is
+// accepted; otherwise it must be a full MAJOR.MINOR.PATCH[-PRERELEASE][+BUILD].
+func parseSemver(value string) (*semver.Version, error) {
+	raw := strings.TrimPrefix(strings.TrimSpace(value), "v")
+	v, err := semver.StrictNewVersion(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid version %q: %v", value, err)
+	}
+	// StrictNewVersion lets an empty pre-release ("1.0.0-") through.
+	if core, _, _ := strings.Cut(raw, "+"); v.Prerelease() == "" && strings.Contains(core, "-") {
+		return nil, fmt.Errorf("invalid version %q: empty pre-release", value)
+	}
+	return v, nil
+}
+
+// parseConstraint parses a compatible_hyperbricks entry with the library the
+// Hyperbricks plugin loader uses, so the index accepts exactly the ranges
+// the loader can interpret: comparisons, "," for AND, "||" for OR, and the
+// ~, ^ and x-range shorthands.
+func parseConstraint(value string) (*semver.Constraints, error) {
+	set, err := semver.NewConstraint(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid constraint %q: %v", value, err)
+	}
+	return set, nil
+}
+
+// isCompatible reports whether the manifest supports the given Hyperbricks
+// version. Constraints are validated during buildIndex.
+func isCompatible(manifest PluginManifest, hyperbricks *semver.Version) bool {
+	for _, raw := range manifest.CompatibleHyperbricks {
+		set, err := parseConstraint(raw)
+		if err != nil {
+			continue
+		}
+		if set.Check(hyperbricks) {
+			return true
+		}
+	}
+	return false
+}
+
+// buildIndex walks root for manifest.json files and groups them per plugin.
+func buildIndex(root string) (map[string]*PluginEntry, error) {
+	manifests := make(map[string]map[string]PluginManifest)
 
 	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -29,45 +163,164 @@ func main() {
 			return nil
 		}
 
+		// A manifest that can't be read or parsed fails the build instead of
+		// silently dropping the plugin from the index.
 		data, err := os.ReadFile(path)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", path, err)
-			return nil
+			return err
 		}
 
 		var manifest PluginManifest
 		if err := json.Unmarshal(data, &manifest); err != nil {
-			fmt.Fprintf(os.Stderr, "Error parsing %s: %v\n", path, err)
-			return nil
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		if _, err := parseSemver(manifest.Version); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
 		}
 
-		if _, ok := index[manifest.Plugin]; !ok {
-			index[manifest.Plugin] = make(map[string]PluginManifest)
+		// The loader has to interpret these, so reject anything it can't parse.
+		for _, raw := range manifest.CompatibleHyperbricks {
+			if _, err := parseConstraint(raw); err != nil {
+				return fmt.Errorf("%s: compatible_hyperbricks: %w", path, err)
+			}
 		}
-		index[manifest.Plugin][manifest.Version] = manifest
+
+		// Entries without a verifiable source must never reach the index.
+		sum, size, err := checksumSource(filepath.Dir(path), manifest.Source)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		manifest.SHA256 = sum
+		manifest.Size = size
+
+		if _, ok := manifests[manifest.Plugin]; !ok {
+			manifests[manifest.Plugin] = make(map[string]PluginManifest)
+		}
+		manifests[manifest.Plugin][manifest.Version] = manifest
 
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	index := make(map[string]*PluginEntry, len(manifests))
+	for plugin, versions := range manifests {
+		index[plugin] = newPluginEntry(versions)
+	}
+	return index, nil
+}
 
+// checksumSource returns the hex SHA-256 and byte size of the manifest's
+// source file, resolved relative to the manifest directory.
+func checksumSource(dir, source string) (string, int64, error) {
+	source = strings.TrimSpace(source)
+	if source == "" {
+		return "", 0, fmt.Errorf("manifest has no source file")
+	}
+	data, err := os.ReadFile(filepath.Join(dir, source))
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Walk error: %v\n", err)
-		os.Exit(1)
+		return "", 0, fmt.Errorf("cannot read source %q: %w", source, err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), int64(len(data)), nil
+}
+
+func newPluginEntry(versions map[string]PluginManifest) *PluginEntry {
+	type parsed struct {
+		manifest PluginManifest
+		version  *semver.Version
+	}
+
+	list := make([]parsed, 0, len(versions))
+	for _, manifest := range versions {
+		// Versions were validated while walking.
+		v, _ := parseSemver(manifest.Version)
+		list = append(list, parsed{manifest: manifest, version: v})
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].version.LessThan(list[j].version)
+	})
+
+	entry := &PluginEntry{Versions: make(VersionList, 0, len(list))}
+	for _, item := range list {
+		entry.Versions = append(entry.Versions, item.manifest)
+		if item.version.Prerelease() == "" {
+			entry.Latest = item.manifest.Version
+		}
+	}
+	for i := range entry.Versions {
+		entry.Versions[i].Latest = entry.Versions[i].Version == entry.Latest
+	}
+	return entry
+}
+
+// printCompatible lists every plugin version whose constraints accept target.
+func printCompatible(index map[string]*PluginEntry, target *semver.Version) {
+	plugins := make([]string, 0, len(index))
+	for plugin := range index {
+		plugins = append(plugins, plugin)
+	}
+	sort.Strings(plugins)
+
+	for _, plugin := range plugins {
+		for _, manifest := range index[plugin].Versions {
+			if isCompatible(manifest, target) {
+				fmt.Printf("%s@%s\n", plugin, manifest.Version)
+			}
+		}
 	}
+}
 
-	out, err := os.Create("plugins.index.json")
+func main() {
+	compatible := flag.String("compatible", "", "print plugin versions compatible with this Hyperbricks version instead of writing the index")
+	flag.Parse()
+
+	index, err := buildIndex("plugins")
 	if err != nil {
+		fmt.Fprintf(os.Stderr, "Index error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *compatible != "" {
+		target, err := parseSemver(*compatible)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -compatible: %v\n", err)
+			os.Exit(1)
+		}
+		printCompatible(index, target)
+		return
+	}
+
+	if err := writeJSON("plugins.index.json", index); err != nil {
 		fmt.Fprintf(os.Stderr, "Cannot write plugins.index.json: %v\n", err)
 		os.Exit(1)
 	}
-	defer out.Close()
+	fmt.Println("plugins.index.json updated.")
+
+	if err := writeJSON("plugins.flat.json", flattenIndex(index, time.Now())); err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot write plugins.flat.json: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("plugins.flat.json updated.")
+}
+
+func writeJSON(path string, value interface{}) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
 
 	enc := json.NewEncoder(out)
 	enc.SetEscapeHTML(false)
 	enc.SetIndent("", "  ")
-	if err := enc.Encode(index); err != nil {
-		fmt.Fprintf(os.Stderr, "Cannot encode JSON: %v\n", err)
-		os.Exit(1)
+	if err := enc.Encode(value); err != nil {
+		out.Close()
+		return fmt.Errorf("cannot encode JSON: %w", err)
 	}
-
-	fmt.Println("plugins.index.json updated.")
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("cannot close %s: %w", path, err)
+	}
+	return nil
 }
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBuildIndexSortsVersionsSemantically(t *testing.T) {
+	index, err := buildIndex("testdata/plugins")
+	if err != nil {
+		t.Fatalf("buildIndex: %v", err)
+	}
+
+	entry, ok := index["github.com/hyperbricks/plugins/example"]
+	if !ok {
+		t.Fatalf("example plugin missing from index")
+	}
+
+	want := []string{"1.0.2", "1.0.9", "1.0.10", "1.1.0", "1.2.0-alpha"}
+	if len(entry.Versions) != len(want) {
+		t.Fatalf("got %d versions, want %d", len(entry.Versions), len(want))
+	}
+	for i, manifest := range entry.Versions {
+		if manifest.Version != want[i] {
+			t.Errorf("version[%d] = %s, want %s", i, manifest.Version, want[i])
+		}
+	}
+
+	if entry.Latest != "1.1.0" {
+		t.Errorf("latest = %s, want 1.1.0 (pre-releases are ignored)", entry.Latest)
+	}
+}
+
+func TestIndexKeepsNestedShape(t *testing.T) {
+	index, err := buildIndex("testdata/plugins")
+	if err != nil {
+		t.Fatalf("buildIndex: %v", err)
+	}
+	data, err := json.Marshal(index)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	var nested map[string]map[string]PluginManifest
+	if err := json.Unmarshal(data, &nested); err != nil {
+		t.Fatalf("index is not plugin → version → manifest: %v\n%s", err, data)
+	}
+	versions := nested["github.com/hyperbricks/plugins/example"]
+	if len(versions) != 5 {
+		t.Fatalf("got %d versions, want 5", len(versions))
+	}
+	for version, manifest := range versions {
+		if manifest.Latest != (version == "1.1.0") {
+			t.Errorf("%s: latest = %v", version, manifest.Latest)
+		}
+	}
+}
+
+func TestBuildIndexRecordsSourceChecksum(t *testing.T) {
+	index, err := buildIndex("testdata/plugins")
+	if err != nil {
+		t.Fatalf("buildIndex: %v", err)
+	}
+
+	source, err := os.ReadFile("testdata/plugins/example/1.0.2/example_plugin.go")
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	sum := sha256.Sum256(source)
+
+	manifest := index["github.com/hyperbricks/plugins/example"].Versions[0]
+	if manifest.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("sha256 = %s, want %x", manifest.SHA256, sum)
+	}
+	if manifest.Size != int64(len(source)) {
+		t.Errorf("size = %d, want %d", manifest.Size, len(source))
+	}
+}
+
+func TestBuildIndexFailsOnMissingSource(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "broken", "1.0.0")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	manifest := `{"plugin": "broken", "version": "1.0.0", "source": "missing.go"}`
+	if err := os.WriteFile(filepath.Join(dir, "manifest.json"), []byte(manifest), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := buildIndex(root); err == nil {
+		t.Fatal("buildIndex succeeded, want error for missing source")
+	}
+}
+
+func TestBuildIndexFailsOnBadManifest(t *testing.T) {
+	for name, manifest := range map[string]string{
+		"unparsable":      `{"plugin": "broken", "version": `,
+		"invalid version": `{"plugin": "broken", "version": "1.0", "source": "broken.go"}`,
+	} {
+		root := t.TempDir()
+		dir := filepath.Join(root, "broken", "1.0.0")
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "manifest.json"), []byte(manifest), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "broken.go"), []byte("package main\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := buildIndex(root); err == nil {
+			t.Errorf("%s: buildIndex succeeded, want error", name)
+		}
+	}
+}
+
+func TestBuildIndexRejectsInvalidConstraint(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "broken", "1.0.0")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	manifest := `{"plugin": "broken", "version": "1.0.0", "source": "broken.go", "compatible_hyperbricks": [">=0.7.8-"]}`
+	if err := os.WriteFile(filepath.Join(dir, "manifest.json"), []byte(manifest), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "broken.go"), []byte("package main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := buildIndex(root); err == nil {
+		t.Fatal("buildIndex succeeded, want error for invalid constraint")
+	}
+}
+
+func TestConstraintCheck(t *testing.T) {
+	cases := []struct {
+		constraint string
+		version    string
+		want       bool
+	}{
+		{">=0.7.8-alpha", "0.8.0-alpha", true},
+		{">=0.7.8-alpha", "0.7.8", true},
+		{">=0.7.8-alpha", "0.5.5-alpha", false},
+		{">=0.5.0-alpha, <0.7.8-alpha", "0.6.1-alpha", true},
+		{">=0.5.0-alpha, <0.7.8-alpha", "0.7.8-alpha", false},
+		{"<0.5.0 || >=1.0.0", "1.2.0", true},
+		{"<0.5.0 || >=1.0.0", "0.6.0", false},
+		{"0.8.0", "0.8.0", true},
+		{"!=0.8.0", "0.8.0", false},
+		{">=0.7", "0.8.0", true},
+		{"0.8.x", "0.8.3", true},
+		{"~1.0.0", "1.1.0", false},
+		{"^0.8.0", "0.8.5", true},
+	}
+	for _, tc := range cases {
+		set, err := parseConstraint(tc.constraint)
+		if err != nil {
+			t.Fatalf("parse %q: %v", tc.constraint, err)
+		}
+		v, err := parseSemver(tc.version)
+		if err != nil {
+			t.Fatalf("parse %s: %v", tc.version, err)
+		}
+		if got := set.Check(v); got != tc.want {
+			t.Errorf("%q.Check(%s) = %v, want %v", tc.constraint, tc.version, got, tc.want)
+		}
+	}
+}
+
+func TestParseConstraintRejectsInvalid(t *testing.T) {
+	for _, value := range []string{"", ">=", ">=0.5.0,", ">=zero", ">=0.7.8-"} {
+		if _, err := parseConstraint(value); err == nil {
+			t.Errorf("parseConstraint(%q) succeeded, want error", value)
+		}
+	}
+}
+
+func TestFlattenIndex(t *testing.T) {
+	index, err := buildIndex("testdata/plugins")
+	if err != nil {
+		t.Fatalf("buildIndex: %v", err)
+	}
+
+	generatedAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	flat := flattenIndex(index, generatedAt)
+	if !flat.GeneratedAt.Equal(generatedAt) {
+		t.Errorf("generated_at = %v, want %v", flat.GeneratedAt, generatedAt)
+	}
+	if flat.Total != 5 || len(flat.Plugins) != 5 {
+		t.Fatalf("total = %d (%d entries), want 5", flat.Total, len(flat.Plugins))
+	}
+	if first := flat.Plugins[0]; first.Plugin != "github.com/hyperbricks/plugins/example" || first.Version != "1.0.2" {
+		t.Errorf("first entry = %s@%s, want example@1.0.2", first.Plugin, first.Version)
+	}
+	if last := flat.Plugins[4]; last.Version != "1.2.0-alpha" {
+		t.Errorf("last entry = %s, want 1.2.0-alpha", last.Version)
+	}
+}
+
+func TestSemverCompare(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0.0", "1.0.10", -1},
+		{"1.0.10", "1.0.9", 1},
+		{"0.7.8-alpha", "0.7.8", -1},
+		{"1.0.0-alpha", "1.0.0-alpha.1", -1},
+		{"1.0.0-alpha.2", "1.0.0-alpha.10", -1},
+		{"1.0.0-alpha.beta", "1.0.0-beta", -1},
+		{"2.0.0", "v2.0.0", 0},
+	}
+	for _, tc := range cases {
+		a, err := parseSemver(tc.a)
+		if err != nil {
+			t.Fatalf("parse %s: %v", tc.a, err)
+		}
+		b, err := parseSemver(tc.b)
+		if err != nil {
+			t.Fatalf("parse %s: %v", tc.b, err)
+		}
+		if got := a.Compare(b); got != tc.want {
+			t.Errorf("Compare(%s, %s) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestParseSemverRejectsInvalid(t *testing.T) {
+	for _, value := range []string{"", "1.0", "1.0.x", "1.0.0-"} {
+		if _, err := parseSemver(value); err == nil {
+			t.Errorf("parseSemver(%q) succeeded, want error", value)
+		}
+	}
+}